@@ -0,0 +1,277 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/signmykeyio/signmykey/builtin/approval"
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/builtin/signer"
+	"github.com/sirupsen/logrus"
+)
+
+// ApprovalConfig represents the human approval of sign requests for privileged principals,
+// disabled when Store is nil.
+type ApprovalConfig struct {
+	Store approval.Store
+	Rules []approval.Rule
+}
+
+// DecisionRequest represents the approval or denial of a request, approver credentials are
+// the same as sign requests ones
+type DecisionRequest struct {
+	request.SignRequest
+	Comment string `json:"comment"`
+}
+
+// requestApproval creates a pending approval request when principals match an approval rule,
+// it returns nil if no approval is needed. The returned secret is needed to read the request
+// and its certificate, it is only given to the requester.
+func requestApproval(ctx context.Context, identity *authenticator.Identity, signReq *request.SignRequest, principals []string, validBefore time.Time) (*approval.Request, string, error) {
+	if config.Approval.Store == nil {
+		return nil, "", nil
+	}
+
+	rule, ok := approval.Match(config.Approval.Rules, principals)
+	if !ok {
+		return nil, "", nil
+	}
+
+	approvalReq := approval.NewRequest(rule, time.Now())
+	approvalReq.User = identity.ID
+	approvalReq.Username = identity.Username
+	approvalReq.AuthTime = identity.AuthTime
+	approvalReq.Principals = principals
+	approvalReq.PublicKey = signReq.PublicKey
+	approvalReq.TTL = signReq.TTL
+	approvalReq.ValidBefore = validBefore
+
+	secret, err := approvalReq.NewSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return approvalReq, secret, config.Approval.Store.Create(ctx, approvalReq)
+}
+
+// approvalRequestHandler returns an approval request and its certificate to the requester,
+// authenticated by the secret of the request
+func approvalRequestHandler(w http.ResponseWriter, r *http.Request) {
+
+	log := r.Context().Value(RequestLoggerKey).(*logrus.Logger)
+	logger := log.WithFields(logrus.Fields{
+		"ctx":         "api",
+		"handler":     "approvalRequest",
+		"req_id":      middleware.GetReqID(r.Context()),
+		"approval_id": chi.URLParam(r, "id"),
+	})
+
+	if config.Approval.Store == nil {
+		render.Status(r, 404)
+		render.JSON(w, r, map[string]string{"error": "approval workflow is disabled"})
+		return
+	}
+
+	secret := r.Header.Get(approval.SecretHeader)
+	if secret == "" {
+		logger.Error("Missing approval request secret")
+		render.Status(r, 401)
+		render.JSON(w, r, map[string]string{"error": "missing approval request secret"})
+		return
+	}
+
+	approvalReq, ok := readApprovalRequest(w, r, logger)
+	if !ok {
+		return
+	}
+
+	if !approvalReq.CheckSecret(secret) {
+		logger.Error("Invalid approval request secret")
+		render.Status(r, 401)
+		render.JSON(w, r, map[string]string{"error": "invalid approval request secret"})
+		return
+	}
+
+	render.JSON(w, r, approvalReq)
+}
+
+// approvalShowHandler returns an approval request, without its certificate, to approvers
+func approvalShowHandler(w http.ResponseWriter, r *http.Request) {
+
+	log := r.Context().Value(RequestLoggerKey).(*logrus.Logger)
+	logger := log.WithFields(logrus.Fields{
+		"ctx":         "api",
+		"handler":     "approvalShow",
+		"req_id":      middleware.GetReqID(r.Context()),
+		"approval_id": chi.URLParam(r, "id"),
+	})
+
+	_, _, approvalReq, ok := authenticateApprover(w, r, &DecisionRequest{}, logger)
+	if !ok {
+		return
+	}
+
+	render.JSON(w, r, approvalReq.Redacted())
+}
+
+func approvalDecisionHandler(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		log := r.Context().Value(RequestLoggerKey).(*logrus.Logger)
+		approvalID := chi.URLParam(r, "id")
+
+		logger := log.WithFields(logrus.Fields{
+			"ctx":         "api",
+			"handler":     "approvalDecision",
+			"req_id":      middleware.GetReqID(r.Context()),
+			"approval_id": approvalID,
+		})
+
+		var decisionReq DecisionRequest
+		ctx, identity, _, ok := authenticateApprover(w, r, &decisionReq, logger)
+		if !ok {
+			return
+		}
+		logger = logger.WithField("approver", identity.ID)
+
+		approved := false
+		approvalReq, err := config.Approval.Store.Update(ctx, approvalID, func(req *approval.Request) error {
+			if !approve {
+				return req.Deny(identity.ID, decisionReq.Comment, time.Now())
+			}
+			ok, err := req.Approve(identity.ID, decisionReq.Comment, time.Now())
+			approved = ok
+			return err
+		})
+		if err != nil {
+			logger.WithError(err).Error("Recording approval decision")
+			render.Status(r, 409)
+			render.JSON(w, r, map[string]string{"error": err.Error()})
+			return
+		}
+
+		logger.WithFields(logrus.Fields{
+			"event":      "approval_decision",
+			"approved":   approve,
+			"user":       approvalReq.User,
+			"principals": approvalReq.Principals,
+			"comment":    decisionReq.Comment,
+			"status":     approvalReq.Status,
+		}).Info("Approval decision recorded")
+
+		if approved {
+			approvalReq = signApproved(ctx, approvalReq, logger)
+		}
+
+		// certificate is only returned to the requester
+		render.JSON(w, r, approvalReq.Redacted())
+	}
+}
+
+// authenticateApprover reads decisionReq from body of r, logs in the approver and returns
+// the approval request of r if the approver is member of its approver groups. The error
+// response is written when it returns false.
+func authenticateApprover(w http.ResponseWriter, r *http.Request, decisionReq *DecisionRequest, logger *logrus.Entry) (context.Context, *authenticator.Identity, *approval.Request, bool) {
+	if config.Approval.Store == nil {
+		render.Status(r, 404)
+		render.JSON(w, r, map[string]string{"error": "approval workflow is disabled"})
+		return nil, nil, nil, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(decisionReq); err != nil {
+		logger.WithError(err).Error("Reading decision request body")
+		render.Status(r, 400)
+		render.JSON(w, r, map[string]string{"error": "invalid decision request"})
+		return nil, nil, nil, false
+	}
+
+	ctx, identity, ok := authenticateRequest(w, r, &decisionReq.SignRequest, logger)
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	approvalReq, ok := readApprovalRequest(w, r.WithContext(ctx), logger)
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	if !isMember(identity, approvalReq.ApproverGroups) {
+		logger.WithField("approver", identity.ID).Error("Approver not member of approver groups")
+		render.Status(r, 403)
+		render.JSON(w, r, map[string]string{"error": "not allowed to decide on this request"})
+		return nil, nil, nil, false
+	}
+
+	return ctx, identity, approvalReq, true
+}
+
+// readApprovalRequest returns the approval request of ID of r from store. The error response
+// is written when it returns false.
+func readApprovalRequest(w http.ResponseWriter, r *http.Request, logger *logrus.Entry) (*approval.Request, bool) {
+	approvalReq, err := config.Approval.Store.Get(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, approval.ErrNotFound) {
+		render.Status(r, 404)
+		render.JSON(w, r, map[string]string{"error": "approval request not found"})
+		return nil, false
+	}
+	if err != nil {
+		logger.WithError(err).Error("Reading approval request")
+		render.Status(r, 500)
+		render.JSON(w, r, map[string]string{"error": "failed to read approval request"})
+		return nil, false
+	}
+
+	return approvalReq, true
+}
+
+// signApproved signs the key of an approved request and stores the certificate, or the
+// failure, in the request
+func signApproved(ctx context.Context, approvalReq *approval.Request, logger *logrus.Entry) *approval.Request {
+	// key ID is the requester one, not the approver one
+	ctx = authenticator.WithIdentity(ctx, &authenticator.Identity{ID: approvalReq.User, AuthTime: approvalReq.AuthTime})
+	opts := signer.Options{ValidBefore: approvalReq.ValidBefore}
+	if config.RenewMaxLifetime > 0 {
+		opts.Extensions = map[string]string{signer.AuthTimeExtension: strconv.FormatInt(approvalReq.AuthTime.Unix(), 10)}
+		if !approvalReq.ValidBefore.IsZero() {
+			opts.Extensions[signer.PrincipalsExpireExtension] = strconv.FormatInt(approvalReq.ValidBefore.Unix(), 10)
+		}
+	}
+	ctx = context.WithValue(ctx, signer.OptionsKey, opts)
+
+	// principals may have expired while waiting for approval
+	signReq := &request.SignRequest{PublicKey: approvalReq.PublicKey, TTL: approvalReq.TTL}
+	signErr := capTTL(signReq, approvalReq.ValidBefore)
+	cert := ""
+	if signErr == nil {
+		cert, signErr = config.Signer.Sign(ctx, signReq, approvalReq.User, approvalReq.Principals)
+	}
+	if signErr != nil {
+		logger.WithError(signErr).Error("Generating SSH certificate of approved request")
+	} else {
+		logger.WithField("user", approvalReq.User).Info("SSH certificate of approved request generated")
+	}
+
+	updated, err := config.Approval.Store.Update(ctx, approvalReq.ID, func(req *approval.Request) error {
+		if signErr != nil {
+			req.Status = approval.StatusFailed
+			req.Error = "unknown server error during key signing"
+			return nil
+		}
+		req.Certificate = cert
+		return nil
+	})
+	if err != nil {
+		logger.WithError(err).Error("Storing certificate of approved request")
+		return approvalReq
+	}
+
+	return updated
+}
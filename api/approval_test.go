@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/approval"
+	"github.com/signmykeyio/signmykey/builtin/approval/memory"
+	"github.com/signmykeyio/signmykey/builtin/principals"
+	localSign "github.com/signmykeyio/signmykey/builtin/signer/local"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestApprovalWorkflow(t *testing.T) {
+	caSigner := newTestSSHSigner(t)
+	userSigner := newTestSSHSigner(t)
+	pubKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(userSigner.PublicKey())))
+
+	store := &memory.Store{}
+	if err := store.Init(viper.New()); err != nil {
+		t.Fatal(err)
+	}
+	config = Config{
+		Auth:   &authMock{},
+		Princs: []principals.Principals{&princsMock{}},
+		Signer: &localSign.Signer{CACert: caSigner.PublicKey(), CAKey: caSigner, TTL: 600},
+		Approval: ApprovalConfig{
+			Store: store,
+			Rules: []approval.Rule{{Principals: []string{"root"}, Approvals: 2, ApproverGroups: []string{"approvers"}, TTL: 10 * time.Minute}},
+		},
+	}
+	router := Router(log.New())
+
+	send := func(method, path, token, body string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if token != "" && method == "GET" {
+			req.Header.Set(approval.SecretHeader, token)
+		} else if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(w, req)
+
+		res := map[string]interface{}{}
+		_ = json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res
+	}
+
+	// principals without approval rule are signed directly
+	code, res := send("POST", "/v1/sign", "", `{"user":"testuser","password":"testpassword","public_key":"`+pubKey+`","principals":["user"]}`)
+	assert.Equal(t, 200, code)
+	assert.NotEmpty(t, res["certificate"])
+
+	code, res = send("POST", "/v1/sign", "", `{"user":"testuser","password":"testpassword","public_key":"`+pubKey+`"}`)
+	assert.Equal(t, 202, code)
+	assert.Equal(t, "pending", res["status"])
+	id, _ := res["request_id"].(string)
+	assert.NotEmpty(t, id)
+	secret, _ := res["request_secret"].(string)
+	assert.NotEmpty(t, secret)
+
+	// requests are only read by requester with their secret
+	code, res = send("GET", "/v1/requests/"+id, secret, "")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "pending", res["status"])
+	assert.Equal(t, "mock-testuser", res["user"])
+	assert.NotContains(t, res, "secret_hash")
+
+	code, _ = send("GET", "/v1/requests/"+id, "", "")
+	assert.Equal(t, 401, code)
+	code, _ = send("GET", "/v1/requests/"+id, "badsecret", "")
+	assert.Equal(t, 401, code)
+	code, _ = send("GET", "/v1/requests/unknown", secret, "")
+	assert.Equal(t, 404, code)
+
+	// or by approvers with their credentials
+	code, res = send("POST", "/v1/requests/"+id+"/show", "", `{"user":"otheruser","password":"testpassword"}`)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "mock-testuser", res["user"])
+	code, _ = send("POST", "/v1/requests/"+id+"/show", "", `{"user":"emptyprincsuser","password":"testpassword"}`)
+	assert.Equal(t, 403, code)
+	code, _ = send("POST", "/v1/requests/"+id+"/show", "", `{"user":"otheruser","password":"badpassword"}`)
+	assert.Equal(t, 401, code)
+
+	cases := []struct {
+		description string
+		path        string
+		token       string
+		body        string
+		code        int
+		status      string
+	}{
+		{"unknown request", "/v1/requests/unknown/approve", "", `{"user":"otheruser","password":"testpassword"}`, 404, ""},
+		{"invalid body", "/v1/requests/" + id + "/approve", "", `{"user":"otheruser"`, 400, ""},
+		{"bad approver password", "/v1/requests/" + id + "/approve", "", `{"user":"otheruser","password":"badpassword"}`, 401, ""},
+		{"approver not in approver groups", "/v1/requests/" + id + "/approve", "", `{"user":"emptyprincsuser","password":"testpassword"}`, 403, ""},
+		{"self approval", "/v1/requests/" + id + "/approve", "", `{"user":"testuser","password":"testpassword"}`, 409, ""},
+		{"first approval", "/v1/requests/" + id + "/approve", "", `{"user":"otheruser","password":"testpassword"}`, 200, "pending"},
+		{"duplicate approval", "/v1/requests/" + id + "/approve", "", `{"user":"otheruser","password":"testpassword"}`, 409, ""},
+		{"second approval with token", "/v1/requests/" + id + "/approve", "goodtoken", `{"comment":"incident #42"}`, 200, "approved"},
+		{"denial after approval", "/v1/requests/" + id + "/deny", "", `{"user":"otheruser","password":"testpassword"}`, 409, ""},
+	}
+
+	for _, c := range cases {
+		code, res := send("POST", c.path, c.token, c.body)
+		assert.Equal(t, c.code, code, c.description)
+		if c.status != "" {
+			assert.Equal(t, c.status, res["status"], c.description)
+		}
+		// certificate is only returned to requester
+		assert.Empty(t, res["certificate"], c.description)
+	}
+
+	code, res = send("POST", "/v1/requests/"+id+"/show", "", `{"user":"otheruser","password":"testpassword"}`)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "approved", res["status"])
+	assert.Empty(t, res["certificate"])
+
+	code, res = send("GET", "/v1/requests/"+id, secret, "")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "approved", res["status"])
+	certStr, _ := res["certificate"].(string)
+	parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(certStr))
+	if !assert.NoError(t, err) {
+		return
+	}
+	cert := parsedKey.(*ssh.Certificate)
+	assert.Equal(t, "mock-testuser", cert.KeyId)
+	assert.Equal(t, []string{"root", "user"}, cert.ValidPrincipals)
+
+	// denied requests are never signed
+	_, res = send("POST", "/v1/sign", "", `{"user":"testuser","password":"testpassword","public_key":"`+pubKey+`","principals":["root"]}`)
+	id, _ = res["request_id"].(string)
+	code, res = send("POST", "/v1/requests/"+id+"/deny", "", `{"user":"otheruser","password":"testpassword","comment":"not now"}`)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "denied", res["status"])
+	assert.Empty(t, res["certificate"])
+
+	// approval endpoints are disabled without store
+	config.Approval = ApprovalConfig{}
+	code, _ = send("GET", "/v1/requests/"+id, secret, "")
+	assert.Equal(t, 404, code)
+	code, _ = send("POST", "/v1/sign", "", `{"user":"testuser","password":"testpassword","public_key":"`+pubKey+`"}`)
+	assert.Equal(t, 200, code)
+}
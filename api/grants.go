@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/principals/grants"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/sirupsen/logrus"
+)
+
+// GrantsConfig represents the administration of principals temporarily granted to users,
+// disabled when Store is nil.
+type GrantsConfig struct {
+	Store *grants.Store
+
+	// AdminGroups are the groups allowed to manage grants
+	AdminGroups []string
+	// MaxDuration is the longest validity of grants
+	MaxDuration time.Duration
+}
+
+// GrantRequest represents a grants administration request, admin credentials are the same
+// as sign requests ones
+type GrantRequest struct {
+	request.SignRequest
+	Grant GrantSpec `json:"grant"`
+}
+
+// GrantSpec represents the grant to create
+type GrantSpec struct {
+	User       string   `json:"user"`
+	Principals []string `json:"principals"`
+	Duration   string   `json:"duration"`
+	Reason     string   `json:"reason"`
+}
+
+// grantsAdmin authenticates grants administration requests and checks that their user is
+// a grants admin. The error response is written when it returns false.
+func grantsAdmin(w http.ResponseWriter, r *http.Request, logger *logrus.Entry) (*authenticator.Identity, *GrantRequest, bool) {
+	if config.Grants.Store == nil {
+		render.Status(r, 404)
+		render.JSON(w, r, map[string]string{"error": "grants are disabled"})
+		return nil, nil, false
+	}
+
+	var grantReq GrantRequest
+	if err := json.NewDecoder(r.Body).Decode(&grantReq); err != nil {
+		logger.WithError(err).Error("Reading grant request body")
+		render.Status(r, 400)
+		render.JSON(w, r, map[string]string{"error": "invalid grant request"})
+		return nil, nil, false
+	}
+
+	_, identity, ok := authenticateRequest(w, r, &grantReq.SignRequest, logger)
+	if !ok {
+		return nil, nil, false
+	}
+
+	if !isMember(identity, config.Grants.AdminGroups) {
+		logger.WithField("admin", identity.ID).Error("User not member of grants admin groups")
+		render.Status(r, 403)
+		render.JSON(w, r, map[string]string{"error": "not allowed to manage grants"})
+		return nil, nil, false
+	}
+
+	return identity, &grantReq, true
+}
+
+func createGrantHandler(w http.ResponseWriter, r *http.Request) {
+
+	log := r.Context().Value(RequestLoggerKey).(*logrus.Logger)
+	logger := log.WithFields(logrus.Fields{
+		"ctx":     "api",
+		"handler": "createGrant",
+		"req_id":  middleware.GetReqID(r.Context()),
+	})
+
+	identity, grantReq, ok := grantsAdmin(w, r, logger)
+	if !ok {
+		return
+	}
+
+	duration, err := time.ParseDuration(grantReq.Grant.Duration)
+	if err != nil {
+		logger.WithError(err).Error("Reading grant duration")
+		render.Status(r, 400)
+		render.JSON(w, r, map[string]string{"error": "invalid duration of grant"})
+		return
+	}
+	grant, err := grants.NewGrant(grantReq.Grant.User, grantReq.Grant.Principals, grantReq.Grant.Reason, identity.ID, duration, config.Grants.MaxDuration, time.Now())
+	if err != nil {
+		logger.WithError(err).Error("Checking grant")
+		render.Status(r, 400)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := config.Grants.Store.Add(grant); err != nil {
+		logger.WithError(err).Error("Storing grant")
+		render.Status(r, 500)
+		render.JSON(w, r, map[string]string{"error": "failed to store grant"})
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"event":      "grant_created",
+		"grant_id":   grant.ID,
+		"user":       grant.User,
+		"principals": grant.Principals,
+		"granter":    grant.Granter,
+		"reason":     grant.Reason,
+		"expire":     grant.Expires,
+	}).Info("Grant created")
+
+	render.Status(r, 201)
+	render.JSON(w, r, grant)
+}
+
+func listGrantsHandler(w http.ResponseWriter, r *http.Request) {
+
+	log := r.Context().Value(RequestLoggerKey).(*logrus.Logger)
+	logger := log.WithFields(logrus.Fields{
+		"ctx":     "api",
+		"handler": "listGrants",
+		"req_id":  middleware.GetReqID(r.Context()),
+	})
+
+	if _, _, ok := grantsAdmin(w, r, logger); !ok {
+		return
+	}
+
+	list, err := config.Grants.Store.List(time.Now())
+	if err != nil {
+		logger.WithError(err).Error("Reading grants")
+		render.Status(r, 500)
+		render.JSON(w, r, map[string]string{"error": "failed to read grants"})
+		return
+	}
+
+	render.JSON(w, r, map[string][]grants.Grant{"grants": list})
+}
+
+func revokeGrantHandler(w http.ResponseWriter, r *http.Request) {
+
+	log := r.Context().Value(RequestLoggerKey).(*logrus.Logger)
+	logger := log.WithFields(logrus.Fields{
+		"ctx":      "api",
+		"handler":  "revokeGrant",
+		"req_id":   middleware.GetReqID(r.Context()),
+		"grant_id": chi.URLParam(r, "id"),
+	})
+
+	identity, _, ok := grantsAdmin(w, r, logger)
+	if !ok {
+		return
+	}
+
+	grant, err := config.Grants.Store.Revoke(chi.URLParam(r, "id"))
+	if errors.Is(err, grants.ErrNotFound) {
+		render.Status(r, 404)
+		render.JSON(w, r, map[string]string{"error": "grant not found"})
+		return
+	}
+	if err != nil {
+		logger.WithError(err).Error("Revoking grant")
+		render.Status(r, 500)
+		render.JSON(w, r, map[string]string{"error": "failed to revoke grant"})
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"event":      "grant_revoked",
+		"user":       grant.User,
+		"principals": grant.Principals,
+		"granter":    grant.Granter,
+		"revoker":    identity.ID,
+		"reason":     grant.Reason,
+		"expire":     grant.Expires,
+	}).Info("Grant revoked")
+
+	render.JSON(w, r, grant)
+}
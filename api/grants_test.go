@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/principals"
+	"github.com/signmykeyio/signmykey/builtin/principals/grants"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrantsHandlers(t *testing.T) {
+	store, err := grants.NewStore(filepath.Join(t.TempDir(), "grants.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config = Config{
+		Auth:   &authMock{},
+		Princs: []principals.Principals{&princsMock{}, &grants.Principals{Store: store}},
+		Signer: &signerMock{},
+		Grants: GrantsConfig{Store: store, AdminGroups: []string{"admins"}, MaxDuration: 4 * time.Hour},
+	}
+	router := Router(log.New())
+
+	send := func(path, body string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+		router.ServeHTTP(w, req)
+
+		res := map[string]interface{}{}
+		_ = json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res
+	}
+	admin := `"user":"testuser","password":"testpassword"`
+	grantee := `{"user":"emptyprincsuser","password":"testpassword","public_key":"` + goodKey + `"}`
+
+	// grantee has no principals before grant
+	code, _ := send("/v1/sign", grantee)
+	assert.Equal(t, 401, code)
+
+	cases := []struct {
+		description string
+		body        string
+		code        int
+	}{
+		{"invalid body", `{` + admin, 400},
+		{"bad admin password", `{"user":"testuser","password":"badpassword","grant":{"user":"emptyprincsuser","principals":["deploy"],"duration":"1h","reason":"INC-42"}}`, 401},
+		{"user not admin", `{"user":"emptyprincsuser","password":"testpassword","grant":{"user":"emptyprincsuser","principals":["deploy"],"duration":"1h","reason":"INC-42"}}`, 403},
+		{"invalid duration", `{` + admin + `,"grant":{"user":"emptyprincsuser","principals":["deploy"],"duration":"soon","reason":"INC-42"}}`, 400},
+		{"duration too long", `{` + admin + `,"grant":{"user":"emptyprincsuser","principals":["deploy"],"duration":"5h","reason":"INC-42"}}`, 400},
+		{"missing reason", `{` + admin + `,"grant":{"user":"emptyprincsuser","principals":["deploy"],"duration":"1h"}}`, 400},
+		{"valid grant", `{` + admin + `,"grant":{"user":"emptyprincsuser","principals":["deploy"],"duration":"1h","reason":"INC-42"}}`, 201},
+	}
+
+	for _, c := range cases {
+		code, _ := send("/v1/grants", c.body)
+		assert.Equal(t, c.code, code, c.description)
+	}
+
+	code, res := send("/v1/sign", grantee)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "goodcert", res["certificate"])
+
+	code, res = send("/v1/grants/list", `{`+admin+`}`)
+	assert.Equal(t, 200, code)
+	list, _ := res["grants"].([]interface{})
+	if !assert.Len(t, list, 1) {
+		return
+	}
+	grant := list[0].(map[string]interface{})
+	assert.Equal(t, "emptyprincsuser", grant["user"])
+	assert.Equal(t, "mock-testuser", grant["granter"])
+	assert.Equal(t, "INC-42", grant["reason"])
+
+	code, _ = send("/v1/grants/list", `{"user":"emptyprincsuser","password":"testpassword"}`)
+	assert.Equal(t, 403, code)
+
+	code, _ = send("/v1/grants/unknown/revoke", `{`+admin+`}`)
+	assert.Equal(t, 404, code)
+	code, _ = send("/v1/grants/"+grant["id"].(string)+"/revoke", `{`+admin+`}`)
+	assert.Equal(t, 200, code)
+
+	code, _ = send("/v1/sign", grantee)
+	assert.Equal(t, 401, code)
+
+	config.Grants = GrantsConfig{}
+	code, _ = send("/v1/grants/list", `{`+admin+`}`)
+	assert.Equal(t, 404, code)
+}
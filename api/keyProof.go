@@ -0,0 +1,41 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/util"
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyProofNamespace is the SSHSIG namespace used to prove possession of the private key to sign
+const KeyProofNamespace = util.KeyProofNamespace
+
+// checkKeyProof verifies that the proof nonce of sign request is signed by the private key
+// matching the public key to sign and returns this public key.
+func checkKeyProof(signReq *request.SignRequest) (ssh.PublicKey, error) {
+	if signReq.ProofNonce == "" || signReq.ProofSignature == "" {
+		return nil, errors.New("missing proof_nonce or proof_signature field")
+	}
+
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(signReq.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+
+	if err := util.ConsumeNonce(signReq.ProofNonce); err != nil {
+		return nil, err
+	}
+
+	signingKey, err := util.SSHVerify([]byte(signReq.ProofSignature), KeyProofNamespace, []byte(signReq.ProofNonce))
+	if err != nil {
+		return nil, err
+	}
+
+	if string(signingKey.Marshal()) != string(pubKey.Marshal()) {
+		return nil, errors.New("proof not signed by the key to sign")
+	}
+
+	return pubKey, nil
+}
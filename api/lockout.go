@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/signmykeyio/signmykey/builtin/lockout"
+	"github.com/sirupsen/logrus"
+)
+
+// LockoutConfig represents the brute-force protection of logins, disabled when Store is nil.
+// Failures are counted by user and by client IP.
+type LockoutConfig struct {
+	Store lockout.Store
+
+	// MaxFailures is the number of failed logins within Window locking a user or client IP
+	MaxFailures int64
+	Window      time.Duration
+
+	// BaseDelay is the first lockout duration, it doubles with each further failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// lockoutKeys returns the failure counter keys of a login request
+func lockoutKeys(r *http.Request, user string) []string {
+	keys := []string{}
+
+	if user != "" {
+		keys = append(keys, "user:"+strings.ToLower(user))
+	}
+	if ip := middleware.GetClientIP(r.Context()); ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+
+	return keys
+}
+
+// checkLockout returns the longest remaining lockout duration of keys. Store errors are
+// logged and ignored so that logins keep working without the Store.
+func checkLockout(ctx context.Context, keys []string, logger *logrus.Entry) time.Duration {
+	if config.Lockout.Store == nil {
+		return 0
+	}
+
+	var retryAfter time.Duration
+	for _, key := range keys {
+		locked, err := config.Lockout.Store.LockedFor(ctx, key)
+		if err != nil {
+			logger.WithError(err).Error("Checking login lockout")
+			continue
+		}
+		if locked > retryAfter {
+			retryAfter = locked
+		}
+		if locked > 0 {
+			logger.WithFields(logrus.Fields{
+				"event":       "login_lockout_rejected",
+				"lockout_key": key,
+				"retry_after": locked.Round(time.Second).String(),
+			}).Warn("Login rejected by lockout")
+		}
+	}
+
+	return retryAfter
+}
+
+// recordLoginFailure counts a failed login for keys and locks keys with too many failures
+func recordLoginFailure(ctx context.Context, keys []string, logger *logrus.Entry) {
+	if config.Lockout.Store == nil {
+		return
+	}
+
+	for _, key := range keys {
+		failures, err := config.Lockout.Store.Fail(ctx, key, config.Lockout.Window)
+		if err != nil {
+			logger.WithError(err).Error("Recording login failure")
+			continue
+		}
+		if failures < config.Lockout.MaxFailures {
+			continue
+		}
+
+		delay := config.Lockout.BaseDelay
+		for i := config.Lockout.MaxFailures; i < failures && delay < config.Lockout.MaxDelay; i++ {
+			delay *= 2
+		}
+		if delay > config.Lockout.MaxDelay {
+			delay = config.Lockout.MaxDelay
+		}
+
+		if err := config.Lockout.Store.Lock(ctx, key, delay); err != nil {
+			logger.WithError(err).Error("Locking login")
+			continue
+		}
+		logger.WithFields(logrus.Fields{
+			"event":            "login_lockout",
+			"lockout_key":      key,
+			"failures":         failures,
+			"lockout_duration": delay.String(),
+		}).Warn("Login locked out")
+	}
+}
+
+// resetLoginFailures forgets failures of the user after a successful login, client IP
+// failures are kept so that a valid account can't be used to reset them.
+func resetLoginFailures(ctx context.Context, keys []string, logger *logrus.Entry) {
+	if config.Lockout.Store == nil {
+		return
+	}
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "user:") {
+			continue
+		}
+		if err := config.Lockout.Store.Reset(ctx, key); err != nil {
+			logger.WithError(err).Error("Resetting login failures")
+		}
+	}
+}
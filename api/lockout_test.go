@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/lockout/memory"
+	"github.com/signmykeyio/signmykey/builtin/principals"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignHandlerLockout(t *testing.T) {
+	newConfig := func() Config {
+		store := &memory.Store{}
+		if err := store.Init(viper.New()); err != nil {
+			t.Fatal(err)
+		}
+
+		return Config{
+			Auth:   &authMock{},
+			Princs: []principals.Principals{&princsMock{}},
+			Signer: &signerMock{},
+			Lockout: LockoutConfig{
+				Store:       store,
+				MaxFailures: 2,
+				Window:      10 * time.Minute,
+				BaseDelay:   time.Minute,
+				MaxDelay:    4 * time.Minute,
+			},
+		}
+	}
+
+	cases := []struct {
+		description string
+		user        string
+		password    string
+		remoteAddr  string
+		code        int
+		retryAfter  string
+	}{
+		{"first user failure", "testuser", "badpassword", "192.0.2.1:1234", 401, ""},
+		{"second user failure locks user", "testuser", "badpassword", "192.0.2.2:1234", 401, ""},
+		{"locked user with good password", "testuser", "testpassword", "192.0.2.3:1234", 429, "60"},
+		{"locked user with other case", "TestUser", "testpassword", "192.0.2.3:1234", 429, "60"},
+		{"second ip failure locks ip", "baduser", "badpassword", "192.0.2.1:1234", 401, ""},
+		{"locked ip with another user", "emptyprincsuser", "testpassword", "192.0.2.1:1234", 429, "60"},
+	}
+
+	config = newConfig()
+	router := Router(log.New())
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v1/sign", bytes.NewBufferString(`{"user":"`+c.user+`","password":"`+c.password+`","public_key":"`+goodKey+`"}`))
+		req.RemoteAddr = c.remoteAddr
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, c.code, w.Code, c.description)
+		assert.Equal(t, c.retryAfter, w.Header().Get("Retry-After"), c.description)
+	}
+
+	// user failures are reset by a successful login, client IP failures aren't
+	config = newConfig()
+	for _, c := range []struct {
+		password   string
+		remoteAddr string
+		code       int
+	}{
+		{"badpassword", "192.0.2.1:1234", 401},
+		{"testpassword", "192.0.2.2:1234", 200},
+		{"badpassword", "192.0.2.1:1234", 401},
+		{"testpassword", "192.0.2.2:1234", 200},
+		{"testpassword", "192.0.2.1:1234", 429},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v1/sign", bytes.NewBufferString(`{"user":"testuser","password":"`+c.password+`","public_key":"`+goodKey+`"}`))
+		req.RemoteAddr = c.remoteAddr
+		router.ServeHTTP(w, req)
+		assert.Equal(t, c.code, w.Code)
+	}
+}
+
+func TestLockoutBackoff(t *testing.T) {
+	store := &memory.Store{}
+	if err := store.Init(viper.New()); err != nil {
+		t.Fatal(err)
+	}
+	config = Config{Lockout: LockoutConfig{
+		Store:       store,
+		MaxFailures: 2,
+		Window:      10 * time.Minute,
+		BaseDelay:   time.Minute,
+		MaxDelay:    3 * time.Minute,
+	}}
+
+	ctx := context.Background()
+	logger := log.NewEntry(log.New())
+	expected := []time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute}
+
+	for _, delay := range expected {
+		recordLoginFailure(ctx, []string{"user:alice"}, logger)
+		locked, err := store.LockedFor(ctx, "user:alice")
+		assert.NoError(t, err)
+		assert.InDelta(t, delay, locked, float64(time.Second))
+	}
+}
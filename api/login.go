@@ -1,28 +1,93 @@
 package api
 
-import "errors"
-
-// Login represents credentials expected by SMK server
-type Login struct {
-	User     string `json:"user" binding:"required"`
-	Password string `json:"password" binding:"required"`
-	PubKey   string `json:"public_key" binding:"required"`
-	Otp      string `json:"otp"`
-}
+import (
+	"context"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/authenticator/token"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/sirupsen/logrus"
+)
+
+// authenticateRequest logs in the user of requests other than sign ones (approval decisions,
+// grants administration) with the configured Authenticator. The error response is written
+// when it returns false.
+func authenticateRequest(w http.ResponseWriter, r *http.Request, signReq *request.SignRequest, logger *logrus.Entry) (context.Context, *authenticator.Identity, bool) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		signReq.Token = strings.TrimSpace(token)
+	}
+	signReq.Client = request.Client{
+		Addr:        middleware.GetClientIP(r.Context()),
+		UserAgent:   r.UserAgent(),
+		RequestID:   middleware.GetReqID(r.Context()),
+		Certificate: r.TLS != nil && len(r.TLS.PeerCertificates) > 0,
+	}
+	if signReq.User == "" && signReq.Token == "" && !signReq.Client.Certificate {
+		logger.Error("Missing user credentials")
+		render.Status(r, 400)
+		render.JSON(w, r, map[string]string{"error": "missing user credentials"})
+		return nil, nil, false
+	}
+
+	reqCtx := r.Context()
+	if r.TLS != nil {
+		reqCtx = context.WithValue(reqCtx, authenticator.TLSStateKey, r.TLS)
+	}
 
-// Validate fields of login struct
-func (l *Login) Validate() error {
-	if l.User == "" {
-		return errors.New("empty user field")
+	failureKeys := lockoutKeys(r, signReq.User)
+	if retryAfter := checkLockout(reqCtx, failureKeys, logger); retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+		render.Status(r, 429)
+		render.JSON(w, r, map[string]string{"error": "too many failed logins, retry later"})
+		return nil, nil, false
 	}
 
-	if l.Password == "" {
-		return errors.New("empty password field")
+	ctx, valid, id, err := login(reqCtx, signReq)
+	if !valid {
+		logger.WithError(err).Error("Authenticating user")
+		recordLoginFailure(reqCtx, failureKeys, logger)
+		render.Status(r, 401)
+		render.JSON(w, r, map[string]string{"error": "login failed"})
+		return nil, nil, false
 	}
+	resetLoginFailures(reqCtx, failureKeys, logger)
+
+	identity, ok := authenticator.IdentityFromContext(ctx)
+	if !ok {
+		identity = &authenticator.Identity{ID: id, AuthTime: time.Now()}
+		ctx = authenticator.WithIdentity(ctx, identity)
+	}
+
+	return ctx, identity, true
+}
+
+// login authenticates the user of signReq, API tokens are checked by Tokens when configured,
+// other credentials by Auth
+func login(ctx context.Context, signReq *request.SignRequest) (context.Context, bool, string, error) {
+	if config.Tokens != nil && strings.HasPrefix(signReq.Token, token.Prefix) {
+		return config.Tokens.Login(ctx, signReq)
+	}
+
+	return config.Auth.Login(ctx, signReq)
+}
 
-	if l.PubKey == "" {
-		return errors.New("empty public_key field")
+// isMember returns true if one of groups is a group of identity reported by the
+// Authenticator. Principals aren't used: principals providers like grants could otherwise
+// grant administration rights.
+func isMember(identity *authenticator.Identity, groups []string) bool {
+	for _, group := range groups {
+		if slices.Contains(identity.Groups, group) {
+			return true
+		}
 	}
 
-	return nil
+	return false
 }
@@ -0,0 +1,12 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/signmykeyio/signmykey/util"
+)
+
+func nonceHandler(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, map[string]string{"nonce": util.IssueNonce()})
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/signmykeyio/signmykey/builtin/principals/cache"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/sirupsen/logrus"
+)
+
+// PrincipalsCacheConfig represents the administration of caches of principals providers,
+// disabled when there is no cache or no admin group.
+type PrincipalsCacheConfig struct {
+	Caches []*cache.Cache
+
+	// AdminGroups are the groups allowed to purge caches
+	AdminGroups []string
+}
+
+// PurgeRequest represents a request purging cached principals of a user, admin credentials
+// are the same as sign requests ones
+type PurgeRequest struct {
+	request.SignRequest
+	Purge PurgeSpec `json:"purge"`
+}
+
+// PurgeSpec represents the cached principals to purge
+type PurgeSpec struct {
+	// User is the ID or the user name of the user
+	User string `json:"user"`
+}
+
+func purgePrincipalsCacheHandler(w http.ResponseWriter, r *http.Request) {
+
+	log := r.Context().Value(RequestLoggerKey).(*logrus.Logger)
+	logger := log.WithFields(logrus.Fields{
+		"ctx":     "api",
+		"handler": "purgePrincipalsCache",
+		"req_id":  middleware.GetReqID(r.Context()),
+	})
+
+	if len(config.PrincipalsCache.Caches) == 0 || len(config.PrincipalsCache.AdminGroups) == 0 {
+		render.Status(r, 404)
+		render.JSON(w, r, map[string]string{"error": "principals cache purge is disabled"})
+		return
+	}
+
+	var purgeReq PurgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&purgeReq); err != nil {
+		logger.WithError(err).Error("Reading purge request body")
+		render.Status(r, 400)
+		render.JSON(w, r, map[string]string{"error": "invalid purge request"})
+		return
+	}
+	if purgeReq.Purge.User == "" {
+		logger.Error("Missing user of purge request")
+		render.Status(r, 400)
+		render.JSON(w, r, map[string]string{"error": "invalid purge request"})
+		return
+	}
+
+	_, identity, ok := authenticateRequest(w, r, &purgeReq.SignRequest, logger)
+	if !ok {
+		return
+	}
+
+	if !isMember(identity, config.PrincipalsCache.AdminGroups) {
+		logger.WithField("admin", identity.ID).Error("User not member of principals cache admin groups")
+		render.Status(r, 403)
+		render.JSON(w, r, map[string]string{"error": "not allowed to purge principals cache"})
+		return
+	}
+
+	purged := 0
+	for _, c := range config.PrincipalsCache.Caches {
+		purged += c.Purge(purgeReq.Purge.User)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"event":  "principals_cache_purged",
+		"user":   purgeReq.Purge.User,
+		"admin":  identity.ID,
+		"purged": purged,
+	}).Info("Principals cache purged")
+
+	render.JSON(w, r, map[string]int{"purged": purged})
+}
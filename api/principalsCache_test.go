@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/principals"
+	"github.com/signmykeyio/signmykey/builtin/principals/cache"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingPrincsMock counts lookups of princsMock
+type countingPrincsMock struct {
+	princsMock
+	lookups atomic.Int64
+}
+
+func (p *countingPrincsMock) Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error) {
+	p.lookups.Add(1)
+
+	return p.princsMock.Get(ctx, req)
+}
+
+func TestPurgePrincipalsCacheHandler(t *testing.T) {
+	princs := &countingPrincsMock{}
+	princsCache := cache.New(princs, time.Minute, time.Minute, 100)
+	config = Config{
+		Auth:            &authMock{},
+		Princs:          []principals.Principals{princsCache},
+		Signer:          &signerMock{},
+		PrincipalsCache: PrincipalsCacheConfig{Caches: []*cache.Cache{princsCache}},
+	}
+	router := Router(log.New())
+
+	send := func(path, body string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+		router.ServeHTTP(w, req)
+
+		res := map[string]interface{}{}
+		_ = json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res
+	}
+	sign := `{"user":"testuser","password":"testpassword","public_key":"` + goodKey + `"}`
+	purge := `{"user":"testuser","password":"testpassword","purge":{"user":"mock-testuser"}}`
+
+	// several keys signed in a row are looked up once
+	for range 3 {
+		code, _ := send("/v1/sign", sign)
+		assert.Equal(t, 200, code)
+	}
+	assert.Equal(t, int64(1), princs.lookups.Load())
+
+	// purge is disabled without admin groups
+	code, _ := send("/v1/principals/cache/purge", purge)
+	assert.Equal(t, 404, code)
+
+	config.PrincipalsCache.AdminGroups = []string{"admins"}
+	cases := []struct {
+		description string
+		body        string
+		code        int
+	}{
+		{"invalid body", `{"user":"testuser"`, 400},
+		{"missing user", `{"user":"testuser","password":"testpassword","purge":{}}`, 400},
+		{"bad admin password", `{"user":"testuser","password":"badpassword","purge":{"user":"mock-testuser"}}`, 401},
+		{"user not admin", `{"user":"emptyprincsuser","password":"testpassword","purge":{"user":"mock-testuser"}}`, 403},
+	}
+	for _, c := range cases {
+		code, _ := send("/v1/principals/cache/purge", c.body)
+		assert.Equal(t, c.code, code, c.description)
+	}
+	// admin checks don't look principals up
+	assert.Equal(t, int64(1), princs.lookups.Load())
+
+	code, res := send("/v1/principals/cache/purge", purge)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, float64(1), res["purged"])
+
+	code, _ = send("/v1/sign", sign)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, int64(2), princs.lookups.Load())
+}
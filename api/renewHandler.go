@@ -0,0 +1,258 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/signmykeyio/signmykey/builtin/approval"
+	"github.com/signmykeyio/signmykey/builtin/authenticator/token"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/builtin/signer"
+	"github.com/signmykeyio/signmykey/client"
+	"github.com/signmykeyio/signmykey/util"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// RenewNamespace is the SSHSIG namespace used to sign renewal nonces
+const RenewNamespace = util.RenewNamespace
+
+// RenewRequest represents a certificate renewal request
+type RenewRequest struct {
+	Certificate string   `json:"certificate"`
+	Nonce       string   `json:"nonce"`
+	Signature   string   `json:"signature"`
+	Principals  []string `json:"principals"`
+}
+
+// Validate fields of renew request struct
+func (rr *RenewRequest) Validate() error {
+	if rr.Certificate == "" {
+		return errors.New("empty certificate field")
+	}
+
+	if rr.Nonce == "" {
+		return errors.New("empty nonce field")
+	}
+
+	if rr.Signature == "" {
+		return errors.New("empty signature field")
+	}
+
+	return nil
+}
+
+func renewHandler(w http.ResponseWriter, r *http.Request) {
+
+	log := r.Context().Value(RequestLoggerKey).(*logrus.Logger)
+	reqID := middleware.GetReqID(r.Context())
+
+	logger := log.WithFields(logrus.Fields{
+		"ctx":     "api",
+		"handler": "renew",
+		"req_id":  reqID,
+	})
+
+	if config.RenewMaxLifetime <= 0 {
+		render.Status(r, 404)
+		render.JSON(w, r, map[string]string{"error": "certificate renewal is disabled"})
+		return
+	}
+
+	var renewReq RenewRequest
+	err := json.NewDecoder(r.Body).Decode(&renewReq)
+	if err == nil {
+		err = renewReq.Validate()
+	}
+	if err != nil {
+		logger.WithError(err).Error("Reading renewal request body")
+		render.Status(r, 400)
+		render.JSON(w, r, map[string]string{"error": "invalid renewal request"})
+		return
+	}
+
+	cert, authTime, err := checkRenewal(r.Context(), &renewReq)
+	if err != nil {
+		logger.WithError(err).Error("Checking renewal request")
+		render.Status(r, 401)
+		render.JSON(w, r, map[string]string{"error": "renewal failed"})
+		return
+	}
+	logger = logger.WithFields(logrus.Fields{
+		"user":        cert.KeyId,
+		"old_serial":  cert.Serial,
+		"auth_time":   authTime,
+		"fingerprint": ssh.FingerprintSHA256(cert.Key),
+	})
+
+	sessionEnd := authTime.Add(config.RenewMaxLifetime)
+	if !time.Now().Before(sessionEnd) {
+		logger.Error("Maximum session lifetime reached")
+		render.Status(r, 401)
+		render.JSON(w, r, map[string]string{"error": "maximum session lifetime reached, login again"})
+		return
+	}
+
+	principals := cert.ValidPrincipals
+	if len(renewReq.Principals) > 0 {
+		for _, principal := range renewReq.Principals {
+			if !slices.Contains(cert.ValidPrincipals, principal) {
+				logger.WithField("principal", principal).Error("Requested principal not in current certificate")
+				render.Status(r, 403)
+				render.JSON(w, r, map[string]string{"error": "requested principals not allowed"})
+				return
+			}
+		}
+		principals = renewReq.Principals
+	}
+	logger = logger.WithField("principals", principals)
+
+	// renewals would extend principals beyond their expiration, like granted ones
+	if _, ok := cert.Extensions[signer.PrincipalsExpireExtension]; ok {
+		logger.Error("Renewal of expiring principals")
+		render.Status(r, 403)
+		render.JSON(w, r, map[string]string{"error": "expiring principals can't be renewed, login again"})
+		return
+	}
+
+	// renewals would extend privileges beyond what approvers agreed on
+	if _, ok := approval.Match(config.Approval.Rules, principals); config.Approval.Store != nil && ok {
+		logger.Error("Renewal of principals requiring approval")
+		render.Status(r, 403)
+		render.JSON(w, r, map[string]string{"error": "principals requiring approval can't be renewed, login again"})
+		return
+	}
+
+	signReq := &request.SignRequest{
+		PublicKey: string(ssh.MarshalAuthorizedKey(cert.Key)),
+		Client: request.Client{
+			Addr:      middleware.GetClientIP(r.Context()),
+			UserAgent: r.UserAgent(),
+			RequestID: reqID,
+		},
+	}
+
+	// renewals must not outlive API tokens nor exceed their limits
+	if tokenID, ok := cert.Extensions[signer.TokenIDExtension]; ok || cert.Extensions[signer.AuthSourceExtension] == "token" {
+		tok, err := renewalToken(tokenID)
+		if err != nil {
+			logger.WithError(err).Error("Checking API token of certificate")
+			render.Status(r, 401)
+			render.JSON(w, r, map[string]string{"error": "renewal failed"})
+			return
+		}
+		if len(tok.Principals) > 0 && slices.ContainsFunc(principals, func(principal string) bool { return !slices.Contains(tok.Principals, principal) }) {
+			logger.WithField("token_id", tok.ID).Error("Principals out of API token scope")
+			render.Status(r, 403)
+			render.JSON(w, r, map[string]string{"error": "requested principals not allowed"})
+			return
+		}
+		signReq.TTL = tok.MaxTTL
+	}
+
+	extensions := map[string]string{signer.AuthTimeExtension: strconv.FormatInt(authTime.Unix(), 10)}
+	for _, name := range []string{signer.AuthSourceExtension, signer.TokenIDExtension} {
+		if value, ok := cert.Extensions[name]; ok {
+			extensions[name] = value
+		}
+	}
+	ctx := context.WithValue(r.Context(), signer.OptionsKey, signer.Options{
+		Extensions:  extensions,
+		ValidBefore: sessionEnd,
+	})
+	newCert, err := config.Signer.Sign(ctx, signReq, cert.KeyId, principals)
+	if err != nil {
+		logger.WithError(err).Error("Generating SSH certificate")
+		render.Status(r, 400)
+		render.JSON(w, r, map[string]string{"error": "unknown server error during key signing"})
+		return
+	}
+
+	_, before, _, _ := client.CertInfo(newCert)
+	logger.WithField("expire", time.Unix(int64(before), 0)).Info("SSH certificate renewed")
+
+	render.JSON(w, r, map[string]string{"certificate": newCert})
+}
+
+// renewalToken returns the API token of ID tokenID if it is still active
+func renewalToken(tokenID string) (token.Token, error) {
+	if config.Tokens == nil {
+		return token.Token{}, errors.New("API tokens not configured")
+	}
+	if tokenID == "" {
+		return token.Token{}, errors.New("certificate without token ID")
+	}
+
+	return config.Tokens.Active(tokenID)
+}
+
+// checkRenewal verifies that certificate of renewal request is a valid certificate issued
+// by our CA and that the client owns its private key. It returns the certificate and the
+// time of the initial authentication.
+func checkRenewal(ctx context.Context, renewReq *RenewRequest) (*ssh.Certificate, time.Time, error) {
+	parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(renewReq.Certificate))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("parsing certificate: %w", err)
+	}
+	cert, ok := parsedKey.(*ssh.Certificate)
+	if !ok || cert.CertType != ssh.UserCert {
+		return nil, time.Time{}, errors.New("not a user certificate")
+	}
+	if len(cert.ValidPrincipals) == 0 {
+		return nil, time.Time{}, errors.New("certificate without principals")
+	}
+
+	caStr, err := config.Signer.ReadCA(ctx)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("reading CA: %w", err)
+	}
+	ca, _, _, _, err := ssh.ParseAuthorizedKey([]byte(caStr))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("parsing CA: %w", err)
+	}
+
+	// CheckCert verifies signature and validity period but not the authority
+	if string(cert.SignatureKey.Marshal()) != string(ca.Marshal()) {
+		return nil, time.Time{}, errors.New("certificate not signed by CA")
+	}
+
+	criticalOptions := []string{}
+	for option := range cert.CriticalOptions {
+		criticalOptions = append(criticalOptions, option)
+	}
+	checker := ssh.CertChecker{SupportedCriticalOptions: criticalOptions}
+	if err := checker.CheckCert(cert.ValidPrincipals[0], cert); err != nil {
+		return nil, time.Time{}, fmt.Errorf("checking certificate: %w", err)
+	}
+
+	if err := util.ConsumeNonce(renewReq.Nonce); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	signingKey, err := util.SSHVerify([]byte(renewReq.Signature), RenewNamespace, []byte(renewReq.Nonce))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if string(signingKey.Marshal()) != string(cert.Key.Marshal()) {
+		return nil, time.Time{}, errors.New("nonce not signed by certificate key")
+	}
+
+	authTimeStr, ok := cert.Extensions[signer.AuthTimeExtension]
+	if !ok {
+		return nil, time.Time{}, errors.New("certificate without authentication time")
+	}
+	authTimeUnix, err := strconv.ParseInt(authTimeStr, 10, 64)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid authentication time: %w", err)
+	}
+
+	return cert, time.Unix(authTimeUnix, 0), nil
+}
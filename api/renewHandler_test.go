@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator/token"
+	"github.com/signmykeyio/signmykey/builtin/principals"
+	"github.com/signmykeyio/signmykey/builtin/principals/grants"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/builtin/signer"
+	localSign "github.com/signmykeyio/signmykey/builtin/signer/local"
+	"github.com/signmykeyio/signmykey/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestSSHSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer
+}
+
+func TestRenewHandler(t *testing.T) {
+	caSigner := newTestSSHSigner(t)
+	otherCASigner := newTestSSHSigner(t)
+	userSigner := newTestSSHSigner(t)
+	otherUserSigner := newTestSSHSigner(t)
+
+	issue := func(ca ssh.Signer, authTime *time.Time) string {
+		s := &localSign.Signer{CACert: ca.PublicKey(), CAKey: ca, TTL: 600}
+		ctx := context.Background()
+		if authTime != nil {
+			ctx = context.WithValue(ctx, signer.OptionsKey, signer.Options{
+				Extensions: map[string]string{signer.AuthTimeExtension: strconv.FormatInt(authTime.Unix(), 10)},
+			})
+		}
+		cert, err := s.Sign(ctx, &request.SignRequest{PublicKey: string(ssh.MarshalAuthorizedKey(userSigner.PublicKey()))}, "local-testuser", []string{"root", "user"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	sign := func(key ssh.Signer, nonce string) string {
+		sig, err := util.SSHSign(key, RenewNamespace, []byte(nonce))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(sig)
+	}
+
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+
+	cases := []struct {
+		description   string
+		maxLifetime   time.Duration
+		cert          string
+		signer        ssh.Signer
+		principals    []string
+		code          int
+		principalsOut []string
+	}{
+		{"renewal disabled", 0, issue(caSigner, &now), userSigner, nil, 404, nil},
+		{"valid renewal", time.Hour, issue(caSigner, &now), userSigner, nil, 200, []string{"root", "user"}},
+		{"valid renewal with less principals", time.Hour, issue(caSigner, &now), userSigner, []string{"user"}, 200, []string{"user"}},
+		{"renewal with more principals", time.Hour, issue(caSigner, &now), userSigner, []string{"user", "admin"}, 403, nil},
+		{"nonce signed by another key", time.Hour, issue(caSigner, &now), otherUserSigner, nil, 401, nil},
+		{"certificate from another CA", time.Hour, issue(otherCASigner, &now), userSigner, nil, 401, nil},
+		{"certificate without auth time", time.Hour, issue(caSigner, nil), userSigner, nil, 401, nil},
+		{"session lifetime reached", time.Hour, issue(caSigner, &old), userSigner, nil, 401, nil},
+	}
+
+	for _, c := range cases {
+		config = Config{
+			Signer:           &localSign.Signer{CACert: caSigner.PublicKey(), CAKey: caSigner, TTL: 86400},
+			RenewMaxLifetime: c.maxLifetime,
+		}
+		router := Router(log.New())
+
+		nonce := util.IssueNonce()
+		body, _ := json.Marshal(RenewRequest{
+			Certificate: c.cert,
+			Nonce:       nonce,
+			Signature:   sign(c.signer, nonce),
+			Principals:  c.principals,
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/renew", bytes.NewBuffer(body))
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, c.code, w.Code, c.description)
+		if c.code != 200 {
+			continue
+		}
+
+		var response map[string]string
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err, c.description)
+
+		parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(response["certificate"]))
+		if !assert.NoError(t, err, c.description) {
+			continue
+		}
+		cert := parsedKey.(*ssh.Certificate)
+		assert.Equal(t, c.principalsOut, cert.ValidPrincipals, c.description)
+		assert.Equal(t, "local-testuser", cert.KeyId, c.description)
+		assert.Equal(t, strconv.FormatInt(now.Unix(), 10), cert.Extensions[signer.AuthTimeExtension], c.description)
+		assert.Equal(t, uint64(now.Add(c.maxLifetime).Unix()), cert.ValidBefore, c.description)
+
+		// nonce can't be replayed
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/v1/renew", bytes.NewBuffer(body))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 401, w.Code, c.description)
+	}
+}
+
+func TestRenewHandlerToken(t *testing.T) {
+	caSigner := newTestSSHSigner(t)
+	userSigner := newTestSSHSigner(t)
+	tokens, secrets := newTestTokens(t, "ci")
+	config = Config{
+		Auth:             &authMock{},
+		Princs:           []principals.Principals{&staticPrincsMock{"deploy", "root"}},
+		Signer:           &localSign.Signer{CACert: caSigner.PublicKey(), CAKey: caSigner, TTL: 86400},
+		Tokens:           tokens,
+		RenewMaxLifetime: time.Hour,
+	}
+	router := Router(log.New())
+
+	send := func(path string, body interface{}, bearer string) (int, *ssh.Certificate) {
+		payload, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(payload))
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		router.ServeHTTP(w, req)
+
+		var response map[string]string
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(response["certificate"]))
+		if err != nil {
+			return w.Code, nil
+		}
+		return w.Code, parsed.(*ssh.Certificate)
+	}
+	renew := func(cert *ssh.Certificate) (int, *ssh.Certificate) {
+		nonce := util.IssueNonce()
+		sig, err := util.SSHSign(userSigner, RenewNamespace, []byte(nonce))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return send("/v1/renew", RenewRequest{
+			Certificate: string(ssh.MarshalAuthorizedKey(cert)),
+			Nonce:       nonce,
+			Signature:   string(sig),
+		}, "")
+	}
+
+	code, cert := send("/v1/sign", request.SignRequest{PublicKey: string(ssh.MarshalAuthorizedKey(userSigner.PublicKey()))}, secrets[0])
+	if !assert.Equal(t, 200, code) {
+		return
+	}
+	assert.Equal(t, "token", cert.Extensions[signer.AuthSourceExtension])
+	assert.NotEmpty(t, cert.Extensions[signer.TokenIDExtension])
+
+	// renewed certificates keep the maximum TTL of token
+	code, renewed := renew(cert)
+	if !assert.Equal(t, 200, code) {
+		return
+	}
+	assert.Equal(t, []string{"deploy"}, renewed.ValidPrincipals)
+	assert.Equal(t, cert.Extensions[signer.TokenIDExtension], renewed.Extensions[signer.TokenIDExtension])
+	assert.InDelta(t, time.Now().Add(time.Minute).Unix(), int64(renewed.ValidBefore), 2)
+
+	// certificates of tokens can't be renewed without API tokens configured
+	config.Tokens = nil
+	code, _ = renew(renewed)
+	assert.Equal(t, 401, code)
+	config.Tokens = tokens
+
+	// nor once tokens are revoked
+	code, renewed = renew(renewed)
+	if !assert.Equal(t, 200, code) {
+		return
+	}
+	list, err := token.ReadTokens(tokens.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list[0].Revoked = time.Now()
+	if err := token.WriteTokens(tokens.File, list); err != nil {
+		t.Fatal(err)
+	}
+	code, _ = renew(renewed)
+	assert.Equal(t, 401, code)
+
+}
+
+func TestRenewHandlerGrants(t *testing.T) {
+	caSigner := newTestSSHSigner(t)
+	userSigner := newTestSSHSigner(t)
+	store, err := grants.NewStore(filepath.Join(t.TempDir(), "grants.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant, _ := grants.NewGrant("emptyprincsuser", []string{"deploy"}, "INC-42", "mock-testuser", 10*time.Minute, time.Hour, time.Now())
+	if err := store.Add(grant); err != nil {
+		t.Fatal(err)
+	}
+	config = Config{
+		Auth:             &authMock{},
+		Princs:           []principals.Principals{&princsMock{}, &grants.Principals{Store: store}},
+		Signer:           &localSign.Signer{CACert: caSigner.PublicKey(), CAKey: caSigner, TTL: 86400},
+		RenewMaxLifetime: time.Hour,
+	}
+	router := Router(log.New())
+
+	payload, _ := json.Marshal(request.SignRequest{
+		User:      "emptyprincsuser",
+		Password:  "testpassword",
+		PublicKey: string(ssh.MarshalAuthorizedKey(userSigner.PublicKey())),
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/sign", bytes.NewBuffer(payload)))
+	if !assert.Equal(t, 200, w.Code) {
+		return
+	}
+	var response map[string]string
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(response["certificate"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := parsed.(*ssh.Certificate)
+
+	// certificates don't outlive grants
+	assert.Equal(t, []string{"deploy"}, cert.ValidPrincipals)
+	assert.InDelta(t, grant.Expires.Unix(), int64(cert.ValidBefore), 1)
+	assert.Equal(t, strconv.FormatInt(grant.Expires.Unix(), 10), cert.Extensions[signer.PrincipalsExpireExtension])
+
+	// nor are they renewed
+	nonce := util.IssueNonce()
+	sig, err := util.SSHSign(userSigner, RenewNamespace, []byte(nonce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ = json.Marshal(RenewRequest{
+		Certificate: string(ssh.MarshalAuthorizedKey(cert)),
+		Nonce:       nonce,
+		Signature:   string(sig),
+	})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/renew", bytes.NewBuffer(payload)))
+	assert.Equal(t, 403, w.Code)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,25 +12,66 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/authenticator/token"
 	"github.com/signmykeyio/signmykey/builtin/principals"
+	"github.com/signmykeyio/signmykey/builtin/principals/rules"
 	"github.com/signmykeyio/signmykey/builtin/signer"
 	"github.com/sirupsen/logrus"
 )
 
 // Config represents the config of the API webserver.
 type Config struct {
-	Addr       string
-	TLSDisable bool
-	TLSCert    string
-	TLSKey     string
+	Addr        string
+	TLSDisable  bool
+	TLSCert     string
+	TLSKey      string
+	TLSClientCA string
 
 	Logger *logrus.Logger
 
 	Auth   authenticator.Authenticator
 	Princs []principals.Principals
 	Signer signer.Signer
+
+	// Tokens checks API tokens of requests ahead of Auth, if not nil
+	Tokens *token.Authenticator
+
+	// PrincipalsMode is the way principals of providers are combined: PrincipalsMerge,
+	// PrincipalsFirstMatch or PrincipalsIntersection. PrincipalsMerge if empty.
+	PrincipalsMode string
+	// PrincipalsRules reshape principals returned by all providers, if not nil
+	PrincipalsRules *rules.Pipeline
+
+	// RenewMaxLifetime enables certificate renewal when greater than zero, certificates
+	// can be renewed up to this duration after the initial authentication
+	RenewMaxLifetime time.Duration
+
+	// KeyProofRequired makes clients prove possession of the private key matching the public key to sign
+	KeyProofRequired bool
+
+	// Lockout protects logins against brute-force attacks
+	Lockout LockoutConfig
+
+	// Approval holds sign requests of privileged principals until approved by other users
+	Approval ApprovalConfig
+
+	// Grants allows admins to temporarily grant principals to users
+	Grants GrantsConfig
+
+	// PrincipalsCache allows admins to purge cached principals of users
+	PrincipalsCache PrincipalsCacheConfig
 }
 
+// Modes of combination of principals of providers
+const (
+	// PrincipalsMerge returns principals of all providers
+	PrincipalsMerge = "merge"
+	// PrincipalsFirstMatch returns principals of the first provider returning principals
+	PrincipalsFirstMatch = "first"
+	// PrincipalsIntersection returns principals returned by all providers
+	PrincipalsIntersection = "intersection"
+)
+
 type contextKey string
 
 var (
@@ -79,6 +121,21 @@ func Serve(startconfig Config) {
 		},
 	}
 
+	if config.TLSClientCA != "" {
+		caPEM, err := os.ReadFile(config.TLSClientCA)
+		if err != nil {
+			logger.WithField("ctx", "api").WithError(err).Error("Load TLS client CA")
+			return
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			logger.WithField("ctx", "api").WithError(fmt.Errorf("no valid certificate found in %s", config.TLSClientCA)).Error("Load TLS client CA")
+			return
+		}
+		tlsCfg.ClientCAs = clientCAs
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
 	// Create standard logger from logrus for http.Server internal ErrorLog
 	lw := logger.WithField("ctx", "api").WriterLevel(logrus.ErrorLevel)
 	defer lw.Close() // nolint:errcheck
@@ -119,6 +176,16 @@ func Router(logger *logrus.Logger) *chi.Mux {
 		r.Get("/ping", pingHandler)
 		r.Post("/sign", signHandler)
 		r.Get("/ca", caHandler)
+		r.Get("/nonce", nonceHandler)
+		r.Post("/renew", renewHandler)
+		r.Get("/requests/{id}", approvalRequestHandler)
+		r.Post("/requests/{id}/show", approvalShowHandler)
+		r.Post("/requests/{id}/approve", approvalDecisionHandler(true))
+		r.Post("/requests/{id}/deny", approvalDecisionHandler(false))
+		r.Post("/grants", createGrantHandler)
+		r.Post("/grants/list", listGrantsHandler)
+		r.Post("/grants/{id}/revoke", revokeGrantHandler)
+		r.Post("/principals/cache/purge", purgePrincipalsCacheHandler)
 	})
 
 	return router
@@ -5,13 +5,22 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/builtin/signer"
 	"github.com/signmykeyio/signmykey/client"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
 
 	princsPkg "github.com/signmykeyio/signmykey/builtin/principals"
 )
@@ -35,27 +44,156 @@ func signHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, valid, id, err := config.Auth.Login(r.Context(), body)
+	signReq, err := request.Decode(body)
+	if err == nil {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			signReq.Token = strings.TrimSpace(token)
+		}
+		signReq.Client = request.Client{
+			Addr:        middleware.GetClientIP(r.Context()),
+			UserAgent:   r.UserAgent(),
+			RequestID:   reqID,
+			Certificate: r.TLS != nil && len(r.TLS.PeerCertificates) > 0,
+		}
+		err = signReq.Validate()
+	}
+	if err != nil {
+		logger.WithError(err).Error("Reading signing request body")
+		render.Status(r, 400)
+		render.JSON(w, r, map[string]string{"error": "invalid sign request"})
+		return
+	}
+
+	reqCtx := r.Context()
+	if r.TLS != nil {
+		reqCtx = context.WithValue(reqCtx, authenticator.TLSStateKey, r.TLS)
+	}
+
+	failureKeys := lockoutKeys(r, signReq.User)
+	if retryAfter := checkLockout(reqCtx, failureKeys, logger); retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+		render.Status(r, 429)
+		render.JSON(w, r, map[string]string{"error": "too many failed logins, retry later"})
+		return
+	}
+
+	ctx, valid, id, err := login(reqCtx, signReq)
 	if !valid {
 		logger.WithError(err).Error("Authenticating user")
+		recordLoginFailure(reqCtx, failureKeys, logger)
+		var deniedError *authenticator.DeniedError
+		if errors.As(err, &deniedError) {
+			render.Status(r, 403)
+			render.JSON(w, r, map[string]string{"error": "login denied: " + deniedError.Error()})
+			return
+		}
 		render.Status(r, 401)
 		render.JSON(w, r, map[string]string{"error": "login failed"})
 		return
 	}
+	resetLoginFailures(reqCtx, failureKeys, logger)
+	identity, ok := authenticator.IdentityFromContext(ctx)
+	if !ok {
+		identity = &authenticator.Identity{ID: id, AuthTime: time.Now()}
+		ctx = authenticator.WithIdentity(ctx, identity)
+	}
 	logger = logger.WithField("user", id)
+	if identity.Source != "" {
+		logger = logger.WithField("source", identity.Source)
+	}
+	if mail := identity.Attribute("mail"); mail != "" {
+		logger = logger.WithField("mail", mail)
+	}
 	logger.Info("User authenticated")
 
-	ctx, principals, err := loadPrincipals(ctx, body, logger)
+	ctx, principals, err := loadPrincipals(ctx, signReq, logger)
 	if err != nil {
 		logger.WithError(err).Error("Getting list of user principals")
 		render.Status(r, 401)
 		render.JSON(w, r, map[string]string{"error": "error getting list of principals"})
 		return
 	}
+	if len(signReq.Principals) > 0 {
+		for _, principal := range signReq.Principals {
+			if !slices.Contains(principals, principal) {
+				logger.WithField("principal", principal).Error("Requested principal not allowed for user")
+				render.Status(r, 403)
+				render.JSON(w, r, map[string]string{"error": "requested principals not allowed"})
+				return
+			}
+		}
+		principals = signReq.Principals
+	}
+	if identity.Principals != nil {
+		principals = slices.DeleteFunc(principals, func(principal string) bool {
+			return !slices.Contains(identity.Principals, principal)
+		})
+		if len(principals) == 0 {
+			logger.WithField("allowed_principals", identity.Principals).Error("No principal allowed for identity")
+			render.Status(r, 403)
+			render.JSON(w, r, map[string]string{"error": "requested principals not allowed"})
+			return
+		}
+	}
+	if maxTTL := int64(identity.MaxTTL.Seconds()); maxTTL > 0 && (signReq.TTL == 0 || signReq.TTL > maxTTL) {
+		signReq.TTL = maxTTL
+	}
+	validBefore := princsPkg.ValidBefore(ctx)
+	if err := capTTL(signReq, validBefore); err != nil {
+		logger.WithError(err).Error("Limiting certificate validity to principals one")
+		render.Status(r, 403)
+		render.JSON(w, r, map[string]string{"error": "principals expired"})
+		return
+	}
 	logger = logger.WithField("principals", principals)
 	logger.Info("User principals retrieved")
 
-	cert, err := config.Signer.Sign(ctx, body, id, principals)
+	if config.KeyProofRequired {
+		pubKey, err := checkKeyProof(signReq)
+		if err != nil {
+			logger.WithError(err).Error("Checking public key proof of possession")
+			render.Status(r, 401)
+			render.JSON(w, r, map[string]string{"error": "invalid public key proof of possession"})
+			return
+		}
+		logger = logger.WithField("fingerprint", ssh.FingerprintSHA256(pubKey))
+		logger.Info("Public key possession proved")
+	}
+
+	approvalReq, secret, err := requestApproval(ctx, identity, signReq, principals, validBefore)
+	if err != nil {
+		logger.WithError(err).Error("Creating approval request")
+		render.Status(r, 500)
+		render.JSON(w, r, map[string]string{"error": "failed to create approval request"})
+		return
+	}
+	if approvalReq != nil {
+		logger.WithFields(logrus.Fields{
+			"event":       "approval_requested",
+			"approval_id": approvalReq.ID,
+			"expire":      approvalReq.Expires,
+		}).Info("Sign request waiting for approval")
+		render.Status(r, 202)
+		render.JSON(w, r, map[string]string{
+			"request_id":     approvalReq.ID,
+			"request_secret": secret,
+			"status":         approvalReq.Status,
+			"expires":        approvalReq.Expires.Format(time.RFC3339),
+		})
+		return
+	}
+
+	opts := signer.Options{ValidBefore: validBefore}
+	if config.RenewMaxLifetime > 0 {
+		// keep initial authentication in certificate to limit renewals
+		opts.Extensions = authExtensions(identity)
+		if !validBefore.IsZero() {
+			opts.Extensions[signer.PrincipalsExpireExtension] = strconv.FormatInt(validBefore.Unix(), 10)
+		}
+	}
+	ctx = context.WithValue(ctx, signer.OptionsKey, opts)
+
+	cert, err := config.Signer.Sign(ctx, signReq, id, principals)
 	if err != nil {
 		logger.WithError(err).Error("Generating SSH certificate")
 		render.Status(r, 400)
@@ -69,22 +207,100 @@ func signHandler(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, map[string]string{"certificate": cert})
 }
 
-func loadPrincipals(ctx context.Context, body []byte, logger *logrus.Entry) (context.Context, []string, error) {
+// capTTL limits TTL of signReq to validBefore when not zero, it fails if validBefore is
+// already past
+func capTTL(signReq *request.SignRequest, validBefore time.Time) error {
+	if validBefore.IsZero() {
+		return nil
+	}
+
+	ttl := int64(time.Until(validBefore).Seconds())
+	if ttl <= 0 {
+		return fmt.Errorf("principals expired at %s", validBefore.Format(time.RFC3339))
+	}
+	if signReq.TTL == 0 || signReq.TTL > ttl {
+		signReq.TTL = ttl
+	}
+
+	return nil
+}
+
+// authExtensions returns certificate extensions describing the initial authentication of
+// identity, checked by renewals
+func authExtensions(identity *authenticator.Identity) map[string]string {
+	extensions := map[string]string{signer.AuthTimeExtension: strconv.FormatInt(identity.AuthTime.Unix(), 10)}
+	if identity.Source != "" {
+		extensions[signer.AuthSourceExtension] = identity.Source
+	}
+	if tokenID := identity.Attribute("token_id"); tokenID != "" {
+		extensions[signer.TokenIDExtension] = tokenID
+	}
+
+	return extensions
+}
+
+// loadPrincipals returns principals of user of signReq, the returned context holds their
+// validity (see princsPkg.ValidBefore)
+func loadPrincipals(ctx context.Context, signReq *request.SignRequest, logger *logrus.Entry) (context.Context, []string, error) {
+	ctx = princsPkg.WithValidity(ctx)
+
+	// providers are queried concurrently, their principals are combined in their order
+	type lookup struct {
+		principals []string
+		err        error
+	}
+	lookups := make([]lookup, len(config.Princs))
+	var wg sync.WaitGroup
+	for i, princsProvider := range config.Princs {
+		wg.Go(func() {
+			_, princs, err := princsProvider.Get(ctx, signReq)
+			lookups[i] = lookup{princs, err}
+		})
+	}
+	wg.Wait()
+
 	principals := []string{}
-	for _, princsProvider := range config.Princs {
-		_, princs, err := princsProvider.Get(ctx, body)
+	first := true
+	for i, lookup := range lookups {
+		princs, err := lookup.principals, lookup.err
 		if err != nil {
-			// actually, this isn't an error, next provider can return principals
 			var principalsNotFoundError *princsPkg.NotFoundError
-			if errors.As(err, &principalsNotFoundError) {
+			provider, _ := config.Princs[i].(*princsPkg.Provider)
+			switch {
+			case errors.As(err, &principalsNotFoundError):
+				// actually, this isn't an error, next provider can return principals.
 				// let admin known that this provider didn't return principals
 				logger.Info(err.Error())
+				princs = []string{}
+			case provider != nil && provider.Optional:
+				logger.WithError(err).WithField("provider", provider.Type).Warn("Ignoring failure of optional principals provider")
 				continue
+			default:
+				return ctx, []string{}, err
 			}
-			return ctx, []string{}, err
 		}
 
-		principals = append(principals, princs...)
+		if config.PrincipalsMode == PrincipalsIntersection && !first {
+			principals = slices.DeleteFunc(principals, func(principal string) bool {
+				return !slices.Contains(princs, principal)
+			})
+			continue
+		}
+		first = false
+
+		for _, principal := range princs {
+			if !slices.Contains(principals, principal) {
+				principals = append(principals, principal)
+			}
+		}
+		if config.PrincipalsMode == PrincipalsFirstMatch && len(principals) > 0 {
+			break
+		}
+	}
+
+	principals, err := config.PrincipalsRules.Apply(principals)
+	if err != nil {
+		return ctx, []string{}, err
 	}
 
 	if len(principals) == 0 {
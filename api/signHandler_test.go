@@ -4,15 +4,27 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/authenticator/token"
 	"github.com/signmykeyio/signmykey/builtin/principals"
+	"github.com/signmykeyio/signmykey/builtin/principals/rules"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/builtin/signer"
+	localSign "github.com/signmykeyio/signmykey/builtin/signer/local"
+	"github.com/signmykeyio/signmykey/util"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestSignHandler(t *testing.T) {
@@ -32,37 +44,61 @@ func TestSignHandler(t *testing.T) {
 		{"DELETE", "/v1/sign", 405, []byte(""), nil, ""},
 		{
 			"POST", "/v1/sign", 401,
-			[]byte(`{"user":"baduser","password":"badpassword","public_key":"goodkey"}`),
+			[]byte(`{"user":"baduser","password":"badpassword","public_key":"` + goodKey + `"}`),
 			JSONResponse{"error": "login failed"},
 			"application/json",
 		},
 		{
 			"POST", "/v1/sign", 401,
-			[]byte(`{"user":"testuser","password":"badpassword","public_key":"goodkey"}`),
+			[]byte(`{"user":"testuser","password":"badpassword","public_key":"` + goodKey + `"}`),
 			JSONResponse{"error": "login failed"},
 			"application/json",
 		},
+		{
+			"POST", "/v1/sign", 403,
+			[]byte(`{"user":"disableduser","password":"testpassword","public_key":"` + goodKey + `"}`),
+			JSONResponse{"error": "login denied: account disabled"},
+			"application/json",
+		},
 		{
 			"POST", "/v1/sign", 401,
-			[]byte(`{"user":"emptyprincsuser","password":"testpassword","public_key":"goodkey"}`),
+			[]byte(`{"user":"emptyprincsuser","password":"testpassword","public_key":"` + goodKey + `"}`),
 			JSONResponse{"error": "error getting list of principals"},
 			"application/json",
 		},
 		{
 			"POST", "/v1/sign", 401,
-			[]byte(`{"user":"emptyallprincsuser","password":"testpassword","public_key":"goodkey"}`),
+			[]byte(`{"user":"emptyallprincsuser","password":"testpassword","public_key":"` + goodKey + `"}`),
 			JSONResponse{"error": "error getting list of principals"},
 			"application/json",
 		},
 		{
 			"POST", "/v1/sign", 400,
-			[]byte(`{"user":"testuser","password":"testpassword","public_key":"badkey"}`),
+			[]byte(`{"user":"testuser","password":"testpassword","public_key":"` + badKey + `"}`),
 			JSONResponse{"error": "unknown server error during key signing"},
 			"application/json",
 		},
+		{
+			"POST", "/v1/sign", 400,
+			[]byte(`{"user":"testuser","password":"testpassword","public_key":"invalidkey"}`),
+			JSONResponse{"error": "invalid sign request"},
+			"application/json",
+		},
+		{
+			"POST", "/v1/sign", 403,
+			[]byte(`{"user":"testuser","password":"testpassword","public_key":"` + goodKey + `","principals":["admin"]}`),
+			JSONResponse{"error": "requested principals not allowed"},
+			"application/json",
+		},
 		{
 			"POST", "/v1/sign", 200,
-			[]byte(`{"user":"testuser","password":"testpassword","public_key":"goodkey"}`),
+			[]byte(`{"user":"testuser","password":"testpassword","public_key":"` + goodKey + `","principals":["user"]}`),
+			JSONResponse{"certificate": "goodcert"},
+			"application/json",
+		},
+		{
+			"POST", "/v1/sign", 200,
+			[]byte(`{"user":"testuser","password":"testpassword","public_key":"` + goodKey + `"}`),
 			JSONResponse{"certificate": "goodcert"},
 			"application/json",
 		},
@@ -97,32 +133,42 @@ func TestSignHandler(t *testing.T) {
 	}
 }
 
+const (
+	goodKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDBiKBPRB6uhYGJl6Uc50HsHRddmij5ZRulLmf2AaOQS"
+	badKey  = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIP8M5UJVHHGxMrGaBace8kx8Kq0okJ/2QQTFRbiTHVxk"
+)
+
 type authMock struct{}
 
-func (a authMock) Login(ctx context.Context, payload []byte) (context.Context, bool, string, error) {
-	var login struct {
-		User     string `json:"user" binding:"required"`
-		Password string `json:"password" binding:"required"`
-	}
-	err := json.Unmarshal(payload, &login)
-	if _, ok := err.(*json.SyntaxError); ok {
-		log.Errorf("invalid json request body: %s", err)
-		return ctx, false, "", fmt.Errorf("invalid json request body: %w", err)
-	}
-	if err != nil {
-		log.Errorf("json unmarshaling failed: %s", err)
-		return ctx, false, "", fmt.Errorf("JSON unmarshaling failed: %w", err)
+func (a authMock) Login(ctx context.Context, req *request.SignRequest) (context.Context, bool, string, error) {
+	if req.Token == "goodtoken" {
+		identity := authenticator.NewIdentity("token", "ci", "token-ci")
+		identity.Principals = []string{"user", "deploy"}
+		identity.MaxTTL = time.Minute
+		identity.Groups = []string{"approvers"}
+		return authenticator.WithIdentity(ctx, identity), true, identity.ID, nil
 	}
 
-	if login.User != "testuser" && login.User != "emptyprincsuser" && login.User != "emptyallprincsuser" {
+	if req.User != "testuser" && req.User != "otheruser" && req.User != "emptyprincsuser" && req.User != "emptyallprincsuser" && req.User != "disableduser" {
 		return ctx, false, "", fmt.Errorf("unknown username")
 	}
 
-	if login.Password != "testpassword" {
+	if req.Password != "testpassword" {
 		return ctx, false, "", fmt.Errorf("invalid password")
 	}
 
-	return ctx, true, "", nil
+	if req.User == "disableduser" {
+		return ctx, false, "", authenticator.NewDeniedError("account disabled")
+	}
+
+	groups := map[string][]string{"testuser": {"admins", "approvers"}, "otheruser": {"approvers"}}
+	if userGroups, ok := groups[req.User]; ok {
+		identity := authenticator.NewIdentity("", req.User, "mock-"+req.User)
+		identity.Groups = userGroups
+		return authenticator.WithIdentity(ctx, identity), true, identity.ID, nil
+	}
+
+	return ctx, true, "mock-" + req.User, nil
 }
 
 func (a authMock) Init(config *viper.Viper) error {
@@ -135,26 +181,12 @@ func (p princsMock) Init(config *viper.Viper) error {
 	return nil
 }
 
-func (p princsMock) Get(ctx context.Context, payload []byte) (context.Context, []string, error) {
-	var login struct {
-		User     string `json:"user" binding:"required"`
-		Password string `json:"password" binding:"required"`
-	}
-	err := json.Unmarshal(payload, &login)
-	if _, ok := err.(*json.SyntaxError); ok {
-		log.Errorf("invalid json request body: %s", err)
-		return ctx, []string{}, fmt.Errorf("invalid json request body: %w", err)
-	}
-	if err != nil {
-		log.Errorf("json unmarshaling failed: %s", err)
-		return ctx, []string{}, fmt.Errorf("JSON unmarshaling failed: %w", err)
-	}
-
-	if login.User == "emptyprincsuser" {
+func (p princsMock) Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error) {
+	if req.User == "emptyprincsuser" {
 		return ctx, []string{}, principals.NewNotFoundError("mock", "empty list of principals")
 	}
 
-	if login.User == "emptyallprincsuser" {
+	if req.User == "emptyallprincsuser" {
 		return ctx, []string{}, fmt.Errorf("empty list of principals")
 	}
 
@@ -171,23 +203,461 @@ func (s signerMock) ReadCA(ctx context.Context) (string, error) {
 	return "", nil
 }
 
-func (s signerMock) Sign(ctx context.Context, payload []byte, id string, principals []string) (string, error) {
-	var pubkey struct {
-		PubKey string `json:"public_key" binding:"required"`
-	}
-	err := json.Unmarshal(payload, &pubkey)
-	if err != nil {
-		log.Errorf("json unmarshaling failed: %s", err)
-		return "", fmt.Errorf("JSON unmarshaling failed: %w", err)
-	}
-
-	if pubkey.PubKey == "goodkey" {
+func (s signerMock) Sign(ctx context.Context, req *request.SignRequest, id string, principals []string) (string, error) {
+	if req.PublicKey == goodKey {
 		return "goodcert", nil
 	}
 
-	if pubkey.PubKey == "badkey" {
+	if req.PublicKey == badKey {
 		return "", fmt.Errorf("bad key format")
 	}
 
 	return "", fmt.Errorf("failed to sign key")
 }
+
+func TestSignHandlerKeyProof(t *testing.T) {
+	caSigner := newTestSSHSigner(t)
+	userSigner := newTestSSHSigner(t)
+	otherSigner := newTestSSHSigner(t)
+	pubKey := string(ssh.MarshalAuthorizedKey(userSigner.PublicKey()))
+
+	proof := func(key ssh.Signer, namespace string) (string, string) {
+		nonce := util.IssueNonce()
+		sig, err := util.SSHSign(key, namespace, []byte(nonce))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nonce, string(sig)
+	}
+
+	cases := []struct {
+		description string
+		required    bool
+		signer      ssh.Signer
+		namespace   string
+		code        int
+	}{
+		{"proof not required", false, nil, "", 200},
+		{"proof required but missing", true, nil, "", 401},
+		{"proof signed by another key", true, otherSigner, KeyProofNamespace, 401},
+		{"proof signed in another namespace", true, userSigner, RenewNamespace, 401},
+		{"valid proof", true, userSigner, KeyProofNamespace, 200},
+	}
+
+	for _, c := range cases {
+		config = Config{
+			Auth:             &authMock{},
+			Princs:           []principals.Principals{&princsMock{}},
+			Signer:           &localSign.Signer{CACert: caSigner.PublicKey(), CAKey: caSigner, TTL: 600},
+			KeyProofRequired: c.required,
+		}
+		router := Router(log.New())
+
+		signReq := request.SignRequest{User: "testuser", Password: "testpassword", PublicKey: pubKey}
+		if c.signer != nil {
+			signReq.ProofNonce, signReq.ProofSignature = proof(c.signer, c.namespace)
+		}
+		payload, _ := json.Marshal(signReq)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/sign", bytes.NewBuffer(payload))
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, c.code, w.Code, c.description)
+	}
+}
+
+// newTestTokens returns API tokens Authenticator of a new tokens file holding the tokens
+// of names, and their secrets
+func newTestTokens(t *testing.T, names ...string) (*token.Authenticator, []string) {
+	tokensFile := filepath.Join(t.TempDir(), "tokens.json")
+	tokens := []token.Token{}
+	secrets := []string{}
+	for _, name := range names {
+		secret, tok, err := token.NewToken(tokens, name, []string{"deploy"}, time.Minute, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, tok)
+		secrets = append(secrets, secret)
+	}
+	if err := token.WriteTokens(tokensFile, tokens); err != nil {
+		t.Fatal(err)
+	}
+
+	tokensOpts := viper.New()
+	tokensOpts.Set("tokensFile", tokensFile)
+	auth := &token.Authenticator{}
+	if err := auth.Init(tokensOpts); err != nil {
+		t.Fatal(err)
+	}
+
+	return auth, secrets
+}
+
+func TestSignHandlerTokens(t *testing.T) {
+	tokens, secrets := newTestTokens(t, "ci")
+	config = Config{
+		Auth:   &authMock{},
+		Princs: []principals.Principals{&staticPrincsMock{"deploy", "root"}},
+		Signer: &signerMock{},
+		Tokens: tokens,
+	}
+	router := Router(log.New())
+
+	cases := []struct {
+		description string
+		token       string
+		payload     string
+		code        int
+	}{
+		{"password", "", `{"user":"testuser","password":"testpassword","public_key":"` + goodKey + `"}`, 200},
+		{"API token", secrets[0], `{"public_key":"` + goodKey + `"}`, 200},
+		{"invalid API token", "smk_00000000_secret", `{"public_key":"` + goodKey + `"}`, 401},
+		// other bearer tokens are checked by Authenticator
+		{"Authenticator token", "goodtoken", `{"public_key":"` + goodKey + `"}`, 200},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v1/sign", bytes.NewBufferString(c.payload))
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, c.code, w.Code, c.description)
+	}
+}
+
+func TestSignHandlerTokenScope(t *testing.T) {
+	caSigner := newTestSSHSigner(t)
+	userSigner := newTestSSHSigner(t)
+	pubKey := string(ssh.MarshalAuthorizedKey(userSigner.PublicKey()))
+
+	config = Config{
+		Auth:   &authMock{},
+		Princs: []principals.Principals{&princsMock{}},
+		Signer: &localSign.Signer{CACert: caSigner.PublicKey(), CAKey: caSigner, TTL: 600},
+	}
+	router := Router(log.New())
+
+	cases := []struct {
+		description string
+		token       string
+		payload     request.SignRequest
+		code        int
+		principals  []string
+		ttl         time.Duration
+	}{
+		{"no token nor user", "", request.SignRequest{PublicKey: pubKey}, 400, nil, 0},
+		{"token scope", "goodtoken", request.SignRequest{PublicKey: pubKey}, 200, []string{"user"}, time.Minute},
+		{"shorter ttl", "goodtoken", request.SignRequest{PublicKey: pubKey, TTL: 30}, 200, []string{"user"}, 30 * time.Second},
+		{"longer ttl", "goodtoken", request.SignRequest{PublicKey: pubKey, TTL: 300}, 200, []string{"user"}, time.Minute},
+		{"principal out of scope", "goodtoken", request.SignRequest{PublicKey: pubKey, Principals: []string{"root"}}, 403, nil, 0},
+	}
+
+	for _, c := range cases {
+		payload, _ := json.Marshal(c.payload)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/sign", bytes.NewBuffer(payload))
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, c.code, w.Code, c.description)
+		if c.code != 200 {
+			continue
+		}
+
+		var response map[string]string
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response), c.description)
+		parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(response["certificate"]))
+		if !assert.NoError(t, err, c.description) {
+			continue
+		}
+		cert := parsed.(*ssh.Certificate)
+		assert.Equal(t, c.principals, cert.ValidPrincipals, c.description)
+		assert.Equal(t, "token-ci", cert.KeyId, c.description)
+		// certificates are valid since one minute before signing
+		validity := time.Unix(int64(cert.ValidBefore), 0).Sub(time.Unix(int64(cert.ValidAfter), 0))
+		assert.InDelta(t, (c.ttl + time.Minute).Seconds(), validity.Seconds(), 2, c.description)
+	}
+}
+
+func TestSignHandlerPrincipalsRules(t *testing.T) {
+	caSigner := newTestSSHSigner(t)
+	userSigner := newTestSSHSigner(t)
+	pubKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(userSigner.PublicKey())))
+
+	pipeline := &rules.Pipeline{
+		Rename: []rules.Rename{{Match: "^root$", Replace: "admin"}},
+		Expand: []rules.Expansion{{Principal: "user", Principals: []string{"deploy", "web", "admin"}}},
+		Deny:   []string{"web"},
+	}
+	assert.NoError(t, pipeline.Compile())
+
+	config = Config{
+		Auth:            &authMock{},
+		Princs:          []principals.Principals{&princsMock{}},
+		Signer:          &localSign.Signer{CACert: caSigner.PublicKey(), CAKey: caSigner, TTL: 600},
+		PrincipalsRules: pipeline,
+	}
+	router := Router(log.New())
+
+	sign := func() *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(request.SignRequest{User: "testuser", Password: "testpassword", PublicKey: pubKey})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/sign", bytes.NewBuffer(payload))
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := sign()
+	assert.Equal(t, 200, w.Code)
+	var response map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(response["certificate"]))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"admin", "deploy"}, parsed.(*ssh.Certificate).ValidPrincipals)
+	}
+
+	pipeline.Required = []string{"wheel"}
+	w = sign()
+	assert.Equal(t, 401, w.Code)
+	assert.JSONEq(t, `{"error":"error getting list of principals"}`, w.Body.String())
+}
+
+// staticPrincsMock returns its principals to every user, or a NotFoundError if empty
+type staticPrincsMock []string
+
+func (p staticPrincsMock) Init(config *viper.Viper) error {
+	return nil
+}
+
+func (p staticPrincsMock) Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error) {
+	if len(p) == 0 {
+		return ctx, []string{}, principals.NewNotFoundError("static", "empty list of principals")
+	}
+
+	return ctx, p, nil
+}
+
+func TestLoadPrincipalsModes(t *testing.T) {
+	cases := []struct {
+		description string
+		mode        string
+		princs      []principals.Principals
+		expected    []string
+	}{
+		{"merge", PrincipalsMerge, []principals.Principals{
+			staticPrincsMock{"a", "b", "a"}, staticPrincsMock{}, staticPrincsMock{"c", "b"},
+		}, []string{"a", "b", "c"}},
+		{"default merge", "", []principals.Principals{
+			staticPrincsMock{"a"}, staticPrincsMock{"b", "a"},
+		}, []string{"a", "b"}},
+		{"first match", PrincipalsFirstMatch, []principals.Principals{
+			staticPrincsMock{}, staticPrincsMock{"b", "c", "b"}, staticPrincsMock{"d"},
+		}, []string{"b", "c"}},
+		{"first match none", PrincipalsFirstMatch, []principals.Principals{
+			staticPrincsMock{}, staticPrincsMock{},
+		}, nil},
+		{"intersection", PrincipalsIntersection, []principals.Principals{
+			staticPrincsMock{"a", "b", "c", "a"}, staticPrincsMock{"c", "a", "d"}, staticPrincsMock{"a", "c"},
+		}, []string{"a", "c"}},
+		{"intersection disagreement", PrincipalsIntersection, []principals.Principals{
+			staticPrincsMock{"a", "b"}, staticPrincsMock{"c"},
+		}, nil},
+		{"intersection not found", PrincipalsIntersection, []principals.Principals{
+			staticPrincsMock{"a", "b"}, staticPrincsMock{}, staticPrincsMock{"a"},
+		}, nil},
+	}
+
+	for _, c := range cases {
+		config = Config{Princs: c.princs, PrincipalsMode: c.mode}
+
+		_, principals, err := loadPrincipals(context.Background(), &request.SignRequest{User: "testuser"}, log.NewEntry(log.New()))
+		if c.expected == nil {
+			assert.EqualError(t, err, "no principals found", c.description)
+			continue
+		}
+		assert.NoError(t, err, c.description)
+		assert.Equal(t, c.expected, principals, c.description)
+	}
+}
+
+// slowPrincsMock returns principals after delay, or an error if err is set
+type slowPrincsMock struct {
+	delay      time.Duration
+	principals []string
+	err        error
+}
+
+func (p slowPrincsMock) Init(config *viper.Viper) error {
+	return nil
+}
+
+func (p slowPrincsMock) Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error) {
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		return ctx, []string{}, ctx.Err()
+	}
+
+	return ctx, p.principals, p.err
+}
+
+func TestLoadPrincipalsProviders(t *testing.T) {
+	slow := func(princs ...string) principals.Principals {
+		return slowPrincsMock{delay: 100 * time.Millisecond, principals: princs}
+	}
+	timedOut := func(optional bool) principals.Principals {
+		return &principals.Provider{Principals: slow("c"), Type: "slow", Timeout: 10 * time.Millisecond, Optional: optional}
+	}
+	failing := func(optional bool) principals.Principals {
+		return &principals.Provider{Principals: slowPrincsMock{err: errors.New("server down")}, Type: "failing", Optional: optional}
+	}
+
+	cases := []struct {
+		description string
+		mode        string
+		princs      []principals.Principals
+		expected    []string
+		err         string
+	}{
+		{"concurrent", PrincipalsMerge, []principals.Principals{slow("a"), slow("b"), slow("a", "c")}, []string{"a", "b", "c"}, ""},
+		{"optional timed out", PrincipalsMerge, []principals.Principals{slow("a"), timedOut(true)}, []string{"a"}, ""},
+		{"required timed out", PrincipalsMerge, []principals.Principals{slow("a"), timedOut(false)}, nil, "slow principals provider: context deadline exceeded"},
+		{"optional failing", PrincipalsMerge, []principals.Principals{failing(true), slow("a")}, []string{"a"}, ""},
+		{"required failing", PrincipalsMerge, []principals.Principals{failing(false), slow("a")}, nil, "server down"},
+		{"optional failing intersection", PrincipalsIntersection, []principals.Principals{slow("a", "b"), failing(true), slow("b")}, []string{"b"}, ""},
+		{"optional failing first match", PrincipalsFirstMatch, []principals.Principals{failing(true), slow("a"), slow("b")}, []string{"a"}, ""},
+	}
+
+	for _, c := range cases {
+		config = Config{Princs: c.princs, PrincipalsMode: c.mode}
+
+		start := time.Now()
+		_, principals, err := loadPrincipals(context.Background(), &request.SignRequest{User: "testuser"}, log.NewEntry(log.New()))
+		// providers are queried concurrently, the lookup lasts as long as the slowest one
+		assert.Less(t, time.Since(start), 190*time.Millisecond, c.description)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.description)
+			continue
+		}
+		assert.NoError(t, err, c.description)
+		assert.Equal(t, c.expected, principals, c.description)
+	}
+}
+
+func TestCapTTL(t *testing.T) {
+	signReq := &request.SignRequest{TTL: 3600}
+	assert.NoError(t, capTTL(signReq, time.Time{}))
+	assert.Equal(t, int64(3600), signReq.TTL)
+
+	assert.NoError(t, capTTL(signReq, time.Now().Add(10*time.Minute+time.Second)))
+	assert.Equal(t, int64(600), signReq.TTL)
+
+	signReq.TTL = 0
+	assert.NoError(t, capTTL(signReq, time.Now().Add(time.Hour+time.Second)))
+	assert.Equal(t, int64(3600), signReq.TTL)
+
+	assert.Error(t, capTTL(signReq, time.Now().Add(-time.Minute)))
+}
+
+// legacy backends unmarshal their own struct from the JSON payload of sign requests
+type legacyPayload struct {
+	User      string `json:"user"`
+	Password  string `json:"password"`
+	PublicKey string `json:"public_key"`
+}
+
+type legacyAuthMock struct{}
+
+func (a legacyAuthMock) Init(config *viper.Viper) error {
+	return nil
+}
+
+func (a legacyAuthMock) Login(ctx context.Context, payload []byte) (context.Context, bool, string, error) {
+	var login legacyPayload
+	if err := json.Unmarshal(payload, &login); err != nil {
+		return ctx, false, "", err
+	}
+	if login.User != "legacyuser" || login.Password != "testpassword" {
+		return ctx, false, "", fmt.Errorf("invalid credentials")
+	}
+
+	return ctx, true, login.User, nil
+}
+
+type legacyPrincsMock struct{}
+
+func (p legacyPrincsMock) Init(config *viper.Viper) error {
+	return nil
+}
+
+func (p legacyPrincsMock) Get(ctx context.Context, payload []byte) (context.Context, []string, error) {
+	var login legacyPayload
+	if err := json.Unmarshal(payload, &login); err != nil {
+		return ctx, []string{}, err
+	}
+
+	return ctx, []string{login.User + "-admin"}, nil
+}
+
+type legacySignerMock struct{}
+
+func (s legacySignerMock) Init(config *viper.Viper) error {
+	return nil
+}
+
+func (s legacySignerMock) ReadCA(ctx context.Context) (string, error) {
+	return "legacyca", nil
+}
+
+func (s legacySignerMock) Sign(ctx context.Context, payload []byte, id string, principals []string) (string, error) {
+	var login legacyPayload
+	if err := json.Unmarshal(payload, &login); err != nil {
+		return "", err
+	}
+	if login.PublicKey != goodKey {
+		return "", fmt.Errorf("bad public key")
+	}
+
+	return "legacycert " + id + " " + strings.Join(principals, ","), nil
+}
+
+func TestSignHandlerLegacy(t *testing.T) {
+	config = Config{
+		Auth:   authenticator.FromLegacy(legacyAuthMock{}),
+		Princs: []principals.Principals{principals.FromLegacy(legacyPrincsMock{})},
+		Signer: signer.FromLegacy(legacySignerMock{}),
+	}
+	router := Router(log.New())
+
+	cases := []struct {
+		description string
+		payload     string
+		code        int
+		cert        string
+	}{
+		{"valid request", `{"user":"legacyuser","password":"testpassword","public_key":"` + goodKey + `"}`, 200, "legacycert legacyuser legacyuser-admin"},
+		{"bad password", `{"user":"legacyuser","password":"badpassword","public_key":"` + goodKey + `"}`, 401, ""},
+		{"bad public key", `{"user":"legacyuser","password":"testpassword","public_key":"` + badKey + `"}`, 400, ""},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/sign", bytes.NewBufferString(c.payload)))
+		assert.Equal(t, c.code, w.Code, c.description)
+
+		var response map[string]string
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, c.cert, response["certificate"], c.description)
+	}
+
+	ca, err := config.Signer.ReadCA(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "legacyca", ca)
+}
@@ -0,0 +1,231 @@
+package approval
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Statuses of approval requests
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusDenied   = "denied"
+	StatusExpired  = "expired"
+	StatusFailed   = "failed"
+)
+
+// ErrNotFound is returned by Store when an approval request doesn't exist
+var ErrNotFound = errors.New("approval request not found")
+
+// Store is the interface that wrap the storage of approval requests.
+type Store interface {
+	Init(config *viper.Viper) error
+	// Create stores a new approval request
+	Create(ctx context.Context, req *Request) error
+	// Get returns a copy of approval request id, pending requests past their expiration
+	// are returned with StatusExpired
+	Get(ctx context.Context, id string) (*Request, error)
+	// Update atomically applies fn to approval request id and stores it if fn succeeds
+	Update(ctx context.Context, id string, fn func(req *Request) error) (*Request, error)
+}
+
+// Rule represents principals needing approval before being signed
+type Rule struct {
+	// Principals requiring approval, a certificate with any of them must be approved
+	Principals []string `mapstructure:"principals"`
+	// Approvals is the number of distinct approvers needed
+	Approvals int `mapstructure:"approvals"`
+	// ApproverGroups are the groups allowed to approve or deny requests
+	ApproverGroups []string `mapstructure:"approverGroups"`
+	// TTL is the validity of pending requests
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// Validate fields of approval rule
+func (r Rule) Validate() error {
+	if len(r.Principals) == 0 {
+		return errors.New("empty principals of approval rule")
+	}
+	if r.Approvals < 1 || r.Approvals > 2 {
+		return errors.New("approvals of approval rule must be 1 or 2")
+	}
+	if len(r.ApproverGroups) == 0 {
+		return errors.New("empty approverGroups of approval rule")
+	}
+	if r.TTL <= 0 {
+		return errors.New("ttl of approval rule must be a positive duration")
+	}
+
+	return nil
+}
+
+// Match returns the first rule of rules matching principals
+func Match(rules []Rule, principals []string) (Rule, bool) {
+	for _, rule := range rules {
+		for _, principal := range principals {
+			if slices.Contains(rule.Principals, principal) {
+				return rule, true
+			}
+		}
+	}
+
+	return Rule{}, false
+}
+
+// Decision represents the approval or denial of a request by an approver
+type Decision struct {
+	Approver string    `json:"approver"`
+	Time     time.Time `json:"time"`
+	Comment  string    `json:"comment,omitempty"`
+}
+
+// Request represents a sign request waiting for approval
+type Request struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	// User is the ID of the requester, used as certificate key ID
+	User       string    `json:"user"`
+	Username   string    `json:"username"`
+	AuthTime   time.Time `json:"auth_time"`
+	Principals []string  `json:"principals"`
+	PublicKey  string    `json:"public_key"`
+	TTL        int64     `json:"ttl,omitempty"`
+	// ValidBefore is the time principals stop being valid, like granted principals
+	ValidBefore time.Time `json:"valid_before,omitzero"`
+
+	Required       int        `json:"required_approvals"`
+	ApproverGroups []string   `json:"approver_groups"`
+	Approvals      []Decision `json:"approvals,omitempty"`
+	Denial         *Decision  `json:"denial,omitempty"`
+
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+
+	Certificate string `json:"certificate,omitempty"`
+	// SecretHash is the SHA-256 hash of the secret given to the requester only, needed to
+	// read the request and its certificate
+	SecretHash string `json:"-"`
+}
+
+// SecretHeader is the HTTP header holding the secret of a request when reading it
+const SecretHeader = "X-Signmykey-Request-Secret"
+
+// NewRequest creates new pending approval request of rule, with a random ID
+func NewRequest(rule Rule, now time.Time) *Request {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return &Request{
+		ID:             hex.EncodeToString(id),
+		Status:         StatusPending,
+		Required:       rule.Approvals,
+		ApproverGroups: rule.ApproverGroups,
+		Created:        now,
+		Expires:        now.Add(rule.TTL),
+	}
+}
+
+// NewSecret sets a new random secret of request and returns it
+func (r *Request) NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(hex.EncodeToString(secret)))
+	r.SecretHash = hex.EncodeToString(hash[:])
+
+	return hex.EncodeToString(secret), nil
+}
+
+// CheckSecret returns true if secret is the secret of request
+func (r *Request) CheckSecret(secret string) bool {
+	if r.SecretHash == "" || secret == "" {
+		return false
+	}
+	hash := sha256.Sum256([]byte(secret))
+
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(hash[:])), []byte(r.SecretHash)) == 1
+}
+
+// Redacted returns a copy of request without its certificate, shown to other users than
+// the requester
+func (r *Request) Redacted() *Request {
+	c := r.Clone()
+	c.Certificate = ""
+
+	return c
+}
+
+// Clone returns a deep copy of request
+func (r *Request) Clone() *Request {
+	c := *r
+	c.Principals = slices.Clone(r.Principals)
+	c.ApproverGroups = slices.Clone(r.ApproverGroups)
+	c.Approvals = slices.Clone(r.Approvals)
+	if r.Denial != nil {
+		denial := *r.Denial
+		c.Denial = &denial
+	}
+
+	return &c
+}
+
+// Expire sets StatusExpired on pending request past its expiration
+func (r *Request) Expire(now time.Time) {
+	if r.Status == StatusPending && !now.Before(r.Expires) {
+		r.Status = StatusExpired
+	}
+}
+
+// Approve records approval of approver and returns true when enough approvals are recorded
+func (r *Request) Approve(approver, comment string, now time.Time) (bool, error) {
+	if err := r.checkDecision(approver); err != nil {
+		return false, err
+	}
+
+	r.Approvals = append(r.Approvals, Decision{Approver: approver, Time: now, Comment: comment})
+	if len(r.Approvals) >= r.Required {
+		r.Status = StatusApproved
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// Deny records denial of approver
+func (r *Request) Deny(approver, comment string, now time.Time) error {
+	if err := r.checkDecision(approver); err != nil {
+		return err
+	}
+
+	r.Denial = &Decision{Approver: approver, Time: now, Comment: comment}
+	r.Status = StatusDenied
+
+	return nil
+}
+
+func (r *Request) checkDecision(approver string) error {
+	if r.Status != StatusPending {
+		return errors.New("approval request is " + r.Status)
+	}
+	if approver == r.User {
+		return errors.New("requester can't approve its own request")
+	}
+	for _, approval := range r.Approvals {
+		if approval.Approver == approver {
+			return errors.New("request already approved by " + approver)
+		}
+	}
+
+	return nil
+}
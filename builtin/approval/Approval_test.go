@@ -0,0 +1,107 @@
+package approval
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleValidate(t *testing.T) {
+	cases := []struct {
+		rule Rule
+		err  string
+	}{
+		{Rule{Approvals: 1, ApproverGroups: []string{"admins"}, TTL: time.Minute}, "empty principals of approval rule"},
+		{Rule{Principals: []string{"root"}, Approvals: 3, ApproverGroups: []string{"admins"}, TTL: time.Minute}, "approvals of approval rule must be 1 or 2"},
+		{Rule{Principals: []string{"root"}, Approvals: 1, TTL: time.Minute}, "empty approverGroups of approval rule"},
+		{Rule{Principals: []string{"root"}, Approvals: 1, ApproverGroups: []string{"admins"}}, "ttl of approval rule must be a positive duration"},
+		{Rule{Principals: []string{"root"}, Approvals: 2, ApproverGroups: []string{"admins"}, TTL: time.Minute}, ""},
+	}
+
+	for _, c := range cases {
+		err := c.rule.Validate()
+		if c.err == "" {
+			assert.NoError(t, err)
+			continue
+		}
+		assert.EqualError(t, err, c.err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rules := []Rule{
+		{Principals: []string{"root"}, Approvals: 2},
+		{Principals: []string{"root", "admin"}, Approvals: 1},
+	}
+
+	rule, ok := Match(rules, []string{"user", "admin"})
+	assert.True(t, ok)
+	assert.Equal(t, 1, rule.Approvals)
+
+	rule, ok = Match(rules, []string{"admin", "root"})
+	assert.True(t, ok)
+	assert.Equal(t, 2, rule.Approvals)
+
+	_, ok = Match(rules, []string{"user"})
+	assert.False(t, ok)
+}
+
+func TestRequestDecisions(t *testing.T) {
+	now := time.Now()
+	rule := Rule{Principals: []string{"root"}, Approvals: 2, ApproverGroups: []string{"admins"}, TTL: time.Minute}
+
+	req := NewRequest(rule, now)
+	req.User = "ldap-alice"
+	assert.Len(t, req.ID, 32)
+	assert.Equal(t, StatusPending, req.Status)
+	assert.NotEqual(t, req.ID, NewRequest(rule, now).ID)
+
+	_, err := req.Approve("ldap-alice", "", now)
+	assert.EqualError(t, err, "requester can't approve its own request")
+
+	approved, err := req.Approve("ldap-bob", "", now)
+	assert.NoError(t, err)
+	assert.False(t, approved)
+	assert.Equal(t, StatusPending, req.Status)
+
+	_, err = req.Approve("ldap-bob", "", now)
+	assert.EqualError(t, err, "request already approved by ldap-bob")
+
+	approved, err = req.Approve("ldap-carol", "incident #42", now)
+	assert.NoError(t, err)
+	assert.True(t, approved)
+	assert.Equal(t, StatusApproved, req.Status)
+
+	assert.EqualError(t, req.Deny("ldap-dave", "", now), "approval request is approved")
+
+	req = NewRequest(rule, now)
+	assert.NoError(t, req.Deny("ldap-bob", "not during freeze", now))
+	assert.Equal(t, StatusDenied, req.Status)
+	assert.Equal(t, "not during freeze", req.Denial.Comment)
+
+	req = NewRequest(rule, now)
+	req.Expire(now.Add(30 * time.Second))
+	assert.Equal(t, StatusPending, req.Status)
+	req.Expire(now.Add(time.Minute))
+	assert.Equal(t, StatusExpired, req.Status)
+	_, err = req.Approve("ldap-bob", "", now)
+	assert.EqualError(t, err, "approval request is expired")
+}
+
+func TestRequestSecret(t *testing.T) {
+	req := NewRequest(Rule{Principals: []string{"root"}, Approvals: 1, ApproverGroups: []string{"admins"}, TTL: time.Minute}, time.Now())
+	assert.False(t, req.CheckSecret(""))
+
+	secret, err := req.NewSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 64)
+	assert.NotContains(t, req.SecretHash, secret)
+	assert.True(t, req.CheckSecret(secret))
+	assert.False(t, req.CheckSecret("bad"))
+	assert.False(t, req.CheckSecret(""))
+
+	req.Certificate = "cert"
+	assert.Empty(t, req.Redacted().Certificate)
+	assert.Equal(t, "cert", req.Certificate)
+}
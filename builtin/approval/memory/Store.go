@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/approval"
+	"github.com/spf13/viper"
+)
+
+// Store struct represents an in memory approval Store, requests are local to the server and
+// lost on restart.
+type Store struct {
+	// Retention is the duration requests are kept after their expiration, so that clients
+	// can still read their status
+	Retention time.Duration
+
+	mu          sync.Mutex
+	requests    map[string]*approval.Request
+	lastCleanup time.Time
+}
+
+// Init method is used to ingest config of Store
+func (s *Store) Init(config *viper.Viper) error {
+	config.SetDefault("retention", "1h")
+	s.Retention = config.GetDuration("retention")
+	s.requests = map[string]*approval.Request{}
+
+	return nil
+}
+
+// Create method is used to store a new approval request
+func (s *Store) Create(ctx context.Context, req *approval.Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanup(time.Now())
+	s.requests[req.ID] = req.Clone()
+
+	return nil
+}
+
+// Get method is used to read an approval request
+func (s *Store) Get(ctx context.Context, id string) (*approval.Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, ok := s.requests[id]
+	if !ok {
+		return nil, approval.ErrNotFound
+	}
+	req.Expire(time.Now())
+
+	return req.Clone(), nil
+}
+
+// Update method is used to change an approval request
+func (s *Store) Update(ctx context.Context, id string, fn func(req *approval.Request) error) (*approval.Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.requests[id]
+	if !ok {
+		return nil, approval.ErrNotFound
+	}
+	stored.Expire(time.Now())
+
+	req := stored.Clone()
+	if err := fn(req); err != nil {
+		return nil, err
+	}
+	s.requests[id] = req
+
+	return req.Clone(), nil
+}
+
+// cleanup removes requests expired since Retention, at most once per minute.
+// Caller must hold s.mu.
+func (s *Store) cleanup(now time.Time) {
+	if now.Sub(s.lastCleanup) < time.Minute {
+		return
+	}
+	s.lastCleanup = now
+
+	for id, req := range s.requests {
+		if now.After(req.Expires.Add(s.Retention)) {
+			delete(s.requests, id)
+		}
+	}
+}
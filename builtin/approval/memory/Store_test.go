@@ -0,0 +1,61 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/approval"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store := &Store{}
+	assert.NoError(t, store.Init(viper.New()))
+	assert.Equal(t, time.Hour, store.Retention)
+
+	rule := approval.Rule{Principals: []string{"root"}, Approvals: 1, ApproverGroups: []string{"admins"}, TTL: time.Minute}
+	req := approval.NewRequest(rule, time.Now())
+	req.User = "ldap-alice"
+	req.Principals = []string{"root"}
+	assert.NoError(t, store.Create(ctx, req))
+
+	// stored requests are copies
+	req.Principals[0] = "user"
+	stored, err := store.Get(ctx, req.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"root"}, stored.Principals)
+
+	_, err = store.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, approval.ErrNotFound)
+	_, err = store.Update(ctx, "unknown", func(req *approval.Request) error { return nil })
+	assert.ErrorIs(t, err, approval.ErrNotFound)
+
+	// failed updates aren't stored
+	_, err = store.Update(ctx, req.ID, func(req *approval.Request) error {
+		req.Status = approval.StatusApproved
+		return errors.New("failed")
+	})
+	assert.EqualError(t, err, "failed")
+	stored, _ = store.Get(ctx, req.ID)
+	assert.Equal(t, approval.StatusPending, stored.Status)
+
+	updated, err := store.Update(ctx, req.ID, func(req *approval.Request) error {
+		_, err := req.Approve("ldap-bob", "", time.Now())
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, approval.StatusApproved, updated.Status)
+
+	// pending requests expire
+	rule.TTL = time.Millisecond
+	expiring := approval.NewRequest(rule, time.Now())
+	assert.NoError(t, store.Create(ctx, expiring))
+	time.Sleep(5 * time.Millisecond)
+	stored, err = store.Get(ctx, expiring.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, approval.StatusExpired, stored.Status)
+}
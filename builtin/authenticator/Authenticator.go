@@ -2,12 +2,122 @@ package authenticator
 
 import (
 	"context"
+	"time"
 
+	"github.com/signmykeyio/signmykey/builtin/request"
 	"github.com/spf13/viper"
 )
 
 // Authenticator is the interface that wrap the SMK Authentication logic.
 type Authenticator interface {
+	Init(config *viper.Viper) error
+	Login(ctx context.Context, req *request.SignRequest) (resultCtx context.Context, valid bool, id string, err error)
+}
+
+// LegacyAuthenticator is the interface of Authenticators reading the raw JSON payload of
+// sign requests, as before SignRequest was introduced
+type LegacyAuthenticator interface {
 	Init(config *viper.Viper) error
 	Login(ctx context.Context, payload []byte) (resultCtx context.Context, valid bool, id string, err error)
 }
+
+// FromLegacy returns an Authenticator calling a LegacyAuthenticator with the JSON payload of requests
+func FromLegacy(a LegacyAuthenticator) Authenticator {
+	return &legacyAuthenticator{legacy: a}
+}
+
+type legacyAuthenticator struct {
+	legacy LegacyAuthenticator
+}
+
+func (a *legacyAuthenticator) Init(config *viper.Viper) error {
+	return a.legacy.Init(config)
+}
+
+func (a *legacyAuthenticator) Login(ctx context.Context, req *request.SignRequest) (context.Context, bool, string, error) {
+	payload, err := req.JSON()
+	if err != nil {
+		return ctx, false, "", err
+	}
+
+	return a.legacy.Login(ctx, payload)
+}
+
+// TLSStateKeyType represents a TLS connection state context key type
+type TLSStateKeyType string
+
+// TLSStateKey represents the context key holding the *tls.ConnectionState of the client request
+const TLSStateKey TLSStateKeyType = "tlsState"
+
+// DeniedError is returned by Authenticator when user credentials are valid but user isn't
+// allowed to log in (ex: disabled account), its message is sent back to the user
+type DeniedError struct {
+	msg string
+}
+
+// NewDeniedError creates new DeniedError error with given reason
+func NewDeniedError(msg string) *DeniedError {
+	return &DeniedError{msg: msg}
+}
+
+func (e *DeniedError) Error() string {
+	return e.msg
+}
+
+// Identity represents a user authenticated by an Authenticator
+type Identity struct {
+	// Username is the user name sent by the client
+	Username string
+	// ID is the canonical identifier of the user, used as certificate key ID
+	ID string
+	// Source is the type of Authenticator which authenticated the user
+	Source string
+	// Groups of the user, when known by Authenticator
+	Groups []string
+	// Attributes of the user read by Authenticator (ex: mail, displayName)
+	Attributes map[string][]string
+	// AuthTime is the time of authentication
+	AuthTime time.Time
+
+	// Principals restricts certificate principals when not nil (ex: scope of API tokens)
+	Principals []string
+	// MaxTTL caps certificate validity when not zero
+	MaxTTL time.Duration
+}
+
+// NewIdentity creates new Identity of user authenticated now by source Authenticator
+func NewIdentity(source, username, id string) *Identity {
+	return &Identity{
+		Username:   username,
+		ID:         id,
+		Source:     source,
+		Attributes: map[string][]string{},
+		AuthTime:   time.Now(),
+	}
+}
+
+// Attribute returns the first value of attribute name, or an empty string
+func (i *Identity) Attribute(name string) string {
+	if values := i.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// IdentityKeyType represents an Identity context key type
+type IdentityKeyType string
+
+// IdentityKey represents the context key holding the *Identity of the authenticated user
+const IdentityKey IdentityKeyType = "identity"
+
+// WithIdentity returns a copy of ctx holding identity
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, IdentityKey, identity)
+}
+
+// IdentityFromContext returns the Identity held by ctx, if any
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(IdentityKey).(*Identity)
+	return identity, ok && identity != nil
+}
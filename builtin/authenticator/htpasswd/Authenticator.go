@@ -0,0 +1,217 @@
+package htpasswd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Authenticator struct represents htpasswd file Authenticator options.
+// Files are reloaded when their modification time or size change.
+type Authenticator struct {
+	File    string
+	OTPFile string
+
+	// OTP validates codes within the skew window and rejects replayed codes
+	OTP *util.OTPValidator
+
+	mu       sync.Mutex
+	users    map[string]string
+	otpSeeds map[string]string
+	fileStat fileStat
+	otpStat  fileStat
+}
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+// Init method is used to ingest config of Authenticator
+func (a *Authenticator) Init(config *viper.Viper) error {
+	if !config.IsSet("htpasswdFile") {
+		return errors.New("missing config entry \"htpasswdFile\" for Authenticator")
+	}
+
+	a.File = config.GetString("htpasswdFile")
+	a.OTPFile = config.GetString("otpFile")
+
+	config.SetDefault("otpSkew", 1)
+	if config.GetInt("otpSkew") < 0 {
+		return errors.New("otpSkew must be positive")
+	}
+	a.OTP = util.NewOTPValidator(config.GetInt("otpSkew"))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.reload(true)
+}
+
+// Login method is used to check if a couple of user/password, and OTP if user has a seed, is valid in htpasswd file
+func (a *Authenticator) Login(ctx context.Context, req *request.SignRequest) (resultCtx context.Context, valid bool, id string, err error) {
+
+	if len(req.User) == 0 {
+		return ctx, false, "", errors.New("empty username")
+	}
+	if len(req.Password) == 0 {
+		return ctx, false, "", errors.New("empty password")
+	}
+
+	a.mu.Lock()
+	if err := a.reload(false); err != nil {
+		log.Errorf("reloading htpasswd files failed, keeping previous users: %s", err)
+	}
+	hash, ok := a.users[req.User]
+	seed, hasSeed := a.otpSeeds[req.User]
+	a.mu.Unlock()
+
+	if !ok {
+		return ctx, false, "", errors.New("user not found")
+	}
+
+	// "signmykey hash" output format: <hash>,<encrypted OTP seed>
+	seedFile := a.OTPFile
+	if h, inlineSeed, _ := util.SplitHashedPassword(hash); inlineSeed != "" {
+		hash, seed, hasSeed = h, inlineSeed, true
+		seedFile = a.File
+	}
+
+	if hasSeed && len(req.Otp) == 0 {
+		return ctx, false, "", errors.New("otp required but not provided")
+	}
+
+	err = util.CheckPassword(hash, []byte(req.Password))
+	if errors.Is(err, util.ErrPasswordMismatch) {
+		return ctx, false, "", errors.New("bad password")
+	}
+	if err != nil {
+		return ctx, false, "", err
+	}
+
+	if hasSeed {
+		decrypted, err := util.DecryptSeed(seed, []byte(req.Password))
+		if err != nil {
+			return ctx, false, "", err
+		}
+		if err := a.OTP.Validate(req.User, decrypted, req.Otp); err != nil {
+			return ctx, false, "", err
+		}
+
+		if util.IsLegacySeed(seed) {
+			a.upgradeSeed(req.User, seedFile, seed, []byte(req.Password))
+		}
+	}
+
+	id = fmt.Sprintf("htpasswd-%s", req.User)
+	return authenticator.WithIdentity(ctx, authenticator.NewIdentity("htpasswd", req.User, id)), true, id, nil
+}
+
+// upgradeSeed encrypts again a legacy OTP seed in current format and replaces it in file.
+// Failures are only logged as login is already validated.
+func (a *Authenticator) upgradeSeed(user, file, encryptedSeed string, password []byte) {
+	upgraded, err := util.UpgradeSeed(encryptedSeed, password)
+	if err != nil {
+		log.Errorf("upgrading OTP seed of user %s failed: %s", user, err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := util.ReplaceInFile(file, encryptedSeed, upgraded); err != nil {
+		log.Errorf("upgrading OTP seed of user %s failed: %s", user, err)
+		return
+	}
+	if err := a.reload(true); err != nil {
+		log.Errorf("reloading htpasswd files failed: %s", err)
+	}
+	log.Infof("OTP seed of user %s upgraded in %s", user, file)
+}
+
+// reload reads htpasswd and OTP files again if they changed since last read, a.mu must be held.
+func (a *Authenticator) reload(force bool) error {
+	stat, changed, err := statChanged(a.File, a.fileStat)
+	if err != nil {
+		return err
+	}
+	if changed || force {
+		users, err := readFile(a.File)
+		if err != nil {
+			return err
+		}
+		a.users, a.fileStat = users, stat
+		log.Infof("loaded %d users from %s", len(users), a.File)
+	}
+
+	if a.OTPFile == "" {
+		return nil
+	}
+
+	stat, changed, err = statChanged(a.OTPFile, a.otpStat)
+	if err != nil {
+		return err
+	}
+	if changed || force {
+		seeds, err := readFile(a.OTPFile)
+		if err != nil {
+			return err
+		}
+		a.otpSeeds, a.otpStat = seeds, stat
+		log.Infof("loaded %d OTP seeds from %s", len(seeds), a.OTPFile)
+	}
+
+	return nil
+}
+
+func statChanged(path string, previous fileStat) (fileStat, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStat{}, false, err
+	}
+	stat := fileStat{modTime: info.ModTime(), size: info.Size()}
+
+	return stat, stat != previous, nil
+}
+
+// readFile parses a file of "user:value" lines, empty lines and lines starting with # are ignored.
+// Extra fields of shadow-style "user:hash:lastchg:..." lines are ignored.
+func readFile(path string) (map[string]string, error) {
+	f, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint:errcheck
+
+	entries := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, value, ok := strings.Cut(line, ":")
+		value, _, _ = strings.Cut(value, ":")
+		if !ok || user == "" || value == "" {
+			return nil, fmt.Errorf("invalid entry at %s line %d", path, lineNum)
+		}
+		entries[user] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,166 @@
+package htpasswd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/util"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func bcryptHash(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(hash)
+}
+
+func encryptSeed(t *testing.T, seed, password string) string {
+	encrypted, err := util.EncryptSeed(seed, []byte(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encrypted
+}
+
+func writeFile(t *testing.T, path, content string, modTime time.Time) {
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthenticatorInit(t *testing.T) {
+	dir := t.TempDir()
+	badFile := filepath.Join(dir, "bad")
+	writeFile(t, badFile, "gooduser\n", time.Now())
+
+	cases := []struct {
+		config map[string]string
+		err    string
+	}{
+		{map[string]string{}, "missing config entry \"htpasswdFile\" for Authenticator"},
+		{map[string]string{"htpasswdFile": filepath.Join(dir, "nonexistent")}, fmt.Sprintf("stat %s/nonexistent: no such file or directory", dir)},
+		{map[string]string{"htpasswdFile": badFile}, fmt.Sprintf("invalid entry at %s line 1", badFile)},
+	}
+
+	for _, c := range cases {
+		testConfig := viper.New()
+		for k, v := range c.config {
+			testConfig.Set(k, v)
+		}
+
+		auth := &Authenticator{}
+		assert.EqualError(t, auth.Init(testConfig), c.err)
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "htpasswd")
+	otpFile := filepath.Join(dir, "otp")
+
+	inlineSeed := util.GenerateSeed()
+	sideSeed := util.GenerateSeed()
+	now := time.Now().Add(-time.Hour)
+
+	writeFile(t, file, fmt.Sprintf(`# signmykey users
+gooduser:%s
+shadowuser:$6$saltsalt$4nDDCnJc5/DUO283DcOB5mhD4sYaeJBq9u9glWD/aXSCm0bxQVc/ccQBQuwSeR79CiR0y1jtYZV8fMC..hFsZ0:19000:0:99999:7:::
+inlineotpuser:%s,%s
+sideotpuser:%s
+`,
+		bcryptHash(t, "goodpassword"),
+		bcryptHash(t, "otppassword"), encryptSeed(t, inlineSeed, "otppassword"),
+		bcryptHash(t, "sidepassword"),
+	), now)
+	writeFile(t, otpFile, fmt.Sprintf("sideotpuser:%s\n", encryptSeed(t, sideSeed, "sidepassword")), now)
+
+	testConfig := viper.New()
+	testConfig.Set("htpasswdFile", file)
+	testConfig.Set("otpFile", otpFile)
+
+	auth := &Authenticator{}
+	err := auth.Init(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inlineOtp := util.GenerateOTPCode(inlineSeed, time.Now().Unix()/30)
+	sideOtp := util.GenerateOTPCode(sideSeed, time.Now().Unix()/30)
+
+	cases := []struct {
+		payload string
+		id      string
+		err     string
+	}{
+		{`{"user":""}`, "", "empty username"},
+		{`{"user":"gooduser"}`, "", "empty password"},
+		{`{"user":"baduser","password":"badpassword"}`, "", "user not found"},
+		{`{"user":"gooduser","password":"badpassword"}`, "", "bad password"},
+		{`{"user":"gooduser","password":"goodpassword"}`, "htpasswd-gooduser", ""},
+		{`{"user":"shadowuser","password":"goodpassword"}`, "htpasswd-shadowuser", ""},
+		{`{"user":"inlineotpuser","password":"otppassword"}`, "", "otp required but not provided"},
+		{`{"user":"inlineotpuser","password":"otppassword","otp":"000000x"}`, "", "otp does not match"},
+		{fmt.Sprintf(`{"user":"inlineotpuser","password":"otppassword","otp":"%s"}`, inlineOtp), "htpasswd-inlineotpuser", ""},
+		{`{"user":"sideotpuser","password":"sidepassword"}`, "", "otp required but not provided"},
+		{fmt.Sprintf(`{"user":"sideotpuser","password":"sidepassword","otp":"%s"}`, sideOtp), "htpasswd-sideotpuser", ""},
+	}
+
+	for _, c := range cases {
+		req, err := request.Decode([]byte(c.payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, valid, id, err := auth.Login(context.Background(), req)
+		assert.Equal(t, c.err == "", valid, c.payload)
+		assert.Equal(t, c.id, id, c.payload)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.payload)
+		}
+	}
+
+	// legacy seeds are upgraded in place
+	legacySeed := "2HYAJEWSLXOT3PMLZK6FYIKYCM7EE5LTYW4XYFDMFZDF56TE3SIA===="
+	writeFile(t, file, fmt.Sprintf("legacyuser:%s\n", bcryptHash(t, "otppassword")), now.Add(30*time.Second))
+	writeFile(t, otpFile, fmt.Sprintf("legacyuser:%s\n", legacySeed), now.Add(30*time.Second))
+	legacyOtp := util.GenerateOTPCode("JBSWY3DPEHPK3PXP", time.Now().Unix()/30)
+
+	_, valid, _, err := auth.Login(context.Background(), &request.SignRequest{User: "legacyuser", Password: "otppassword", Otp: legacyOtp})
+	assert.True(t, valid)
+	assert.NoError(t, err)
+	content, err := os.ReadFile(otpFile)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), "legacyuser:v2."))
+
+	// users are reloaded when file changes
+	writeFile(t, file, fmt.Sprintf("newuser:%s\n", bcryptHash(t, "newpassword")), now.Add(time.Minute))
+
+	_, valid, _, err = auth.Login(context.Background(), &request.SignRequest{User: "newuser", Password: "newpassword"})
+	assert.True(t, valid)
+	assert.NoError(t, err)
+	_, valid, _, err = auth.Login(context.Background(), &request.SignRequest{User: "gooduser", Password: "goodpassword"})
+	assert.False(t, valid)
+	assert.EqualError(t, err, "user not found")
+
+	// previous users are kept when new file is invalid
+	writeFile(t, file, "invalid line\n", now.Add(2*time.Minute))
+
+	_, valid, _, err = auth.Login(context.Background(), &request.SignRequest{User: "newuser", Password: "newpassword"})
+	assert.True(t, valid)
+	assert.NoError(t, err)
+}
@@ -2,15 +2,18 @@ package ldap
 
 import (
 	"context"
-	"crypto/tls"
-	"encoding/json"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"slices"
 	"strings"
 	"time"
 
 	ldap "github.com/go-ldap/ldap/v3"
-	log "github.com/sirupsen/logrus"
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
 	"github.com/spf13/viper"
 )
 
@@ -24,11 +27,27 @@ type Authenticator struct {
 	SearchStr    string
 	UseTLS       bool
 	TLSVerify    bool
-}
 
-type ldapLogin struct {
-	User     string `json:"user" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	// URLs of LDAP servers, tried in order. Address and Port are used when empty.
+	URLs []string
+	// StartTLS upgrades ldap:// connections to TLS
+	StartTLS bool
+	// CAFile is a PEM bundle of CA used to verify servers certificates, system CA are used if empty
+	CAFile string
+	// PoolSize is the maximum number of idle connections kept open
+	PoolSize int
+	// Timeout of connections and requests
+	Timeout time.Duration
+	// ServerRetry is the duration an unavailable server is skipped
+	ServerRetry time.Duration
+
+	// RequireFilter is an LDAP filter the user entry must match to log in
+	RequireFilter string
+	// AccountChecks denies login of disabled, locked or expired accounts and expired passwords
+	AccountChecks bool
+
+	rootCAs *x509.CertPool
+	pool    *connPool
 }
 
 // Init method is used to ingest config of Authenticator
@@ -43,6 +62,15 @@ func (a *Authenticator) Init(config *viper.Viper) error {
 		"ldapBase",
 		"ldapSearch",
 	}
+	if config.IsSet("ldapURLs") {
+		neededEntries = []string{
+			"ldapBindUser",
+			"ldapBindPassword",
+			"ldapBase",
+			"ldapSearch",
+		}
+		config.SetDefault("ldapTLSVerify", true)
+	}
 
 	var missingEntriesLst []string
 	for _, entry := range neededEntries {
@@ -55,6 +83,31 @@ func (a *Authenticator) Init(config *viper.Viper) error {
 		return fmt.Errorf("missing config entries (%s) for Authenticator", missingEntries)
 	}
 
+	for _, rawURL := range config.GetStringSlice("ldapURLs") {
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			return fmt.Errorf("invalid LDAP URL %q, must be ldap://host[:port] or ldaps://host[:port]", rawURL)
+		}
+	}
+	if config.GetInt("ldapPoolSize") < 0 {
+		return errors.New("ldapPoolSize must be positive")
+	}
+	if config.GetDuration("ldapTimeout") < 0 || config.GetDuration("ldapServerRetry") < 0 {
+		return errors.New("ldapTimeout and ldapServerRetry must be positive")
+	}
+
+	if caFile := config.GetString("ldapCAFile"); caFile != "" {
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("error reading ldapCAFile: %w", err)
+		}
+		a.rootCAs = x509.NewCertPool()
+		if !a.rootCAs.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("no valid certificate found in %s", caFile)
+		}
+		a.CAFile = caFile
+	}
+
 	a.Address = config.GetString("ldapAddr")
 	a.Port = config.GetInt("ldapPort")
 	a.UseTLS = config.GetBool("ldapTLS")
@@ -64,62 +117,143 @@ func (a *Authenticator) Init(config *viper.Viper) error {
 	a.SearchBase = config.GetString("ldapBase")
 	a.SearchStr = config.GetString("ldapSearch")
 
+	a.URLs = config.GetStringSlice("ldapURLs")
+	a.StartTLS = config.GetBool("ldapStartTLS")
+	a.PoolSize = config.GetInt("ldapPoolSize")
+	a.Timeout = config.GetDuration("ldapTimeout")
+	a.ServerRetry = config.GetDuration("ldapServerRetry")
+
+	a.RequireFilter = config.GetString("ldapRequireFilter")
+	if a.RequireFilter != "" {
+		if _, err := ldap.CompileFilter(a.RequireFilter); err != nil {
+			return fmt.Errorf("invalid ldapRequireFilter: %w", err)
+		}
+	}
+	a.AccountChecks = config.GetBool("ldapAccountChecks")
+
+	a.pool = newConnPool(a)
+
 	return nil
 }
 
 // Login method is used to check if a couple of user/password is valid in LDAP.
-func (a *Authenticator) Login(ctx context.Context, payload []byte) (resultCtx context.Context, valid bool, id string, err error) {
+func (a *Authenticator) Login(ctx context.Context, req *request.SignRequest) (resultCtx context.Context, valid bool, id string, err error) {
 
-	var login ldapLogin
-	err = json.Unmarshal(payload, &login)
+	entry, err := a.SearchUser(req.User, a.searchAttributes())
 	if err != nil {
-		log.Errorf("json unmarshaling failed: %s", err)
-		return ctx, false, "", fmt.Errorf("JSON unmarshaling failed: %w", err)
+		return ctx, false, "", err
 	}
+	userdn := entry.DN
 
-	l := &ldap.Conn{}
-	l.SetTimeout(time.Second * 10)
-
-	if a.UseTLS {
-		l, err = ldap.DialURL(fmt.Sprintf("ldaps://%s:%d", a.Address, a.Port), ldap.DialWithTLSConfig(&tls.Config{InsecureSkipVerify: !a.TLSVerify}))
-	} else {
-		l, err = ldap.DialURL(fmt.Sprintf("ldap://%s:%d", a.Address, a.Port))
-	}
+	// Bind as the user to verify their password
+	err = a.pool.withAuthConn(func(l *ldap.Conn) error {
+		return l.Bind(userdn, req.Password)
+	})
 	if err != nil {
+		if a.AccountChecks {
+			err = bindError(err)
+		}
 		return ctx, false, "", err
 	}
-	defer l.Close() // nolint:errcheck
 
-	err = l.Bind(a.BindUser, a.BindPassword)
-	if err != nil {
+	if err := a.CheckAccess(entry); err != nil {
 		return ctx, false, "", err
 	}
 
+	id = fmt.Sprintf("ldap-%s", req.User)
+	identity := authenticator.NewIdentity("ldap", req.User, id)
+	identity.Groups = entry.GetEqualFoldAttributeValues("memberOf")
+	for _, attr := range identityAttributes {
+		if values := entry.GetEqualFoldAttributeValues(attr); len(values) > 0 {
+			identity.Attributes[attr] = values
+		}
+	}
+
+	return authenticator.WithIdentity(ctx, identity), true, id, nil
+}
+
+// SearchUser returns the entry of user read with the service account, holding attributes and
+// the account state attributes needed by CheckAccess.
+func (a *Authenticator) SearchUser(user string, attributes []string) (*ldap.Entry, error) {
+	if a.pool == nil {
+		return nil, errors.New("LDAP Authenticator not initialized")
+	}
+	if a.AccountChecks {
+		attributes = append(slices.Clone(attributes), accountAttributes...)
+	}
+
 	searchReq := ldap.NewSearchRequest(
 		a.SearchBase, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
-		fmt.Sprintf(a.SearchStr, ldap.EscapeFilter(login.User)),
-		[]string{"dn"},
+		fmt.Sprintf(a.SearchStr, ldap.EscapeFilter(user)),
+		attributes,
 		nil,
 	)
 
-	sr, err := l.Search(searchReq)
+	var sr *ldap.SearchResult
+	err := a.pool.withSearchConn(func(l *ldap.Conn) (err error) {
+		sr, err = l.Search(searchReq)
+		return err
+	})
 	if err != nil {
-		return ctx, false, "", err
+		return nil, err
 	}
 
 	if len(sr.Entries) > 1 {
-		return ctx, false, "", errors.New("too many user entries returned")
+		return nil, errors.New("too many user entries returned")
 	} else if len(sr.Entries) == 0 {
-		return ctx, false, "", errors.New("user not found")
+		return nil, errors.New("user not found")
 	}
 
-	userdn := sr.Entries[0].DN
+	return sr.Entries[0], nil
+}
 
-	// Bind as the user to verify their password
-	err = l.Bind(userdn, login.Password)
+// CheckAccess returns a DeniedError if user entry, read with SearchUser, shows a disabled, locked
+// or expired account with AccountChecks, or doesn't match RequireFilter.
+func (a *Authenticator) CheckAccess(entry *ldap.Entry) error {
+	if a.AccountChecks {
+		if err := checkAccount(entry, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	if a.RequireFilter != "" {
+		allowed, err := a.matchRequireFilter(entry.DN)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return authenticator.NewDeniedError("user not allowed to log in")
+		}
+	}
+
+	return nil
+}
+
+// identityAttributes are the attributes of user entry added to Identity
+var identityAttributes = []string{"mail", "displayName"}
+
+// searchAttributes returns attributes read on user search
+func (a *Authenticator) searchAttributes() []string {
+	return append([]string{"dn", "memberOf"}, identityAttributes...)
+}
+
+// matchRequireFilter returns true if user entry matches RequireFilter
+func (a *Authenticator) matchRequireFilter(userdn string) (bool, error) {
+	searchReq := ldap.NewSearchRequest(
+		userdn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		a.RequireFilter,
+		[]string{"dn"},
+		nil,
+	)
+
+	var sr *ldap.SearchResult
+	err := a.pool.withSearchConn(func(l *ldap.Conn) (err error) {
+		sr, err = l.Search(searchReq)
+		return err
+	})
 	if err != nil {
-		return ctx, false, "", err
+		return false, err
 	}
 
-	return ctx, true, fmt.Sprintf("ldap-%s", login.User), nil
+	return len(sr.Entries) == 1, nil
 }
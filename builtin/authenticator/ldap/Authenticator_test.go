@@ -3,33 +3,165 @@ package ldap
 import (
 	"bytes"
 	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/internal/ldaptest"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestAuthenticator(t *testing.T) {
-	// TODO: Add LDAP mocking
-	t.Skip()
-
-	ldap := &Authenticator{
-		Address:      "127.0.0.1",
-		Port:         636,
-		BindUser:     "CN=fakebinduser,OU=Users,DC=test,DC=domain",
-		BindPassword: "fakebindpasswd",
-		SearchBase:   "OU=Users,DC=test,DC=domain",
-		SearchStr:    "(&(objectClass=organizationalPerson)(sAMAccountName=%s))",
-		UseTLS:       true,
+var testEntries = []ldaptest.Entry{
+	{DN: "cn=svc,dc=test", Password: "svcpassword"},
+	{DN: "uid=foo,ou=users,dc=test", Password: "foopassword", Attributes: map[string][]string{
+		"uid":         {"foo"},
+		"mail":        {"foo@test"},
+		"displayName": {"Foo Bar"},
+		"memberOf":    {"cn=ssh-users,ou=groups,dc=test"},
+	}},
+}
+
+// testAuthenticator returns an Authenticator without Init, its pool must be built with
+// newConnPool once fields are set.
+func testAuthenticator(urls ...string) *Authenticator {
+	return &Authenticator{
+		URLs:         urls,
+		BindUser:     "cn=svc,dc=test",
+		BindPassword: "svcpassword",
+		SearchBase:   "ou=users,dc=test",
+		SearchStr:    "(uid=%s)",
 		TLSVerify:    true,
+		Timeout:      2 * time.Second,
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	srv := ldaptest.NewServer(t, testEntries, nil)
+	auth := testAuthenticator(srv.URL)
+	auth.pool = newConnPool(auth)
+
+	for i := 0; i < 3; i++ {
+		ctx, valid, id, err := auth.Login(context.Background(), &request.SignRequest{User: "foo", Password: "foopassword"})
+		assert.NoError(t, err)
+		assert.True(t, valid)
+		assert.Equal(t, "ldap-foo", id)
+
+		identity, ok := authenticator.IdentityFromContext(ctx)
+		if assert.True(t, ok) {
+			assert.Equal(t, "foo", identity.Username)
+			assert.Equal(t, "ldap", identity.Source)
+			assert.Equal(t, []string{"cn=ssh-users,ou=groups,dc=test"}, identity.Groups)
+			assert.Equal(t, "foo@test", identity.Attribute("mail"))
+			assert.Equal(t, "Foo Bar", identity.Attribute("displayName"))
+		}
 	}
 
-	_, valid, _, err := ldap.Login(context.Background(), []byte("jsonpayload"))
-	if !valid || err != nil {
-		t.Logf("%s", err)
-		t.Fail()
-		return
+	_, valid, _, err := auth.Login(context.Background(), &request.SignRequest{User: "foo", Password: "badpassword"})
+	assert.Error(t, err)
+	assert.False(t, valid)
+
+	_, valid, _, err = auth.Login(context.Background(), &request.SignRequest{User: "bar", Password: "foopassword"})
+	assert.EqualError(t, err, "user not found")
+	assert.False(t, valid)
+
+	// one search connection bound once with service account and one auth connection for users
+	assert.EqualValues(t, 2, srv.Conns.Load())
+	assert.EqualValues(t, 5, srv.Binds.Load())
+
+	// Login needs a pool built by Init
+	_, valid, _, err = testAuthenticator(srv.URL).Login(context.Background(), &request.SignRequest{User: "foo", Password: "foopassword"})
+	assert.EqualError(t, err, "LDAP Authenticator not initialized")
+	assert.False(t, valid)
+}
+
+func TestAuthenticatorLegacyAddress(t *testing.T) {
+	srv := ldaptest.NewServer(t, testEntries, nil)
+	host, port, err := net.SplitHostPort(srv.Addr())
+	if err != nil {
+		t.Fatal(err)
 	}
+	portNum, _ := strconv.Atoi(port)
+
+	auth := testAuthenticator()
+	auth.Address = host
+	auth.Port = portNum
+	auth.pool = newConnPool(auth)
+
+	_, valid, _, err := auth.Login(context.Background(), &request.SignRequest{User: "foo", Password: "foopassword"})
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestAuthenticatorTLS(t *testing.T) {
+	tlsConfig, caPEM := ldaptest.NewTLSConfig(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	startTLSSrv := ldaptest.NewServer(t, testEntries, tlsConfig)
+	ldapsSrv := ldaptest.NewTLSServer(t, testEntries, tlsConfig)
+
+	for _, url := range []string{startTLSSrv.URL, ldapsSrv.URL} {
+		config := viper.New()
+		config.Set("ldapURLs", []string{url})
+		config.Set("ldapStartTLS", true)
+		config.Set("ldapCAFile", caFile)
+		config.Set("ldapBindUser", "cn=svc,dc=test")
+		config.Set("ldapBindPassword", "svcpassword")
+		config.Set("ldapBase", "ou=users,dc=test")
+		config.Set("ldapSearch", "(uid=%s)")
+
+		auth := &Authenticator{}
+		assert.NoError(t, auth.Init(config))
+
+		_, valid, _, err := auth.Login(context.Background(), &request.SignRequest{User: "foo", Password: "foopassword"})
+		assert.NoError(t, err, url)
+		assert.True(t, valid, url)
+
+		// server certificate isn't trusted without CA file
+		auth = testAuthenticator(url)
+		auth.StartTLS = true
+		auth.pool = newConnPool(auth)
+		_, valid, _, err = auth.Login(context.Background(), &request.SignRequest{User: "foo", Password: "foopassword"})
+		assert.ErrorContains(t, err, "certificate", url)
+		assert.False(t, valid, url)
+	}
+}
+
+func TestAuthenticatorFailover(t *testing.T) {
+	down := ldaptest.NewServer(t, testEntries, nil)
+	down.Close()
+	srv := ldaptest.NewServer(t, testEntries, nil)
+
+	auth := testAuthenticator(down.URL, srv.URL)
+	auth.ServerRetry = time.Hour
+	auth.pool = newConnPool(auth)
+
+	_, valid, _, err := auth.Login(context.Background(), &request.SignRequest{User: "foo", Password: "foopassword"})
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Contains(t, auth.pool.downUntil, down.URL)
+
+	// pooled connections closed by server are replaced
+	srv.CloseConns()
+	_, valid, _, err = auth.Login(context.Background(), &request.SignRequest{User: "foo", Password: "foopassword"})
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.EqualValues(t, 4, srv.Conns.Load())
+
+	srv.Close()
+	_, valid, _, err = auth.Login(context.Background(), &request.SignRequest{User: "foo", Password: "foopassword"})
+	assert.ErrorContains(t, err, "no LDAP server available")
+	assert.False(t, valid)
 }
 
 func TestAuthenticatorInit(t *testing.T) {
@@ -114,6 +246,68 @@ ldapSearch: "(&(objectClass=organizationalPerson)(sAMAccountName=%s))"
 			Authenticator{},
 			"Missing config entries (ldapPort, ldapBindPassword) for Authenticator",
 		},
+		{
+			[]byte(`
+ldapURLs:
+  - ldap://ldap1.local
+  - ldaps://ldap2.local:636
+ldapStartTLS: True
+ldapPoolSize: 8
+ldapTimeout: 3s
+ldapServerRetry: 1m
+ldapBindUser: binduser
+ldapBindPassword: bindpassword
+ldapBase: "DC=fake,DC=org"
+ldapSearch: "(&(objectClass=organizationalPerson)(sAMAccountName=%s))"
+`),
+			Authenticator{
+				URLs:         []string{"ldap://ldap1.local", "ldaps://ldap2.local:636"},
+				StartTLS:     true,
+				TLSVerify:    true,
+				PoolSize:     8,
+				Timeout:      3 * time.Second,
+				ServerRetry:  time.Minute,
+				BindUser:     "binduser",
+				BindPassword: "bindpassword",
+				SearchBase:   "DC=fake,DC=org",
+				SearchStr:    "(&(objectClass=organizationalPerson)(sAMAccountName=%s))",
+			},
+			"",
+		},
+		{
+			[]byte(`
+ldapURLs:
+  - ldap://ldap1.local
+ldapBindUser: binduser
+`),
+			Authenticator{},
+			"missing config entries (ldapBindPassword, ldapBase, ldapSearch) for Authenticator",
+		},
+		{
+			[]byte(`
+ldapURLs:
+  - ldap1.local:389
+ldapBindUser: binduser
+ldapBindPassword: bindpassword
+ldapBase: "DC=fake,DC=org"
+ldapSearch: "(uid=%s)"
+`),
+			Authenticator{},
+			"invalid LDAP URL \"ldap1.local:389\", must be ldap://host[:port] or ldaps://host[:port]",
+		},
+		{
+			[]byte(`
+ldapURLs:
+  - ldap://ldap1.local
+ldapCAFile: /nonexistent/ca.pem
+ldapBindUser: binduser
+ldapBindPassword: bindpassword
+ldapBase: "DC=fake,DC=org"
+ldapSearch: "(uid=%s)"
+`),
+			Authenticator{},
+			"error reading ldapCAFile: open /nonexistent/ca.pem: no such file or directory",
+		},
 	}
 
 	for _, c := range cases {
@@ -127,6 +321,9 @@ ldapSearch: "(&(objectClass=organizationalPerson)(sAMAccountName=%s))"
 		auth := Authenticator{}
 		err = auth.Init(testConfig)
 
+		// pool is only built by successful Init
+		assert.Equal(t, err == nil, auth.pool != nil)
+		auth.pool = nil
 		assert.EqualValues(t, c.auth, auth)
 		if c.err == "" {
 			assert.NoError(t, err)
@@ -135,3 +332,113 @@ ldapSearch: "(&(objectClass=organizationalPerson)(sAMAccountName=%s))"
 		}
 	}
 }
+
+func TestAuthenticatorRequireFilter(t *testing.T) {
+	srv := ldaptest.NewServer(t, []ldaptest.Entry{
+		{DN: "cn=svc,dc=test", Password: "svcpassword"},
+		{DN: "uid=foo,ou=users,dc=test", Password: "foopassword", Attributes: map[string][]string{
+			"uid":      {"foo"},
+			"memberOf": {"cn=ssh-users,ou=groups,dc=test"},
+		}},
+		{DN: "uid=bar,ou=users,dc=test", Password: "barpassword", Attributes: map[string][]string{
+			"uid":      {"bar"},
+			"memberOf": {"cn=web-users,ou=groups,dc=test"},
+		}},
+	}, nil)
+	auth := testAuthenticator(srv.URL)
+	auth.RequireFilter = "(memberOf=cn=ssh-users,ou=groups,dc=test)"
+	auth.pool = newConnPool(auth)
+
+	_, valid, _, err := auth.Login(context.Background(), &request.SignRequest{User: "foo", Password: "foopassword"})
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	_, valid, _, err = auth.Login(context.Background(), &request.SignRequest{User: "bar", Password: "barpassword"})
+	var deniedError *authenticator.DeniedError
+	assert.ErrorAs(t, err, &deniedError)
+	assert.EqualError(t, err, "user not allowed to log in")
+	assert.False(t, valid)
+
+	// membership isn't disclosed without valid password
+	_, valid, _, err = auth.Login(context.Background(), &request.SignRequest{User: "bar", Password: "badpassword"})
+	assert.False(t, errors.As(err, &deniedError))
+	assert.False(t, valid)
+}
+
+func TestAuthenticatorAccountChecks(t *testing.T) {
+	srv := ldaptest.NewServer(t, []ldaptest.Entry{
+		{DN: "cn=svc,dc=test", Password: "svcpassword"},
+		{DN: "uid=foo,ou=users,dc=test", Password: "foopassword", Attributes: map[string][]string{
+			"uid":                {"foo"},
+			"userAccountControl": {"512"},
+		}},
+		{DN: "uid=bar,ou=users,dc=test", Password: "barpassword", Attributes: map[string][]string{
+			"uid":                {"bar"},
+			"userAccountControl": {"514"},
+		}},
+	}, nil)
+	auth := testAuthenticator(srv.URL)
+	auth.AccountChecks = true
+	auth.pool = newConnPool(auth)
+
+	_, valid, _, err := auth.Login(context.Background(), &request.SignRequest{User: "foo", Password: "foopassword"})
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	_, valid, _, err = auth.Login(context.Background(), &request.SignRequest{User: "bar", Password: "barpassword"})
+	assert.EqualError(t, err, "account disabled")
+	assert.False(t, valid)
+}
+
+func TestCheckAccount(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	today := strconv.FormatInt(now.Unix()/86400, 10)
+
+	cases := []struct {
+		attributes map[string][]string
+		err        string
+	}{
+		{map[string][]string{}, ""},
+		{map[string][]string{"userAccountControl": {"512"}, "accountExpires": {"9223372036854775807"}, "pwdLastSet": {"134000000000000000"}}, ""},
+		{map[string][]string{"userAccountControl": {"514"}}, "account disabled"},
+		{map[string][]string{"userAccountControl": {"528"}}, "account locked"},
+		{map[string][]string{"userAccountControl": {"8389120"}}, "password expired"},
+		{map[string][]string{"accountExpires": {"0"}}, ""},
+		// 2026-01-01
+		{map[string][]string{"accountExpires": {"134116992000000000"}}, "account expired"},
+		// 2027-01-01
+		{map[string][]string{"accountExpires": {"134432352000000000"}}, ""},
+		{map[string][]string{"pwdLastSet": {"0"}}, "password must be changed"},
+		{map[string][]string{"shadowExpire": {"-1"}}, ""},
+		{map[string][]string{"shadowExpire": {"20000"}}, "account expired"},
+		{map[string][]string{"shadowLastChange": {"0"}}, "password must be changed"},
+		{map[string][]string{"shadowLastChange": {today}, "shadowMax": {"90"}}, ""},
+		{map[string][]string{"shadowLastChange": {"20000"}, "shadowMax": {"90"}}, "password expired"},
+		{map[string][]string{"shadowLastChange": {"20000"}, "shadowMax": {"99999"}}, ""},
+		{map[string][]string{"pwdAccountLockedTime": {"000001010000Z"}}, "account locked"},
+		{map[string][]string{"nsAccountLock": {"TRUE"}}, "account disabled"},
+		{map[string][]string{"nsAccountLock": {"FALSE"}}, ""},
+		{map[string][]string{"krbPrincipalExpiration": {"20260101000000Z"}}, "account expired"},
+		{map[string][]string{"krbPasswordExpiration": {"20260101000000Z"}}, "password expired"},
+		{map[string][]string{"krbPasswordExpiration": {"20270101000000Z"}}, ""},
+	}
+
+	for _, c := range cases {
+		err := checkAccount(ldap.NewEntry("uid=foo,dc=test", c.attributes), now)
+		if c.err == "" {
+			assert.NoError(t, err, c.attributes)
+		} else {
+			assert.EqualError(t, err, c.err, c.attributes)
+		}
+	}
+}
+
+func TestBindError(t *testing.T) {
+	err := bindError(ldap.NewError(ldap.LDAPResultInvalidCredentials,
+		errors.New("80090308: LdapErr: DSID-0C09044E, comment: AcceptSecurityContext error, data 532, v4563")))
+	assert.EqualError(t, err, "password expired")
+
+	err = bindError(ldap.NewError(ldap.LDAPResultInvalidCredentials,
+		errors.New("80090308: LdapErr: DSID-0C09044E, comment: AcceptSecurityContext error, data 52e, v4563")))
+	assert.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials))
+}
@@ -0,0 +1,123 @@
+package ldap
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+)
+
+// accountAttributes are the attributes of user entry read to check account state, from Active
+// Directory, shadowAccount, password policy overlay and FreeIPA/389 Directory Server schemas
+var accountAttributes = []string{
+	"userAccountControl",
+	"accountExpires",
+	"pwdLastSet",
+	"shadowExpire",
+	"shadowLastChange",
+	"shadowMax",
+	"pwdAccountLockedTime",
+	"nsAccountLock",
+	"krbPrincipalExpiration",
+	"krbPasswordExpiration",
+}
+
+// Active Directory userAccountControl flags
+const (
+	uacAccountDisable  = 0x2
+	uacLockout         = 0x10
+	uacPasswordExpired = 0x800000
+)
+
+// Active Directory bind errors sub-codes, only returned when password is valid
+var adBindErrors = map[string]string{
+	"data 532": "password expired",
+	"data 533": "account disabled",
+	"data 701": "account expired",
+	"data 773": "password must be changed",
+	"data 775": "account locked",
+}
+
+// checkAccount returns a DeniedError if the attributes of user entry show that account is
+// disabled, locked or expired, or that password is expired
+func checkAccount(entry *ldap.Entry, now time.Time) error {
+	if uac, err := strconv.ParseInt(entry.GetEqualFoldAttributeValue("userAccountControl"), 10, 64); err == nil {
+		switch {
+		case uac&uacAccountDisable != 0:
+			return authenticator.NewDeniedError("account disabled")
+		case uac&uacLockout != 0:
+			return authenticator.NewDeniedError("account locked")
+		case uac&uacPasswordExpired != 0:
+			return authenticator.NewDeniedError("password expired")
+		}
+	}
+
+	// accountExpires is a number of 100ns intervals since 1601-01-01, 0 and max value mean never
+	if expires, err := strconv.ParseInt(entry.GetEqualFoldAttributeValue("accountExpires"), 10, 64); err == nil &&
+		expires != 0 && expires != math.MaxInt64 && fileTime(expires).Before(now) {
+		return authenticator.NewDeniedError("account expired")
+	}
+
+	if entry.GetEqualFoldAttributeValue("pwdLastSet") == "0" {
+		return authenticator.NewDeniedError("password must be changed")
+	}
+
+	// shadow attributes are numbers of days since epoch, -1 or missing means never
+	if expire, err := strconv.ParseInt(entry.GetEqualFoldAttributeValue("shadowExpire"), 10, 64); err == nil &&
+		expire >= 0 && epochDays(expire).Before(now) {
+		return authenticator.NewDeniedError("account expired")
+	}
+	lastChange, lastChangeErr := strconv.ParseInt(entry.GetEqualFoldAttributeValue("shadowLastChange"), 10, 64)
+	if lastChangeErr == nil && lastChange == 0 {
+		return authenticator.NewDeniedError("password must be changed")
+	}
+	if maxAge, err := strconv.ParseInt(entry.GetEqualFoldAttributeValue("shadowMax"), 10, 64); err == nil && lastChangeErr == nil &&
+		maxAge >= 0 && maxAge < 99999 && epochDays(lastChange+maxAge).Before(now) {
+		return authenticator.NewDeniedError("password expired")
+	}
+
+	if entry.GetEqualFoldAttributeValue("pwdAccountLockedTime") != "" {
+		return authenticator.NewDeniedError("account locked")
+	}
+	if strings.EqualFold(entry.GetEqualFoldAttributeValue("nsAccountLock"), "true") {
+		return authenticator.NewDeniedError("account disabled")
+	}
+
+	if expires, err := ber.ParseGeneralizedTime([]byte(entry.GetEqualFoldAttributeValue("krbPrincipalExpiration"))); err == nil && expires.Before(now) {
+		return authenticator.NewDeniedError("account expired")
+	}
+	if expires, err := ber.ParseGeneralizedTime([]byte(entry.GetEqualFoldAttributeValue("krbPasswordExpiration"))); err == nil && expires.Before(now) {
+		return authenticator.NewDeniedError("password expired")
+	}
+
+	return nil
+}
+
+// bindError returns a DeniedError if err is an Active Directory bind error telling that the
+// password is valid but account can't log in, err otherwise
+func bindError(err error) error {
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return err
+	}
+
+	for code, reason := range adBindErrors {
+		if strings.Contains(err.Error(), code) {
+			return authenticator.NewDeniedError(reason)
+		}
+	}
+
+	return err
+}
+
+func fileTime(t int64) time.Time {
+	// 11644473600 seconds between 1601-01-01 and 1970-01-01
+	return time.Unix(t/1e7-11644473600, (t%1e7)*100)
+}
+
+func epochDays(days int64) time.Time {
+	return time.Unix(days*86400, 0)
+}
@@ -0,0 +1,223 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// Default connection pool settings, used when options are not set
+const (
+	defaultPoolSize    = 4
+	defaultTimeout     = 10 * time.Second
+	defaultServerRetry = 30 * time.Second
+)
+
+// connPool keeps idle connections to LDAP servers. Search connections stay bound with the
+// service account, auth connections are only used to bind as users. Servers are tried in order
+// and a server failing to answer is skipped for retry duration.
+type connPool struct {
+	urls        []string
+	bindUser    string
+	bindPass    string
+	startTLS    bool
+	tlsVerify   bool
+	rootCAs     *x509.CertPool
+	timeout     time.Duration
+	serverRetry time.Duration
+
+	search chan *ldap.Conn
+	auth   chan *ldap.Conn
+
+	mu        sync.Mutex
+	downUntil map[string]time.Time
+}
+
+func newConnPool(a *Authenticator) *connPool {
+	urls := a.URLs
+	if len(urls) == 0 {
+		scheme := "ldap"
+		if a.UseTLS {
+			scheme = "ldaps"
+		}
+		urls = []string{fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(a.Address, fmt.Sprint(a.Port)))}
+	}
+
+	size := a.PoolSize
+	if size == 0 {
+		size = defaultPoolSize
+	}
+	timeout := a.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	serverRetry := a.ServerRetry
+	if serverRetry == 0 {
+		serverRetry = defaultServerRetry
+	}
+
+	return &connPool{
+		urls:        urls,
+		bindUser:    a.BindUser,
+		bindPass:    a.BindPassword,
+		startTLS:    a.StartTLS,
+		tlsVerify:   a.TLSVerify,
+		rootCAs:     a.rootCAs,
+		timeout:     timeout,
+		serverRetry: serverRetry,
+		search:      make(chan *ldap.Conn, size),
+		auth:        make(chan *ldap.Conn, size),
+		downUntil:   map[string]time.Time{},
+	}
+}
+
+// withSearchConn runs f with a connection bound as service account
+func (p *connPool) withSearchConn(f func(*ldap.Conn) error) error {
+	return p.with(p.search, true, f)
+}
+
+// withAuthConn runs f with a connection used to bind as users
+func (p *connPool) withAuthConn(f func(*ldap.Conn) error) error {
+	return p.with(p.auth, false, f)
+}
+
+// with takes an idle connection from idle, or dials a new one, and runs f with it. When f fails
+// with a network error on a pooled connection, which may have been closed by server since last
+// use, f is run again once with a new connection.
+func (p *connPool) with(idle chan *ldap.Conn, bind bool, f func(*ldap.Conn) error) error {
+	conn, pooled := p.idle(idle)
+	if conn == nil {
+		var err error
+		conn, err = p.dial(bind)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := f(conn)
+	if pooled && connError(conn, err) {
+		conn.Close() // nolint:errcheck
+		conn, err = p.dial(bind)
+		if err != nil {
+			return err
+		}
+		err = f(conn)
+	}
+
+	if connError(conn, err) {
+		conn.Close() // nolint:errcheck
+		return err
+	}
+
+	select {
+	case idle <- conn:
+	default:
+		conn.Close() // nolint:errcheck
+	}
+
+	return err
+}
+
+// connError returns true if err is caused by conn being unusable
+func connError(conn *ldap.Conn, err error) bool {
+	return err != nil && (conn.IsClosing() || ldap.IsErrorWithCode(err, ldap.ErrorNetwork))
+}
+
+// idle returns an open idle connection, or nil if none is available
+func (p *connPool) idle(idle chan *ldap.Conn) (*ldap.Conn, bool) {
+	for {
+		select {
+		case conn := <-idle:
+			if conn.IsClosing() {
+				conn.Close() // nolint:errcheck
+				continue
+			}
+			return conn, true
+		default:
+			return nil, false
+		}
+	}
+}
+
+// dial connects to the first available server, skipping servers marked down unless all of them are
+func (p *connPool) dial(bind bool) (*ldap.Conn, error) {
+	now := time.Now()
+	candidates := []string{}
+	p.mu.Lock()
+	for _, u := range p.urls {
+		if now.After(p.downUntil[u]) {
+			candidates = append(candidates, u)
+		}
+	}
+	p.mu.Unlock()
+	if len(candidates) == 0 {
+		candidates = p.urls
+	}
+
+	var errs []error
+	for _, u := range candidates {
+		conn, err := p.dialURL(u)
+		if err != nil {
+			log.WithField("ctx", "ldap").WithError(err).Warnf("LDAP server %s unavailable", u)
+			p.mu.Lock()
+			p.downUntil[u] = time.Now().Add(p.serverRetry)
+			p.mu.Unlock()
+			errs = append(errs, err)
+			continue
+		}
+
+		p.mu.Lock()
+		delete(p.downUntil, u)
+		p.mu.Unlock()
+
+		if bind {
+			if err := conn.Bind(p.bindUser, p.bindPass); err != nil {
+				conn.Close() // nolint:errcheck
+				return nil, fmt.Errorf("service account bind failed: %w", err)
+			}
+		}
+
+		return conn, nil
+	}
+
+	return nil, fmt.Errorf("no LDAP server available: %w", errors.Join(errs...))
+}
+
+func (p *connPool) dialURL(rawURL string) (*ldap.Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         u.Hostname(),
+		RootCAs:            p.rootCAs,
+		InsecureSkipVerify: !p.tlsVerify, // nolint:gosec
+	}
+
+	conn, err := ldap.DialURL(rawURL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: p.timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(p.timeout)
+
+	if p.startTLS && u.Scheme == "ldap" {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close() // nolint:errcheck
+			return nil, fmt.Errorf("StartTLS failed: %w", err)
+		}
+	}
+
+	return conn, nil
+}
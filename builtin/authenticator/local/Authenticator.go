@@ -2,12 +2,13 @@ package local
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
-	"time"
+	"sync"
 
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
 	"github.com/signmykeyio/signmykey/util"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -17,12 +18,15 @@ import (
 // Authenticator struct represents local Authenticator options
 type Authenticator struct {
 	UserMap *viper.Viper
-}
 
-type localLogin struct {
-	User     string `json:"user" binding:"required"`
-	Password string `json:"password" binding:"required"`
-	Otp      string `json:"otp"`
+	// UpgradeFile is the config file where legacy OTP seeds are upgraded and used
+	// recovery codes are removed on login
+	UpgradeFile string
+
+	// OTP validates codes within the skew window and rejects replayed codes
+	OTP *util.OTPValidator
+
+	mu sync.RWMutex
 }
 
 // Init method is used to ingest config of Authenticator
@@ -33,54 +37,126 @@ func (a *Authenticator) Init(config *viper.Viper) error {
 	}
 
 	a.UserMap = config.Sub("users")
+	a.UpgradeFile = config.GetString("upgradeFile")
+
+	// used recovery codes must be removed to be accepted only once
+	if a.UpgradeFile == "" {
+		for _, user := range a.UserMap.AllKeys() {
+			if _, _, recoveryCodes := util.SplitHashedPassword(a.UserMap.GetString(user)); len(recoveryCodes) > 0 {
+				return fmt.Errorf("recovery codes of user %s need upgradeFile config entry for Authenticator", user)
+			}
+		}
+	}
+
+	config.SetDefault("otpSkew", 1)
+	if config.GetInt("otpSkew") < 0 {
+		return errors.New("otpSkew must be positive")
+	}
+	a.OTP = util.NewOTPValidator(config.GetInt("otpSkew"))
 
 	return nil
 }
 
 // Login method is used to check if a couple of user/password is valid in local config
-func (a Authenticator) Login(ctx context.Context, payload []byte) (resultCtx context.Context, valid bool, id string, err error) {
+func (a *Authenticator) Login(ctx context.Context, req *request.SignRequest) (resultCtx context.Context, valid bool, id string, err error) {
 
-	var login localLogin
-	err = json.Unmarshal(payload, &login)
-	if err != nil {
-		log.Errorf("json unmarshaling failed: %s", err)
-		return ctx, false, "", fmt.Errorf("JSON unmarshaling failed: %w", err)
-	}
-
-	if len(login.User) == 0 {
+	if len(req.User) == 0 {
 		return ctx, false, "", errors.New("empty username")
 	}
-	if len(login.Password) == 0 {
+	if len(req.Password) == 0 {
 		return ctx, false, "", errors.New("empty password")
 	}
 
-	hashedPass := a.UserMap.GetString(login.User)
+	a.mu.RLock()
+	hashedPass := a.UserMap.GetString(req.User)
+	a.mu.RUnlock()
 	if len(hashedPass) == 0 {
 		return ctx, false, "", errors.New("user not found")
 	}
 
-	passAndOtp := strings.Split(hashedPass, ",")
-	if len(passAndOtp) == 2 && len(login.Otp) == 0 {
+	hash, encryptedSeed, recoveryCodes := util.SplitHashedPassword(hashedPass)
+	if len(encryptedSeed) > 0 && len(req.Otp) == 0 {
 		return ctx, false, "", errors.New("otp required but not provided")
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(passAndOtp[0]), []byte(login.Password))
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password))
 	if err != nil {
 		return ctx, false, "", errors.New("bad password")
 	}
 
-	if len(passAndOtp) == 2 {
-		seed := util.DecryptSeed(passAndOtp[1], []byte(login.Password))
-		timeval := time.Now().Unix() / 30
-		generated := util.GenerateOTPCode(seed, timeval)
-		if login.Otp != generated {
-			// try again as industry standard is a 30 sec tolerance window
-			timeval = (time.Now().Unix() - 30) / 30
-			if login.Otp != util.GenerateOTPCode(seed, timeval) {
-				return ctx, false, "", errors.New("otp does not match")
-			}
+	if len(encryptedSeed) > 0 {
+		seed, err := util.DecryptSeed(encryptedSeed, []byte(req.Password))
+		if err != nil {
+			return ctx, false, "", err
+		}
+
+		otpErr := a.OTP.Validate(req.User, seed, req.Otp)
+		if otpErr != nil && len(recoveryCodes) > 0 && a.consumeRecoveryCode(req.User, req.Otp) {
+			log.Infof("user %s logged in with a recovery code", req.User)
+			otpErr = nil
+		}
+		if otpErr != nil {
+			return ctx, false, "", otpErr
+		}
+
+		if util.IsLegacySeed(encryptedSeed) {
+			a.upgradeSeed(req.User, encryptedSeed, []byte(req.Password))
 		}
 	}
 
-	return ctx, true, fmt.Sprintf("local-%s", login.User), nil
+	id = fmt.Sprintf("local-%s", req.User)
+	return authenticator.WithIdentity(ctx, authenticator.NewIdentity("local", req.User, id)), true, id, nil
+}
+
+// upgradeSeed encrypts again a legacy OTP seed in current format and replaces it in UpgradeFile.
+// Failures are only logged as login is already validated.
+func (a *Authenticator) upgradeSeed(user, encryptedSeed string, password []byte) {
+	if a.UpgradeFile == "" {
+		log.Warnf("OTP seed of user %s uses legacy encryption, set upgradeFile option or run \"signmykey hash --migrate\"", user)
+		return
+	}
+
+	upgraded, err := util.UpgradeSeed(encryptedSeed, password)
+	if err != nil {
+		log.Errorf("upgrading OTP seed of user %s failed: %s", user, err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := util.ReplaceInFile(a.UpgradeFile, encryptedSeed, upgraded); err != nil {
+		log.Errorf("upgrading OTP seed of user %s failed: %s", user, err)
+		return
+	}
+	a.UserMap.Set(user, strings.Replace(a.UserMap.GetString(user), encryptedSeed, upgraded, 1))
+	log.Infof("OTP seed of user %s upgraded in %s", user, a.UpgradeFile)
+}
+
+// consumeRecoveryCode checks code against recovery codes of user and removes it from UpgradeFile
+// if it matches, so each code is accepted only once.
+func (a *Authenticator) consumeRecoveryCode(user, code string) bool {
+	if a.UpgradeFile == "" {
+		log.Warnf("recovery codes of user %s ignored, upgradeFile option is needed to invalidate used codes", user)
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry := a.UserMap.GetString(user)
+	hash, encryptedSeed, recoveryCodes := util.SplitHashedPassword(entry)
+	remainingCodes, ok := util.ConsumeRecoveryCode(recoveryCodes, code)
+	if !ok {
+		return false
+	}
+
+	newEntry := util.JoinHashedPassword(hash, encryptedSeed, remainingCodes)
+	if err := util.ReplaceInFile(a.UpgradeFile, entry, newEntry); err != nil {
+		log.Errorf("removing used recovery code of user %s failed: %s", user, err)
+		return false
+	}
+	a.UserMap.Set(user, newEntry)
+
+	return true
 }
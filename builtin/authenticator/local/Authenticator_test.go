@@ -4,10 +4,17 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/util"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestAuthenticator(t *testing.T) {
@@ -30,22 +37,21 @@ users:
 	}
 
 	cases := []struct {
-		payload []byte
-		id      string
-		err     string
-		valid   bool
+		req   *request.SignRequest
+		id    string
+		err   string
+		valid bool
 	}{
-		{[]byte(""), "", "JSON unmarshaling failed: unexpected end of JSON input", false},
-		{[]byte("{\"user\":\"\"}"), "", "empty username", false},
-		{[]byte("{\"password\":\"\"}"), "", "empty username", false},
-		{[]byte("{\"user\":\"baduser\"}"), "", "empty password", false},
-		{[]byte("{\"user\":\"baduser\",\"password\":\"badpassword\"}"), "", "user not found", false},
-		{[]byte("{\"user\":\"gooduser\",\"password\":\"badpassword\"}"), "", "bad password", false},
-		{[]byte("{\"user\":\"gooduser\",\"password\":\"goodpassword\"}"), "local-gooduser", "", true},
+		{&request.SignRequest{User: ""}, "", "empty username", false},
+		{&request.SignRequest{Password: ""}, "", "empty username", false},
+		{&request.SignRequest{User: "baduser"}, "", "empty password", false},
+		{&request.SignRequest{User: "baduser", Password: "badpassword"}, "", "user not found", false},
+		{&request.SignRequest{User: "gooduser", Password: "badpassword"}, "", "bad password", false},
+		{&request.SignRequest{User: "gooduser", Password: "goodpassword"}, "local-gooduser", "", true},
 	}
 
 	for _, c := range cases {
-		_, valid, id, err := local.Login(context.Background(), c.payload)
+		ctx, valid, id, err := local.Login(context.Background(), c.req)
 
 		assert.Equal(t, c.valid, valid)
 
@@ -53,8 +59,131 @@ users:
 
 		if !c.valid {
 			assert.EqualError(t, err, c.err)
+			continue
 		}
+
+		identity, ok := authenticator.IdentityFromContext(ctx)
+		if assert.True(t, ok) {
+			assert.Equal(t, "gooduser", identity.Username)
+			assert.Equal(t, c.id, identity.ID)
+			assert.Equal(t, "local", identity.Source)
+		}
+	}
+}
+
+func TestAuthenticatorSeedUpgrade(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("otppassword"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// seed JBSWY3DPEHPK3PXP encrypted with the legacy format
+	legacySeed := "2HYAJEWSLXOT3PMLZK6FYIKYCM7EE5LTYW4XYFDMFZDF56TE3SIA===="
+
+	configFile := filepath.Join(t.TempDir(), "signmykey.yml")
+	configBytes := []byte(fmt.Sprintf(`
+# local users
+users:
+  otpuser: "%s,%s"
+`, hash, legacySeed))
+	err = os.WriteFile(configFile, configBytes, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testConfig := viper.New()
+	testConfig.SetConfigType("yaml")
+	err = testConfig.ReadConfig(bytes.NewBuffer(configBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testConfig.Set("upgradeFile", configFile)
+
+	local := &Authenticator{}
+	err = local.Init(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		// next time step as a code can't be used twice
+		otp := util.GenerateOTPCode("JBSWY3DPEHPK3PXP", time.Now().Unix()/30+int64(i))
+		_, valid, _, err := local.Login(context.Background(), &request.SignRequest{User: "otpuser", Password: "otppassword", Otp: otp})
+		assert.NoError(t, err)
+		assert.True(t, valid)
+
+		content, err := os.ReadFile(configFile)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(content), legacySeed)
+		assert.Contains(t, string(content), "# local users\nusers:\n  otpuser: \""+string(hash)+",v2.")
+
+		_, valid, _, err = local.Login(context.Background(), &request.SignRequest{User: "otpuser", Password: "otppassword", Otp: otp})
+		assert.EqualError(t, err, "otp already used")
+		assert.False(t, valid)
+	}
+}
+
+func TestAuthenticatorRecoveryCodes(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("otppassword"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedSeed, err := util.EncryptSeed(util.GenerateSeed(), []byte("otppassword"))
+	if err != nil {
+		t.Fatal(err)
 	}
+	codes, field, err := util.GenerateRecoveryCodes(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configFile := filepath.Join(t.TempDir(), "signmykey.yml")
+	configBytes := []byte(fmt.Sprintf("users:\n  otpuser: \"%s\"\n", util.JoinHashedPassword(string(hash), encryptedSeed, field)))
+	err = os.WriteFile(configFile, configBytes, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testConfig := viper.New()
+	testConfig.SetConfigType("yaml")
+	err = testConfig.ReadConfig(bytes.NewBuffer(configBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// used codes can't be removed without upgrade file
+	local := &Authenticator{}
+	err = local.Init(testConfig)
+	assert.EqualError(t, err, "recovery codes of user otpuser need upgradeFile config entry for Authenticator")
+
+	testConfig.Set("upgradeFile", configFile)
+	local = &Authenticator{}
+	err = local.Init(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		code  string
+		valid bool
+	}{
+		{"aaaa-bbbb-cccc-dddd", false},
+		{codes[0], true},
+		{codes[0], false},
+		{codes[1], true},
+	}
+
+	for _, c := range cases {
+		_, valid, _, err := local.Login(context.Background(), &request.SignRequest{User: "otpuser", Password: "otppassword", Otp: c.code})
+		assert.Equal(t, c.valid, valid, c.code)
+		if !c.valid {
+			assert.EqualError(t, err, "otp does not match", c.code)
+		}
+	}
+
+	// all codes are removed from config file
+	content, err := os.ReadFile(configFile)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("users:\n  otpuser: \"%s,%s\"\n", hash, encryptedSeed), string(content))
 }
 
 func FuzzAuthenticator(f *testing.F) {
@@ -79,7 +208,7 @@ users:
 
 	f.Fuzz(func(t *testing.T, user, password string) {
 
-		_, _, _, err := local.Login(context.Background(), []byte(fmt.Sprintf("{\"user\":\"%s\",\"password\":\"%s\"}", user, password)))
+		_, _, _, err := local.Login(context.Background(), &request.SignRequest{User: user, Password: password})
 		if err == nil && user != "gooduser" && password != "goodpassword" {
 			t.Fail()
 		}
@@ -109,7 +238,7 @@ users:
 
 	f.Fuzz(func(t *testing.T, user, password, otp string) {
 
-		_, _, _, err := local.Login(context.Background(), []byte(fmt.Sprintf("{\"user\":\"%s\",\"password\":\"%s\",\"otp\": \"%s\"}", user, password, otp)))
+		_, _, _, err := local.Login(context.Background(), &request.SignRequest{User: user, Password: password, Otp: otp})
 		if err == nil && user != "gooduser" && password != "goodpassword" {
 			t.Fail()
 		}
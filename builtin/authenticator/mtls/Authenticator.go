@@ -0,0 +1,166 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/spf13/viper"
+)
+
+// Authenticator struct represents mutual TLS options for SMK Authentication.
+type Authenticator struct {
+	ClientCAs *x509.CertPool
+	IDRules   []IDRule
+}
+
+// IDRule maps a field of the client certificate to the user id
+type IDRule struct {
+	Source string
+	Regex  *regexp.Regexp
+}
+
+type idRuleConfig struct {
+	Source string `mapstructure:"source"`
+	Regex  string `mapstructure:"regex"`
+}
+
+var validSources = map[string]bool{
+	"cn":    true,
+	"email": true,
+	"dns":   true,
+	"uri":   true,
+}
+
+// Init method is used to ingest config of Authenticator
+func (a *Authenticator) Init(config *viper.Viper) error {
+	if !config.IsSet("clientCA") {
+		return errors.New("missing config entry \"clientCA\" for Authenticator")
+	}
+
+	caFile := config.GetString("clientCA")
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("error reading client CA file %s: %w", caFile, err)
+	}
+	a.ClientCAs = x509.NewCertPool()
+	if !a.ClientCAs.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no valid certificate found in client CA file %s", caFile)
+	}
+
+	var rulesConfig []idRuleConfig
+	if config.IsSet("idRules") {
+		if err := config.UnmarshalKey("idRules", &rulesConfig); err != nil {
+			return fmt.Errorf("error parsing idRules config entry for Authenticator: %w", err)
+		}
+	} else {
+		rulesConfig = []idRuleConfig{{Source: "cn"}}
+	}
+
+	a.IDRules = []IDRule{}
+	for _, ruleConfig := range rulesConfig {
+		if !validSources[ruleConfig.Source] {
+			return fmt.Errorf("unknown idRules source %q for Authenticator, must be cn, email, dns or uri", ruleConfig.Source)
+		}
+
+		rule := IDRule{Source: ruleConfig.Source}
+		if ruleConfig.Regex != "" {
+			rule.Regex, err = regexp.Compile(ruleConfig.Regex)
+			if err != nil {
+				return fmt.Errorf("error compiling idRules regex %q for Authenticator: %w", ruleConfig.Regex, err)
+			}
+		}
+		a.IDRules = append(a.IDRules, rule)
+	}
+
+	return nil
+}
+
+// Login method is used to check if the client certificate of the request is valid and maps
+// to the user of sign request, the user of the certificate is used when sign request has none.
+func (a *Authenticator) Login(ctx context.Context, req *request.SignRequest) (resultCtx context.Context, valid bool, id string, err error) {
+
+	state, ok := ctx.Value(authenticator.TLSStateKey).(*tls.ConnectionState)
+	if !ok || state == nil || len(state.PeerCertificates) == 0 {
+		return ctx, false, "", errors.New("no client certificate provided")
+	}
+
+	leaf := state.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         a.ClientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return ctx, false, "", fmt.Errorf("invalid client certificate: %w", err)
+	}
+
+	user := a.mapUser(leaf)
+	if user == "" {
+		return ctx, false, "", errors.New("no user found in client certificate")
+	}
+
+	if req.User != "" && req.User != user {
+		return ctx, false, "", fmt.Errorf("user %q doesn't match client certificate user %q", req.User, user)
+	}
+
+	id = fmt.Sprintf("mtls-%s", user)
+	identity := authenticator.NewIdentity("mtls", user, id)
+	identity.Attributes["cn"] = []string{leaf.Subject.CommonName}
+	if len(leaf.EmailAddresses) > 0 {
+		identity.Attributes["mail"] = leaf.EmailAddresses
+	}
+
+	return authenticator.WithIdentity(ctx, identity), true, id, nil
+}
+
+// mapUser returns the user of the first rule matching the certificate
+func (a *Authenticator) mapUser(cert *x509.Certificate) string {
+	for _, rule := range a.IDRules {
+		var values []string
+		switch rule.Source {
+		case "cn":
+			values = []string{cert.Subject.CommonName}
+		case "email":
+			values = cert.EmailAddresses
+		case "dns":
+			values = cert.DNSNames
+		case "uri":
+			for _, uri := range cert.URIs {
+				values = append(values, uri.String())
+			}
+		}
+
+		for _, value := range values {
+			if value == "" {
+				continue
+			}
+
+			if rule.Regex == nil {
+				return value
+			}
+
+			match := rule.Regex.FindStringSubmatch(value)
+			if len(match) == 0 {
+				continue
+			}
+			if len(match) > 1 {
+				return match[1]
+			}
+			return match[0]
+		}
+	}
+
+	return ""
+}
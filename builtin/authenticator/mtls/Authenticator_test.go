@@ -0,0 +1,187 @@
+package mtls
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testCA{cert: cert, key: key}
+}
+
+func (ca testCA) issue(t *testing.T, cn string, emails []string, usage x509.ExtKeyUsage) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		Subject:        pkix.Name{CommonName: cn},
+		EmailAddresses: emails,
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func (ca testCA) writePEM(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestAuthenticatorInit(t *testing.T) {
+	ca := newTestCA(t)
+	caFile := ca.writePEM(t)
+
+	cases := []struct {
+		config []byte
+		err    string
+	}{
+		{[]byte(""), "missing config entry \"clientCA\" for Authenticator"},
+		{[]byte("clientCA: /nonexistent/ca.pem"), "error reading client CA file /nonexistent/ca.pem: open /nonexistent/ca.pem: no such file or directory"},
+		{[]byte("clientCA: " + caFile + "\nidRules:\n  - source: serial\n"), "unknown idRules source \"serial\" for Authenticator, must be cn, email, dns or uri"},
+		{[]byte("clientCA: " + caFile + "\nidRules:\n  - source: cn\n    regex: \"(\"\n"), "error compiling idRules regex \"(\" for Authenticator: error parsing regexp: missing closing ): `(`"},
+		{[]byte("clientCA: " + caFile), ""},
+	}
+
+	for _, c := range cases {
+		testConfig := viper.New()
+		testConfig.SetConfigType("yaml")
+		err := testConfig.ReadConfig(bytes.NewBuffer(c.config))
+		if err != nil {
+			t.Error(err)
+		}
+
+		auth := Authenticator{}
+		err = auth.Init(testConfig)
+		if c.err == "" {
+			assert.NoError(t, err)
+			assert.Equal(t, []IDRule{{Source: "cn"}}, auth.IDRules)
+		} else {
+			assert.EqualError(t, err, c.err)
+		}
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+
+	testConfig := viper.New()
+	testConfig.SetConfigType("yaml")
+	err := testConfig.ReadConfig(bytes.NewBufferString(`
+clientCA: ` + ca.writePEM(t) + `
+idRules:
+  - source: email
+    regex: "^(.+)@my\\.corp$"
+  - source: cn
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := &Authenticator{}
+	if err := auth.Init(testConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		certs   []*x509.Certificate
+		payload string
+		id      string
+		err     string
+	}{
+		{nil, `{"user":"alice"}`, "", "no client certificate provided"},
+		{[]*x509.Certificate{ca.issue(t, "alice", []string{"alice@my.corp"}, x509.ExtKeyUsageClientAuth)}, `{"user":"alice"}`, "mtls-alice", ""},
+		{[]*x509.Certificate{ca.issue(t, "host1", []string{"bob@other.corp"}, x509.ExtKeyUsageClientAuth)}, `{"user":"host1"}`, "mtls-host1", ""},
+		{[]*x509.Certificate{ca.issue(t, "alice", []string{"alice@my.corp"}, x509.ExtKeyUsageClientAuth)}, `{}`, "mtls-alice", ""},
+		{[]*x509.Certificate{ca.issue(t, "alice", []string{"alice@my.corp"}, x509.ExtKeyUsageClientAuth)}, `{"user":"bob"}`, "", "user \"bob\" doesn't match client certificate user \"alice\""},
+		{[]*x509.Certificate{ca.issue(t, "alice", nil, x509.ExtKeyUsageServerAuth)}, `{"user":"alice"}`, "", "invalid client certificate: x509: certificate specifies an incompatible key usage"},
+		{[]*x509.Certificate{otherCA.issue(t, "alice", nil, x509.ExtKeyUsageClientAuth)}, `{"user":"alice"}`, "", "invalid client certificate: x509: certificate signed by unknown authority"},
+		{[]*x509.Certificate{ca.issue(t, "", nil, x509.ExtKeyUsageClientAuth)}, `{"user":""}`, "", "no user found in client certificate"},
+	}
+
+	for _, c := range cases {
+		ctx := context.Background()
+		if c.certs != nil {
+			ctx = context.WithValue(ctx, authenticator.TLSStateKey, &tls.ConnectionState{PeerCertificates: c.certs})
+		}
+
+		req, err := request.Decode([]byte(c.payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, valid, id, err := auth.Login(ctx, req)
+		assert.Equal(t, c.id, id)
+		if c.err == "" {
+			assert.True(t, valid)
+			assert.NoError(t, err)
+		} else {
+			assert.False(t, valid)
+			assert.ErrorContains(t, err, c.err)
+		}
+	}
+}
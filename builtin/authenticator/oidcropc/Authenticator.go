@@ -11,7 +11,8 @@ import (
 	"strings"
 	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
 	"github.com/spf13/viper"
 )
 
@@ -20,16 +21,19 @@ type Authenticator struct {
 	OIDCTokenEndpoint string
 	OIDCClientID      string
 	OIDCClientSecret  string
-}
 
-type oidcLogin struct {
-	User     string `json:"user" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	// Issuer enables discovery of provider endpoints and ID token validation
+	Issuer        string
+	UsernameClaim string
+	GroupsClaim   string
+
+	provider *Provider
 }
 
 type oidcTokenResponse struct {
-	Token string `json:"access_token"`
-	Error string `json:"error"`
+	Token   string `json:"access_token"`
+	IDToken string `json:"id_token"`
+	Error   string `json:"error"`
 }
 
 // OIDCToken represents a OIDC userinfo token
@@ -48,6 +52,10 @@ func (a *Authenticator) Init(config *viper.Viper) error {
 		"oidcClientID",
 		"oidcClientSecret",
 	}
+	// token endpoint is discovered from issuer
+	if config.IsSet("oidcIssuer") {
+		neededEntries = neededEntries[1:]
+	}
 
 	var missingEntriesLst []string
 	for _, entry := range neededEntries {
@@ -64,30 +72,41 @@ func (a *Authenticator) Init(config *viper.Viper) error {
 	a.OIDCClientID = config.GetString("oidcClientID")
 	a.OIDCClientSecret = config.GetString("oidcClientSecret")
 
+	if config.IsSet("oidcIssuer") {
+		config.SetDefault("oidcUsernameClaim", "preferred_username")
+
+		a.Issuer = config.GetString("oidcIssuer")
+		a.UsernameClaim = config.GetString("oidcUsernameClaim")
+		a.GroupsClaim = config.GetString("oidcGroupsClaim")
+		a.provider = NewProvider(a.Issuer)
+	}
+
 	return nil
 }
 
 // Login method is used to check if a couple of user/password is valid in OIDC.
-func (a *Authenticator) Login(ctx context.Context, payload []byte) (resultCtx context.Context, valid bool, id string, err error) {
-
-	var login oidcLogin
-	err = json.Unmarshal(payload, &login)
-	if err != nil {
-		log.Errorf("json unmarshaling failed: %s", err)
-		return ctx, false, "", fmt.Errorf("JSON unmarshaling failed: %w", err)
-	}
+func (a *Authenticator) Login(ctx context.Context, req *request.SignRequest) (resultCtx context.Context, valid bool, id string, err error) {
 
 	v := url.Values{}
 	v.Set("grant_type", "password")
-	v.Add("username", login.User)
-	v.Add("password", login.Password)
+	v.Add("username", req.User)
+	v.Add("password", req.Password)
 	v.Add("client_id", a.OIDCClientID)
 	v.Add("client_secret", a.OIDCClientSecret)
 	v.Add("scope", "openid")
 
 	oidcPayload := strings.NewReader(v.Encode())
 
-	reqToken, err := http.NewRequest("POST", a.OIDCTokenEndpoint, oidcPayload)
+	tokenEndpoint := a.OIDCTokenEndpoint
+	if tokenEndpoint == "" && a.provider != nil {
+		metadata, err := a.provider.Metadata(ctx)
+		if err != nil {
+			return ctx, false, "", err
+		}
+		tokenEndpoint = metadata.TokenEndpoint
+	}
+
+	reqToken, err := http.NewRequestWithContext(ctx, "POST", tokenEndpoint, oidcPayload)
 	if err != nil {
 		return ctx, false, "", err
 	}
@@ -123,5 +142,41 @@ func (a *Authenticator) Login(ctx context.Context, payload []byte) (resultCtx co
 		return ctx, false, "", nil
 	}
 
-	return context.WithValue(ctx, OIDCTokenKey, OIDCToken(tokenRes.Token)), true, fmt.Sprintf("oidc-%s", login.User), nil
+	ctx = context.WithValue(ctx, OIDCTokenKey, OIDCToken(tokenRes.Token))
+
+	if a.provider == nil {
+		id = fmt.Sprintf("oidc-%s", req.User)
+		ctx = authenticator.WithIdentity(ctx, authenticator.NewIdentity("oidcropc", req.User, id))
+
+		return ctx, true, id, nil
+	}
+
+	if tokenRes.IDToken == "" {
+		return ctx, false, "", errors.New("no ID token in token response")
+	}
+
+	claims, err := a.provider.VerifyIDToken(ctx, tokenRes.IDToken, a.OIDCClientID)
+	if err != nil {
+		return ctx, false, "", err
+	}
+
+	username := claims.String(a.UsernameClaim)
+	if username == "" {
+		return ctx, false, "", fmt.Errorf("claim %s not found in ID token", a.UsernameClaim)
+	}
+
+	id = fmt.Sprintf("oidc-%s", username)
+	identity := authenticator.NewIdentity("oidcropc", username, id)
+	if a.GroupsClaim != "" {
+		identity.Groups = claims.Strings(a.GroupsClaim)
+	}
+	if mail := claims.String("email"); mail != "" {
+		identity.Attributes["mail"] = []string{mail}
+	}
+	if name := claims.String("name"); name != "" {
+		identity.Attributes["displayName"] = []string{name}
+	}
+	ctx = authenticator.WithIdentity(ctx, identity)
+
+	return context.WithValue(ctx, IDTokenClaimsKey, claims), true, id, nil
 }
@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"context"
 	"testing"
+	"time"
 
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/internal/oidctest"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
@@ -19,7 +23,7 @@ func TestAuthenticator(t *testing.T) {
 		OIDCClientSecret:  "461c5204-160b-45cf-8609-aa5d500e6093",
 	}
 
-	_, valid, _, err := oidc.Login(context.Background(), []byte("jsonpayload"))
+	_, valid, _, err := oidc.Login(context.Background(), &request.SignRequest{User: "fakeuser", Password: "fakepassword"})
 	if !valid || err != nil {
 		t.Logf("%s", err)
 		t.Fail()
@@ -85,3 +89,114 @@ oidcClientSecret: "461c5204-160b-45cf-8609-aa5d500e6093"
 		}
 	}
 }
+
+func TestAuthenticatorInitIssuer(t *testing.T) {
+	testConfig := viper.New()
+	testConfig.SetConfigType("yaml")
+	err := testConfig.ReadConfig(bytes.NewBuffer([]byte(`
+oidcIssuer: "https://idp.my.corp/realms/mycorp"
+oidcClientID: "signmykey"
+`)))
+	if err != nil {
+		t.Error(err)
+	}
+
+	auth := Authenticator{}
+	assert.EqualError(t, auth.Init(testConfig), "missing config entries (oidcClientSecret) for Authenticator")
+
+	testConfig.Set("oidcClientSecret", "secret")
+	testConfig.Set("oidcGroupsClaim", "groups")
+	auth = Authenticator{}
+	assert.NoError(t, auth.Init(testConfig))
+	assert.Equal(t, "", auth.OIDCTokenEndpoint)
+	assert.Equal(t, "https://idp.my.corp/realms/mycorp", auth.Issuer)
+	assert.Equal(t, "preferred_username", auth.UsernameClaim)
+	assert.Equal(t, "groups", auth.GroupsClaim)
+	assert.NotNil(t, auth.provider)
+}
+
+func TestAuthenticatorIssuer(t *testing.T) {
+	idp := oidctest.NewServer(t, "signmykey", "secret", map[string]oidctest.User{
+		"alice": {Password: "alicepass", Claims: map[string]interface{}{
+			"preferred_username": "alice",
+			"email":              "alice@my.corp",
+			"groups":             []string{"admins", "devs"},
+		}},
+		"bob":   {Password: "bobpass", Claims: map[string]interface{}{"preferred_username": "robert"}},
+		"carol": {Password: "carolpass"},
+		"dave":  {Password: "davepass", Claims: map[string]interface{}{"preferred_username": "dave", "aud": "other"}},
+		"erin":  {Password: "erinpass", Claims: map[string]interface{}{"preferred_username": "erin", "exp": time.Now().Add(-time.Hour).Unix()}},
+		"frank": {Password: "frankpass", Claims: map[string]interface{}{"preferred_username": "frank", "iss": "https://evil.corp"}},
+	})
+
+	testConfig := viper.New()
+	testConfig.Set("oidcIssuer", idp.Issuer)
+	testConfig.Set("oidcClientID", "signmykey")
+	testConfig.Set("oidcClientSecret", "secret")
+	testConfig.Set("oidcGroupsClaim", "groups")
+
+	auth := &Authenticator{}
+	if err := auth.Init(testConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		req *request.SignRequest
+		id  string
+		err string
+	}{
+		{&request.SignRequest{User: "alice", Password: "badpass"}, "", "invalid_grant"},
+		{&request.SignRequest{User: "alice", Password: "alicepass"}, "oidc-alice", ""},
+		{&request.SignRequest{User: "bob", Password: "bobpass"}, "oidc-robert", ""},
+		{&request.SignRequest{User: "carol", Password: "carolpass"}, "", "claim preferred_username not found in ID token"},
+		{&request.SignRequest{User: "dave", Password: "davepass"}, "", "ID token not issued for this client"},
+		{&request.SignRequest{User: "erin", Password: "erinpass"}, "", "ID token expired"},
+		{&request.SignRequest{User: "frank", Password: "frankpass"}, "", "invalid ID token issuer \"https://evil.corp\""},
+	}
+
+	for _, c := range cases {
+		ctx, valid, id, err := auth.Login(context.Background(), c.req)
+		assert.Equal(t, c.err == "", valid, c.req.User)
+		assert.Equal(t, c.id, id, c.req.User)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.req.User)
+			continue
+		}
+		assert.NoError(t, err, c.req.User)
+
+		_, ok := ctx.Value(IDTokenClaimsKey).(IDTokenClaims)
+		assert.True(t, ok, c.req.User)
+	}
+
+	ctx, _, _, err := auth.Login(context.Background(), &request.SignRequest{User: "alice", Password: "alicepass"})
+	assert.NoError(t, err)
+	identity, ok := authenticator.IdentityFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "alice", identity.Username)
+	assert.Equal(t, []string{"admins", "devs"}, identity.Groups)
+	assert.Equal(t, "alice@my.corp", identity.Attribute("mail"))
+
+	// discovery document and keys are cached
+	assert.Equal(t, int64(1), idp.Discoveries.Load())
+	assert.Equal(t, int64(1), idp.KeyFetches.Load())
+}
+
+func TestAuthenticatorTokenEndpoint(t *testing.T) {
+	idp := oidctest.NewServer(t, "signmykey", "secret", map[string]oidctest.User{
+		"alice": {Password: "alicepass"},
+	})
+
+	// without issuer, ID token isn't checked and id is built from request user
+	auth := &Authenticator{
+		OIDCTokenEndpoint: idp.Issuer + "/token",
+		OIDCClientID:      "signmykey",
+		OIDCClientSecret:  "secret",
+	}
+
+	ctx, valid, id, err := auth.Login(context.Background(), &request.SignRequest{User: "alice", Password: "alicepass"})
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Equal(t, "oidc-alice", id)
+	assert.Equal(t, OIDCToken("access-alice"), ctx.Value(OIDCTokenKey))
+	assert.Equal(t, int64(0), idp.Discoveries.Load())
+}
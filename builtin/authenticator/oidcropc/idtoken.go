@@ -0,0 +1,218 @@
+package oidcropc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// idTokenLeeway is the allowed clock skew when checking ID token time claims
+const idTokenLeeway = time.Minute
+
+// IDTokenClaims represents the claims of a verified ID token
+type IDTokenClaims map[string]interface{}
+
+// IDTokenClaimsKeyType represents an ID token claims context key type
+type IDTokenClaimsKeyType string
+
+// IDTokenClaimsKey represents the context key holding IDTokenClaims of the authenticated user
+const IDTokenClaimsKey IDTokenClaimsKeyType = "oidcIDTokenClaims"
+
+// String returns claim name if it is a string, or an empty string
+func (c IDTokenClaims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+// Strings returns claim name as a list, for claims holding a string or a list of strings
+func (c IDTokenClaims) Strings(name string) []string {
+	switch value := c[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := []string{}
+		for _, rawValue := range value {
+			if s, ok := rawValue.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// VerifyIDToken checks signature of raw ID token with provider keys and validates its issuer,
+// audience and time claims.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, clientID string) (IDTokenClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed ID token header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ID token signature: %w", err)
+	}
+
+	key, err := p.key(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := IDTokenClaims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed ID token claims: %w", err)
+	}
+
+	return claims, claims.validate(p.Issuer, clientID, time.Now())
+}
+
+func (c IDTokenClaims) validate(issuer, clientID string, now time.Time) error {
+	if c.String("iss") != issuer {
+		return fmt.Errorf("invalid ID token issuer %q", c.String("iss"))
+	}
+
+	audiences := c.Strings("aud")
+	found := false
+	for _, aud := range audiences {
+		if aud == clientID {
+			found = true
+		}
+	}
+	if !found {
+		return errors.New("ID token not issued for this client")
+	}
+	if azp := c.String("azp"); azp != "" && azp != clientID {
+		return fmt.Errorf("invalid ID token authorized party %q", azp)
+	}
+
+	exp, ok := c["exp"].(float64)
+	if !ok {
+		return errors.New("missing exp claim in ID token")
+	}
+	if now.Add(-idTokenLeeway).After(time.Unix(int64(exp), 0)) {
+		return errors.New("ID token expired")
+	}
+
+	if iat, ok := c["iat"].(float64); ok && now.Add(idTokenLeeway).Before(time.Unix(int64(iat), 0)) {
+		return errors.New("ID token issued in the future")
+	}
+	if nbf, ok := c["nbf"].(float64); ok && now.Add(idTokenLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("ID token not valid yet")
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, v)
+}
+
+func algHash(alg string) (crypto.Hash, error) {
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256, nil
+	case "384":
+		return crypto.SHA384, nil
+	case "512":
+		return crypto.SHA512, nil
+	}
+
+	return 0, fmt.Errorf("unsupported ID token algorithm %q", alg)
+}
+
+func keyMatchesAlg(key crypto.PublicKey, alg string) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		// each ES algorithm is bound to one curve (RFC 7518 section 3.4)
+		return (alg == "ES256" && k.Curve == elliptic.P256()) ||
+			(alg == "ES384" && k.Curve == elliptic.P384()) ||
+			(alg == "ES512" && k.Curve == elliptic.P521())
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	}
+
+	return false
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	if alg == "EdDSA" {
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return errors.New("ID token key doesn't match algorithm")
+		}
+		if !ed25519.Verify(edKey, signed, signature) {
+			return errors.New("invalid ID token signature")
+		}
+		return nil
+	}
+
+	// none and HMAC algorithms are refused, only provider keys can sign ID tokens
+	if len(alg) != 5 || !keyMatchesAlg(key, alg) {
+		return fmt.Errorf("unsupported ID token algorithm %q", alg)
+	}
+
+	hash, err := algHash(alg)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		err = rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), hash, digest, signature)
+	case "PS":
+		err = rsa.VerifyPSS(key.(*rsa.PublicKey), hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES":
+		ecKey := key.(*ecdsa.PublicKey)
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid ID token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			err = errors.New("invalid ID token signature")
+		}
+	}
+	if err != nil {
+		return errors.New("invalid ID token signature")
+	}
+
+	return nil
+}
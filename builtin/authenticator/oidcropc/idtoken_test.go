@@ -0,0 +1,177 @@
+package oidcropc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func signToken(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	var err error
+	digest := sha256.Sum256([]byte(signed))
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, []byte(signed))
+	case *ecdsa.PrivateKey:
+		hash, hashErr := algHash(alg)
+		if hashErr != nil {
+			t.Fatal(hashErr)
+		}
+		h := hash.New()
+		h.Write([]byte(signed))
+		r, s, signErr := ecdsa.Sign(rand.Reader, k, h.Sum(nil))
+		err = signErr
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+	case *rsa.PrivateKey:
+		if strings.HasPrefix(alg, "PS") {
+			signature, err = rsa.SignPSS(rand.Reader, k, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProvider("https://idp.my.corp")
+	p.keys = []providerKey{
+		{kid: "rsa", key: rsaKey.Public()},
+		{kid: "ec", alg: "ES256", key: ecKey.Public()},
+		{kid: "ec384", key: ec384Key.Public()},
+		{kid: "ed", key: edKey.Public()},
+	}
+	// no fetch of provider keys during test
+	p.keysFetched = time.Now()
+
+	claims := map[string]interface{}{
+		"iss": "https://idp.my.corp",
+		"aud": "signmykey",
+		"exp": time.Now().Add(time.Minute).Unix(),
+		"sub": "alice",
+	}
+	rsaToken := signToken(t, "RS256", "rsa", rsaKey, claims)
+	parts := strings.Split(rsaToken, ".")
+
+	cases := []struct {
+		description string
+		token       string
+		err         string
+	}{
+		{"RS256", rsaToken, ""},
+		{"PS256", signToken(t, "PS256", "rsa", rsaKey, claims), ""},
+		{"ES256", signToken(t, "ES256", "ec", ecKey, claims), ""},
+		{"ES384", signToken(t, "ES384", "ec384", ec384Key, claims), ""},
+		{"curve algorithm mismatch", signToken(t, "ES256", "ec384", ecKey, claims), "unsupported ID token algorithm \"ES256\""},
+		{"ES512 with P-384 key", signToken(t, "ES512", "ec384", ec384Key, claims), "unsupported ID token algorithm \"ES512\""},
+		{"ECDSA signature of other curve size", signToken(t, "ES384", "ec384", ecKey, claims), "invalid ID token signature"},
+		{"EdDSA", signToken(t, "EdDSA", "ed", edKey, claims), ""},
+		{"no kid", signToken(t, "ES256", "", ecKey, claims), ""},
+		{"malformed", "abc.def", "malformed ID token"},
+		{"unknown kid", signToken(t, "RS256", "other", rsaKey, claims), "no provider key found for kid \"other\""},
+		{"key of other type", signToken(t, "RS256", "ed", rsaKey, claims), "unsupported ID token algorithm \"RS256\""},
+		{"key algorithm mismatch", signToken(t, "ES384", "ec", ecKey, claims), "no provider key found for kid \"ec\""},
+		{"alg none", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"rsa"}`)) + "." + parts[1] + ".", "unsupported ID token algorithm \"none\""},
+		{"HS256", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","kid":"rsa"}`)) + "." + parts[1] + "." + parts[2], "unsupported ID token algorithm \"HS256\""},
+		{"tampered claims", parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"https://idp.my.corp","aud":"signmykey","exp":9999999999,"sub":"root"}`)) + "." + parts[2], "invalid ID token signature"},
+		{"signed by other key", signToken(t, "EdDSA", "ed", ed25519.NewKeyFromSeed(make([]byte, 32)), claims), "invalid ID token signature"},
+	}
+
+	for _, c := range cases {
+		verified, err := p.VerifyIDToken(context.Background(), c.token, "signmykey")
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.description)
+			continue
+		}
+
+		assert.NoError(t, err, c.description)
+		assert.Equal(t, "alice", verified.String("sub"), c.description)
+	}
+}
+
+func TestIDTokenClaimsValidate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	cases := []struct {
+		claims string
+		err    string
+	}{
+		{`{"iss":"https://idp","aud":"smk","exp":1700000060}`, ""},
+		{`{"iss":"https://idp","aud":["other","smk"],"exp":1700000060}`, ""},
+		{`{"iss":"https://idp","aud":["other","smk"],"azp":"smk","exp":1700000060}`, ""},
+		{`{"iss":"https://idp","aud":["other","smk"],"azp":"other","exp":1700000060}`, "invalid ID token authorized party \"other\""},
+		{`{"iss":"https://other","aud":"smk","exp":1700000060}`, "invalid ID token issuer \"https://other\""},
+		{`{"iss":"https://idp","aud":"other","exp":1700000060}`, "ID token not issued for this client"},
+		{`{"iss":"https://idp","aud":"smk"}`, "missing exp claim in ID token"},
+		{`{"iss":"https://idp","aud":"smk","exp":1699999970}`, ""},
+		{`{"iss":"https://idp","aud":"smk","exp":1699999900}`, "ID token expired"},
+		{`{"iss":"https://idp","aud":"smk","exp":1700000600,"iat":1700000300}`, "ID token issued in the future"},
+		{`{"iss":"https://idp","aud":"smk","exp":1700000600,"nbf":1700000300}`, "ID token not valid yet"},
+	}
+
+	for _, c := range cases {
+		claims := IDTokenClaims{}
+		if err := json.Unmarshal([]byte(c.claims), &claims); err != nil {
+			t.Fatal(err)
+		}
+
+		err := claims.validate("https://idp", "smk", now)
+		if c.err == "" {
+			assert.NoError(t, err, c.claims)
+		} else {
+			assert.EqualError(t, err, c.err, c.claims)
+		}
+	}
+}
+
+func TestIDTokenClaimsStrings(t *testing.T) {
+	claims := IDTokenClaims{}
+	err := json.Unmarshal([]byte(`{"single":"a","list":["b",1,"c"],"number":1}`), &claims)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"a"}, claims.Strings("single"))
+	assert.Equal(t, []string{"b", "c"}, claims.Strings("list"))
+	assert.Nil(t, claims.Strings("number"))
+	assert.Nil(t, claims.Strings("missing"))
+	assert.Equal(t, "", claims.String("list"))
+}
@@ -0,0 +1,259 @@
+package oidcropc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksRefreshInterval is the minimum delay between two fetches of provider keys, when an
+// ID token is signed by an unknown key
+const jwksRefreshInterval = time.Minute
+
+// ProviderMetadata represents the OpenID Connect discovery document of a provider
+type ProviderMetadata struct {
+	Issuer           string `json:"issuer"`
+	TokenEndpoint    string `json:"token_endpoint"`
+	UserinfoEndpoint string `json:"userinfo_endpoint"`
+	JWKSURI          string `json:"jwks_uri"`
+}
+
+// Provider represents an OpenID Connect provider discovered from its issuer URL. Discovery
+// document and signing keys are fetched on first use and cached.
+type Provider struct {
+	Issuer string
+
+	client *http.Client
+
+	mu          sync.Mutex
+	metadata    *ProviderMetadata
+	keys        []providerKey
+	keysFetched time.Time
+}
+
+type providerKey struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewProvider creates new Provider of given issuer URL
+func NewProvider(issuer string) *Provider {
+	return &Provider{
+		Issuer: issuer,
+		client: &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+// Metadata returns the discovery document of provider, fetched from
+// <issuer>/.well-known/openid-configuration
+func (p *Provider) Metadata(ctx context.Context) (*ProviderMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.discover(ctx)
+}
+
+func (p *Provider) discover(ctx context.Context) (*ProviderMetadata, error) {
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	metadata := &ProviderMetadata{}
+	err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", metadata)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+
+	if metadata.Issuer != p.Issuer {
+		return nil, fmt.Errorf("OIDC discovery failed: issuer %q doesn't match configured one", metadata.Issuer)
+	}
+	if metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery failed: missing token_endpoint or jwks_uri")
+	}
+
+	p.metadata = metadata
+
+	return metadata, nil
+}
+
+// key returns the public key identified by kid (or any key usable with alg if kid is empty).
+// Keys are fetched again when not found, at most once per jwksRefreshInterval.
+func (p *Provider) key(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := findKey(p.keys, kid, alg); key != nil {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("no provider key found for kid %q", kid)
+	}
+
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = p.getJSON(ctx, metadata.JWKSURI, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("fetching provider keys failed: %w", err)
+	}
+
+	keys := []providerKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			// ignore unsupported keys, others may be usable
+			continue
+		}
+
+		keys = append(keys, providerKey{kid: jwk.Kid, alg: jwk.Alg, key: key})
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	if key := findKey(p.keys, kid, alg); key != nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("no provider key found for kid %q", kid)
+}
+
+func findKey(keys []providerKey, kid, alg string) crypto.PublicKey {
+	for _, k := range keys {
+		if k.alg != "" && k.alg != alg {
+			continue
+		}
+		if kid != "" && k.kid != kid {
+			continue
+		}
+		if kid == "" && !keyMatchesAlg(k.key, alg) {
+			continue
+		}
+
+		return k.key
+	}
+
+	return nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Accept", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close() // nolint:errcheck
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("unexpected status %d from %s", res.StatusCode, url)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return errors.New("can't read body")
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA key exponent")
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		point := append([]byte{4}, x...)
+		return ecdsa.ParseUncompressedPublicKey(curve, append(point, y...))
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
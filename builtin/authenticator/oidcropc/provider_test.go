@@ -0,0 +1,72 @@
+package oidcropc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/internal/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderMetadata(t *testing.T) {
+	idp := oidctest.NewServer(t, "signmykey", "secret", map[string]oidctest.User{})
+
+	p := NewProvider(idp.Issuer)
+	metadata, err := p.Metadata(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, idp.Issuer+"/token", metadata.TokenEndpoint)
+	assert.Equal(t, idp.Issuer+"/userinfo", metadata.UserinfoEndpoint)
+
+	// issuer returned by discovery must match configured one
+	p = NewProvider(idp.Issuer + "/")
+	_, err = p.Metadata(context.Background())
+	assert.EqualError(t, err, "OIDC discovery failed: issuer \""+idp.Issuer+"\" doesn't match configured one")
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	p = NewProvider(notFound.URL)
+	_, err = p.Metadata(context.Background())
+	assert.EqualError(t, err, "OIDC discovery failed: unexpected status 404 from "+notFound.URL+"/.well-known/openid-configuration")
+}
+
+func TestProviderKeyRotation(t *testing.T) {
+	idp := oidctest.NewServer(t, "signmykey", "secret", map[string]oidctest.User{})
+	claims := map[string]interface{}{
+		"iss": idp.Issuer,
+		"aud": "signmykey",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+
+	p := NewProvider(idp.Issuer)
+	_, err := p.VerifyIDToken(context.Background(), idp.SignIDToken(claims), "signmykey")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), idp.KeyFetches.Load())
+
+	// token signed by a new key isn't valid until keys are fetched again
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.Key = newKey
+	token := idp.SignIDToken(claims)
+
+	_, err = p.VerifyIDToken(context.Background(), token, "signmykey")
+	assert.EqualError(t, err, "invalid ID token signature")
+	assert.Equal(t, int64(1), idp.KeyFetches.Load())
+
+	// keys of unknown kid are fetched again, at most once per jwksRefreshInterval
+	p.keys[0].kid = "old"
+	_, err = p.VerifyIDToken(context.Background(), token, "signmykey")
+	assert.EqualError(t, err, "no provider key found for kid \""+oidctest.KeyID+"\"")
+	assert.Equal(t, int64(1), idp.KeyFetches.Load())
+
+	p.keysFetched = time.Now().Add(-jwksRefreshInterval)
+	_, err = p.VerifyIDToken(context.Background(), token, "signmykey")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), idp.KeyFetches.Load())
+}
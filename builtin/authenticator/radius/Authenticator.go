@@ -0,0 +1,239 @@
+package radius
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// maxChallenges is the maximum number of Access-Challenge round trips during a login
+const maxChallenges = 3
+
+// Authenticator struct represents RADIUS options for SMK Authentication.
+type Authenticator struct {
+	Servers       []string
+	Secret        []byte
+	Timeout       time.Duration
+	NASIdentifier string
+	OTPAppend     bool
+	// RequireMessageAuthenticator rejects responses without Message-Authenticator attribute
+	RequireMessageAuthenticator bool
+}
+
+// unreachableError is returned when a RADIUS server doesn't answer, next server is tried
+type unreachableError struct {
+	err error
+}
+
+func (e unreachableError) Error() string {
+	return e.err.Error()
+}
+
+// Init method is used to ingest config of Authenticator
+func (a *Authenticator) Init(config *viper.Viper) error {
+	neededEntries := []string{
+		"radiusServers",
+		"radiusSecretFile",
+	}
+
+	var missingEntriesLst []string
+	for _, entry := range neededEntries {
+		if !config.IsSet(entry) {
+			missingEntriesLst = append(missingEntriesLst, entry)
+		}
+	}
+	if len(missingEntriesLst) > 0 {
+		missingEntries := strings.Join(missingEntriesLst, ", ")
+		return fmt.Errorf("missing config entries (%s) for Authenticator", missingEntries)
+	}
+
+	config.SetDefault("radiusTimeout", "5s")
+	config.SetDefault("radiusNASIdentifier", "signmykey")
+	config.SetDefault("radiusOTPAppend", false)
+	config.SetDefault("radiusRequireMessageAuthenticator", true)
+
+	a.Servers = config.GetStringSlice("radiusServers")
+	if len(a.Servers) == 0 {
+		return errors.New("empty radiusServers list for Authenticator")
+	}
+	for i, server := range a.Servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			// default RADIUS authentication port
+			a.Servers[i] = net.JoinHostPort(server, "1812")
+		}
+	}
+
+	secret, err := os.ReadFile(config.GetString("radiusSecretFile"))
+	if err != nil {
+		return fmt.Errorf("error reading RADIUS secret file: %w", err)
+	}
+	a.Secret = []byte(strings.TrimSpace(string(secret)))
+	if len(a.Secret) == 0 {
+		return errors.New("empty RADIUS secret")
+	}
+
+	a.Timeout = config.GetDuration("radiusTimeout")
+	if a.Timeout <= 0 {
+		return errors.New("radiusTimeout must be a positive duration")
+	}
+	a.NASIdentifier = config.GetString("radiusNASIdentifier")
+	a.OTPAppend = config.GetBool("radiusOTPAppend")
+	a.RequireMessageAuthenticator = config.GetBool("radiusRequireMessageAuthenticator")
+
+	return nil
+}
+
+// Login method is used to check if a couple of user/password, and optional OTP, is valid on RADIUS servers.
+// Exchanges are limited by the deadline of ctx and no other server is tried once ctx is done.
+func (a *Authenticator) Login(ctx context.Context, req *request.SignRequest) (resultCtx context.Context, valid bool, id string, err error) {
+
+	if len(req.User) == 0 {
+		return ctx, false, "", errors.New("empty username")
+	}
+	if len(req.Password) == 0 {
+		return ctx, false, "", errors.New("empty password")
+	}
+
+	for _, server := range a.Servers {
+		err = a.exchange(ctx, server, req)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctx, false, "", fmt.Errorf("%w: %w", ctxErr, err)
+		}
+
+		var unreachable unreachableError
+		if errors.As(err, &unreachable) {
+			log.Warnf("RADIUS server %s unreachable: %s", server, err)
+			continue
+		}
+		if err != nil {
+			return ctx, false, "", err
+		}
+
+		id = fmt.Sprintf("radius-%s", req.User)
+		return authenticator.WithIdentity(ctx, authenticator.NewIdentity("radius", req.User, id)), true, id, nil
+	}
+
+	return ctx, false, "", errors.New("no RADIUS server reachable")
+}
+
+// exchange runs an authentication on server, following Access-Challenge round trips.
+func (a *Authenticator) exchange(ctx context.Context, server string, req *request.SignRequest) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return unreachableError{err}
+	}
+	defer conn.Close() // nolint:errcheck
+
+	// closing the connection fails pending reads
+	stop := context.AfterFunc(ctx, func() { conn.Close() }) // nolint:errcheck
+	defer stop()
+
+	password := req.Password
+	otpSent := false
+	if a.OTPAppend && req.Otp != "" {
+		password += req.Otp
+		otpSent = true
+	}
+
+	var state []byte
+	for i := 0; i <= maxChallenges; i++ {
+		response, err := a.send(ctx, conn, req.User, password, state)
+		if err != nil {
+			return err
+		}
+
+		switch response.Code {
+		case codeAccessAccept:
+			return nil
+		case codeAccessReject:
+			if msg := response.get(attrReplyMessage); msg != nil {
+				return fmt.Errorf("access rejected: %s", msg)
+			}
+			return errors.New("access rejected")
+		case codeAccessChallenge:
+			if otpSent {
+				return errors.New("unexpected RADIUS challenge")
+			}
+			if req.Otp == "" {
+				return errors.New("otp required but not provided")
+			}
+			password = req.Otp
+			otpSent = true
+			state = response.get(attrState)
+		default:
+			return fmt.Errorf("unexpected RADIUS response code %d", response.Code)
+		}
+	}
+
+	return errors.New("too many RADIUS challenges")
+}
+
+// send sends an Access-Request on conn and waits for its authenticated response, until
+// Timeout or the deadline of ctx.
+func (a *Authenticator) send(ctx context.Context, conn net.Conn, user, password string, state []byte) (*packet, error) {
+	identifier := make([]byte, 1)
+	if _, err := rand.Read(identifier); err != nil {
+		return nil, err
+	}
+
+	accessReq, err := newAccessRequest(identifier[0])
+	if err != nil {
+		return nil, err
+	}
+	hidden, err := hidePassword([]byte(password), a.Secret, accessReq.Authenticator)
+	if err != nil {
+		return nil, err
+	}
+	accessReq.add(attrUserName, []byte(user))
+	accessReq.add(attrUserPassword, hidden)
+	accessReq.add(attrNASIdentifier, []byte(a.NASIdentifier))
+	if state != nil {
+		accessReq.add(attrState, state)
+	}
+
+	raw, err := accessReq.encodeRequest(a.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(a.Timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, unreachableError{err}
+	}
+	if _, err := conn.Write(raw); err != nil {
+		return nil, unreachableError{err}
+	}
+
+	buf := make([]byte, maxPacketLen)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, unreachableError{err}
+		}
+
+		// ignore late answers to previous requests and forged packets
+		if n < headerLen || buf[1] != accessReq.Identifier {
+			continue
+		}
+		if err := checkResponse(buf[:n], accessReq, a.Secret, a.RequireMessageAuthenticator); err != nil {
+			log.Warnf("dropping RADIUS response from %s: %s", conn.RemoteAddr(), err)
+			continue
+		}
+
+		return decodePacket(buf[:n])
+	}
+}
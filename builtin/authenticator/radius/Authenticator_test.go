@@ -0,0 +1,293 @@
+package radius
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5" // nolint:gosec
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeResponse encodes a response to request with its response authenticator, and a
+// Message-Authenticator attribute if msgAuth is set.
+func (p *packet) encodeResponse(accessReq *packet, secret []byte, msgAuth bool) ([]byte, error) {
+	p.Identifier = accessReq.Identifier
+	p.Authenticator = accessReq.Authenticator
+	if msgAuth {
+		p.add(attrMessageAuthenticator, make([]byte, 16))
+	}
+	raw, err := p.encode()
+	if err != nil {
+		return nil, err
+	}
+	if msgAuth {
+		mac := hmac.New(md5.New, secret)
+		mac.Write(raw)
+		copy(raw[len(raw)-16:], mac.Sum(nil))
+	}
+
+	hash := md5.New() // nolint:gosec
+	hash.Write(raw)
+	hash.Write(secret)
+	copy(raw[4:20], hash.Sum(nil))
+
+	return raw, nil
+}
+
+// revealPassword decrypts a User-Password attribute value hidden with hidePassword.
+func revealPassword(hidden, secret []byte, authenticator [16]byte) ([]byte, error) {
+	if len(hidden) == 0 || len(hidden)%16 != 0 {
+		return nil, errors.New("invalid RADIUS User-Password length")
+	}
+	password := make([]byte, len(hidden))
+
+	last := authenticator[:]
+	for i := 0; i < len(hidden); i += 16 {
+		hash := md5.New() // nolint:gosec
+		hash.Write(secret)
+		hash.Write(last)
+		sum := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			password[i+j] = hidden[i+j] ^ sum[j]
+		}
+		last = hidden[i : i+16]
+	}
+
+	return bytes.TrimRight(password, "\x00"), nil
+}
+
+// startResponder starts an in-process RADIUS server accepting:
+//   - alice with password "alicepass"
+//   - bob with password "bobpass" then OTP "123456" after an Access-Challenge
+//   - carol with password and OTP appended "carolpass123456"
+//
+// Responses hold a Message-Authenticator attribute if msgAuth is set.
+func startResponder(t *testing.T, secret []byte, msgAuth bool) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() }) // nolint:errcheck
+
+	go func() {
+		buf := make([]byte, maxPacketLen)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			accessReq, err := decodePacket(buf[:n])
+			if err != nil || accessReq.Code != codeAccessRequest {
+				continue
+			}
+
+			// check Message-Authenticator of request
+			raw := append([]byte{}, buf[:n]...)
+			reqMsgAuth := append([]byte{}, accessReq.get(attrMessageAuthenticator)...)
+			copy(raw[n-16:], make([]byte, 16))
+			mac := hmac.New(md5.New, secret)
+			mac.Write(raw)
+			if !hmac.Equal(mac.Sum(nil), reqMsgAuth) {
+				continue
+			}
+
+			password, err := revealPassword(accessReq.get(attrUserPassword), secret, accessReq.Authenticator)
+			if err != nil {
+				continue
+			}
+
+			response := &packet{Code: codeAccessReject}
+			switch user, pass, state := string(accessReq.get(attrUserName)), string(password), string(accessReq.get(attrState)); {
+			case user == "alice" && pass == "alicepass":
+				response.Code = codeAccessAccept
+			case user == "bob" && pass == "bobpass" && state == "":
+				response.Code = codeAccessChallenge
+				response.add(attrState, []byte("bob-state"))
+				response.add(attrReplyMessage, []byte("Enter OTP"))
+			case user == "bob" && pass == "123456" && state == "bob-state":
+				response.Code = codeAccessAccept
+			case user == "carol" && pass == "carolpass123456":
+				response.Code = codeAccessAccept
+			default:
+				response.add(attrReplyMessage, []byte("bad credentials"))
+			}
+
+			out, err := response.encodeResponse(accessReq, secret, msgAuth)
+			if err != nil {
+				continue
+			}
+			_, _ = conn.WriteTo(out, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// startBlackhole starts an UDP server which never answers
+func startBlackhole(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() }) // nolint:errcheck
+
+	return conn.LocalAddr().String()
+}
+
+func writeSecret(t *testing.T, secret string) string {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte(secret+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestPasswordHiding(t *testing.T) {
+	secret := []byte("secret")
+	auth := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	for _, password := range []string{"", "short", "exactly16bytes!!", "a password longer than sixteen bytes"} {
+		hidden, err := hidePassword([]byte(password), secret, auth)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(hidden)%16)
+
+		revealed, err := revealPassword(hidden, secret, auth)
+		assert.NoError(t, err)
+		assert.Equal(t, password, string(revealed))
+	}
+
+	_, err := hidePassword(bytes.Repeat([]byte("a"), 129), secret, auth)
+	assert.EqualError(t, err, "password too long for RADIUS")
+}
+
+func TestAuthenticatorInit(t *testing.T) {
+	secretFile := writeSecret(t, "testing123")
+
+	cases := []struct {
+		config []byte
+		err    string
+	}{
+		{[]byte(""), "missing config entries (radiusServers, radiusSecretFile) for Authenticator"},
+		{[]byte("radiusServers: []\nradiusSecretFile: " + secretFile), "empty radiusServers list for Authenticator"},
+		{[]byte("radiusServers: [127.0.0.1]\nradiusSecretFile: /nonexistent"), "error reading RADIUS secret file: open /nonexistent: no such file or directory"},
+		{[]byte("radiusServers: [127.0.0.1]\nradiusSecretFile: " + secretFile + "\nradiusTimeout: 0s"), "radiusTimeout must be a positive duration"},
+		{[]byte("radiusServers: [127.0.0.1]\nradiusSecretFile: " + secretFile), ""},
+	}
+
+	for _, c := range cases {
+		testConfig := viper.New()
+		testConfig.SetConfigType("yaml")
+		err := testConfig.ReadConfig(bytes.NewBuffer(c.config))
+		if err != nil {
+			t.Error(err)
+		}
+
+		auth := Authenticator{}
+		err = auth.Init(testConfig)
+		if c.err == "" {
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"127.0.0.1:1812"}, auth.Servers)
+			assert.Equal(t, []byte("testing123"), auth.Secret)
+			assert.Equal(t, "signmykey", auth.NASIdentifier)
+		} else {
+			assert.EqualError(t, err, c.err)
+		}
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	secret := []byte("testing123")
+	responder := startResponder(t, secret, true)
+	legacyResponder := startResponder(t, secret, false)
+	blackhole := startBlackhole(t)
+
+	cases := []struct {
+		description string
+		servers     []string
+		secret      string
+		otpAppend   bool
+		req         *request.SignRequest
+		id          string
+		err         string
+		noMsgAuth   bool
+	}{
+		{"empty user", []string{responder}, "testing123", false, &request.SignRequest{Password: "alicepass"}, "", "empty username", false},
+		{"empty password", []string{responder}, "testing123", false, &request.SignRequest{User: "alice"}, "", "empty password", false},
+		{"valid password", []string{responder}, "testing123", false, &request.SignRequest{User: "alice", Password: "alicepass"}, "radius-alice", "", false},
+		{"bad password", []string{responder}, "testing123", false, &request.SignRequest{User: "alice", Password: "badpass"}, "", "access rejected: bad credentials", false},
+		{"challenge with otp", []string{responder}, "testing123", false, &request.SignRequest{User: "bob", Password: "bobpass", Otp: "123456"}, "radius-bob", "", false},
+		{"challenge with bad otp", []string{responder}, "testing123", false, &request.SignRequest{User: "bob", Password: "bobpass", Otp: "654321"}, "", "access rejected: bad credentials", false},
+		{"challenge without otp", []string{responder}, "testing123", false, &request.SignRequest{User: "bob", Password: "bobpass"}, "", "otp required but not provided", false},
+		{"appended otp", []string{responder}, "testing123", true, &request.SignRequest{User: "carol", Password: "carolpass", Otp: "123456"}, "radius-carol", "", false},
+		{"failover to second server", []string{blackhole, responder}, "testing123", false, &request.SignRequest{User: "alice", Password: "alicepass"}, "radius-alice", "", false},
+		{"no server reachable", []string{blackhole}, "testing123", false, &request.SignRequest{User: "alice", Password: "alicepass"}, "", "no RADIUS server reachable", false},
+		{"bad secret", []string{responder}, "badsecret", false, &request.SignRequest{User: "alice", Password: "alicepass"}, "", "no RADIUS server reachable", false},
+		{"missing message authenticator", []string{legacyResponder}, "testing123", false, &request.SignRequest{User: "alice", Password: "alicepass"}, "", "no RADIUS server reachable", false},
+		{"message authenticator not required", []string{legacyResponder}, "testing123", false, &request.SignRequest{User: "alice", Password: "alicepass"}, "radius-alice", "", true},
+	}
+
+	for _, c := range cases {
+		testConfig := viper.New()
+		testConfig.Set("radiusServers", c.servers)
+		testConfig.Set("radiusSecretFile", writeSecret(t, c.secret))
+		testConfig.Set("radiusTimeout", "200ms")
+		testConfig.Set("radiusOTPAppend", c.otpAppend)
+		testConfig.Set("radiusRequireMessageAuthenticator", !c.noMsgAuth)
+
+		auth := &Authenticator{}
+		err := auth.Init(testConfig)
+		if !assert.NoError(t, err, c.description) {
+			continue
+		}
+
+		_, valid, id, err := auth.Login(context.Background(), c.req)
+		assert.Equal(t, c.err == "", valid, c.description)
+		assert.Equal(t, c.id, id, c.description)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.description)
+		} else {
+			assert.NoError(t, err, c.description)
+		}
+	}
+}
+
+func TestAuthenticatorContext(t *testing.T) {
+	secret := []byte("testing123")
+	responder := startResponder(t, secret, true)
+	blackhole := startBlackhole(t)
+
+	auth := &Authenticator{
+		Servers:                     []string{blackhole, responder},
+		Secret:                      secret,
+		Timeout:                     time.Minute,
+		NASIdentifier:               "signmykey",
+		RequireMessageAuthenticator: true,
+	}
+	req := &request.SignRequest{User: "alice", Password: "alicepass"}
+
+	// exchanges stop at the deadline of context, next servers aren't tried
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, valid, _, err := auth.Login(ctx, req)
+	assert.False(t, valid)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, valid, _, err = auth.Login(ctx, &request.SignRequest{User: "alice", Password: "alicepass"})
+	assert.False(t, valid)
+	assert.ErrorIs(t, err, context.Canceled)
+}
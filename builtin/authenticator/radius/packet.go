@@ -0,0 +1,202 @@
+package radius
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5" // nolint:gosec
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// RADIUS packet codes and attribute types used by the Authenticator (RFC 2865 and RFC 3579)
+const (
+	codeAccessRequest   byte = 1
+	codeAccessAccept    byte = 2
+	codeAccessReject    byte = 3
+	codeAccessChallenge byte = 11
+
+	attrUserName             byte = 1
+	attrUserPassword         byte = 2
+	attrReplyMessage         byte = 18
+	attrState                byte = 24
+	attrNASIdentifier        byte = 32
+	attrMessageAuthenticator byte = 80
+
+	headerLen    = 20
+	maxPacketLen = 4096
+)
+
+type attribute struct {
+	Type  byte
+	Value []byte
+}
+
+type packet struct {
+	Code          byte
+	Identifier    byte
+	Authenticator [16]byte
+	Attributes    []attribute
+}
+
+func (p *packet) get(attrType byte) []byte {
+	for _, attr := range p.Attributes {
+		if attr.Type == attrType {
+			return attr.Value
+		}
+	}
+
+	return nil
+}
+
+func (p *packet) add(attrType byte, value []byte) {
+	p.Attributes = append(p.Attributes, attribute{Type: attrType, Value: value})
+}
+
+func (p *packet) encode() ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, headerLen))
+	for _, attr := range p.Attributes {
+		if len(attr.Value) > 253 {
+			return nil, fmt.Errorf("RADIUS attribute %d too long", attr.Type)
+		}
+		buf.WriteByte(attr.Type)
+		buf.WriteByte(byte(len(attr.Value) + 2))
+		buf.Write(attr.Value)
+	}
+
+	raw := buf.Bytes()
+	if len(raw) > maxPacketLen {
+		return nil, errors.New("RADIUS packet too long")
+	}
+	raw[0] = p.Code
+	raw[1] = p.Identifier
+	binary.BigEndian.PutUint16(raw[2:4], uint16(len(raw)))
+	copy(raw[4:20], p.Authenticator[:])
+
+	return raw, nil
+}
+
+func decodePacket(raw []byte) (*packet, error) {
+	if len(raw) < headerLen {
+		return nil, errors.New("RADIUS packet too short")
+	}
+	length := int(binary.BigEndian.Uint16(raw[2:4]))
+	if length < headerLen || length > len(raw) || length > maxPacketLen {
+		return nil, errors.New("invalid RADIUS packet length")
+	}
+
+	p := &packet{Code: raw[0], Identifier: raw[1]}
+	copy(p.Authenticator[:], raw[4:20])
+
+	attrs := raw[headerLen:length]
+	for len(attrs) > 0 {
+		if len(attrs) < 2 || int(attrs[1]) < 2 || int(attrs[1]) > len(attrs) {
+			return nil, errors.New("invalid RADIUS attribute")
+		}
+		p.add(attrs[0], append([]byte{}, attrs[2:attrs[1]]...))
+		attrs = attrs[attrs[1]:]
+	}
+
+	return p, nil
+}
+
+// newAccessRequest returns an Access-Request with a random request authenticator.
+func newAccessRequest(identifier byte) (*packet, error) {
+	p := &packet{Code: codeAccessRequest, Identifier: identifier}
+	if _, err := rand.Read(p.Authenticator[:]); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// encodeRequest encodes an Access-Request with a Message-Authenticator attribute.
+func (p *packet) encodeRequest(secret []byte) ([]byte, error) {
+	p.add(attrMessageAuthenticator, make([]byte, 16))
+	raw, err := p.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(md5.New, secret)
+	mac.Write(raw)
+	copy(raw[len(raw)-16:], mac.Sum(nil))
+
+	return raw, nil
+}
+
+// checkResponse verifies the response authenticator and the Message-Authenticator attribute of
+// a raw response to request. A missing Message-Authenticator is only accepted when
+// requireMsgAuth is false.
+func checkResponse(raw []byte, accessReq *packet, secret []byte, requireMsgAuth bool) error {
+	if len(raw) < headerLen {
+		return errors.New("RADIUS packet too short")
+	}
+	length := int(binary.BigEndian.Uint16(raw[2:4]))
+	if length < headerLen || length > len(raw) {
+		return errors.New("invalid RADIUS packet length")
+	}
+	raw = append([]byte{}, raw[:length]...)
+	respAuth := append([]byte{}, raw[4:20]...)
+	copy(raw[4:20], accessReq.Authenticator[:])
+
+	hash := md5.New() // nolint:gosec
+	hash.Write(raw)
+	hash.Write(secret)
+	if !hmac.Equal(hash.Sum(nil), respAuth) {
+		return errors.New("invalid RADIUS response authenticator")
+	}
+
+	// Message-Authenticator is computed with the request authenticator and a zeroed value
+	msgAuthFound := false
+	offset := headerLen
+	for offset+2 <= length {
+		attrLen := int(raw[offset+1])
+		if attrLen < 2 || offset+attrLen > length {
+			return errors.New("invalid RADIUS attribute")
+		}
+		if raw[offset] == attrMessageAuthenticator && attrLen == 18 {
+			msgAuth := append([]byte{}, raw[offset+2:offset+18]...)
+			copy(raw[offset+2:offset+18], make([]byte, 16))
+			mac := hmac.New(md5.New, secret)
+			mac.Write(raw)
+			if !hmac.Equal(mac.Sum(nil), msgAuth) {
+				return errors.New("invalid RADIUS Message-Authenticator")
+			}
+			msgAuthFound = true
+		}
+		offset += attrLen
+	}
+	if requireMsgAuth && !msgAuthFound {
+		return errors.New("missing RADIUS Message-Authenticator")
+	}
+
+	return nil
+}
+
+// hidePassword encrypts a User-Password attribute value as described in RFC 2865 section 5.2.
+func hidePassword(password, secret []byte, authenticator [16]byte) ([]byte, error) {
+	if len(password) > 128 {
+		return nil, errors.New("password too long for RADIUS")
+	}
+	padded := make([]byte, (len(password)+15)/16*16)
+	if len(padded) == 0 {
+		padded = make([]byte, 16)
+	}
+	copy(padded, password)
+
+	last := authenticator[:]
+	for i := 0; i < len(padded); i += 16 {
+		hash := md5.New() // nolint:gosec
+		hash.Write(secret)
+		hash.Write(last)
+		sum := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			padded[i+j] ^= sum[j]
+		}
+		last = padded[i : i+16]
+	}
+
+	return padded, nil
+}
@@ -0,0 +1,136 @@
+package sshkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	ldapAuth "github.com/signmykeyio/signmykey/builtin/authenticator/ldap"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
+)
+
+// LoginNamespace is the SSHSIG namespace used to sign login nonces
+const LoginNamespace = util.LoginNamespace
+
+// Authenticator struct represents SSH keys options for SMK Authentication.
+type Authenticator struct {
+	// UserKeys is the map of registered keys by user when keys are configured locally
+	UserKeys map[string][]ssh.PublicKey
+
+	// LDAP is used to read keys from users LDAP entries, with the connection options of LDAP
+	// Authenticator
+	LDAP         *ldapAuth.Authenticator
+	KeyAttribute string
+}
+
+// Init method is used to ingest config of Authenticator
+func (a *Authenticator) Init(config *viper.Viper) error {
+	if config.IsSet("users") {
+		a.UserKeys = map[string][]ssh.PublicKey{}
+		for user, keys := range config.GetStringMapStringSlice("users") {
+			for _, key := range keys {
+				pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+				if err != nil {
+					return fmt.Errorf("error parsing SSH key of user %s: %w", user, err)
+				}
+				a.UserKeys[user] = append(a.UserKeys[user], pubKey)
+			}
+		}
+
+		return nil
+	}
+
+	if !config.IsSet("ldapURLs") && !config.IsSet("ldapAddr") {
+		return errors.New("missing config entries (users or ldapURLs) for Authenticator")
+	}
+
+	a.LDAP = &ldapAuth.Authenticator{}
+	if err := a.LDAP.Init(config); err != nil {
+		return err
+	}
+
+	config.SetDefault("ldapKeyAttribute", "sshPublicKey")
+	a.KeyAttribute = config.GetString("ldapKeyAttribute")
+
+	return nil
+}
+
+// Login method is used to check if the login nonce is signed by one of the registered SSH keys of user.
+func (a *Authenticator) Login(ctx context.Context, req *request.SignRequest) (resultCtx context.Context, valid bool, id string, err error) {
+
+	if len(req.User) == 0 {
+		return ctx, false, "", errors.New("empty username")
+	}
+	if len(req.Nonce) == 0 || len(req.Signature) == 0 {
+		return ctx, false, "", errors.New("empty nonce or signature")
+	}
+
+	if err := util.ConsumeNonce(req.Nonce); err != nil {
+		return ctx, false, "", err
+	}
+
+	signingKey, err := util.SSHVerify([]byte(req.Signature), LoginNamespace, []byte(req.Nonce))
+	if err != nil {
+		return ctx, false, "", err
+	}
+
+	// viper map keys of local users are lower case, LDAP users get the same identity
+	user := strings.ToLower(req.User)
+
+	userKeys, entry, err := a.getUserKeys(user)
+	if err != nil {
+		return ctx, false, "", err
+	}
+
+	for _, key := range userKeys {
+		if string(key.Marshal()) == string(signingKey.Marshal()) {
+			if entry != nil {
+				if err := a.LDAP.CheckAccess(entry); err != nil {
+					return ctx, false, "", err
+				}
+			}
+
+			id = fmt.Sprintf("sshkey-%s", user)
+			identity := authenticator.NewIdentity("sshkey", user, id)
+			identity.Attributes["fingerprint"] = []string{ssh.FingerprintSHA256(signingKey)}
+			return authenticator.WithIdentity(ctx, identity), true, id, nil
+		}
+	}
+
+	return ctx, false, "", fmt.Errorf("key %s not registered for user", ssh.FingerprintSHA256(signingKey))
+}
+
+// getUserKeys returns the registered keys of user, and its LDAP entry when keys are read from LDAP
+func (a *Authenticator) getUserKeys(user string) ([]ssh.PublicKey, *ldap.Entry, error) {
+	if a.UserKeys != nil {
+		keys, ok := a.UserKeys[user]
+		if !ok {
+			return nil, nil, errors.New("user not found")
+		}
+		return keys, nil, nil
+	}
+
+	entry, err := a.LDAP.SearchUser(user, []string{a.KeyAttribute})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := []ssh.PublicKey{}
+	for _, value := range entry.GetAttributeValues(a.KeyAttribute) {
+		pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(value))
+		if err != nil {
+			log.Warnf("invalid SSH key in %s attribute of %s: %s", a.KeyAttribute, entry.DN, err)
+			continue
+		}
+		keys = append(keys, pubKey)
+	}
+
+	return keys, entry, nil
+}
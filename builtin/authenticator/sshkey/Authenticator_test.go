@@ -0,0 +1,226 @@
+package sshkey
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/internal/ldaptest"
+	"github.com/signmykeyio/signmykey/util"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer
+}
+
+func TestAuthenticatorInit(t *testing.T) {
+	cases := []struct {
+		config []byte
+		err    string
+	}{
+		{[]byte(""), "missing config entries (users or ldapURLs) for Authenticator"},
+		{[]byte("ldapURLs: [ldap://127.0.0.1]\nldapBindUser: binduser\n"), "missing config entries (ldapBindPassword, ldapBase, ldapSearch) for Authenticator"},
+		{[]byte("users:\n  alice:\n    - invalidkey\n"), "error parsing SSH key of user alice: ssh: no key found"},
+		{[]byte(`
+ldapAddr: 127.0.0.1
+ldapPort: 636
+ldapTLS: True
+ldapTLSVerify: True
+ldapBindUser: binduser
+ldapBindPassword: bindpassword
+ldapBase: "DC=fake,DC=org"
+ldapSearch: "(uid=%s)"
+`), ""},
+	}
+
+	for _, c := range cases {
+		testConfig := viper.New()
+		testConfig.SetConfigType("yaml")
+		err := testConfig.ReadConfig(bytes.NewBuffer(c.config))
+		if err != nil {
+			t.Error(err)
+		}
+
+		auth := Authenticator{}
+		err = auth.Init(testConfig)
+		if c.err == "" {
+			assert.NoError(t, err)
+			assert.Equal(t, "sshPublicKey", auth.KeyAttribute)
+		} else {
+			assert.EqualError(t, err, c.err)
+		}
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	aliceKey := newTestSigner(t)
+	aliceOtherKey := newTestSigner(t)
+	unknownKey := newTestSigner(t)
+
+	testConfig := viper.New()
+	testConfig.SetConfigType("yaml")
+	err := testConfig.ReadConfig(bytes.NewBufferString(`
+users:
+  alice:
+    - ` + string(ssh.MarshalAuthorizedKey(aliceKey.PublicKey())) + `
+    - ` + string(ssh.MarshalAuthorizedKey(aliceOtherKey.PublicKey())) + `
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := &Authenticator{}
+	if err := auth.Init(testConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(user string, key ssh.Signer, namespace string) *request.SignRequest {
+		nonce := util.IssueNonce()
+		sig, err := util.SSHSign(key, namespace, []byte(nonce))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &request.SignRequest{User: user, Nonce: nonce, Signature: string(sig)}
+	}
+
+	replayed := login("alice", aliceKey, LoginNamespace)
+	_, valid, _, err := auth.Login(context.Background(), replayed)
+	assert.True(t, valid)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		req *request.SignRequest
+		id  string
+		err string
+	}{
+		{&request.SignRequest{Nonce: "nonce", Signature: "sig"}, "", "empty username"},
+		{&request.SignRequest{User: "alice"}, "", "empty nonce or signature"},
+		{&request.SignRequest{User: "alice", Nonce: "badnonce", Signature: "sig"}, "", "invalid nonce"},
+		{replayed, "", "nonce already used"},
+		{login("alice", aliceKey, "other@signmykey.io"), "", "SSHSIG namespace \"other@signmykey.io\" doesn't match expected \"login@signmykey.io\""},
+		{login("bob", aliceKey, LoginNamespace), "", "user not found"},
+		{login("alice", unknownKey, LoginNamespace), "", "key " + ssh.FingerprintSHA256(unknownKey.PublicKey()) + " not registered for user"},
+		{login("alice", aliceKey, LoginNamespace), "sshkey-alice", ""},
+		{login("alice", aliceOtherKey, LoginNamespace), "sshkey-alice", ""},
+		{login("Alice", aliceKey, LoginNamespace), "sshkey-alice", ""},
+	}
+
+	for _, c := range cases {
+		_, valid, id, err := auth.Login(context.Background(), c.req)
+		assert.Equal(t, c.id, id)
+		if c.err == "" {
+			assert.True(t, valid)
+			assert.NoError(t, err)
+		} else {
+			assert.False(t, valid)
+			assert.EqualError(t, err, c.err)
+		}
+	}
+}
+
+func TestAuthenticatorLDAP(t *testing.T) {
+	aliceKey := newTestSigner(t)
+	bobKey := newTestSigner(t)
+	carolKey := newTestSigner(t)
+
+	tlsConfig, caPEM := ldaptest.NewTLSConfig(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	srv := ldaptest.NewTLSServer(t, []ldaptest.Entry{
+		{DN: "cn=svc,dc=test", Password: "svcpassword"},
+		{DN: "uid=alice,ou=users,dc=test", Attributes: map[string][]string{
+			"uid":                {"alice"},
+			"memberOf":           {"cn=ssh-users,ou=groups,dc=test"},
+			"userAccountControl": {"512"},
+			"sshPublicKey":       {"invalidkey", string(ssh.MarshalAuthorizedKey(aliceKey.PublicKey()))},
+		}},
+		{DN: "uid=bob,ou=users,dc=test", Attributes: map[string][]string{
+			"uid":                {"bob"},
+			"memberOf":           {"cn=ssh-users,ou=groups,dc=test"},
+			"userAccountControl": {"514"},
+			"sshPublicKey":       {string(ssh.MarshalAuthorizedKey(bobKey.PublicKey()))},
+		}},
+		{DN: "uid=carol,ou=users,dc=test", Attributes: map[string][]string{
+			"uid":          {"carol"},
+			"sshPublicKey": {string(ssh.MarshalAuthorizedKey(carolKey.PublicKey()))},
+		}},
+	}, tlsConfig)
+
+	login := func(auth *Authenticator, user string, key ssh.Signer) (bool, string, error) {
+		nonce := util.IssueNonce()
+		sig, err := util.SSHSign(key, LoginNamespace, []byte(nonce))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, valid, id, err := auth.Login(context.Background(), &request.SignRequest{User: user, Nonce: nonce, Signature: string(sig)})
+		return valid, id, err
+	}
+
+	testConfig := viper.New()
+	testConfig.Set("ldapURLs", []string{srv.URL})
+	testConfig.Set("ldapBindUser", "cn=svc,dc=test")
+	testConfig.Set("ldapBindPassword", "svcpassword")
+	testConfig.Set("ldapBase", "ou=users,dc=test")
+	testConfig.Set("ldapSearch", "(uid=%s)")
+
+	// server certificate is verified by default
+	auth := &Authenticator{}
+	if err := auth.Init(testConfig); err != nil {
+		t.Fatal(err)
+	}
+	valid, _, err := login(auth, "alice", aliceKey)
+	assert.ErrorContains(t, err, "certificate")
+	assert.False(t, valid)
+
+	testConfig.Set("ldapCAFile", caFile)
+	testConfig.Set("ldapAccountChecks", true)
+	testConfig.Set("ldapRequireFilter", "(memberOf=cn=ssh-users,ou=groups,dc=test)")
+	auth = &Authenticator{}
+	if err := auth.Init(testConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		user string
+		key  ssh.Signer
+		id   string
+		err  string
+	}{
+		{"alice", aliceKey, "sshkey-alice", ""},
+		{"Alice", aliceKey, "sshkey-alice", ""},
+		{"bob", bobKey, "", "account disabled"},
+		{"carol", carolKey, "", "user not allowed to log in"},
+	}
+	for _, c := range cases {
+		valid, id, err := login(auth, c.user, c.key)
+		assert.Equal(t, c.err == "", valid, c.user)
+		assert.Equal(t, c.id, id, c.user)
+		if c.err == "" {
+			assert.NoError(t, err, c.user)
+		} else {
+			var deniedErr *authenticator.DeniedError
+			assert.ErrorAs(t, err, &deniedErr, c.user)
+			assert.EqualError(t, err, c.err, c.user)
+		}
+	}
+}
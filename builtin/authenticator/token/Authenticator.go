@@ -0,0 +1,136 @@
+package token
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Authenticator struct represents API tokens Authenticator options.
+// Tokens file is reloaded when its modification time or size change.
+type Authenticator struct {
+	File string
+
+	mu       sync.Mutex
+	tokens   map[string]Token
+	fileStat fileStat
+}
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+// Init method is used to ingest config of Authenticator
+func (a *Authenticator) Init(config *viper.Viper) error {
+	if !config.IsSet("tokensFile") {
+		return errors.New("missing config entry \"tokensFile\" for Authenticator")
+	}
+
+	a.File = config.GetString("tokensFile")
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.reload(true)
+}
+
+// Login method is used to check if the API token of request is valid in tokens file.
+func (a *Authenticator) Login(ctx context.Context, req *request.SignRequest) (resultCtx context.Context, valid bool, id string, err error) {
+
+	if len(req.Token) == 0 {
+		return ctx, false, "", errors.New("empty token")
+	}
+
+	tokenID, err := ParseID(req.Token)
+	if err != nil {
+		return ctx, false, "", err
+	}
+
+	a.mu.Lock()
+	if err := a.reload(false); err != nil {
+		log.Errorf("reloading tokens file failed, keeping previous tokens: %s", err)
+	}
+	token, ok := a.tokens[tokenID]
+	a.mu.Unlock()
+
+	if !ok || subtle.ConstantTimeCompare([]byte(token.Hash), []byte(Hash(req.Token))) != 1 {
+		return ctx, false, "", errors.New("invalid token")
+	}
+
+	switch token.Status(time.Now()) {
+	case "revoked":
+		return ctx, false, "", fmt.Errorf("token %s revoked", token.ID)
+	case "expired":
+		return ctx, false, "", fmt.Errorf("token %s expired", token.ID)
+	}
+
+	if req.User != "" && req.User != token.Name {
+		return ctx, false, "", fmt.Errorf("token %s not issued for user %s", token.ID, req.User)
+	}
+
+	id = fmt.Sprintf("token-%s", token.Name)
+	identity := authenticator.NewIdentity("token", token.Name, id)
+	identity.Attributes["token_id"] = []string{token.ID}
+	identity.MaxTTL = time.Duration(token.MaxTTL) * time.Second
+	if len(token.Principals) > 0 {
+		identity.Principals = token.Principals
+	}
+
+	return authenticator.WithIdentity(ctx, identity), true, id, nil
+}
+
+// Active returns the token of ID id if it is still active, for renewals of certificates
+// signed after a login with this token
+func (a *Authenticator) Active(id string) (Token, error) {
+	a.mu.Lock()
+	if err := a.reload(false); err != nil {
+		log.Errorf("reloading tokens file failed, keeping previous tokens: %s", err)
+	}
+	token, ok := a.tokens[id]
+	a.mu.Unlock()
+
+	if !ok {
+		return Token{}, fmt.Errorf("token %s not found", id)
+	}
+	if status := token.Status(time.Now()); status != "active" {
+		return Token{}, fmt.Errorf("token %s %s", token.ID, status)
+	}
+
+	return token, nil
+}
+
+// reload reads tokens file again if it changed since last read, or if force is set.
+// Caller must hold a.mu.
+func (a *Authenticator) reload(force bool) error {
+	info, err := os.Stat(a.File)
+	if err != nil {
+		return err
+	}
+	stat := fileStat{modTime: info.ModTime(), size: info.Size()}
+	if !force && stat == a.fileStat {
+		return nil
+	}
+
+	tokens, err := ReadTokens(a.File)
+	if err != nil {
+		return err
+	}
+
+	a.tokens = map[string]Token{}
+	for _, token := range tokens {
+		a.tokens[token.ID] = token
+	}
+	a.fileStat = stat
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package token
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticatorInit(t *testing.T) {
+	dir := t.TempDir()
+	badFile := filepath.Join(dir, "bad")
+	if err := os.WriteFile(badFile, []byte(`{"tokens": [`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		config map[string]string
+		err    string
+	}{
+		{map[string]string{}, "missing config entry \"tokensFile\" for Authenticator"},
+		{map[string]string{"tokensFile": filepath.Join(dir, "nonexistent")}, "stat " + dir + "/nonexistent: no such file or directory"},
+		{map[string]string{"tokensFile": badFile}, "invalid tokens file " + badFile + ": unexpected end of JSON input"},
+	}
+
+	for _, c := range cases {
+		testConfig := viper.New()
+		for k, v := range c.config {
+			testConfig.Set(k, v)
+		}
+
+		auth := &Authenticator{}
+		assert.EqualError(t, auth.Init(testConfig), c.err)
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tokens.json")
+
+	tokens := []Token{}
+	newToken := func(name string, principals []string, maxTTL time.Duration, expires time.Time) (string, Token) {
+		secret, token, err := NewToken(tokens, name, principals, maxTTL, expires)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+		return secret, token
+	}
+
+	ciSecret, ci := newToken("ci", []string{"deploy"}, time.Hour, time.Time{})
+	anySecret, _ := newToken("monitoring", nil, 0, time.Now().Add(time.Hour))
+	expiredSecret, expired := newToken("old", nil, 0, time.Now().Add(-time.Hour))
+	revokedSecret, revoked := newToken("leaked", nil, 0, time.Time{})
+	tokens[3].Revoked = time.Now()
+	if err := WriteTokens(file, tokens); err != nil {
+		t.Fatal(err)
+	}
+
+	testConfig := viper.New()
+	testConfig.Set("tokensFile", file)
+	auth := &Authenticator{}
+	if err := auth.Init(testConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		description string
+		req         *request.SignRequest
+		id          string
+		err         string
+	}{
+		{"no token", &request.SignRequest{User: "ci"}, "", "empty token"},
+		{"malformed token", &request.SignRequest{Token: "abcdef"}, "", "malformed token"},
+		{"unknown token", &request.SignRequest{Token: Prefix + "00000000_secret"}, "", "invalid token"},
+		{"bad secret", &request.SignRequest{Token: Prefix + ci.ID + "_secret"}, "", "invalid token"},
+		{"valid token", &request.SignRequest{Token: ciSecret}, "token-ci", ""},
+		{"valid token and user", &request.SignRequest{User: "ci", Token: ciSecret}, "token-ci", ""},
+		{"token of other user", &request.SignRequest{User: "root", Token: ciSecret}, "", "token " + ci.ID + " not issued for user root"},
+		{"token with expiration", &request.SignRequest{Token: anySecret}, "token-monitoring", ""},
+		{"expired token", &request.SignRequest{Token: expiredSecret}, "", "token " + expired.ID + " expired"},
+		{"revoked token", &request.SignRequest{Token: revokedSecret}, "", "token " + revoked.ID + " revoked"},
+	}
+
+	for _, c := range cases {
+		_, valid, id, err := auth.Login(context.Background(), c.req)
+		assert.Equal(t, c.err == "", valid, c.description)
+		assert.Equal(t, c.id, id, c.description)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.description)
+		} else {
+			assert.NoError(t, err, c.description)
+		}
+	}
+
+	// identity is scoped by token
+	ctx, _, _, err := auth.Login(context.Background(), &request.SignRequest{Token: ciSecret})
+	assert.NoError(t, err)
+	identity, ok := authenticator.IdentityFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "ci", identity.Username)
+	assert.Equal(t, []string{"deploy"}, identity.Principals)
+	assert.Equal(t, time.Hour, identity.MaxTTL)
+	assert.Equal(t, ci.ID, identity.Attribute("token_id"))
+
+	ctx, _, _, err = auth.Login(context.Background(), &request.SignRequest{Token: anySecret})
+	assert.NoError(t, err)
+	identity, _ = authenticator.IdentityFromContext(ctx)
+	assert.Nil(t, identity.Principals)
+	assert.Equal(t, time.Duration(0), identity.MaxTTL)
+
+	// tokens are reloaded when file changes
+	tokens[0].Revoked = time.Now()
+	if err := WriteTokens(file, tokens); err != nil {
+		t.Fatal(err)
+	}
+	_, valid, _, err := auth.Login(context.Background(), &request.SignRequest{Token: ciSecret})
+	assert.False(t, valid)
+	assert.EqualError(t, err, "token "+ci.ID+" revoked")
+}
@@ -0,0 +1,144 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Prefix of API tokens, followed by token ID and secret separated by "_"
+const Prefix = "smk_"
+
+// Token represents an API token of tokens file, only the hash of its secret is stored
+type Token struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Hash       string    `json:"hash"`
+	Principals []string  `json:"principals,omitempty"`
+	MaxTTL     int64     `json:"max_ttl,omitempty"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires,omitzero"`
+	Revoked    time.Time `json:"revoked,omitzero"`
+}
+
+// Status returns "active", "expired" or "revoked"
+func (t Token) Status(now time.Time) string {
+	switch {
+	case !t.Revoked.IsZero():
+		return "revoked"
+	case !t.Expires.IsZero() && !now.Before(t.Expires):
+		return "expired"
+	}
+
+	return "active"
+}
+
+// NewToken creates a new token of name added to tokens. Returned secret is only known by
+// caller, it must be given to the token user.
+func NewToken(tokens []Token, name string, principals []string, maxTTL time.Duration, expires time.Time) (string, Token, error) {
+	if name == "" {
+		return "", Token{}, errors.New("empty token name")
+	}
+
+	id := randomString(4, hex.EncodeToString)
+	for _, t := range tokens {
+		if t.ID == id {
+			return "", Token{}, errors.New("token ID collision, try again")
+		}
+	}
+
+	secret := Prefix + id + "_" + randomString(32, base64.RawURLEncoding.EncodeToString)
+	token := Token{
+		ID:         id,
+		Name:       name,
+		Hash:       Hash(secret),
+		Principals: principals,
+		MaxTTL:     int64(maxTTL.Seconds()),
+		Created:    time.Now().UTC().Truncate(time.Second),
+		Expires:    expires.UTC(),
+	}
+
+	return secret, token, nil
+}
+
+// Hash returns the hash of a token secret as stored in tokens file. Secrets are random so a
+// plain SHA-256 is enough.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// ParseID returns the ID of a token secret
+func ParseID(secret string) (string, error) {
+	id, _, ok := strings.Cut(strings.TrimPrefix(secret, Prefix), "_")
+	if !strings.HasPrefix(secret, Prefix) || !ok || id == "" {
+		return "", errors.New("malformed token")
+	}
+
+	return id, nil
+}
+
+// ReadTokens reads tokens file, a missing file holds no tokens
+func ReadTokens(path string) ([]Token, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Token{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Tokens []Token `json:"tokens"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("invalid tokens file %s: %w", path, err)
+	}
+	if file.Tokens == nil {
+		file.Tokens = []Token{}
+	}
+
+	return file.Tokens, nil
+}
+
+// WriteTokens replaces tokens file atomically
+func WriteTokens(path string, tokens []Token) error {
+	content, err := json.MarshalIndent(map[string][]Token{"tokens": tokens}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // nolint:errcheck
+
+	if _, err := tmp.Write(append(content, '\n')); err != nil {
+		tmp.Close() // nolint:errcheck
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close() // nolint:errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func randomString(size int, encode func([]byte) string) string {
+	b := make([]byte, size)
+	_, _ = rand.Read(b)
+	return encode(b)
+}
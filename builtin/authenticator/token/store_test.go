@@ -0,0 +1,69 @@
+package token
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewToken(t *testing.T) {
+	_, _, err := NewToken(nil, "", nil, 0, time.Time{})
+	assert.EqualError(t, err, "empty token name")
+
+	secret, token, err := NewToken(nil, "ci", []string{"deploy"}, 90*time.Minute, time.Time{})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(secret, Prefix+token.ID+"_"))
+	assert.Equal(t, Hash(secret), token.Hash)
+	assert.NotContains(t, token.Hash, secret)
+	assert.Equal(t, int64(5400), token.MaxTTL)
+	assert.Equal(t, "active", token.Status(time.Now()))
+
+	id, err := ParseID(secret)
+	assert.NoError(t, err)
+	assert.Equal(t, token.ID, id)
+
+	for _, malformed := range []string{"", "smk_", "smk_abcd", "abcd_efgh", "smk__secret"} {
+		_, err := ParseID(malformed)
+		assert.EqualError(t, err, "malformed token", malformed)
+	}
+}
+
+func TestTokenStatus(t *testing.T) {
+	now := time.Now()
+
+	assert.Equal(t, "active", Token{}.Status(now))
+	assert.Equal(t, "active", Token{Expires: now.Add(time.Second)}.Status(now))
+	assert.Equal(t, "expired", Token{Expires: now}.Status(now))
+	assert.Equal(t, "revoked", Token{Expires: now, Revoked: now}.Status(now))
+}
+
+func TestReadWriteTokens(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tokens.json")
+
+	// missing file holds no tokens
+	tokens, err := ReadTokens(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []Token{}, tokens)
+
+	_, token, err := NewToken(tokens, "ci", nil, 0, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.NoError(t, WriteTokens(file, []Token{token}))
+
+	info, err := os.Stat(file)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	content, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "revoked")
+
+	tokens, err = ReadTokens(file)
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 1)
+	assert.Equal(t, token.ID, tokens[0].ID)
+	assert.True(t, token.Expires.Equal(tokens[0].Expires))
+}
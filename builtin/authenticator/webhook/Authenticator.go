@@ -0,0 +1,238 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/spf13/viper"
+)
+
+// Headers of webhook requests signed with HMAC
+const (
+	TimestampHeader = "X-Signmykey-Timestamp"
+	SignatureHeader = "X-Signmykey-Signature"
+)
+
+// maxResponseSize limits the size of webhook responses
+const maxResponseSize = 1 << 20
+
+var defaultFields = []string{"user", "password", "otp", "client_ip", "request_id"}
+
+// validFields are the fields of sign request which can be sent to webhook
+var validFields = map[string]func(req *request.SignRequest) string{
+	"user":       func(req *request.SignRequest) string { return req.User },
+	"password":   func(req *request.SignRequest) string { return req.Password },
+	"otp":        func(req *request.SignRequest) string { return req.Otp },
+	"public_key": func(req *request.SignRequest) string { return req.PublicKey },
+	"client_ip":  func(req *request.SignRequest) string { return req.Client.Addr },
+	"user_agent": func(req *request.SignRequest) string { return req.Client.UserAgent },
+	"request_id": func(req *request.SignRequest) string { return req.Client.RequestID },
+}
+
+// Authenticator struct represents webhook options for SMK Authentication.
+type Authenticator struct {
+	URL    string
+	Fields []string
+	Extra  map[string]string
+	Secret []byte
+
+	client *http.Client
+}
+
+// Response represents the JSON response of webhook
+type Response struct {
+	// Allow is true when user is authenticated
+	Allow bool `json:"allow"`
+	// Denied is true when credentials are valid but user isn't allowed to log in
+	Denied bool `json:"denied"`
+	// Message is the reason of failure
+	Message string `json:"message"`
+
+	// ID is the canonical identifier of the user (default: webhook-<user>)
+	ID string `json:"id"`
+	// Username replaces the user name sent by the client (optional)
+	Username   string              `json:"username"`
+	Groups     []string            `json:"groups"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+// Init method is used to ingest config of Authenticator
+func (a *Authenticator) Init(config *viper.Viper) error {
+	if !config.IsSet("webhookURL") {
+		return errors.New("missing config entry \"webhookURL\" for Authenticator")
+	}
+	a.URL = config.GetString("webhookURL")
+	if !strings.HasPrefix(a.URL, "https://") && !strings.HasPrefix(a.URL, "http://") {
+		return fmt.Errorf("invalid webhookURL %q for Authenticator", a.URL)
+	}
+
+	a.Fields = defaultFields
+	if config.IsSet("webhookFields") {
+		a.Fields = config.GetStringSlice("webhookFields")
+	}
+	for _, field := range a.Fields {
+		if _, ok := validFields[field]; !ok {
+			return fmt.Errorf("unknown webhookFields entry %q for Authenticator", field)
+		}
+	}
+	a.Extra = config.GetStringMapString("webhookExtra")
+
+	if config.IsSet("webhookSecretFile") {
+		secretFile := config.GetString("webhookSecretFile")
+		secret, err := os.ReadFile(secretFile)
+		if err != nil {
+			return fmt.Errorf("error reading webhook secret file: %w", err)
+		}
+		a.Secret = bytes.TrimSpace(secret)
+		if len(a.Secret) == 0 {
+			return fmt.Errorf("empty webhook secret file %s", secretFile)
+		}
+	}
+
+	config.SetDefault("webhookTimeout", "10s")
+	timeout := config.GetDuration("webhookTimeout")
+	if timeout <= 0 {
+		return errors.New("webhookTimeout must be a positive duration")
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.IsSet("webhookCAFile") {
+		caFile := config.GetString("webhookCAFile")
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("error reading webhook CA file %s: %w", caFile, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("no valid certificate found in webhook CA file %s", caFile)
+		}
+	}
+
+	if config.IsSet("webhookTLSCert") || config.IsSet("webhookTLSKey") {
+		cert, err := tls.LoadX509KeyPair(config.GetString("webhookTLSCert"), config.GetString("webhookTLSKey"))
+		if err != nil {
+			return fmt.Errorf("error loading webhook client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	a.client = &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		// credentials must not be sent to another URL
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return nil
+}
+
+// Login method is used to check user credentials with webhook.
+func (a *Authenticator) Login(ctx context.Context, req *request.SignRequest) (resultCtx context.Context, valid bool, id string, err error) {
+	if req.User == "" {
+		return ctx, false, "", errors.New("empty username")
+	}
+
+	envelope := map[string]string{}
+	for k, v := range a.Extra {
+		envelope[k] = v
+	}
+	for _, field := range a.Fields {
+		envelope[field] = validFields[field](req)
+	}
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return ctx, false, "", err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", a.URL, bytes.NewReader(body))
+	if err != nil {
+		return ctx, false, "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if len(a.Secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		httpReq.Header.Set(TimestampHeader, timestamp)
+		httpReq.Header.Set(SignatureHeader, "sha256="+Sign(a.Secret, timestamp, body))
+	}
+
+	client := a.client
+	if client == nil {
+		client = &http.Client{Timeout: time.Second * 10}
+	}
+	res, err := client.Do(httpReq)
+	if err != nil {
+		return ctx, false, "", fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer res.Body.Close() // nolint:errcheck
+
+	if res.StatusCode != 200 {
+		return ctx, false, "", fmt.Errorf("webhook returned status %d", res.StatusCode)
+	}
+
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return ctx, false, "", errors.New("can't read body")
+	}
+
+	var response Response
+	if err := json.Unmarshal(resBody, &response); err != nil {
+		return ctx, false, "", fmt.Errorf("invalid webhook response: %w", err)
+	}
+
+	if !response.Allow {
+		message := response.Message
+		if message == "" {
+			message = "access rejected by webhook"
+		}
+		if response.Denied {
+			return ctx, false, "", authenticator.NewDeniedError(message)
+		}
+		return ctx, false, "", errors.New(message)
+	}
+
+	username := req.User
+	if response.Username != "" {
+		username = response.Username
+	}
+	id = response.ID
+	if id == "" {
+		id = fmt.Sprintf("webhook-%s", username)
+	}
+
+	identity := authenticator.NewIdentity("webhook", username, id)
+	identity.Groups = response.Groups
+	for k, v := range response.Attributes {
+		identity.Attributes[k] = v
+	}
+
+	return authenticator.WithIdentity(ctx, identity), true, id, nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of timestamp and body with secret, as sent in
+// SignatureHeader. Webhooks must compute it again to check requests.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,316 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, name string, content []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// handler answers like an identity service accepting alice, and checks signature of requests
+// if secret isn't empty
+func handler(t *testing.T, secret []byte, envelopes chan<- map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if len(secret) > 0 && r.Header.Get(SignatureHeader) != "sha256="+Sign(secret, r.Header.Get(TimestampHeader), body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		envelope := map[string]string{}
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			t.Error(err)
+		}
+		if envelopes != nil {
+			envelopes <- envelope
+		}
+
+		var response interface{}
+		switch {
+		case envelope["user"] == "alice" && envelope["password"] == "alicepass":
+			response = Response{Allow: true, ID: "uid-1001", Groups: []string{"admins"}, Attributes: map[string][]string{"mail": {"alice@my.corp"}}}
+		case envelope["user"] == "bob" && envelope["password"] == "bobpass":
+			response = Response{Allow: true, Username: "robert"}
+		case envelope["user"] == "carol":
+			response = Response{Denied: true, Message: "account disabled"}
+		case envelope["user"] == "error":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case envelope["user"] == "garbage":
+			_, _ = w.Write([]byte("<html>"))
+			return
+		default:
+			response = Response{Message: "bad credentials"}
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}
+}
+
+func TestAuthenticatorInit(t *testing.T) {
+	secretFile := writeFile(t, "secret", []byte("s3cr3t\n"))
+	emptyFile := writeFile(t, "empty", []byte("\n"))
+
+	cases := []struct {
+		config []byte
+		err    string
+	}{
+		{[]byte(""), "missing config entry \"webhookURL\" for Authenticator"},
+		{[]byte("webhookURL: idp.my.corp"), "invalid webhookURL \"idp.my.corp\" for Authenticator"},
+		{[]byte("webhookURL: https://idp.my.corp\nwebhookFields: [user, ssn]"), "unknown webhookFields entry \"ssn\" for Authenticator"},
+		{[]byte("webhookURL: https://idp.my.corp\nwebhookSecretFile: /nonexistent"), "error reading webhook secret file: open /nonexistent: no such file or directory"},
+		{[]byte("webhookURL: https://idp.my.corp\nwebhookSecretFile: " + emptyFile), "empty webhook secret file " + emptyFile},
+		{[]byte("webhookURL: https://idp.my.corp\nwebhookTimeout: 0s"), "webhookTimeout must be a positive duration"},
+		{[]byte("webhookURL: https://idp.my.corp\nwebhookCAFile: " + secretFile), "no valid certificate found in webhook CA file " + secretFile},
+		{[]byte("webhookURL: https://idp.my.corp\nwebhookTLSCert: " + secretFile), "error loading webhook client certificate: open : no such file or directory"},
+		{[]byte("webhookURL: https://idp.my.corp\nwebhookSecretFile: " + secretFile), ""},
+	}
+
+	for _, c := range cases {
+		testConfig := viper.New()
+		testConfig.SetConfigType("yaml")
+		err := testConfig.ReadConfig(bytes.NewBuffer(c.config))
+		if err != nil {
+			t.Error(err)
+		}
+
+		auth := &Authenticator{}
+		err = auth.Init(testConfig)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err)
+			continue
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, "https://idp.my.corp", auth.URL)
+		assert.Equal(t, defaultFields, auth.Fields)
+		assert.Equal(t, []byte("s3cr3t"), auth.Secret)
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	secret := []byte("s3cr3t")
+	envelopes := make(chan map[string]string, 1)
+	server := httptest.NewServer(handler(t, secret, envelopes))
+	defer server.Close()
+
+	testConfig := viper.New()
+	testConfig.Set("webhookURL", server.URL)
+	testConfig.Set("webhookSecretFile", writeFile(t, "secret", secret))
+	testConfig.Set("webhookExtra", map[string]string{"service": "signmykey"})
+
+	auth := &Authenticator{}
+	if err := auth.Init(testConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		req    *request.SignRequest
+		id     string
+		err    string
+		denied bool
+	}{
+		{&request.SignRequest{Password: "alicepass"}, "", "empty username", false},
+		{&request.SignRequest{User: "alice", Password: "badpass"}, "", "bad credentials", false},
+		{&request.SignRequest{User: "alice", Password: "alicepass"}, "uid-1001", "", false},
+		{&request.SignRequest{User: "bob", Password: "bobpass"}, "webhook-robert", "", false},
+		{&request.SignRequest{User: "carol", Password: "carolpass"}, "", "account disabled", true},
+		{&request.SignRequest{User: "error"}, "", "webhook returned status 500", false},
+		{&request.SignRequest{User: "garbage"}, "", "invalid webhook response: invalid character '<' looking for beginning of value", false},
+	}
+
+	for _, c := range cases {
+		_, valid, id, err := auth.Login(context.Background(), c.req)
+		assert.Equal(t, c.err == "", valid, c.req.User)
+		assert.Equal(t, c.id, id, c.req.User)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.req.User)
+			var denied *authenticator.DeniedError
+			assert.Equal(t, c.denied, errors.As(err, &denied), c.req.User)
+		} else {
+			assert.NoError(t, err, c.req.User)
+		}
+
+		// drain envelope of request, if webhook was called
+		select {
+		case <-envelopes:
+		default:
+		}
+	}
+
+	// envelope holds configured fields and client metadata
+	ctx, _, _, err := auth.Login(context.Background(), &request.SignRequest{
+		User:      "alice",
+		Password:  "alicepass",
+		Otp:       "123456",
+		PublicKey: "ssh-ed25519 AAAA",
+		Client:    request.Client{Addr: "192.0.2.1", RequestID: "req-1"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"user":       "alice",
+		"password":   "alicepass",
+		"otp":        "123456",
+		"client_ip":  "192.0.2.1",
+		"request_id": "req-1",
+		"service":    "signmykey",
+	}, <-envelopes)
+
+	identity, ok := authenticator.IdentityFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "webhook", identity.Source)
+	assert.Equal(t, []string{"admins"}, identity.Groups)
+	assert.Equal(t, "alice@my.corp", identity.Attribute("mail"))
+
+	// unsigned requests are rejected by webhook
+	auth.Secret = nil
+	_, valid, _, err := auth.Login(context.Background(), &request.SignRequest{User: "alice", Password: "alicepass"})
+	assert.False(t, valid)
+	assert.EqualError(t, err, "webhook returned status 401")
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testCA{cert: cert, key: key}
+}
+
+// issue returns PEM encoded certificate and key for cn, valid for usage
+func (ca testCA) issue(t *testing.T, cn string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestAuthenticatorMTLS(t *testing.T) {
+	ca := newTestCA(t)
+	caFile := writeFile(t, "ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}))
+
+	serverCert, serverKey := ca.issue(t, "webhook", x509.ExtKeyUsageServerAuth)
+	tlsCert, err := tls.X509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	server := httptest.NewUnstartedServer(handler(t, nil, nil))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{tlsCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	clientCert, clientKey := ca.issue(t, "signmykey", x509.ExtKeyUsageClientAuth)
+
+	cases := []struct {
+		withCert bool
+		valid    bool
+	}{
+		{false, false},
+		{true, true},
+	}
+
+	for _, c := range cases {
+		testConfig := viper.New()
+		testConfig.Set("webhookURL", server.URL)
+		testConfig.Set("webhookCAFile", caFile)
+		if c.withCert {
+			testConfig.Set("webhookTLSCert", writeFile(t, "client.pem", clientCert))
+			testConfig.Set("webhookTLSKey", writeFile(t, "client.key", clientKey))
+		}
+
+		auth := &Authenticator{}
+		if err := auth.Init(testConfig); err != nil {
+			t.Fatal(err)
+		}
+
+		_, valid, _, err := auth.Login(context.Background(), &request.SignRequest{User: "alice", Password: "alicepass"})
+		assert.Equal(t, c.valid, valid)
+		if c.valid {
+			assert.NoError(t, err)
+		} else {
+			assert.Error(t, err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package lockout
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Store is the interface that wrap the storage of login failure counters and lockouts.
+type Store interface {
+	Init(config *viper.Viper) error
+	// Fail records a failed login of key and returns the number of failures of key
+	// since the first one, counters are forgotten window after the first failure
+	Fail(ctx context.Context, key string, window time.Duration) (failures int64, err error)
+	// Reset forgets failures of key
+	Reset(ctx context.Context, key string) error
+	// Lock locks key for duration
+	Lock(ctx context.Context, key string, duration time.Duration) error
+	// LockedFor returns the remaining lock duration of key, zero if key isn't locked
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+}
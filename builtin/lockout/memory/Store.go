@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Store struct represents an in memory lockout Store, counters are local to the server.
+type Store struct {
+	mu          sync.Mutex
+	entries     map[string]*entry
+	lastCleanup time.Time
+}
+
+type entry struct {
+	failures    int64
+	windowEnd   time.Time
+	lockedUntil time.Time
+}
+
+// Init method is used to ingest config of Store
+func (s *Store) Init(config *viper.Viper) error {
+	s.entries = map[string]*entry{}
+
+	return nil
+}
+
+// Fail method is used to record a failed login of key
+func (s *Store) Fail(ctx context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.cleanup(now)
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &entry{}
+		s.entries[key] = e
+	}
+	if now.After(e.windowEnd) {
+		e.failures = 0
+		e.windowEnd = now.Add(window)
+	}
+	e.failures++
+
+	return e.failures, nil
+}
+
+// Reset method is used to forget failures of key
+func (s *Store) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		e.failures = 0
+		e.windowEnd = time.Time{}
+	}
+
+	return nil
+}
+
+// Lock method is used to lock key for duration
+func (s *Store) Lock(ctx context.Context, key string, duration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &entry{}
+		s.entries[key] = e
+	}
+	e.lockedUntil = time.Now().Add(duration)
+
+	return nil
+}
+
+// LockedFor method is used to get the remaining lock duration of key
+func (s *Store) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return 0, nil
+	}
+	if remaining := time.Until(e.lockedUntil); remaining > 0 {
+		return remaining, nil
+	}
+
+	return 0, nil
+}
+
+// cleanup removes entries without failures nor lock at most once a minute, s.mu must be held
+func (s *Store) cleanup(now time.Time) {
+	if now.Sub(s.lastCleanup) < time.Minute {
+		return
+	}
+	s.lastCleanup = now
+
+	for key, e := range s.entries {
+		if now.After(e.windowEnd) && now.After(e.lockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+}
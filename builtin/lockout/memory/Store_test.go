@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store := &Store{}
+	assert.NoError(t, store.Init(viper.New()))
+
+	for i := int64(1); i <= 3; i++ {
+		failures, err := store.Fail(ctx, "user:alice", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, i, failures)
+	}
+
+	failures, err := store.Fail(ctx, "user:bob", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), failures)
+
+	assert.NoError(t, store.Reset(ctx, "user:alice"))
+	failures, err = store.Fail(ctx, "user:alice", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), failures)
+
+	// failures are forgotten after window
+	failures, err = store.Fail(ctx, "ip:192.0.2.1", time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), failures)
+	time.Sleep(5 * time.Millisecond)
+	failures, err = store.Fail(ctx, "ip:192.0.2.1", time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), failures)
+
+	locked, err := store.LockedFor(ctx, "user:alice")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), locked)
+
+	assert.NoError(t, store.Lock(ctx, "user:alice", time.Minute))
+	locked, err = store.LockedFor(ctx, "user:alice")
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Minute, locked, float64(time.Second))
+
+	assert.NoError(t, store.Lock(ctx, "user:bob", time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	locked, err = store.LockedFor(ctx, "user:bob")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), locked)
+}
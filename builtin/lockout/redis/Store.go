@@ -0,0 +1,245 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Store struct represents a Redis lockout Store, counters are shared by all servers using
+// the same Redis server.
+type Store struct {
+	Address   string
+	Password  string
+	DB        int
+	UseTLS    bool
+	TLSVerify bool
+	KeyPrefix string
+	Timeout   time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// Init method is used to ingest config of Store
+func (s *Store) Init(config *viper.Viper) error {
+	if !config.IsSet("redisAddr") {
+		return errors.New("missing config entry \"redisAddr\" for lockout Store")
+	}
+
+	config.SetDefault("redisDB", 0)
+	config.SetDefault("redisTLS", false)
+	config.SetDefault("redisTLSVerify", true)
+	config.SetDefault("redisKeyPrefix", "signmykey:lockout:")
+	config.SetDefault("redisTimeout", "2s")
+
+	s.Address = config.GetString("redisAddr")
+	s.Password = config.GetString("redisPassword")
+	s.DB = config.GetInt("redisDB")
+	s.UseTLS = config.GetBool("redisTLS")
+	s.TLSVerify = config.GetBool("redisTLSVerify")
+	s.KeyPrefix = config.GetString("redisKeyPrefix")
+	s.Timeout = config.GetDuration("redisTimeout")
+
+	return nil
+}
+
+// failScript increments a failure counter and sets its expiration when it has none, both at
+// once so that a counter never stays without expiration. Counter window starts with first failure.
+const failScript = `local count = redis.call("INCR", KEYS[1])
+if redis.call("PTTL", KEYS[1]) == -1 then
+  redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count`
+
+// Fail method is used to record a failed login of key
+func (s *Store) Fail(ctx context.Context, key string, window time.Duration) (int64, error) {
+	failures, err := s.do(ctx, "EVAL", failScript, "1", s.KeyPrefix+"fail:"+key, strconv.FormatInt(window.Milliseconds(), 10))
+	if err != nil {
+		return 0, err
+	}
+	count, ok := failures.(int64)
+	if !ok {
+		return 0, errors.New("unexpected redis EVAL reply")
+	}
+
+	return count, nil
+}
+
+// Reset method is used to forget failures of key
+func (s *Store) Reset(ctx context.Context, key string) error {
+	_, err := s.do(ctx, "DEL", s.KeyPrefix+"fail:"+key)
+
+	return err
+}
+
+// Lock method is used to lock key for duration
+func (s *Store) Lock(ctx context.Context, key string, duration time.Duration) error {
+	_, err := s.do(ctx, "SET", s.KeyPrefix+"lock:"+key, "1", "PX", strconv.FormatInt(duration.Milliseconds(), 10))
+
+	return err
+}
+
+// LockedFor method is used to get the remaining lock duration of key
+func (s *Store) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.do(ctx, "PTTL", s.KeyPrefix+"lock:"+key)
+	if err != nil {
+		return 0, err
+	}
+	ms, ok := ttl.(int64)
+	if !ok {
+		return 0, errors.New("unexpected redis PTTL reply")
+	}
+	if ms <= 0 {
+		// -2 when key doesn't exist, -1 when key has no expiration
+		return 0, nil
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// do sends a command to Redis and returns its reply, connection is opened again after errors.
+// Command fails when Timeout or deadline of ctx is reached.
+func (s *Store) do(ctx context.Context, args ...string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reply, err := s.doLocked(ctx, args...)
+	if err != nil && ctx.Err() != nil {
+		err = fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
+
+	return reply, err
+}
+
+func (s *Store) doLocked(ctx context.Context, args ...string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := s.roundTrip(ctx, args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		s.conn.Close() // nolint:errcheck
+		s.conn = nil
+	}
+
+	return reply, err
+}
+
+func (s *Store) connect(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: s.Timeout}
+
+	var conn net.Conn
+	var err error
+	if s.UseTLS {
+		host, _, _ := net.SplitHostPort(s.Address)
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host, InsecureSkipVerify: !s.TLSVerify}} // nolint:gosec
+		conn, err = tlsDialer.DialContext(ctx, "tcp", s.Address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", s.Address)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.rd = bufio.NewReader(conn)
+
+	if s.Password != "" {
+		if _, err := s.roundTrip(ctx, "AUTH", s.Password); err != nil {
+			s.conn.Close() // nolint:errcheck
+			s.conn = nil
+			return fmt.Errorf("redis authentication failed: %w", err)
+		}
+	}
+	if s.DB != 0 {
+		if _, err := s.roundTrip(ctx, "SELECT", strconv.Itoa(s.DB)); err != nil {
+			s.conn.Close() // nolint:errcheck
+			s.conn = nil
+			return fmt.Errorf("redis database selection failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// redisError represents an error reply of Redis, connection is still usable after it
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func (s *Store) roundTrip(ctx context.Context, args ...string) (interface{}, error) {
+	deadline := time.Now().Add(s.Timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := s.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := s.conn.Write([]byte(cmd.String())); err != nil {
+		return nil, err
+	}
+
+	return readReply(s.rd)
+}
+
+// readReply reads a RESP reply, arrays are not used by Store commands
+func readReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("invalid redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errors.New("invalid redis bulk string size")
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	default:
+		return nil, fmt.Errorf("unsupported redis reply type %q", line[0])
+	}
+}
@@ -0,0 +1,208 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// startFakeRedis starts a TCP server implementing the few Redis commands used by Store
+func startFakeRedis(t *testing.T, password string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() }) // nolint:errcheck
+
+	var mu sync.Mutex
+	values := map[string]int64{}
+	expires := map[string]time.Time{}
+
+	get := func(key string) (int64, bool) {
+		if exp, ok := expires[key]; ok && time.Now().After(exp) {
+			delete(values, key)
+			delete(expires, key)
+		}
+		v, ok := values[key]
+		return v, ok
+	}
+
+	handle := func(conn net.Conn) {
+		defer conn.Close() // nolint:errcheck
+		rd := bufio.NewReader(conn)
+		authenticated := password == ""
+
+		for {
+			line, err := rd.ReadString('\n')
+			if err != nil {
+				return
+			}
+			count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			args := make([]string, count)
+			for i := range args {
+				sizeLine, err := rd.ReadString('\n')
+				if err != nil {
+					return
+				}
+				size, _ := strconv.Atoi(strings.TrimSpace(sizeLine[1:]))
+				arg := make([]byte, size+2)
+				if _, err := io.ReadFull(rd, arg); err != nil {
+					return
+				}
+				args[i] = string(arg[:size])
+			}
+
+			mu.Lock()
+			var reply string
+			switch {
+			case args[0] == "AUTH":
+				if args[1] == password {
+					authenticated = true
+					reply = "+OK\r\n"
+				} else {
+					reply = "-WRONGPASS invalid password\r\n"
+				}
+			case !authenticated:
+				reply = "-NOAUTH Authentication required.\r\n"
+			case args[0] == "INCR":
+				v, _ := get(args[1])
+				values[args[1]] = v + 1
+				reply = fmt.Sprintf(":%d\r\n", v+1)
+			case args[0] == "EVAL" && args[1] == failScript:
+				// INCR then PEXPIRE when key has no expiration
+				v, _ := get(args[3])
+				values[args[3]] = v + 1
+				if _, ok := expires[args[3]]; !ok {
+					ms, _ := strconv.Atoi(args[4])
+					expires[args[3]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+				}
+				reply = fmt.Sprintf(":%d\r\n", v+1)
+			case args[0] == "DEL":
+				delete(values, args[1])
+				delete(expires, args[1])
+				reply = ":1\r\n"
+			case args[0] == "SET":
+				ms, _ := strconv.Atoi(args[4])
+				values[args[1]] = 1
+				expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+				reply = "+OK\r\n"
+			case args[0] == "PTTL":
+				if _, ok := get(args[1]); !ok {
+					reply = ":-2\r\n"
+				} else {
+					reply = fmt.Sprintf(":%d\r\n", time.Until(expires[args[1]]).Milliseconds())
+				}
+			default:
+				reply = "-ERR unknown command\r\n"
+			}
+			mu.Unlock()
+
+			if _, err := conn.Write([]byte(reply)); err != nil {
+				return
+			}
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestStoreInit(t *testing.T) {
+	store := &Store{}
+	assert.EqualError(t, store.Init(viper.New()), "missing config entry \"redisAddr\" for lockout Store")
+
+	config := viper.New()
+	config.Set("redisAddr", "127.0.0.1:6379")
+	assert.NoError(t, store.Init(config))
+	assert.Equal(t, "signmykey:lockout:", store.KeyPrefix)
+	assert.Equal(t, 2*time.Second, store.Timeout)
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	addr := startFakeRedis(t, "secret")
+
+	config := viper.New()
+	config.Set("redisAddr", addr)
+	config.Set("redisPassword", "badsecret")
+	store := &Store{}
+	assert.NoError(t, store.Init(config))
+	_, err := store.Fail(ctx, "user:alice", time.Minute)
+	assert.EqualError(t, err, "redis authentication failed: redis: WRONGPASS invalid password")
+
+	config.Set("redisPassword", "secret")
+	store = &Store{}
+	assert.NoError(t, store.Init(config))
+
+	for i := int64(1); i <= 3; i++ {
+		failures, err := store.Fail(ctx, "user:alice", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, i, failures)
+	}
+
+	assert.NoError(t, store.Reset(ctx, "user:alice"))
+	failures, err := store.Fail(ctx, "user:alice", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), failures)
+
+	locked, err := store.LockedFor(ctx, "user:alice")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), locked)
+
+	assert.NoError(t, store.Lock(ctx, "user:alice", time.Minute))
+	locked, err = store.LockedFor(ctx, "user:alice")
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Minute, locked, float64(time.Second))
+}
+
+func TestStoreContext(t *testing.T) {
+	// server accepting connections but never answering
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() }) // nolint:errcheck
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() }) // nolint:errcheck
+		}
+	}()
+
+	store := &Store{Address: ln.Addr().String(), KeyPrefix: "signmykey:lockout:", Timeout: time.Minute}
+
+	// commands stop at the deadline of context
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = store.Fail(ctx, "user:alice", time.Minute)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = store.LockedFor(ctx, "user:alice")
+	assert.ErrorIs(t, err, context.Canceled)
+}
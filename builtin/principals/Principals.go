@@ -2,16 +2,137 @@ package principals
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
+	"github.com/signmykeyio/signmykey/builtin/request"
 	"github.com/spf13/viper"
 )
 
 // Principals is the interface that wrap the get of SMK Principals.
 type Principals interface {
+	Init(config *viper.Viper) error
+	Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error)
+}
+
+// LegacyPrincipals is the interface of Principals reading the raw JSON payload of sign
+// requests, as before SignRequest was introduced
+type LegacyPrincipals interface {
 	Init(config *viper.Viper) error
 	Get(ctx context.Context, payload []byte) (context.Context, []string, error)
 }
 
+// FromLegacy returns Principals calling LegacyPrincipals with the JSON payload of requests
+func FromLegacy(p LegacyPrincipals) Principals {
+	return &legacyPrincipals{legacy: p}
+}
+
+type legacyPrincipals struct {
+	legacy LegacyPrincipals
+}
+
+func (p *legacyPrincipals) Init(config *viper.Viper) error {
+	return p.legacy.Init(config)
+}
+
+func (p *legacyPrincipals) Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error) {
+	payload, err := req.JSON()
+	if err != nil {
+		return ctx, []string{}, err
+	}
+
+	return p.legacy.Get(ctx, payload)
+}
+
+// Provider represents Principals configured on server with their lookup policy
+type Provider struct {
+	Principals
+
+	// Type of Principals, used in logs and errors
+	Type string
+	// Timeout of lookups, no timeout if 0
+	Timeout time.Duration
+	// Optional providers failing are ignored instead of failing requests
+	Optional bool
+}
+
+// Get returns principals of Principals, or an error wrapping context.DeadlineExceeded if they
+// aren't returned within Timeout. The context returned is ctx, the one of Principals is dropped.
+func (p *Provider) Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error) {
+	if p.Timeout <= 0 {
+		return p.Principals.Get(ctx, req)
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	type lookup struct {
+		principals []string
+		err        error
+	}
+	// buffered so that lookups ignoring their context don't block once timed out
+	done := make(chan lookup, 1)
+	go func() {
+		_, principals, err := p.Principals.Get(lookupCtx, req)
+		done <- lookup{principals, err}
+	}()
+
+	select {
+	case result := <-done:
+		return ctx, result.principals, result.err
+	case <-lookupCtx.Done():
+		return ctx, []string{}, fmt.Errorf("%s principals provider: %w", p.Type, lookupCtx.Err())
+	}
+}
+
+// ValidityKeyType represents a principals validity context key type
+type ValidityKeyType string
+
+// ValidityKey represents the context key holding the *Validity of principals of a request
+const ValidityKey ValidityKeyType = "principalsValidity"
+
+// Validity holds the time principals returned for a request stop being valid, like
+// principals temporarily granted. Providers limit it with LimitValidity.
+type Validity struct {
+	mu     sync.Mutex
+	before time.Time
+}
+
+// WithValidity returns a copy of ctx holding a new Validity of principals
+func WithValidity(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ValidityKey, &Validity{})
+}
+
+// LimitValidity caps validity of principals of the request of ctx to before
+func LimitValidity(ctx context.Context, before time.Time) {
+	v, ok := ctx.Value(ValidityKey).(*Validity)
+	if !ok {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.before.IsZero() || before.Before(v.before) {
+		v.before = before
+	}
+}
+
+// ValidBefore returns the time principals of the request of ctx stop being valid, zero if
+// they don't expire
+func ValidBefore(ctx context.Context) time.Time {
+	v, ok := ctx.Value(ValidityKey).(*Validity)
+	if !ok {
+		return time.Time{}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.before
+}
+
 // NotFoundError it's principals provider error when no principals are found
 type NotFoundError struct {
 	provider string
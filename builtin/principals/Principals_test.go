@@ -0,0 +1,88 @@
+package principals
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowPrincipals returns principals after delay, ignoring cancellation of context
+type slowPrincipals struct {
+	delay      time.Duration
+	principals []string
+}
+
+func (p slowPrincipals) Init(config *viper.Viper) error {
+	return nil
+}
+
+func (p slowPrincipals) Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error) {
+	time.Sleep(p.delay)
+
+	return ctx, p.principals, nil
+}
+
+func TestProvider(t *testing.T) {
+	req := &request.SignRequest{User: "testuser"}
+
+	cases := []struct {
+		description string
+		timeout     time.Duration
+		expected    []string
+		err         error
+	}{
+		{"no timeout", 0, []string{"a", "b"}, nil},
+		{"within timeout", time.Second, []string{"a", "b"}, nil},
+		{"timed out", 10 * time.Millisecond, []string{}, context.DeadlineExceeded},
+	}
+
+	for _, c := range cases {
+		provider := &Provider{
+			Principals: slowPrincipals{delay: 50 * time.Millisecond, principals: []string{"a", "b"}},
+			Type:       "slow",
+			Timeout:    c.timeout,
+		}
+
+		start := time.Now()
+		_, principals, err := provider.Get(context.Background(), req)
+		assert.Equal(t, c.expected, principals, c.description)
+		if c.err == nil {
+			assert.NoError(t, err, c.description)
+			continue
+		}
+		assert.ErrorIs(t, err, c.err, c.description)
+		assert.EqualError(t, err, "slow principals provider: "+c.err.Error(), c.description)
+		assert.Less(t, time.Since(start), 40*time.Millisecond, c.description)
+	}
+}
+
+func TestProviderCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	provider := &Provider{Principals: slowPrincipals{delay: time.Second}, Type: "slow", Timeout: time.Minute}
+
+	returnedCtx, _, err := provider.Get(ctx, &request.SignRequest{User: "testuser"})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, ctx, returnedCtx)
+}
+
+func TestValidity(t *testing.T) {
+	now := time.Now()
+
+	// validity isn't limited without collector
+	LimitValidity(context.Background(), now)
+	assert.True(t, ValidBefore(context.Background()).IsZero())
+
+	ctx := WithValidity(context.Background())
+	assert.True(t, ValidBefore(ctx).IsZero())
+
+	LimitValidity(ctx, now.Add(time.Hour))
+	LimitValidity(ctx, now.Add(time.Minute))
+	LimitValidity(ctx, now.Add(2*time.Hour))
+	assert.Equal(t, now.Add(time.Minute), ValidBefore(ctx))
+}
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/principals"
+	"github.com/signmykeyio/signmykey/builtin/request"
+)
+
+// Cache is Principals caching principals returned by the Principals it wraps, per identity of
+// users. Principals not found are cached for NegativeTTL, other errors aren't cached.
+type Cache struct {
+	principals.Principals
+
+	// TTL of principals found
+	TTL time.Duration
+	// NegativeTTL of principals not found, they aren't cached if 0
+	NegativeTTL time.Duration
+	// MaxEntries is the maximum number of identities cached, least recently used ones are
+	// evicted first. No limit if 0.
+	MaxEntries int
+
+	mu         sync.Mutex
+	entries    map[key]*list.Element
+	lru        *list.List
+	generation uint64
+	now        func() time.Time
+}
+
+// key is the canonical identity of users: the Authenticator which authenticated them and
+// their ID
+type key struct {
+	source string
+	id     string
+}
+
+type entry struct {
+	key        key
+	username   string
+	principals []string
+	err        error
+	expires    time.Time
+}
+
+// New creates new Cache of princs
+func New(princs principals.Principals, ttl, negativeTTL time.Duration, maxEntries int) *Cache {
+	return &Cache{
+		Principals:  princs,
+		TTL:         ttl,
+		NegativeTTL: negativeTTL,
+		MaxEntries:  maxEntries,
+		entries:     map[key]*list.Element{},
+		lru:         list.New(),
+		now:         time.Now,
+	}
+}
+
+// Get returns cached principals of user, or principals of wrapped Principals when they
+// aren't cached or are expired
+func (c *Cache) Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error) {
+	k, username := identityKey(ctx, req)
+
+	c.mu.Lock()
+	if e, ok := c.lookup(k); ok {
+		c.mu.Unlock()
+		if e.err != nil {
+			return ctx, []string{}, e.err
+		}
+		return ctx, slices.Clone(e.principals), nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	ctx, princs, err := c.Principals.Get(ctx, req)
+
+	var notFoundError *principals.NotFoundError
+	switch {
+	case err == nil:
+		c.store(generation, &entry{key: k, username: username, principals: slices.Clone(princs), expires: c.now().Add(c.TTL)})
+	case errors.As(err, &notFoundError) && c.NegativeTTL > 0:
+		c.store(generation, &entry{key: k, username: username, err: err, expires: c.now().Add(c.NegativeTTL)})
+	}
+
+	return ctx, princs, err
+}
+
+// Purge removes cached principals of identities whose ID or user name is user, it returns
+// the number of entries removed
+func (c *Cache) Purge(user string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// lookups running during purge must not cache principals read before it
+	c.generation++
+
+	purged := 0
+	for k, elem := range c.entries {
+		if k.id == user || elem.Value.(*entry).username == user {
+			c.remove(elem)
+			purged++
+		}
+	}
+
+	return purged
+}
+
+// Len returns the number of cached entries, expired ones included
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// lookup returns the entry of k if not expired, c.mu must be held
+func (c *Cache) lookup(k key) (*entry, bool) {
+	elem, ok := c.entries[k]
+	if !ok {
+		return nil, false
+	}
+
+	e := elem.Value.(*entry)
+	if !c.now().Before(e.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+
+	return e, true
+}
+
+// store caches e unless Purge was called since generation, it evicts least recently used
+// entries above MaxEntries
+func (c *Cache) store(generation uint64, e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if elem, ok := c.entries[e.key]; ok {
+		c.remove(elem)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+
+	for c.MaxEntries > 0 && c.lru.Len() > c.MaxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove removes elem from cache, c.mu must be held
+func (c *Cache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*entry).key)
+}
+
+// identityKey returns the canonical identity of user authenticated for req and its user name
+func identityKey(ctx context.Context, req *request.SignRequest) (key, string) {
+	if identity, ok := authenticator.IdentityFromContext(ctx); ok {
+		return key{source: identity.Source, id: identity.ID}, identity.Username
+	}
+
+	return key{id: req.User}, req.User
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/principals"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingPrincipals returns principals of users and counts lookups
+type countingPrincipals struct {
+	users   map[string][]string
+	err     error
+	lookups int
+}
+
+func (p *countingPrincipals) Init(config *viper.Viper) error {
+	return nil
+}
+
+func (p *countingPrincipals) Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error) {
+	p.lookups++
+	if p.err != nil {
+		return ctx, []string{}, p.err
+	}
+	princs, ok := p.users[req.User]
+	if !ok {
+		return ctx, []string{}, principals.NewNotFoundError("counting", "user not found")
+	}
+
+	return ctx, princs, nil
+}
+
+// testCache returns Cache of countingPrincipals with a clock advanced by the returned func
+func testCache(ttl, negativeTTL time.Duration, maxEntries int) (*Cache, *countingPrincipals, func(time.Duration)) {
+	princs := &countingPrincipals{users: map[string][]string{
+		"alice": {"alice", "dba"},
+		"bob":   {"bob"},
+		"carol": {"carol"},
+	}}
+	c := New(princs, ttl, negativeTTL, maxEntries)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	return c, princs, func(d time.Duration) { now = now.Add(d) }
+}
+
+func get(t *testing.T, c *Cache, user string) ([]string, error) {
+	t.Helper()
+
+	ctx := authenticator.WithIdentity(context.Background(), authenticator.NewIdentity("ldap", user, "id-"+user))
+	_, princs, err := c.Get(ctx, &request.SignRequest{User: user})
+
+	return princs, err
+}
+
+func TestCache(t *testing.T) {
+	c, princs, advance := testCache(time.Minute, 0, 0)
+
+	for range 5 {
+		result, err := get(t, c, "alice")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"alice", "dba"}, result)
+	}
+	assert.Equal(t, 1, princs.lookups)
+
+	// cached principals can't be modified by callers
+	result, _ := get(t, c, "alice")
+	result[0] = "root"
+	result, _ = get(t, c, "alice")
+	assert.Equal(t, []string{"alice", "dba"}, result)
+	assert.Equal(t, 1, princs.lookups)
+
+	advance(time.Minute)
+	_, err := get(t, c, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, princs.lookups)
+
+	// identities of other sources aren't shared
+	ctx := authenticator.WithIdentity(context.Background(), authenticator.NewIdentity("oidcropc", "alice", "id-alice"))
+	_, _, err = c.Get(ctx, &request.SignRequest{User: "alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, princs.lookups)
+
+	// without identity, user of request is the key
+	_, result, err = c.Get(context.Background(), &request.SignRequest{User: "bob"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bob"}, result)
+	_, _, err = c.Get(context.Background(), &request.SignRequest{User: "bob"})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, princs.lookups)
+}
+
+func TestCacheNegative(t *testing.T) {
+	c, princs, advance := testCache(time.Minute, 10*time.Second, 0)
+
+	for range 3 {
+		_, err := get(t, c, "unknown")
+		var notFoundError *principals.NotFoundError
+		assert.ErrorAs(t, err, &notFoundError)
+	}
+	assert.Equal(t, 1, princs.lookups)
+
+	advance(10 * time.Second)
+	_, err := get(t, c, "unknown")
+	assert.Error(t, err)
+	assert.Equal(t, 2, princs.lookups)
+
+	// without negative TTL, principals not found aren't cached
+	c, princs, _ = testCache(time.Minute, 0, 0)
+	for range 3 {
+		_, err := get(t, c, "unknown")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 3, princs.lookups)
+
+	// other errors aren't cached
+	c, princs, _ = testCache(time.Minute, time.Minute, 0)
+	princs.err = errors.New("server down")
+	for range 3 {
+		_, err := get(t, c, "alice")
+		assert.EqualError(t, err, "server down")
+	}
+	assert.Equal(t, 3, princs.lookups)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	c, princs, _ := testCache(time.Minute, 0, 2)
+
+	get(t, c, "alice") // nolint:errcheck
+	get(t, c, "bob")   // nolint:errcheck
+	get(t, c, "alice") // nolint:errcheck
+	get(t, c, "carol") // nolint:errcheck
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, 3, princs.lookups)
+
+	// bob was the least recently used
+	get(t, c, "alice") // nolint:errcheck
+	get(t, c, "carol") // nolint:errcheck
+	assert.Equal(t, 3, princs.lookups)
+	get(t, c, "bob") // nolint:errcheck
+	assert.Equal(t, 4, princs.lookups)
+}
+
+func TestCachePurge(t *testing.T) {
+	c, princs, _ := testCache(time.Minute, time.Minute, 0)
+
+	get(t, c, "alice")   // nolint:errcheck
+	get(t, c, "bob")     // nolint:errcheck
+	get(t, c, "unknown") // nolint:errcheck
+	assert.Equal(t, 3, princs.lookups)
+
+	assert.Equal(t, 1, c.Purge("id-alice"))
+	assert.Equal(t, 1, c.Purge("unknown"))
+	assert.Equal(t, 0, c.Purge("alice"))
+	assert.Equal(t, 1, c.Len())
+
+	get(t, c, "alice")   // nolint:errcheck
+	get(t, c, "bob")     // nolint:errcheck
+	get(t, c, "unknown") // nolint:errcheck
+	assert.Equal(t, 5, princs.lookups)
+}
@@ -0,0 +1,18 @@
+package common
+
+import (
+	"context"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+)
+
+// User returns the name of the authenticated user, from the Identity set in ctx by
+// Authenticator or from the request when there is none
+func User(ctx context.Context, req *request.SignRequest) string {
+	if identity, ok := authenticator.IdentityFromContext(ctx); ok {
+		return identity.Username
+	}
+
+	return req.User
+}
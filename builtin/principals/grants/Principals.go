@@ -0,0 +1,80 @@
+package grants
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/principals"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/spf13/viper"
+)
+
+// Principals struct represents grants options, principals temporarily granted to users
+// through the grants API.
+type Principals struct {
+	Store *Store
+
+	// AdminGroups are the groups allowed to manage grants
+	AdminGroups []string
+	// MaxDuration is the longest validity of grants
+	MaxDuration time.Duration
+}
+
+// Init method is used to ingest config of Principals
+func (p *Principals) Init(config *viper.Viper) error {
+	neededEntries := []string{
+		"grantsFile",
+		"grantsAdminGroups",
+	}
+
+	var missingEntriesLst []string
+	for _, entry := range neededEntries {
+		if !config.IsSet(entry) {
+			missingEntriesLst = append(missingEntriesLst, entry)
+		}
+	}
+	if len(missingEntriesLst) > 0 {
+		return fmt.Errorf("missing config entries (%s) for Principals", strings.Join(missingEntriesLst, ", "))
+	}
+
+	config.SetDefault("grantsMaxDuration", "24h")
+
+	p.AdminGroups = config.GetStringSlice("grantsAdminGroups")
+	p.MaxDuration = config.GetDuration("grantsMaxDuration")
+	if len(p.AdminGroups) == 0 {
+		return errors.New("empty grantsAdminGroups for Principals")
+	}
+	if p.MaxDuration <= 0 {
+		return errors.New("grantsMaxDuration must be a positive duration")
+	}
+
+	store, err := NewStore(config.GetString("grantsFile"))
+	if err != nil {
+		return err
+	}
+	p.Store = store
+
+	return nil
+}
+
+// Get method returns the principals of active grants of user.
+func (p Principals) Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error) {
+
+	user := req.User
+	if identity, ok := authenticator.IdentityFromContext(ctx); ok && identity.Username != "" {
+		user = identity.Username
+	}
+
+	granted, expires := p.Store.Active(user, time.Now())
+	if len(granted) == 0 {
+		return ctx, []string{}, principals.NewNotFoundError("grants", "no active grant for user")
+	}
+	// certificates must not outlive grants
+	principals.LimitValidity(ctx, expires)
+
+	return ctx, granted, nil
+}
@@ -0,0 +1,81 @@
+package grants
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/principals"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrincipalsInit(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "grants.json")
+
+	cases := []struct {
+		config string
+		err    string
+	}{
+		{``, "missing config entries (grantsFile, grantsAdminGroups) for Principals"},
+		{"grantsFile: " + file + "\ngrantsAdminGroups: []", "empty grantsAdminGroups for Principals"},
+		{"grantsFile: " + file + "\ngrantsAdminGroups: [security]\ngrantsMaxDuration: -1h", "grantsMaxDuration must be a positive duration"},
+		{"grantsFile: " + file + "\ngrantsAdminGroups: [security]", ""},
+	}
+
+	for _, c := range cases {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		if err := config.ReadConfig(bytes.NewBufferString(c.config)); err != nil {
+			t.Fatal(err)
+		}
+
+		p := &Principals{}
+		err := p.Init(config)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err)
+			continue
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"security"}, p.AdminGroups)
+		assert.Equal(t, 24*time.Hour, p.MaxDuration)
+		assert.Equal(t, file, p.Store.File)
+	}
+}
+
+func TestPrincipals(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "grants.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant, _ := NewGrant("alice", []string{"root"}, "INC-42", "ldap-bob", time.Hour, time.Hour, time.Now())
+	if err := store.Add(grant); err != nil {
+		t.Fatal(err)
+	}
+	p := Principals{Store: store}
+
+	_, princs, err := p.Get(context.Background(), &request.SignRequest{User: "alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"root"}, princs)
+
+	// username of identity is used when user is known by Authenticator
+	ctx := authenticator.WithIdentity(context.Background(), authenticator.NewIdentity("oidc", "alice", "oidc-alice"))
+	_, princs, err = p.Get(ctx, &request.SignRequest{User: "alice@my.corp"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"root"}, princs)
+
+	// validity of principals is limited to expiration of grants
+	ctx = principals.WithValidity(context.Background())
+	_, _, err = p.Get(ctx, &request.SignRequest{User: "alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, grant.Expires, principals.ValidBefore(ctx))
+
+	_, _, err = p.Get(context.Background(), &request.SignRequest{User: "bob"})
+	var notFoundError *principals.NotFoundError
+	assert.ErrorAs(t, err, &notFoundError)
+}
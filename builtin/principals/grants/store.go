@@ -0,0 +1,310 @@
+package grants
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNotFound is returned by Store when a grant doesn't exist
+var ErrNotFound = errors.New("grant not found")
+
+// Grant represents principals temporarily granted to a user
+type Grant struct {
+	ID         string    `json:"id"`
+	User       string    `json:"user"`
+	Principals []string  `json:"principals"`
+	Reason     string    `json:"reason"`
+	Granter    string    `json:"granter"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+}
+
+// NewGrant creates a new grant of principals to user, valid for duration
+func NewGrant(user string, principals []string, reason, granter string, duration, maxDuration time.Duration, now time.Time) (Grant, error) {
+	if user == "" {
+		return Grant{}, errors.New("empty user of grant")
+	}
+	if len(principals) == 0 || slices.Contains(principals, "") {
+		return Grant{}, errors.New("empty principal in principals of grant")
+	}
+	if strings.TrimSpace(reason) == "" {
+		return Grant{}, errors.New("empty reason of grant")
+	}
+	if duration <= 0 {
+		return Grant{}, errors.New("duration of grant must be positive")
+	}
+	if duration > maxDuration {
+		return Grant{}, fmt.Errorf("duration of grant must not exceed %s", maxDuration)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Grant{}, fmt.Errorf("generating grant ID: %w", err)
+	}
+	now = now.UTC().Truncate(time.Second)
+
+	return Grant{
+		ID:         hex.EncodeToString(id),
+		User:       user,
+		Principals: principals,
+		Reason:     reason,
+		Granter:    granter,
+		Created:    now,
+		Expires:    now.Add(duration),
+	}, nil
+}
+
+// Store struct represents grants kept in a JSON file by a single signmykey server: writes
+// aren't locked across processes, so the file must not be shared by several servers. File is
+// reloaded when its modification time or size change, expired grants are removed from it.
+type Store struct {
+	File string
+
+	mu        sync.Mutex
+	grants    []Grant
+	fileStat  fileStat
+	lastSweep time.Time
+}
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewStore returns a Store of grants file, a missing file holds no grants
+func NewStore(file string) (*Store, error) {
+	s := &Store{File: file}
+	if err := s.reload(true); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Active returns principals of active grants of user and the earliest expiration of these
+// grants
+func (s *Store) Active(user string, now time.Time) ([]string, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(false); err != nil {
+		log.WithField("ctx", "grants").Errorf("reloading grants file failed, keeping previous grants: %s", err)
+	}
+	s.sweep(now, false)
+
+	principals := []string{}
+	expires := time.Time{}
+	for _, grant := range s.grants {
+		if !strings.EqualFold(grant.User, user) || !now.Before(grant.Expires) {
+			continue
+		}
+		for _, principal := range grant.Principals {
+			if !slices.Contains(principals, principal) {
+				principals = append(principals, principal)
+			}
+		}
+		if expires.IsZero() || grant.Expires.Before(expires) {
+			expires = grant.Expires
+		}
+	}
+
+	return principals, expires
+}
+
+// List returns active grants
+func (s *Store) List(now time.Time) ([]Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(false); err != nil {
+		return nil, err
+	}
+	s.sweep(now, false)
+
+	return slices.DeleteFunc(slices.Clone(s.grants), func(grant Grant) bool {
+		return !now.Before(grant.Expires)
+	}), nil
+}
+
+// Add stores a new grant
+func (s *Store) Add(grant Grant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(false); err != nil {
+		return err
+	}
+	for _, g := range s.grants {
+		if g.ID == grant.ID {
+			return errors.New("grant ID collision, try again")
+		}
+	}
+
+	return s.write(append(slices.Clone(s.grants), grant))
+}
+
+// Revoke removes grant id before its expiration and returns it
+func (s *Store) Revoke(id string) (Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(false); err != nil {
+		return Grant{}, err
+	}
+
+	i := slices.IndexFunc(s.grants, func(grant Grant) bool { return grant.ID == id })
+	if i < 0 {
+		return Grant{}, ErrNotFound
+	}
+	grant := s.grants[i]
+
+	return grant, s.write(slices.Delete(slices.Clone(s.grants), i, i+1))
+}
+
+// Sweep removes expired grants from grants file, each expiration is audit logged
+func (s *Store) Sweep(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(false); err != nil {
+		log.WithField("ctx", "grants").Errorf("reloading grants file failed, keeping previous grants: %s", err)
+	}
+	s.sweep(now, true)
+}
+
+// sweep removes expired grants, at most once per minute unless force is set.
+// Caller must hold s.mu.
+func (s *Store) sweep(now time.Time, force bool) {
+	if !force && now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	active := []Grant{}
+	expired := []Grant{}
+	for _, grant := range s.grants {
+		if now.Before(grant.Expires) {
+			active = append(active, grant)
+			continue
+		}
+		expired = append(expired, grant)
+	}
+	if len(expired) == 0 {
+		return
+	}
+
+	if err := s.write(active); err != nil {
+		log.WithField("ctx", "grants").Errorf("removing expired grants failed: %s", err)
+		return
+	}
+
+	for _, grant := range expired {
+		log.WithFields(log.Fields{
+			"ctx":        "grants",
+			"event":      "grant_expired",
+			"grant_id":   grant.ID,
+			"user":       grant.User,
+			"principals": grant.Principals,
+			"granter":    grant.Granter,
+			"reason":     grant.Reason,
+			"expire":     grant.Expires,
+		}).Info("Grant expired")
+	}
+}
+
+// reload reads grants file again if it changed since last read, or if force is set.
+// Caller must hold s.mu.
+func (s *Store) reload(force bool) error {
+	stat := fileStat{}
+	info, err := os.Stat(s.File)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		stat = fileStat{modTime: info.ModTime(), size: info.Size()}
+	}
+	if !force && stat == s.fileStat {
+		return nil
+	}
+
+	grants, err := readGrants(s.File)
+	if err != nil {
+		return err
+	}
+	s.grants = grants
+	s.fileStat = stat
+
+	return nil
+}
+
+// write replaces grants file atomically.
+// Caller must hold s.mu.
+func (s *Store) write(grants []Grant) error {
+	content, err := json.MarshalIndent(map[string][]Grant{"grants": grants}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.File), "."+filepath.Base(s.File)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // nolint:errcheck
+
+	if _, err := tmp.Write(append(content, '\n')); err != nil {
+		tmp.Close() // nolint:errcheck
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close() // nolint:errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.File); err != nil {
+		return err
+	}
+
+	s.grants = grants
+	info, err := os.Stat(s.File)
+	if err != nil {
+		return err
+	}
+	s.fileStat = fileStat{modTime: info.ModTime(), size: info.Size()}
+
+	return nil
+}
+
+func readGrants(path string) ([]Grant, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Grant{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Grants []Grant `json:"grants"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("invalid grants file %s: %w", path, err)
+	}
+	if file.Grants == nil {
+		file.Grants = []Grant{}
+	}
+
+	return file.Grants, nil
+}
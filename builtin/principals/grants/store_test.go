@@ -0,0 +1,122 @@
+package grants
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewGrant(t *testing.T) {
+	now := time.Now()
+
+	cases := []struct {
+		user       string
+		principals []string
+		reason     string
+		duration   time.Duration
+		err        string
+	}{
+		{"", []string{"root"}, "INC-42", time.Hour, "empty user of grant"},
+		{"alice", nil, "INC-42", time.Hour, "empty principal in principals of grant"},
+		{"alice", []string{"root", ""}, "INC-42", time.Hour, "empty principal in principals of grant"},
+		{"alice", []string{"root"}, " ", time.Hour, "empty reason of grant"},
+		{"alice", []string{"root"}, "INC-42", 0, "duration of grant must be positive"},
+		{"alice", []string{"root"}, "INC-42", 5 * time.Hour, "duration of grant must not exceed 4h0m0s"},
+	}
+
+	for _, c := range cases {
+		_, err := NewGrant(c.user, c.principals, c.reason, "ldap-bob", c.duration, 4*time.Hour, now)
+		assert.EqualError(t, err, c.err)
+	}
+
+	grant, err := NewGrant("alice", []string{"root"}, "INC-42", "ldap-bob", 4*time.Hour, 4*time.Hour, now)
+	assert.NoError(t, err)
+	assert.Len(t, grant.ID, 32)
+	assert.Equal(t, "ldap-bob", grant.Granter)
+	assert.Equal(t, 4*time.Hour, grant.Expires.Sub(grant.Created))
+}
+
+func TestStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "grants.json")
+	now := time.Now()
+
+	// missing file holds no grants
+	store, err := NewStore(file)
+	assert.NoError(t, err)
+	princs, _ := store.Active("alice", now)
+	assert.Empty(t, princs)
+
+	rootGrant, _ := NewGrant("alice", []string{"root"}, "INC-42", "ldap-bob", time.Hour, time.Hour, now)
+	dbGrant, _ := NewGrant("alice", []string{"root", "dba"}, "INC-43", "ldap-bob", 30*time.Minute, time.Hour, now)
+	assert.NoError(t, store.Add(rootGrant))
+	assert.NoError(t, store.Add(dbGrant))
+	assert.EqualError(t, store.Add(rootGrant), "grant ID collision, try again")
+
+	info, err := os.Stat(file)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	princs, expires := store.Active("Alice", now)
+	assert.Equal(t, []string{"root", "dba"}, princs)
+	assert.Equal(t, dbGrant.Expires, expires)
+	princs, _ = store.Active("bob", now)
+	assert.Empty(t, princs)
+
+	// file is reloaded when changed by another store
+	other, err := NewStore(file)
+	assert.NoError(t, err)
+	list, err := other.List(now)
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	revoked, err := other.Revoke(rootGrant.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, rootGrant.ID, revoked.ID)
+	_, err = other.Revoke(rootGrant.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	list, err = store.List(now)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	// expired grants are ignored
+	princs, _ = store.Active("alice", now.Add(45*time.Minute))
+	assert.Empty(t, princs)
+
+	assert.NoError(t, os.WriteFile(file, []byte(`{"grants": [`), 0600))
+	_, err = NewStore(file)
+	assert.ErrorContains(t, err, "invalid grants file")
+}
+
+func TestStoreSweep(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "grants.json")
+	now := time.Now()
+
+	hook := test.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	store, err := NewStore(file)
+	assert.NoError(t, err)
+	grant, _ := NewGrant("alice", []string{"root"}, "INC-42", "ldap-bob", time.Hour, time.Hour, now)
+	assert.NoError(t, store.Add(grant))
+
+	store.Sweep(now)
+	assert.Empty(t, hook.AllEntries())
+
+	// expired grants are removed from file and logged
+	store.Sweep(now.Add(2 * time.Hour))
+	entry := hook.LastEntry()
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, "grant_expired", entry.Data["event"])
+		assert.Equal(t, grant.ID, entry.Data["grant_id"])
+	}
+
+	content, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"grants": []}`, string(content))
+}
@@ -3,16 +3,16 @@ package ldap
 import (
 	"context"
 	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"regexp"
 	"strings"
 	"time"
 
 	ldap "github.com/go-ldap/ldap/v3"
 	"github.com/signmykeyio/signmykey/builtin/principals/common"
-	log "github.com/sirupsen/logrus"
+	"github.com/signmykeyio/signmykey/builtin/request"
 	"github.com/spf13/viper"
 
 	princsPkg "github.com/signmykeyio/signmykey/builtin/principals"
@@ -32,12 +32,40 @@ type Principals struct {
 	TLSVerify       bool
 	Prefix          string
 	TransformCase   string
-}
 
-type ldapPrincipals struct {
-	User string `json:"user" binding:"required"`
+	// NestedGroups resolves nested groups membership: recursive runs group searches again
+	// with found groups, inchain uses LDAP_MATCHING_RULE_IN_CHAIN of Active Directory.
+	// Only direct membership is resolved when empty.
+	NestedGroups string
+	// NestedMaxDepth limits levels of nested groups resolved with recursive searches
+	NestedMaxDepth int
+	// MemberAttribute is the attribute of group search filter rewritten with the in chain
+	// matching rule
+	MemberAttribute string
+	// GroupAttribute is an attribute of user and group entries listing their groups, like
+	// memberOf, read instead of running group searches
+	GroupAttribute string
+	// PrimaryGroup adds the Active Directory primary group of user, found from its
+	// primaryGroupID and objectSid attributes
+	PrimaryGroup bool
+	// PageSize enables paged group searches when not 0
+	PageSize uint32
+
+	// UserPrincipals are attributes of user entry used as principals
+	UserPrincipals []Source
+	// GroupPrincipals are attributes of group entries used as principals instead of their
+	// CN filtered by Prefix
+	GroupPrincipals []Source
 }
 
+// Nested groups resolution modes
+const (
+	NestedRecursive = "recursive"
+	NestedInChain   = "inchain"
+
+	inChainOID = "1.2.840.113556.1.4.1941"
+)
+
 // Init method is used to ingest config of Principals
 func (p *Principals) Init(config *viper.Viper) error {
 	neededEntries := []string{
@@ -84,70 +112,145 @@ func (p *Principals) Init(config *viper.Viper) error {
 	p.Prefix = config.GetString("ldapGroupPrefix")
 	p.TransformCase = tc
 
+	var err error
+	if p.UserPrincipals, err = initSources(config, "ldapUserPrincipals"); err != nil {
+		return err
+	}
+	if p.GroupPrincipals, err = initSources(config, "ldapGroupPrincipals"); err != nil {
+		return err
+	}
+
+	return p.initGroups(config)
+}
+
+// initGroups ingests config of groups resolution, ldapActiveDirectory sets defaults suited to
+// Active Directory
+func (p *Principals) initGroups(config *viper.Viper) error {
+	ad := config.GetBool("ldapActiveDirectory")
+	if ad {
+		config.SetDefault("ldapNestedGroups", NestedInChain)
+		config.SetDefault("ldapPrimaryGroup", true)
+		config.SetDefault("ldapPageSize", 500)
+	}
+
+	switch nested := config.GetString("ldapNestedGroups"); nested {
+	case "", "none":
+	case NestedRecursive:
+		config.SetDefault("ldapNestedMaxDepth", 10)
+		p.NestedGroups = nested
+		p.NestedMaxDepth = config.GetInt("ldapNestedMaxDepth")
+		if p.NestedMaxDepth < 1 {
+			return errors.New("ldapNestedMaxDepth config entry for Principals must be positive")
+		}
+	case NestedInChain:
+		config.SetDefault("ldapGroupMemberAttribute", "member")
+		p.NestedGroups = nested
+		p.MemberAttribute = config.GetString("ldapGroupMemberAttribute")
+		if !strings.Contains(p.GroupSearchStr, "("+p.MemberAttribute+"=%s)") {
+			return fmt.Errorf("ldapGroupSearch config entry for Principals must contain (%s=%%s) with inchain nested groups", p.MemberAttribute)
+		}
+	default:
+		return errors.New("ldapNestedGroups config entry for Principals must be none, recursive or inchain")
+	}
+
+	p.GroupAttribute = config.GetString("ldapGroupAttribute")
+	if p.GroupAttribute != "" && p.NestedGroups == NestedInChain {
+		return errors.New("ldapGroupAttribute config entry for Principals can't be used with inchain nested groups")
+	}
+
+	p.PrimaryGroup = config.GetBool("ldapPrimaryGroup")
+
+	pageSize := config.GetInt("ldapPageSize")
+	if pageSize < 0 {
+		return errors.New("ldapPageSize config entry for Principals must not be negative")
+	}
+	p.PageSize = uint32(pageSize)
+
 	return nil
 }
 
-// Get method is used to get the list of principals associated to a specific user.
-func (p Principals) Get(ctx context.Context, payload []byte) (context.Context, []string, error) {
+// Get method is used to get the list of principals associated to a specific user, LDAP
+// requests are cancelled when ctx is done.
+func (p Principals) Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error) {
+
+	user := common.User(ctx, req)
+
+	l, err := getLDAPConn(ctx, p)
+	if err != nil {
+		return ctx, []string{}, contextError(ctx, err)
+	}
+	defer l.Close() // nolint:errcheck
 
-	var ldapPrinc ldapPrincipals
-	err := json.Unmarshal(payload, &ldapPrinc)
+	// closing the connection fails pending requests
+	stop := context.AfterFunc(ctx, func() { l.Close() }) // nolint:errcheck
+	defer stop()
+
+	err = l.Bind(p.BindUser, p.BindPassword)
 	if err != nil {
-		log.Errorf("json unmarshaling failed: %s", err)
-		return ctx, []string{}, fmt.Errorf("JSON unmarshaling failed: %w", err)
+		return ctx, []string{}, contextError(ctx, err)
 	}
 
-	l, err := getLDAPConn(p)
+	principals, err := p.lookup(l, user)
 	if err != nil {
-		return ctx, []string{}, err
+		return ctx, []string{}, contextError(ctx, err)
 	}
-	defer l.Close() // nolint:errcheck
+
+	return ctx, principals, nil
+}
+
+// lookup returns principals of user with connection l
+func (p Principals) lookup(l *ldap.Conn, user string) ([]string, error) {
+	userAttributes := []string{}
+	if p.PrimaryGroup {
+		userAttributes = append(userAttributes, "objectSid", "primaryGroupID")
+	}
+	if p.GroupAttribute != "" {
+		userAttributes = append(userAttributes, p.GroupAttribute)
+	}
+	userAttributes = appendUnique(userAttributes, sourcesAttributes(p.UserPrincipals)...)
 
 	userSearchReq := ldap.NewSearchRequest(
 		p.UserSearchBase, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
-		fmt.Sprintf(p.UserSearchStr, ldap.EscapeFilter((ldapPrinc.User))),
-		[]string{},
+		fmt.Sprintf(p.UserSearchStr, ldap.EscapeFilter(user)),
+		userAttributes,
 		nil,
 	)
 
 	usr, err := l.Search(userSearchReq)
 	if err != nil {
-		return ctx, []string{}, fmt.Errorf("execute LDAP user search request: %w", err)
+		return nil, fmt.Errorf("execute LDAP user search request: %w", err)
 	}
 
 	if len(usr.Entries) > 1 {
-		return ctx, []string{}, errors.New("too many user entries returned")
+		return nil, errors.New("too many user entries returned")
 	} else if len(usr.Entries) == 0 {
-		return ctx, []string{}, errors.New("user not found")
+		return nil, errors.New("user not found")
 	}
 
-	groupSearchRequest := ldap.NewSearchRequest(
-		p.GroupSearchBase,
-		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
-		fmt.Sprintf(p.GroupSearchStr, ldap.EscapeFilter(usr.Entries[0].DN)),
-		[]string{},
-		nil,
-	)
+	userPrincipals, err := p.sourcesPrincipals(l, usr.Entries[0], p.UserPrincipals)
+	if err != nil {
+		return nil, err
+	}
 
-	gsr, err := l.Search(groupSearchRequest)
+	fetched := map[string]*ldap.Entry{}
+	groups, err := p.groups(l, usr.Entries[0], fetched)
 	if err != nil {
-		return ctx, []string{}, fmt.Errorf("execute LDAP groups search request: %w", err)
+		return nil, err
 	}
 
-	if len(gsr.Entries) == 0 {
-		return ctx, []string{}, princsPkg.NewNotFoundError("ldap", "No group found")
+	if len(groups) == 0 && len(userPrincipals) == 0 {
+		return nil, princsPkg.NewNotFoundError("ldap", "No group found")
 	}
 
-	var principals []string
-	for _, group := range gsr.Entries {
-		principals = append(principals, group.DN)
+	groupPrincipals, err := p.groupsPrincipals(l, groups, fetched)
+	if err != nil {
+		return nil, err
 	}
 
-	principals = getCN(principals)
-	principals = filterByPrefix(p.Prefix, principals)
+	principals := append(userPrincipals, groupPrincipals...)
 	principals = common.TransformCase(p.TransformCase, principals)
 
-	return ctx, principals, nil
+	return principals, nil
 }
 
 func getCN(list []string) []string {
@@ -175,20 +278,33 @@ func filterByPrefix(prefix string, list []string) []string {
 	return principals
 }
 
-func getLDAPConn(p Principals) (l *ldap.Conn, err error) {
-	l = &ldap.Conn{}
-	l.SetTimeout(time.Second * 10)
+// getLDAPConn returns a connection to LDAP server, dial is limited by the deadline of ctx
+func getLDAPConn(ctx context.Context, p Principals) (l *ldap.Conn, err error) {
+	timeout := time.Second * 10
+	dialer := &net.Dialer{Timeout: timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
 
 	if p.UseTLS {
-		l, err = ldap.DialURL(fmt.Sprintf("ldaps://%s:%d", p.Address, p.Port), ldap.DialWithTLSConfig(&tls.Config{InsecureSkipVerify: !p.TLSVerify}))
+		l, err = ldap.DialURL(fmt.Sprintf("ldaps://%s:%d", p.Address, p.Port), ldap.DialWithTLSDialer(&tls.Config{InsecureSkipVerify: !p.TLSVerify}, dialer))
 	} else {
-		l, err = ldap.DialURL(fmt.Sprintf("ldap://%s:%d", p.Address, p.Port))
+		l, err = ldap.DialURL(fmt.Sprintf("ldap://%s:%d", p.Address, p.Port), ldap.DialWithDialer(dialer))
 	}
 	if err != nil {
 		return l, err
 	}
+	l.SetTimeout(timeout)
 
-	err = l.Bind(p.BindUser, p.BindPassword)
+	return l, nil
+}
+
+// contextError wraps err with the error of ctx when ctx is done, requests failing because
+// the connection was closed on cancellation
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
 
-	return l, err
+	return fmt.Errorf("%w: %w", ctx.Err(), err)
 }
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"context"
 	"testing"
+	"time"
 
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/internal/ldaptest"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
@@ -27,7 +30,7 @@ func TestPrincipals(t *testing.T) {
 		Prefix:          "smk-",
 	}
 
-	_, principals, err := ldap.Get(context.Background(), []byte("{\"user\": \"fakeuser\"}"))
+	_, principals, err := ldap.Get(context.Background(), &request.SignRequest{User: "fakeuser"})
 	if err != nil {
 		t.Logf("%s", err)
 		t.Fail()
@@ -39,6 +42,21 @@ func TestPrincipals(t *testing.T) {
 	}
 }
 
+func TestPrincipalsContext(t *testing.T) {
+	srv := ldaptest.NewServer(t, groupEntries, nil)
+	srv.SearchDelay = time.Second
+	p := testGroupsPrincipals(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, principals, err := p.Get(ctx, &request.SignRequest{User: "alice"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, principals)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
 func TestGetCN(t *testing.T) {
 	cases := []struct {
 		list    []string
@@ -0,0 +1,302 @@
+package ldap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// groups returns DNs of groups of user entry, including its primary group and nested groups
+// when enabled. Group entries found with searches are added to fetched, by lowercase DN.
+func (p Principals) groups(l *ldap.Conn, user *ldap.Entry, fetched map[string]*ldap.Entry) ([]string, error) {
+	var (
+		direct []string
+		err    error
+	)
+	if p.GroupAttribute != "" {
+		direct, err = p.rangedValues(l, user, p.GroupAttribute)
+	} else {
+		direct, err = p.searchGroups(l, p.groupFilter(user.DN), fetched)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seeds := []string{user.DN}
+	if p.PrimaryGroup {
+		primary, err := p.primaryGroup(l, user, fetched)
+		if err != nil {
+			return nil, err
+		}
+		if primary != "" {
+			direct = appendUnique(direct, primary)
+			seeds = append(seeds, primary)
+		}
+	}
+
+	switch p.NestedGroups {
+	case NestedRecursive:
+		return p.recursiveGroups(l, direct, fetched)
+	case NestedInChain:
+		// groups found with user DN already include nested ones, only groups of primary
+		// group, which isn't listed in member attributes, are missing
+		for _, seed := range seeds[1:] {
+			nested, err := p.searchGroups(l, p.groupFilter(seed), fetched)
+			if err != nil {
+				return nil, err
+			}
+			direct = appendUnique(direct, nested...)
+		}
+	}
+
+	return direct, nil
+}
+
+// groupFilter returns the group search filter of member dn
+func (p Principals) groupFilter(dn string) string {
+	filter := p.GroupSearchStr
+	if p.NestedGroups == NestedInChain {
+		filter = strings.ReplaceAll(filter, "("+p.MemberAttribute+"=%s)", "("+p.MemberAttribute+":"+inChainOID+":=%s)")
+	}
+
+	return fmt.Sprintf(filter, ldap.EscapeFilter(dn))
+}
+
+// recursiveGroups returns groups and the groups they are members of, recursively up to
+// NestedMaxDepth levels. Cycles between groups are ignored.
+func (p Principals) recursiveGroups(l *ldap.Conn, groups []string, fetched map[string]*ldap.Entry) ([]string, error) {
+	all := slices.Clone(groups)
+	level := groups
+
+	for depth := 0; depth < p.NestedMaxDepth && len(level) > 0; depth++ {
+		var next []string
+		for _, group := range level {
+			parents, err := p.parentGroups(l, group, fetched)
+			if err != nil {
+				return nil, err
+			}
+			for _, parent := range parents {
+				if containsFold(all, parent) {
+					continue
+				}
+				all = append(all, parent)
+				next = append(next, parent)
+			}
+		}
+		level = next
+	}
+
+	return all, nil
+}
+
+// parentGroups returns DNs of groups which group is a direct member of
+func (p Principals) parentGroups(l *ldap.Conn, group string, fetched map[string]*ldap.Entry) ([]string, error) {
+	if p.GroupAttribute == "" {
+		return p.searchGroups(l, p.groupFilter(group), fetched)
+	}
+
+	entry, err := readEntry(l, group, []string{p.GroupAttribute})
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	return p.rangedValues(l, entry, p.GroupAttribute)
+}
+
+// searchGroups returns DNs of groups found with filter
+func (p Principals) searchGroups(l *ldap.Conn, filter string, fetched map[string]*ldap.Entry) ([]string, error) {
+	res, err := p.search(l, ldap.NewSearchRequest(
+		p.GroupSearchBase,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter,
+		p.groupEntryAttributes(),
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("execute LDAP groups search request: %w", err)
+	}
+
+	groups := []string{}
+	for _, group := range res.Entries {
+		groups = append(groups, group.DN)
+		fetched[strings.ToLower(group.DN)] = group
+	}
+
+	return groups, nil
+}
+
+// groupEntryAttributes returns attributes of group entries read by group searches, only those
+// of GroupPrincipals sources as large groups would return all their members
+func (p Principals) groupEntryAttributes() []string {
+	attributes := sourcesAttributes(p.GroupPrincipals)
+	if len(attributes) == 0 {
+		return []string{"1.1"}
+	}
+
+	return attributes
+}
+
+// readEntry returns attributes of entry dn, or nil if it doesn't exist
+func readEntry(l *ldap.Conn, dn string, attributes []string) (*ldap.Entry, error) {
+	res, err := l.Search(ldap.NewSearchRequest(
+		dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		attributes,
+		nil,
+	))
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("execute LDAP entry search request: %w", err)
+	}
+	if len(res.Entries) == 0 {
+		return nil, nil
+	}
+
+	return res.Entries[0], nil
+}
+
+// search runs a paged search if PageSize is set, so that users in more groups than the
+// server size limit get all of them
+func (p Principals) search(l *ldap.Conn, req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if p.PageSize > 0 {
+		return l.SearchWithPaging(req, p.PageSize)
+	}
+
+	return l.Search(req)
+}
+
+// primaryGroup returns DN of the Active Directory primary group of user, its SID is the user
+// domain SID followed by primaryGroupID. It returns an empty DN if user has no primary group
+// or if it isn't below GroupSearchBase.
+func (p Principals) primaryGroup(l *ldap.Conn, user *ldap.Entry, fetched map[string]*ldap.Entry) (string, error) {
+	rid := user.GetAttributeValue("primaryGroupID")
+	sid := user.GetRawAttributeValue("objectSid")
+	if rid == "" || len(sid) == 0 {
+		return "", nil
+	}
+
+	groupSID, err := primaryGroupSID(sid, rid)
+	if err != nil {
+		return "", err
+	}
+
+	var filter strings.Builder
+	filter.WriteString("(objectSid=")
+	for _, b := range groupSID {
+		fmt.Fprintf(&filter, "\\%02x", b)
+	}
+	filter.WriteString(")")
+
+	res, err := l.Search(ldap.NewSearchRequest(
+		p.GroupSearchBase,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter.String(),
+		p.groupEntryAttributes(),
+		nil,
+	))
+	if err != nil {
+		return "", fmt.Errorf("execute LDAP primary group search request: %w", err)
+	}
+	if len(res.Entries) == 0 {
+		return "", nil
+	}
+	fetched[strings.ToLower(res.Entries[0].DN)] = res.Entries[0]
+
+	return res.Entries[0].DN, nil
+}
+
+// primaryGroupSID replaces the last sub-authority (RID) of binary SID sid with rid
+func primaryGroupSID(sid []byte, rid string) ([]byte, error) {
+	// revision, sub-authorities count, 6 bytes of authority and 4 bytes per sub-authority
+	if len(sid) < 12 || len(sid) != 8+4*int(sid[1]) {
+		return nil, errors.New("invalid objectSid of user")
+	}
+	groupRID, err := strconv.ParseUint(rid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid primaryGroupID of user: %w", err)
+	}
+
+	groupSID := slices.Clone(sid)
+	binary.LittleEndian.PutUint32(groupSID[len(groupSID)-4:], uint32(groupRID))
+
+	return groupSID, nil
+}
+
+// rangedValues returns all values of attr of entry. Servers limiting the number of values
+// returned at once, like Active Directory, return attr;range=0-1499 instead of attr, next
+// values are read with attr;range=1500-* until the range ends with *.
+func (p Principals) rangedValues(l *ldap.Conn, entry *ldap.Entry, attr string) ([]string, error) {
+	values := []string{}
+
+	for {
+		name, low, high, ok := attributeRange(entry, attr)
+		if !ok {
+			return append(values, entry.GetEqualFoldAttributeValues(attr)...), nil
+		}
+		if low != len(values) {
+			return nil, fmt.Errorf("unexpected range %s of LDAP attribute", name)
+		}
+		values = append(values, entry.GetEqualFoldAttributeValues(name)...)
+		if high == "*" {
+			return values, nil
+		}
+
+		next := fmt.Sprintf("%s;range=%d-*", attr, len(values))
+		res, err := l.Search(ldap.NewSearchRequest(
+			entry.DN, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+			"(objectClass=*)",
+			[]string{next},
+			nil,
+		))
+		if err != nil {
+			return nil, fmt.Errorf("execute LDAP ranged attribute search request: %w", err)
+		}
+		if len(res.Entries) == 0 {
+			return nil, fmt.Errorf("entry %s not found reading %s", entry.DN, next)
+		}
+		entry = res.Entries[0]
+	}
+}
+
+// attributeRange returns name and bounds of the ranged attribute attr of entry, if any
+func attributeRange(entry *ldap.Entry, attr string) (name string, low int, high string, ok bool) {
+	prefix := strings.ToLower(attr) + ";range="
+	for _, attribute := range entry.Attributes {
+		if !strings.HasPrefix(strings.ToLower(attribute.Name), prefix) {
+			continue
+		}
+		bounds := strings.SplitN(attribute.Name[len(prefix):], "-", 2)
+		if len(bounds) != 2 {
+			continue
+		}
+		low, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			continue
+		}
+
+		return attribute.Name, low, bounds[1], true
+	}
+
+	return "", 0, "", false
+}
+
+func containsFold(list []string, str string) bool {
+	return slices.ContainsFunc(list, func(s string) bool { return strings.EqualFold(s, str) })
+}
+
+func appendUnique(list []string, strs ...string) []string {
+	for _, str := range strs {
+		if !containsFold(list, str) {
+			list = append(list, str)
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,303 @@
+package ldap
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/internal/ldaptest"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// testSID returns binary SID S-1-5-21-1-2-3-rid
+func testSID(rid uint32) string {
+	sid := []byte{1, 5, 0, 0, 0, 0, 0, 5}
+	for _, subAuthority := range []uint32{21, 1, 2, 3, rid} {
+		sid = binary.LittleEndian.AppendUint32(sid, subAuthority)
+	}
+
+	return string(sid)
+}
+
+// groupEntries are alice, member of dba and dev, with domain-users as primary group. dba is
+// member of ops, member of admins, member of dba. domain-users is member of vpn.
+var groupEntries = []ldaptest.Entry{
+	{DN: "cn=svc,dc=test", Password: "svcpassword"},
+	{DN: "uid=alice,ou=users,dc=test", Attributes: map[string][]string{
+		"uid":            {"alice"},
+		"objectSid":      {testSID(1105)},
+		"primaryGroupID": {"513"},
+		"memberOf":       {"cn=smk-dba,ou=groups,dc=test", "cn=smk-dev,ou=groups,dc=test"},
+	}},
+	{DN: "cn=smk-dba,ou=groups,dc=test", Attributes: map[string][]string{
+		"objectClass": {"group"},
+		"member":      {"uid=alice,ou=users,dc=test", "cn=smk-admins,ou=groups,dc=test"},
+		"memberOf":    {"cn=smk-ops,ou=groups,dc=test"},
+	}},
+	{DN: "cn=smk-dev,ou=groups,dc=test", Attributes: map[string][]string{
+		"objectClass": {"group"},
+		"member":      {"uid=alice,ou=users,dc=test"},
+	}},
+	{DN: "cn=smk-ops,ou=groups,dc=test", Attributes: map[string][]string{
+		"objectClass": {"group"},
+		"member":      {"cn=smk-dba,ou=groups,dc=test"},
+		"memberOf":    {"cn=smk-admins,ou=groups,dc=test"},
+	}},
+	{DN: "cn=smk-admins,ou=groups,dc=test", Attributes: map[string][]string{
+		"objectClass": {"group"},
+		"member":      {"cn=smk-ops,ou=groups,dc=test"},
+		"memberOf":    {"cn=smk-dba,ou=groups,dc=test"},
+	}},
+	{DN: "cn=smk-domain-users,ou=groups,dc=test", Attributes: map[string][]string{
+		"objectClass": {"group"},
+		"objectSid":   {testSID(513)},
+		"memberOf":    {"cn=smk-vpn,ou=groups,dc=test"},
+	}},
+	{DN: "cn=smk-vpn,ou=groups,dc=test", Attributes: map[string][]string{
+		"objectClass": {"group"},
+		"member":      {"cn=smk-domain-users,ou=groups,dc=test"},
+	}},
+}
+
+func testGroupsPrincipals(t *testing.T, srv *ldaptest.Server) Principals {
+	host, port, err := net.SplitHostPort(srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Principals{
+		Address:         host,
+		Port:            portNum,
+		BindUser:        "cn=svc,dc=test",
+		BindPassword:    "svcpassword",
+		UserSearchBase:  "ou=users,dc=test",
+		UserSearchStr:   "(uid=%s)",
+		GroupSearchBase: "ou=groups,dc=test",
+		GroupSearchStr:  "(&(objectClass=group)(member=%s))",
+		Prefix:          "smk-",
+		TransformCase:   "none",
+	}
+}
+
+func TestGroups(t *testing.T) {
+	srv := ldaptest.NewServer(t, groupEntries, nil)
+
+	tests := map[string]struct {
+		setup    func(p *Principals)
+		expected []string
+	}{
+		"direct": {
+			setup:    func(p *Principals) {},
+			expected: []string{"dba", "dev"},
+		},
+		"recursive": {
+			setup: func(p *Principals) {
+				p.NestedGroups = NestedRecursive
+				p.NestedMaxDepth = 10
+			},
+			expected: []string{"dba", "dev", "ops", "admins"},
+		},
+		"recursive max depth": {
+			setup: func(p *Principals) {
+				p.NestedGroups = NestedRecursive
+				p.NestedMaxDepth = 1
+			},
+			expected: []string{"dba", "dev", "ops"},
+		},
+		"recursive with primary group": {
+			setup: func(p *Principals) {
+				p.NestedGroups = NestedRecursive
+				p.NestedMaxDepth = 10
+				p.PrimaryGroup = true
+			},
+			expected: []string{"dba", "dev", "ops", "admins", "domain-users", "vpn"},
+		},
+		"inchain": {
+			setup: func(p *Principals) {
+				p.NestedGroups = NestedInChain
+				p.MemberAttribute = "member"
+			},
+			expected: []string{"dba", "dev", "ops", "admins"},
+		},
+		"inchain with primary group": {
+			setup: func(p *Principals) {
+				p.NestedGroups = NestedInChain
+				p.MemberAttribute = "member"
+				p.PrimaryGroup = true
+			},
+			expected: []string{"dba", "dev", "ops", "admins", "domain-users", "vpn"},
+		},
+		"primary group": {
+			setup: func(p *Principals) {
+				p.PrimaryGroup = true
+			},
+			expected: []string{"dba", "dev", "domain-users"},
+		},
+		"group attribute": {
+			setup: func(p *Principals) {
+				p.GroupAttribute = "memberOf"
+			},
+			expected: []string{"dba", "dev"},
+		},
+		"group attribute recursive": {
+			setup: func(p *Principals) {
+				p.GroupAttribute = "memberOf"
+				p.NestedGroups = NestedRecursive
+				p.NestedMaxDepth = 10
+				p.PrimaryGroup = true
+			},
+			expected: []string{"dba", "dev", "ops", "admins", "domain-users", "vpn"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := testGroupsPrincipals(t, srv)
+			tc.setup(&p)
+
+			_, principals, err := p.Get(context.Background(), &request.SignRequest{User: "alice"})
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tc.expected, principals)
+		})
+	}
+}
+
+func TestGroupsPaging(t *testing.T) {
+	srv := ldaptest.NewServer(t, groupEntries, nil)
+	srv.SizeLimit = 1
+	p := testGroupsPrincipals(t, srv)
+
+	_, _, err := p.Get(context.Background(), &request.SignRequest{User: "alice"})
+	assert.ErrorContains(t, err, "execute LDAP groups search request")
+
+	p.PageSize = 1
+	srv.Searches.Store(0)
+	_, principals, err := p.Get(context.Background(), &request.SignRequest{User: "alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dba", "dev"}, principals)
+	// user search and 2 pages of groups
+	assert.EqualValues(t, 3, srv.Searches.Load())
+}
+
+func TestGroupsRanged(t *testing.T) {
+	srv := ldaptest.NewServer(t, groupEntries, nil)
+	srv.MaxValRange = 1
+	p := testGroupsPrincipals(t, srv)
+	p.GroupAttribute = "memberOf"
+
+	_, principals, err := p.Get(context.Background(), &request.SignRequest{User: "alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dba", "dev"}, principals)
+	// user search and the second value of memberOf
+	assert.EqualValues(t, 2, srv.Searches.Load())
+}
+
+func TestPrimaryGroupSID(t *testing.T) {
+	sid, err := primaryGroupSID([]byte(testSID(1105)), "513")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(testSID(513)), sid)
+
+	_, err = primaryGroupSID([]byte(testSID(1105))[:20], "513")
+	assert.EqualError(t, err, "invalid objectSid of user")
+
+	_, err = primaryGroupSID([]byte(testSID(1105)), "domain users")
+	assert.ErrorContains(t, err, "invalid primaryGroupID of user")
+}
+
+func TestInitGroups(t *testing.T) {
+	baseConfig := []byte(`
+ldapAddr: localhost
+ldapPort: 636
+ldapTLS: true
+ldapTLSVerify: true
+ldapBindUser: "CN=bind,DC=test"
+ldapBindPassword: password
+ldapUserBase: "DC=test"
+ldapUserSearch: "(sAMAccountName=%s)"
+ldapGroupBase: "DC=test"
+ldapGroupSearch: "(&(objectClass=group)(member=%s))"
+`)
+
+	tests := map[string]struct {
+		config   string
+		expected Principals
+		err      string
+	}{
+		"active directory": {
+			config: "ldapActiveDirectory: true",
+			expected: Principals{
+				NestedGroups:    NestedInChain,
+				MemberAttribute: "member",
+				PrimaryGroup:    true,
+				PageSize:        500,
+			},
+		},
+		"active directory recursive": {
+			config: "ldapActiveDirectory: true\nldapNestedGroups: recursive\nldapPageSize: 0",
+			expected: Principals{
+				NestedGroups:   NestedRecursive,
+				NestedMaxDepth: 10,
+				PrimaryGroup:   true,
+			},
+		},
+		"recursive with group attribute": {
+			config: "ldapNestedGroups: recursive\nldapNestedMaxDepth: 3\nldapGroupAttribute: memberOf",
+			expected: Principals{
+				NestedGroups:   NestedRecursive,
+				NestedMaxDepth: 3,
+				GroupAttribute: "memberOf",
+			},
+		},
+		"bad nested groups": {
+			config: "ldapNestedGroups: always",
+			err:    "ldapNestedGroups config entry for Principals must be none, recursive or inchain",
+		},
+		"bad max depth": {
+			config: "ldapNestedGroups: recursive\nldapNestedMaxDepth: 0",
+			err:    "ldapNestedMaxDepth config entry for Principals must be positive",
+		},
+		"inchain without member filter": {
+			config: "ldapNestedGroups: inchain\nldapGroupMemberAttribute: uniqueMember",
+			err:    "ldapGroupSearch config entry for Principals must contain (uniqueMember=%s) with inchain nested groups",
+		},
+		"inchain with group attribute": {
+			config: "ldapNestedGroups: inchain\nldapGroupAttribute: memberOf",
+			err:    "ldapGroupAttribute config entry for Principals can't be used with inchain nested groups",
+		},
+		"negative page size": {
+			config: "ldapPageSize: -1",
+			err:    "ldapPageSize config entry for Principals must not be negative",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := viper.New()
+			config.SetConfigType("yaml")
+			assert.NoError(t, config.ReadConfig(bytes.NewBuffer(append(append([]byte{}, baseConfig...), []byte(tc.config)...))))
+
+			p := &Principals{}
+			err := p.Init(config)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected.NestedGroups, p.NestedGroups)
+			assert.Equal(t, tc.expected.NestedMaxDepth, p.NestedMaxDepth)
+			assert.Equal(t, tc.expected.MemberAttribute, p.MemberAttribute)
+			assert.Equal(t, tc.expected.GroupAttribute, p.GroupAttribute)
+			assert.Equal(t, tc.expected.PrimaryGroup, p.PrimaryGroup)
+			assert.Equal(t, tc.expected.PageSize, p.PageSize)
+		})
+	}
+}
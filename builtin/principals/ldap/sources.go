@@ -0,0 +1,136 @@
+package ldap
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/spf13/viper"
+)
+
+// Source represents an attribute of LDAP entries used as principals. If Regex is set, only
+// values matching it are used: its first capture group, or the whole match without group.
+// Attribute dn is the DN of entries.
+type Source struct {
+	Attribute string `mapstructure:"attribute"`
+	Regex     string `mapstructure:"regex"`
+
+	regex *regexp.Regexp
+}
+
+// initSources reads sources of config entry key
+func initSources(config *viper.Viper, key string) ([]Source, error) {
+	if !config.IsSet(key) {
+		return nil, nil
+	}
+
+	var sources []Source
+	if err := config.UnmarshalKey(key, &sources); err != nil {
+		return nil, fmt.Errorf("invalid %s config entry for Principals: %w", key, err)
+	}
+
+	for i := range sources {
+		if sources[i].Attribute == "" {
+			return nil, fmt.Errorf("empty attribute of %s source for Principals", key)
+		}
+		if sources[i].Regex == "" {
+			continue
+		}
+		regex, err := regexp.Compile(sources[i].Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex of %s source %s for Principals: %w", key, sources[i].Attribute, err)
+		}
+		sources[i].regex = regex
+	}
+
+	return sources, nil
+}
+
+// extract returns principals of values of source
+func (s Source) extract(values []string) []string {
+	principals := []string{}
+	for _, value := range values {
+		if s.regex == nil {
+			principals = append(principals, value)
+			continue
+		}
+
+		match := s.regex.FindStringSubmatch(value)
+		switch {
+		case match == nil:
+		case len(match) > 1:
+			principals = append(principals, match[1])
+		default:
+			principals = append(principals, match[0])
+		}
+	}
+
+	return principals
+}
+
+// sourcesPrincipals returns principals of entry from sources
+func (p Principals) sourcesPrincipals(l *ldap.Conn, entry *ldap.Entry, sources []Source) ([]string, error) {
+	principals := []string{}
+	for _, source := range sources {
+		values := []string{entry.DN}
+		if !strings.EqualFold(source.Attribute, "dn") {
+			var err error
+			values, err = p.rangedValues(l, entry, source.Attribute)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, principal := range source.extract(values) {
+			if principal != "" {
+				principals = append(principals, principal)
+			}
+		}
+	}
+
+	return principals, nil
+}
+
+// groupsPrincipals returns principals of groups: their CN filtered by Prefix, or values of
+// GroupPrincipals sources if set. Group entries missing in fetched are read.
+func (p Principals) groupsPrincipals(l *ldap.Conn, groups []string, fetched map[string]*ldap.Entry) ([]string, error) {
+	if len(p.GroupPrincipals) == 0 {
+		return filterByPrefix(p.Prefix, getCN(groups)), nil
+	}
+
+	principals := []string{}
+	for _, group := range groups {
+		entry, ok := fetched[strings.ToLower(group)]
+		if !ok {
+			var err error
+			entry, err = readEntry(l, group, p.groupEntryAttributes())
+			if err != nil {
+				return nil, err
+			}
+			if entry == nil {
+				continue
+			}
+		}
+
+		groupPrincipals, err := p.sourcesPrincipals(l, entry, p.GroupPrincipals)
+		if err != nil {
+			return nil, err
+		}
+		principals = append(principals, groupPrincipals...)
+	}
+
+	return principals, nil
+}
+
+// sourcesAttributes returns LDAP attributes of sources to read
+func sourcesAttributes(sources []Source) []string {
+	attributes := []string{}
+	for _, source := range sources {
+		if !strings.EqualFold(source.Attribute, "dn") {
+			attributes = appendUnique(attributes, source.Attribute)
+		}
+	}
+
+	return attributes
+}
@@ -0,0 +1,182 @@
+package ldap
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/internal/ldaptest"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+var sourceEntries = []ldaptest.Entry{
+	{DN: "cn=svc,dc=test", Password: "svcpassword"},
+	{DN: "uid=bob,ou=users,dc=test", Attributes: map[string][]string{
+		"uid":          {"bob"},
+		"employeeType": {"contractor-dba"},
+		"sshPrincipal": {"bob-admin", "deploy", "backup"},
+	}},
+	{DN: "uid=carol,ou=users,dc=test", Attributes: map[string][]string{
+		"uid": {"carol"},
+	}},
+	{DN: "cn=unix-staff,ou=groups,dc=test", Attributes: map[string][]string{
+		"objectClass": {"posixGroup"},
+		"member":      {"uid=bob,ou=users,dc=test"},
+		"gidNumber":   {"5000"},
+	}},
+	{DN: "cn=unix-web,ou=groups,dc=test", Attributes: map[string][]string{
+		"objectClass": {"posixGroup"},
+		"member":      {"uid=bob,ou=users,dc=test"},
+		"gidNumber":   {"5001"},
+	}},
+}
+
+func TestSources(t *testing.T) {
+	srv := ldaptest.NewServer(t, sourceEntries, nil)
+
+	tests := map[string]struct {
+		user     string
+		setup    func(p *Principals)
+		expected []string
+		err      string
+	}{
+		"group CN": {
+			user:     "bob",
+			setup:    func(p *Principals) { p.Prefix = "unix-" },
+			expected: []string{"staff", "web"},
+		},
+		"user attributes": {
+			user: "bob",
+			setup: func(p *Principals) {
+				p.Prefix = "unix-"
+				p.UserPrincipals = []Source{
+					{Attribute: "uid"},
+					{Attribute: "employeeType", regex: regexp.MustCompile(`^contractor-(.+)$`)},
+					{Attribute: "sshPrincipal", regex: regexp.MustCompile(`^[a-z]+-admin$`)},
+				}
+			},
+			expected: []string{"bob", "dba", "bob-admin", "staff", "web"},
+		},
+		"group attributes": {
+			user: "bob",
+			setup: func(p *Principals) {
+				p.GroupPrincipals = []Source{
+					{Attribute: "gidNumber", regex: regexp.MustCompile(`^50(\d\d)$`)},
+					{Attribute: "dn", regex: regexp.MustCompile(`^cn=unix-(web),`)},
+				}
+			},
+			expected: []string{"00", "01", "web"},
+		},
+		"user attributes without group": {
+			user: "carol",
+			setup: func(p *Principals) {
+				p.UserPrincipals = []Source{{Attribute: "uid"}}
+			},
+			expected: []string{"carol"},
+		},
+		"no group": {
+			user:  "carol",
+			setup: func(p *Principals) {},
+			err:   "ldap: No group found",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := testGroupsPrincipals(t, srv)
+			p.Prefix = ""
+			p.GroupSearchStr = "(&(objectClass=posixGroup)(member=%s))"
+			tc.setup(&p)
+
+			_, principals, err := p.Get(context.Background(), &request.SignRequest{User: tc.user})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, principals)
+		})
+	}
+}
+
+func TestSourcesRanged(t *testing.T) {
+	srv := ldaptest.NewServer(t, sourceEntries, nil)
+	srv.MaxValRange = 2
+	p := testGroupsPrincipals(t, srv)
+	p.GroupSearchStr = "(&(objectClass=posixGroup)(member=%s))"
+	p.UserPrincipals = []Source{{Attribute: "sshPrincipal"}}
+	p.GroupPrincipals = []Source{{Attribute: "gidNumber"}}
+
+	_, principals, err := p.Get(context.Background(), &request.SignRequest{User: "bob"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bob-admin", "deploy", "backup", "5000", "5001"}, principals)
+}
+
+func TestSourceExtract(t *testing.T) {
+	source := Source{}
+	assert.Equal(t, []string{"a", "b"}, source.extract([]string{"a", "b"}))
+
+	source.regex = regexp.MustCompile(`^smk-`)
+	assert.Equal(t, []string{"smk-"}, source.extract([]string{"smk-a", "b"}))
+
+	source.regex = regexp.MustCompile(`^smk-(.*)$`)
+	assert.Equal(t, []string{"a"}, source.extract([]string{"smk-a", "b"}))
+}
+
+func TestInitSources(t *testing.T) {
+	tests := map[string]struct {
+		config   string
+		expected []Source
+		err      string
+	}{
+		"unset": {
+			config: "other: true",
+		},
+		"sources": {
+			config: `
+ldapUserPrincipals:
+  - attribute: uid
+  - attribute: employeeType
+    regex: "^contractor-(.+)$"
+`,
+			expected: []Source{
+				{Attribute: "uid"},
+				{Attribute: "employeeType", Regex: "^contractor-(.+)$", regex: regexp.MustCompile("^contractor-(.+)$")},
+			},
+		},
+		"empty attribute": {
+			config: `
+ldapUserPrincipals:
+  - regex: "^(.+)$"
+`,
+			err: "empty attribute of ldapUserPrincipals source for Principals",
+		},
+		"bad regex": {
+			config: `
+ldapUserPrincipals:
+  - attribute: uid
+    regex: "^(.+$"
+`,
+			err: "invalid regex of ldapUserPrincipals source uid for Principals: error parsing regexp: missing closing ): `^(.+$`",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := viper.New()
+			config.SetConfigType("yaml")
+			assert.NoError(t, config.ReadConfig(bytes.NewBufferString(tc.config)))
+
+			sources, err := initSources(config, "ldapUserPrincipals")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, sources)
+		})
+	}
+}
@@ -2,12 +2,11 @@ package local
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"strings"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/signmykeyio/signmykey/builtin/principals/common"
+	"github.com/signmykeyio/signmykey/builtin/request"
 	"github.com/spf13/viper"
 
 	princsPkg "github.com/signmykeyio/signmykey/builtin/principals"
@@ -18,10 +17,6 @@ type Principals struct {
 	UserMap *viper.Viper
 }
 
-type localPrincipals struct {
-	User string `json:"user" binding:"required"`
-}
-
 // Init method is used to ingest config of Principals
 func (p *Principals) Init(config *viper.Viper) error {
 	if !config.IsSet("users") {
@@ -34,21 +29,16 @@ func (p *Principals) Init(config *viper.Viper) error {
 }
 
 // Get method is used to get the list of principals associated to a specific user.
-func (p Principals) Get(ctx context.Context, payload []byte) (context.Context, []string, error) {
+func (p Principals) Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error) {
 
-	var local localPrincipals
-	err := json.Unmarshal(payload, &local)
-	if err != nil {
-		log.Errorf("json unmarshaling failed: %s", err)
-		return ctx, []string{}, fmt.Errorf("JSON unmarshaling failed: %w", err)
-	}
+	user := common.User(ctx, req)
 
-	if !p.UserMap.IsSet(local.User) {
+	if !p.UserMap.IsSet(user) {
 		return ctx, []string{}, princsPkg.NewNotFoundError("local", "No principals found")
 	}
 
 	principals := []string{}
-	for _, str := range strings.Split(p.UserMap.GetString(local.User), ",") {
+	for _, str := range strings.Split(p.UserMap.GetString(user), ",") {
 		trimmed := strings.Trim(str, " ")
 		if len(trimmed) > 0 {
 			principals = append(principals, trimmed)
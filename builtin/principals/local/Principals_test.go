@@ -6,6 +6,8 @@ import (
 	"sort"
 	"testing"
 
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
@@ -14,7 +16,7 @@ func TestPrincipals(t *testing.T) {
 
 	cases := []struct {
 		userMap []byte
-		payload []byte
+		req     *request.SignRequest
 		expErr  bool
 		expList []string
 	}{
@@ -22,19 +24,19 @@ func TestPrincipals(t *testing.T) {
 			[]byte(`
 users:
   user1: princ2,princ1`),
-			[]byte("{\"user\": \"user1\"}"), false, []string{"princ1", "princ2"},
+			&request.SignRequest{User: "user1"}, false, []string{"princ1", "princ2"},
 		},
 		{
 			[]byte(`
 users:
   user: princ1,princ2`),
-			[]byte("{\"user\": \"user\"}"), false, []string{"princ1", "princ2"},
+			&request.SignRequest{User: "user"}, false, []string{"princ1", "princ2"},
 		},
 		{
 			[]byte(`
 users:
   user2: princ1,princ2`),
-			[]byte("{\"user\": \"user1\"}"), true, []string{},
+			&request.SignRequest{User: "user1"}, true, []string{},
 		},
 		{
 			[]byte(`
@@ -42,7 +44,7 @@ users:
   user1: princ1
   user2: princ3,princ4
 `),
-			[]byte("{\"user\": \"user2\"}"), false, []string{"princ3", "princ4"},
+			&request.SignRequest{User: "user2"}, false, []string{"princ3", "princ4"},
 		},
 		{
 			[]byte(`
@@ -50,7 +52,7 @@ users:
   user1: princ1, princ2,princ3
   user2: princ3,princ4
 `),
-			[]byte("{\"user\": \"user1\"}"), false, []string{"princ1", "princ2", "princ3"},
+			&request.SignRequest{User: "user1"}, false, []string{"princ1", "princ2", "princ3"},
 		},
 		{
 			[]byte(`
@@ -58,7 +60,7 @@ users:
   user1: princ1, princ2,princ3 , ,princ4
   user2: princ3,princ4
 `),
-			[]byte("{\"user\": \"user1\"}"), false, []string{"princ1", "princ2", "princ3", "princ4"},
+			&request.SignRequest{User: "user1"}, false, []string{"princ1", "princ2", "princ3", "princ4"},
 		},
 	}
 
@@ -76,7 +78,7 @@ users:
 			t.Error(err)
 		}
 
-		_, principals, err := local.Get(context.Background(), c.payload)
+		_, principals, err := local.Get(context.Background(), c.req)
 		if c.expErr {
 			assert.Error(t, err)
 		} else {
@@ -88,3 +90,25 @@ users:
 		assert.Equal(t, c.expList, principals)
 	}
 }
+
+func TestPrincipalsIdentity(t *testing.T) {
+	testConfig := viper.New()
+	testConfig.SetConfigType("yaml")
+	err := testConfig.ReadConfig(bytes.NewBuffer([]byte(`
+users:
+  user1: princ1
+  user2: princ2
+`)))
+	if err != nil {
+		t.Error(err)
+	}
+
+	local := &Principals{}
+	assert.NoError(t, local.Init(testConfig))
+
+	// user authenticated by Authenticator is used instead of request one
+	ctx := authenticator.WithIdentity(context.Background(), authenticator.NewIdentity("local", "user2", "local-user2"))
+	_, principals, err := local.Get(ctx, &request.SignRequest{User: "user1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"princ2"}, principals)
+}
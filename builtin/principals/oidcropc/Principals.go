@@ -12,6 +12,7 @@ import (
 
 	"github.com/signmykeyio/signmykey/builtin/authenticator/oidcropc"
 	"github.com/signmykeyio/signmykey/builtin/principals/common"
+	"github.com/signmykeyio/signmykey/builtin/request"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
@@ -21,6 +22,13 @@ type Principals struct {
 	OIDCUserinfoEndpoint string
 	OIDCUserGroupsEntry  string
 	TransformCase        string
+
+	// Issuer enables discovery of userinfo endpoint
+	Issuer string
+	// GroupsSource is "idtoken" to read groups from ID token claims instead of userinfo endpoint
+	GroupsSource string
+
+	provider *oidcropc.Provider
 }
 
 // Init method is used to ingest config of Principals
@@ -29,6 +37,10 @@ func (p *Principals) Init(config *viper.Viper) error {
 		"oidcUserinfoEndpoint",
 		"oidcUserGroupsEntry",
 	}
+	// userinfo endpoint is discovered from issuer or not used at all
+	if config.IsSet("oidcIssuer") || config.GetString("oidcGroupsSource") == "idtoken" {
+		neededEntries = neededEntries[1:]
+	}
 
 	var missingEntriesLst []string
 	for _, entry := range neededEntries {
@@ -53,48 +65,41 @@ func (p *Principals) Init(config *viper.Viper) error {
 
 	p.TransformCase = tc
 
-	return nil
-}
-
-// Get method is used to get the list of principals associated to a specific user.
-func (p Principals) Get(ctx context.Context, payload []byte) (context.Context, []string, error) {
-
-	// Get token from OIDC authenticator
-	token, err := getTokenFromContext(ctx)
-	if err != nil {
-		return ctx, []string{}, err
-	}
-
-	reqInfo, err := http.NewRequest("GET", p.OIDCUserinfoEndpoint, nil)
-	if err != nil {
-		return ctx, []string{}, err
+	p.GroupsSource = config.GetString("oidcGroupsSource")
+	if p.GroupsSource != "" && p.GroupsSource != "userinfo" && p.GroupsSource != "idtoken" {
+		return errors.New("oidcGroupsSource config entry for Principals must be userinfo or idtoken")
 	}
 
-	// Add HTTP Authorization Header
-	reqInfo.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-
-	client := http.Client{Timeout: time.Second * 10}
-	resInfo, err := client.Do(reqInfo)
-	if err != nil {
-		return ctx, []string{}, err
+	if config.IsSet("oidcIssuer") {
+		p.Issuer = config.GetString("oidcIssuer")
+		p.provider = oidcropc.NewProvider(p.Issuer)
 	}
 
-	defer resInfo.Body.Close() // nolint:errcheck
+	return nil
+}
 
-	bodyInfo, err := io.ReadAll(resInfo.Body)
-	if err != nil {
-		return ctx, []string{}, err
-	}
+// Get method is used to get the list of principals associated to a specific user.
+func (p Principals) Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error) {
 
-	oidcUserinfo := make(map[string]interface{})
-	err = json.Unmarshal(bodyInfo, &oidcUserinfo)
-	if err != nil {
-		return ctx, []string{}, err
+	var claims map[string]interface{}
+	if p.GroupsSource == "idtoken" {
+		idTokenClaims, ok := ctx.Value(oidcropc.IDTokenClaimsKey).(oidcropc.IDTokenClaims)
+		if !ok {
+			log.Errorf("ID token claims not available, oidcropc principals needs that oidcropc authenticator validates ID token")
+			return ctx, []string{}, errors.New("OIDC ID token claims not available")
+		}
+		claims = idTokenClaims
+	} else {
+		userinfo, err := p.userinfo(ctx)
+		if err != nil {
+			return ctx, []string{}, err
+		}
+		claims = userinfo
 	}
 
 	principals := []string{}
 	for _, entry := range strings.Split(p.OIDCUserGroupsEntry, ",") {
-		rawGroups, ok := oidcUserinfo[entry]
+		rawGroups, ok := claims[entry]
 		if !ok {
 			log.Infof("oidc entry %s doesn't exists", entry)
 			continue
@@ -122,6 +127,56 @@ func (p Principals) Get(ctx context.Context, payload []byte) (context.Context, [
 	return ctx, principals, nil
 }
 
+func (p Principals) userinfo(ctx context.Context) (map[string]interface{}, error) {
+
+	// Get token from OIDC authenticator
+	token, err := getTokenFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := p.OIDCUserinfoEndpoint
+	if endpoint == "" && p.provider != nil {
+		metadata, err := p.provider.Metadata(ctx)
+		if err != nil {
+			return nil, err
+		}
+		endpoint = metadata.UserinfoEndpoint
+	}
+	if endpoint == "" {
+		return nil, errors.New("no OIDC userinfo endpoint available")
+	}
+
+	reqInfo, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add HTTP Authorization Header
+	reqInfo.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	client := http.Client{Timeout: time.Second * 10}
+	resInfo, err := client.Do(reqInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resInfo.Body.Close() // nolint:errcheck
+
+	bodyInfo, err := io.ReadAll(resInfo.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	oidcUserinfo := make(map[string]interface{})
+	err = json.Unmarshal(bodyInfo, &oidcUserinfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return oidcUserinfo, nil
+}
+
 func getTokenFromContext(ctx context.Context) (oidcropc.OIDCToken, error) {
 
 	// Get token from OIDC authenticator
@@ -3,8 +3,12 @@ package oidcropc
 import (
 	"bytes"
 	"context"
+	"sort"
 	"testing"
 
+	"github.com/signmykeyio/signmykey/builtin/authenticator/oidcropc"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/internal/oidctest"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
@@ -18,7 +22,7 @@ func TestPrincipals(t *testing.T) {
 		OIDCUserGroupsEntry:  "oidc-groups",
 	}
 
-	_, principals, err := oidc.Get(context.Background(), []byte("{\"user\": \"fakeuser\"}"))
+	_, principals, err := oidc.Get(context.Background(), &request.SignRequest{User: "fakeuser"})
 	if err != nil {
 		t.Logf("%s", err)
 		t.Fail()
@@ -80,3 +84,99 @@ oidcUserGroupsEntry: "oidc-groups"
 	}
 
 }
+
+func TestPrincipalsInitIssuer(t *testing.T) {
+	cases := []struct {
+		config []byte
+		err    string
+	}{
+		{[]byte(`oidcIssuer: "https://idp.my.corp"`), "missing config entries (oidcUserGroupsEntry) for Principals"},
+		{[]byte(`
+oidcGroupsSource: "idtoken"
+oidcUserGroupsEntry: "groups"
+`), ""},
+		{[]byte(`
+oidcIssuer: "https://idp.my.corp"
+oidcGroupsSource: "accesstoken"
+oidcUserGroupsEntry: "groups"
+`), "oidcGroupsSource config entry for Principals must be userinfo or idtoken"},
+		{[]byte(`
+oidcIssuer: "https://idp.my.corp"
+oidcUserGroupsEntry: "groups"
+`), ""},
+	}
+
+	for _, c := range cases {
+		testConfig := viper.New()
+		testConfig.SetConfigType("yaml")
+		err := testConfig.ReadConfig(bytes.NewBuffer(c.config))
+		if err != nil {
+			t.Error(err)
+		}
+
+		princs := Principals{}
+		err = princs.Init(testConfig)
+		if c.err == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, c.err)
+		}
+	}
+}
+
+func TestPrincipalsSources(t *testing.T) {
+	idp := oidctest.NewServer(t, "signmykey", "secret", map[string]oidctest.User{
+		"alice": {
+			Password: "alicepass",
+			Claims:   map[string]interface{}{"preferred_username": "alice", "groups": []string{"token-admins"}},
+			Userinfo: map[string]interface{}{"groups": []string{"admins", "devs"}, "roles": []string{"ops"}},
+		},
+	})
+
+	authConfig := viper.New()
+	authConfig.Set("oidcIssuer", idp.Issuer)
+	authConfig.Set("oidcClientID", "signmykey")
+	authConfig.Set("oidcClientSecret", "secret")
+	auth := &oidcropc.Authenticator{}
+	if err := auth.Init(authConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, valid, _, err := auth.Login(context.Background(), &request.SignRequest{User: "alice", Password: "alicepass"})
+	if !valid || err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		source  string
+		entries string
+		expList []string
+	}{
+		{"", "groups,roles", []string{"admins", "devs", "ops"}},
+		{"userinfo", "groups", []string{"admins", "devs"}},
+		{"idtoken", "groups", []string{"token-admins"}},
+		{"idtoken", "roles", []string{}},
+	}
+
+	for _, c := range cases {
+		testConfig := viper.New()
+		testConfig.Set("oidcIssuer", idp.Issuer)
+		testConfig.Set("oidcGroupsSource", c.source)
+		testConfig.Set("oidcUserGroupsEntry", c.entries)
+
+		princs := &Principals{}
+		if err := princs.Init(testConfig); err != nil {
+			t.Fatal(err)
+		}
+
+		_, principals, err := princs.Get(ctx, &request.SignRequest{User: "alice"})
+		assert.NoError(t, err, c.source)
+		sort.Strings(principals)
+		assert.Equal(t, c.expList, principals, c.source)
+	}
+
+	// ID token claims are only available when checked by authenticator
+	princs := &Principals{OIDCUserGroupsEntry: "groups", GroupsSource: "idtoken"}
+	_, _, err = princs.Get(context.Background(), &request.SignRequest{User: "alice"})
+	assert.EqualError(t, err, "OIDC ID token claims not available")
+}
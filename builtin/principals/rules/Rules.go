@@ -0,0 +1,170 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Pipeline represents rules reshaping principals returned by all principals providers. They
+// are applied in this order: renames, required check, expansions, allow list, deny list,
+// deduplication and maximum count.
+type Pipeline struct {
+	// Rename rewrites principals, the first rule matching a principal is applied
+	Rename []Rename `mapstructure:"rename"`
+	// Required principals must all be present after renames
+	Required []string `mapstructure:"required"`
+	// Expand replaces principals by a list of principals
+	Expand []Expansion `mapstructure:"expand"`
+	// Allow keeps only principals matching one of these regexes, all principals if empty
+	Allow []string `mapstructure:"allow"`
+	// Deny removes principals matching one of these regexes
+	Deny []string `mapstructure:"deny"`
+	// MaxPrincipals fails requests with more principals, no limit if 0
+	MaxPrincipals int `mapstructure:"maxPrincipals"`
+
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// Rename represents a regex rename of principals, Replace can reference capture groups of
+// Match with $1 or ${name}
+type Rename struct {
+	Match   string `mapstructure:"match"`
+	Replace string `mapstructure:"replace"`
+
+	match *regexp.Regexp
+}
+
+// Expansion represents a principal replaced by Principals, like a group by the logins its
+// members can use
+type Expansion struct {
+	Principal  string   `mapstructure:"principal"`
+	Principals []string `mapstructure:"principals"`
+}
+
+// Compile validates rules and compiles their regexes, it must be called before Apply.
+// Allow and Deny regexes must match whole principals.
+func (p *Pipeline) Compile() error {
+	for i := range p.Rename {
+		if p.Rename[i].Match == "" {
+			return errors.New("empty match of rename rule")
+		}
+		match, err := regexp.Compile(p.Rename[i].Match)
+		if err != nil {
+			return fmt.Errorf("invalid match of rename rule: %w", err)
+		}
+		p.Rename[i].match = match
+	}
+
+	for _, expansion := range p.Expand {
+		if expansion.Principal == "" {
+			return errors.New("empty principal of expand rule")
+		}
+		if slices.Contains(expansion.Principals, "") {
+			return fmt.Errorf("empty principal in principals of expand rule %s", expansion.Principal)
+		}
+	}
+
+	if slices.Contains(p.Required, "") {
+		return errors.New("empty principal in required principals")
+	}
+	if p.MaxPrincipals < 0 {
+		return errors.New("maxPrincipals must not be negative")
+	}
+
+	var err error
+	if p.allow, err = compileAnchored(p.Allow); err != nil {
+		return fmt.Errorf("invalid allow rule: %w", err)
+	}
+	if p.deny, err = compileAnchored(p.Deny); err != nil {
+		return fmt.Errorf("invalid deny rule: %w", err)
+	}
+
+	return nil
+}
+
+// Apply returns principals reshaped by rules
+func (p *Pipeline) Apply(principals []string) ([]string, error) {
+	if p == nil {
+		return principals, nil
+	}
+
+	renamed := make([]string, 0, len(principals))
+	for _, principal := range principals {
+		renamed = append(renamed, p.rename(principal))
+	}
+
+	var missing []string
+	for _, required := range p.Required {
+		if !slices.Contains(renamed, required) {
+			missing = append(missing, required)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required principals (%s)", strings.Join(missing, ", "))
+	}
+
+	result := []string{}
+	for _, principal := range p.expand(renamed) {
+		if principal == "" || slices.Contains(result, principal) {
+			continue
+		}
+		if len(p.allow) > 0 && !matchAny(p.allow, principal) {
+			continue
+		}
+		if matchAny(p.deny, principal) {
+			continue
+		}
+		result = append(result, principal)
+	}
+
+	if p.MaxPrincipals > 0 && len(result) > p.MaxPrincipals {
+		return nil, fmt.Errorf("too many principals (%d), maximum is %d", len(result), p.MaxPrincipals)
+	}
+
+	return result, nil
+}
+
+func (p *Pipeline) rename(principal string) string {
+	for _, rename := range p.Rename {
+		if rename.match.MatchString(principal) {
+			return rename.match.ReplaceAllString(principal, rename.Replace)
+		}
+	}
+
+	return principal
+}
+
+func (p *Pipeline) expand(principals []string) []string {
+	expanded := []string{}
+	for _, principal := range principals {
+		i := slices.IndexFunc(p.Expand, func(expansion Expansion) bool { return expansion.Principal == principal })
+		if i < 0 {
+			expanded = append(expanded, principal)
+			continue
+		}
+		expanded = append(expanded, p.Expand[i].Principals...)
+	}
+
+	return expanded
+}
+
+func compileAnchored(patterns []string) ([]*regexp.Regexp, error) {
+	regexes := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, err
+		}
+		regexes = append(regexes, regex)
+	}
+
+	return regexes, nil
+}
+
+func matchAny(regexes []*regexp.Regexp, principal string) bool {
+	return slices.ContainsFunc(regexes, func(regex *regexp.Regexp) bool { return regex.MatchString(principal) })
+}
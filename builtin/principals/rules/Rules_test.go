@@ -0,0 +1,95 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile(t *testing.T) {
+	cases := []struct {
+		description string
+		pipeline    Pipeline
+		err         string
+	}{
+		{"empty", Pipeline{}, ""},
+		{"valid", Pipeline{
+			Rename:        []Rename{{Match: "^smk-(.+)$", Replace: "$1"}},
+			Required:      []string{"ssh-users"},
+			Expand:        []Expansion{{Principal: "team-dba", Principals: []string{"postgres", "mysql"}}},
+			Allow:         []string{"[a-z][a-z0-9-]*"},
+			Deny:          []string{"root"},
+			MaxPrincipals: 10,
+		}, ""},
+		{"empty rename match", Pipeline{Rename: []Rename{{Replace: "$1"}}}, "empty match of rename rule"},
+		{"invalid rename match", Pipeline{Rename: []Rename{{Match: "(", Replace: "$1"}}}, "invalid match of rename rule: error parsing regexp: missing closing ): `(`"},
+		{"empty expand principal", Pipeline{Expand: []Expansion{{Principals: []string{"postgres"}}}}, "empty principal of expand rule"},
+		{"empty expanded principal", Pipeline{Expand: []Expansion{{Principal: "team-dba", Principals: []string{""}}}}, "empty principal in principals of expand rule team-dba"},
+		{"empty required", Pipeline{Required: []string{""}}, "empty principal in required principals"},
+		{"negative max", Pipeline{MaxPrincipals: -1}, "maxPrincipals must not be negative"},
+		{"invalid allow", Pipeline{Allow: []string{"["}}, "invalid allow rule: error parsing regexp: missing closing ]: `[)$`"},
+		{"invalid deny", Pipeline{Deny: []string{"a++"}}, "invalid deny rule: error parsing regexp: invalid nested repetition operator: `++`"},
+	}
+
+	for _, c := range cases {
+		err := c.pipeline.Compile()
+		if c.err == "" {
+			assert.NoError(t, err, c.description)
+			continue
+		}
+		assert.EqualError(t, err, c.err, c.description)
+	}
+}
+
+func TestApply(t *testing.T) {
+	cases := []struct {
+		description string
+		pipeline    Pipeline
+		principals  []string
+		expected    []string
+		err         string
+	}{
+		{"no rule", Pipeline{}, []string{"a", "b", "a"}, []string{"a", "b"}, ""},
+		{"rename first match", Pipeline{Rename: []Rename{
+			{Match: "^smk-(.+)$", Replace: "$1"},
+			{Match: "^smk-", Replace: "other-"},
+			{Match: "^(?P<team>[a-z]+)-ops$", Replace: "${team}"},
+		}}, []string{"smk-dba", "web-ops", "root"}, []string{"dba", "web", "root"}, ""},
+		{"required", Pipeline{
+			Rename:   []Rename{{Match: "^SSH-USERS$", Replace: "ssh-users"}},
+			Required: []string{"ssh-users"},
+			Expand:   []Expansion{{Principal: "ssh-users", Principals: []string{}}},
+		}, []string{"SSH-USERS", "alice"}, []string{"alice"}, ""},
+		{"missing required", Pipeline{Required: []string{"ssh-users", "vpn", "alice"}}, []string{"alice"}, nil, "missing required principals (ssh-users, vpn)"},
+		{"expand", Pipeline{Expand: []Expansion{
+			{Principal: "team-dba", Principals: []string{"postgres", "mysql"}},
+			{Principal: "team-web", Principals: []string{"nginx", "mysql"}},
+		}}, []string{"team-dba", "alice", "team-web"}, []string{"postgres", "mysql", "alice", "nginx"}, ""},
+		{"allow", Pipeline{Allow: []string{"[a-z]+", "deploy-[0-9]+"}}, []string{"alice", "Bob", "deploy-1", "deploy-x", "alice2"}, []string{"alice", "deploy-1"}, ""},
+		{"deny", Pipeline{Deny: []string{"root", "adm.*"}}, []string{"root", "rooty", "admin", "alice"}, []string{"rooty", "alice"}, ""},
+		{"deny after expansion", Pipeline{
+			Expand: []Expansion{{Principal: "team-sys", Principals: []string{"root", "sys"}}},
+			Deny:   []string{"root"},
+		}, []string{"team-sys"}, []string{"sys"}, ""},
+		{"max principals", Pipeline{MaxPrincipals: 2}, []string{"a", "b", "a"}, []string{"a", "b"}, ""},
+		{"too many principals", Pipeline{MaxPrincipals: 2}, []string{"a", "b", "c"}, nil, "too many principals (3), maximum is 2"},
+	}
+
+	for _, c := range cases {
+		if !assert.NoError(t, c.pipeline.Compile(), c.description) {
+			continue
+		}
+		principals, err := c.pipeline.Apply(c.principals)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.description)
+			continue
+		}
+		assert.NoError(t, err, c.description)
+		assert.Equal(t, c.expected, principals, c.description)
+	}
+
+	var pipeline *Pipeline
+	principals, err := pipeline.Apply([]string{"a", "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "a"}, principals)
+}
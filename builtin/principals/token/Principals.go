@@ -0,0 +1,29 @@
+package token
+
+import (
+	"context"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/principals"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/spf13/viper"
+)
+
+// Principals struct represents token options.
+type Principals struct{}
+
+// Init method is used to ingest config of Principals
+func (p *Principals) Init(config *viper.Viper) error {
+	return nil
+}
+
+// Get method returns the principals of the API token used to log in.
+func (p Principals) Get(ctx context.Context, req *request.SignRequest) (context.Context, []string, error) {
+
+	identity, ok := authenticator.IdentityFromContext(ctx)
+	if !ok || identity.Source != "token" || len(identity.Principals) == 0 {
+		return ctx, []string{}, principals.NewNotFoundError("token", "no principals for user")
+	}
+
+	return ctx, identity.Principals, nil
+}
@@ -0,0 +1,43 @@
+package token
+
+import (
+	"context"
+	"testing"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/principals"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrincipals(t *testing.T) {
+	tokenIdentity := authenticator.NewIdentity("token", "ci", "token-ci")
+	tokenIdentity.Principals = []string{"deploy"}
+
+	cases := []struct {
+		identity *authenticator.Identity
+		expList  []string
+	}{
+		{nil, nil},
+		{authenticator.NewIdentity("token", "ci", "token-ci"), nil},
+		{&authenticator.Identity{Source: "ldap", Principals: []string{"deploy"}}, nil},
+		{tokenIdentity, []string{"deploy"}},
+	}
+
+	for _, c := range cases {
+		ctx := context.Background()
+		if c.identity != nil {
+			ctx = authenticator.WithIdentity(ctx, c.identity)
+		}
+
+		_, princs, err := (&Principals{}).Get(ctx, &request.SignRequest{User: "ci"})
+		if c.expList == nil {
+			var notFoundError *principals.NotFoundError
+			assert.ErrorAs(t, err, &notFoundError)
+			continue
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, c.expList, princs)
+	}
+}
@@ -0,0 +1,112 @@
+// Package request holds the sign request passed to Authenticator, Principals and Signer backends.
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SignRequest represents a request to sign an SSH public key, parsed and validated once by
+// the API before being passed to backends
+type SignRequest struct {
+	User      string `json:"user"`
+	Password  string `json:"password,omitempty"`
+	Otp       string `json:"otp,omitempty"`
+	PublicKey string `json:"public_key"`
+
+	// Server nonce signed by a registered SSH key, used by sshkey Authenticator
+	Nonce     string `json:"nonce,omitempty"`
+	Signature string `json:"signature,omitempty"`
+
+	// Proof of possession of the private key matching PublicKey
+	ProofNonce     string `json:"proof_nonce,omitempty"`
+	ProofSignature string `json:"proof_signature,omitempty"`
+
+	// TTL is the requested certificate validity in seconds, it can only shorten Signer TTL
+	TTL int64 `json:"ttl,omitempty"`
+	// Principals restricts certificate principals to this subset of user principals
+	Principals []string `json:"principals,omitempty"`
+
+	// Token is the API token sent in the Authorization header, set by the API
+	Token string `json:"-"`
+
+	// Client holds metadata of the HTTP request, set by the API
+	Client Client `json:"-"`
+
+	// Payload is the raw request body, passed to legacy backends
+	Payload []byte `json:"-"`
+}
+
+// Client represents metadata of the client HTTP request
+type Client struct {
+	Addr      string
+	UserAgent string
+	RequestID string
+	// Certificate is set when the client presented a TLS certificate
+	Certificate bool
+}
+
+// Parse decodes and validates a JSON sign request
+func Parse(payload []byte) (*SignRequest, error) {
+	req, err := Decode(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// Decode decodes a JSON sign request without validating it
+func Decode(payload []byte) (*SignRequest, error) {
+	var req SignRequest
+	err := json.Unmarshal(payload, &req)
+	if err != nil {
+		return nil, fmt.Errorf("JSON unmarshaling failed: %w", err)
+	}
+	req.Payload = payload
+
+	return &req, nil
+}
+
+// Validate fields of sign request, credentials are checked by Authenticator
+func (r *SignRequest) Validate() error {
+	// user of API tokens and client certificates is known by Authenticator
+	if r.User == "" && r.Token == "" && !r.Client.Certificate {
+		return errors.New("empty user field")
+	}
+
+	if r.PublicKey == "" {
+		return errors.New("empty public_key field")
+	}
+	if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(r.PublicKey)); err != nil {
+		return fmt.Errorf("invalid public_key field: %w", err)
+	}
+
+	if r.TTL < 0 {
+		return errors.New("ttl field must be positive")
+	}
+
+	for _, principal := range r.Principals {
+		if principal == "" {
+			return errors.New("empty principal in principals field")
+		}
+	}
+
+	return nil
+}
+
+// JSON returns the JSON payload of sign request, Payload if set
+func (r *SignRequest) JSON() ([]byte, error) {
+	if r.Payload != nil {
+		return r.Payload, nil
+	}
+
+	return json.Marshal(r)
+}
@@ -0,0 +1,69 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDBiKBPRB6uhYGJl6Uc50HsHRddmij5ZRulLmf2AaOQS"
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		payload string
+		err     string
+	}{
+		{`{"user":"foo"`, "JSON unmarshaling failed: unexpected end of JSON input"},
+		{`{"user":42}`, "JSON unmarshaling failed: json: cannot unmarshal number into Go struct field SignRequest.user of type string"},
+		{`{"public_key":"` + testKey + `"}`, "empty user field"},
+		{`{"user":"foo"}`, "empty public_key field"},
+		{`{"user":"foo","public_key":"badkey"}`, "invalid public_key field: ssh: no key found"},
+		{`{"user":"foo","public_key":"` + testKey + `","ttl":-1}`, "ttl field must be positive"},
+		{`{"user":"foo","public_key":"` + testKey + `","principals":["root",""]}`, "empty principal in principals field"},
+		{`{"user":"foo","public_key":"` + testKey + `","ttl":60,"principals":["root"]}`, ""},
+	}
+
+	for _, c := range cases {
+		req, err := Parse([]byte(c.payload))
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.payload)
+			assert.Nil(t, req, c.payload)
+			continue
+		}
+
+		assert.NoError(t, err, c.payload)
+		assert.Equal(t, "foo", req.User)
+		assert.Equal(t, testKey, req.PublicKey)
+		assert.Equal(t, int64(60), req.TTL)
+		assert.Equal(t, []string{"root"}, req.Principals)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	payload := []byte(`{"user":"foo","password":"bar","public_key":"` + testKey + `","custom":"field"}`)
+	req, err := Decode(payload)
+	assert.NoError(t, err)
+
+	// raw payload is kept for legacy backends reading custom fields
+	out, err := req.JSON()
+	assert.NoError(t, err)
+	assert.Equal(t, payload, out)
+
+	req = &SignRequest{User: "foo", PublicKey: testKey, Client: Client{Addr: "127.0.0.1"}}
+	out, err = req.JSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"user":"foo","public_key":"`+testKey+`"}`, string(out))
+}
+
+func TestValidateToken(t *testing.T) {
+	// user of API tokens is known by Authenticator
+	req := &SignRequest{PublicKey: testKey, Token: "smk_abcd_secret"}
+	assert.NoError(t, req.Validate())
+
+	req.Token = ""
+	assert.EqualError(t, req.Validate(), "empty user field")
+
+	// nor is user of client certificates
+	req.Client.Certificate = true
+	assert.NoError(t, req.Validate())
+}
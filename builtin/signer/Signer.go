@@ -2,20 +2,95 @@ package signer
 
 import (
 	"context"
+	"time"
 
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
 	"github.com/spf13/viper"
 )
 
 // Signer is the interface that wrap the SMK SSH Signing operation.
 type Signer interface {
+	Init(config *viper.Viper) error
+	Sign(ctx context.Context, req *request.SignRequest, id string, principals []string) (cert string, err error)
+	ReadCA(ctx context.Context) (cert string, err error)
+}
+
+// LegacySigner is the interface of Signers reading the raw JSON payload of sign requests,
+// as before SignRequest was introduced
+type LegacySigner interface {
 	Init(config *viper.Viper) error
 	Sign(ctx context.Context, payload []byte, id string, principals []string) (cert string, err error)
 	ReadCA(ctx context.Context) (cert string, err error)
 }
 
+// FromLegacy returns a Signer calling a LegacySigner with the JSON payload of requests
+func FromLegacy(s LegacySigner) Signer {
+	return &legacySigner{legacy: s}
+}
+
+type legacySigner struct {
+	legacy LegacySigner
+}
+
+func (s *legacySigner) Init(config *viper.Viper) error {
+	return s.legacy.Init(config)
+}
+
+func (s *legacySigner) ReadCA(ctx context.Context) (string, error) {
+	return s.legacy.ReadCA(ctx)
+}
+
+func (s *legacySigner) Sign(ctx context.Context, req *request.SignRequest, id string, principals []string) (string, error) {
+	payload, err := req.JSON()
+	if err != nil {
+		return "", err
+	}
+
+	return s.legacy.Sign(ctx, payload, id, principals)
+}
+
 // CertReq represents certificate request
 type CertReq struct {
 	Key        string
 	ID         string
 	Principals []string
 }
+
+// OptionsKeyType represents a signing options context key type
+type OptionsKeyType string
+
+// OptionsKey represents the context key holding per request signing Options
+const OptionsKey OptionsKeyType = "signerOptions"
+
+// Options represents per request signing options, they are only supported by local Signer
+type Options struct {
+	// Extensions are added to extensions of Signer config
+	Extensions map[string]string
+	// ValidBefore caps certificate validity if not zero
+	ValidBefore time.Time
+}
+
+// Certificate extensions describing the initial authentication, they are kept across
+// certificate renewals.
+const (
+	// AuthTimeExtension holds the unix time of the initial authentication
+	AuthTimeExtension = "auth-time@signmykey.io"
+	// AuthSourceExtension holds the type of Authenticator of the initial authentication
+	AuthSourceExtension = "auth-source@signmykey.io"
+	// TokenIDExtension holds the ID of the API token of the initial authentication
+	TokenIDExtension = "token-id@signmykey.io"
+	// PrincipalsExpireExtension holds the unix time principals of certificate stop being
+	// valid, like temporarily granted principals. Such certificates aren't renewed.
+	PrincipalsExpireExtension = "principals-expire@signmykey.io"
+)
+
+// KeyID returns the certificate key ID, the ID of the authenticated Identity held by ctx if
+// any, id otherwise (ex: renewals)
+func KeyID(ctx context.Context, id string) string {
+	if identity, ok := authenticator.IdentityFromContext(ctx); ok && identity.ID != "" {
+		return identity.ID
+	}
+
+	return id
+}
@@ -4,14 +4,13 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/binary"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"time"
 
+	"github.com/signmykeyio/signmykey/builtin/request"
 	"github.com/signmykeyio/signmykey/builtin/signer"
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"golang.org/x/crypto/ssh"
 )
@@ -25,10 +24,6 @@ type Signer struct {
 	Extensions      map[string]string
 }
 
-type localSignReq struct {
-	PubKey string `json:"public_key" binding:"required"`
-}
-
 // Init method is used to ingest config of Signer
 func (s *Signer) Init(config *viper.Viper) error {
 	neededEntries := []string{
@@ -90,15 +85,9 @@ func (s Signer) ReadCA(ctx context.Context) (string, error) {
 }
 
 // Sign method is used to sign passed SSH Key.
-func (s Signer) Sign(ctx context.Context, payload []byte, id string, principals []string) (cert string, err error) {
-
-	var signReq localSignReq
-	err = json.Unmarshal(payload, &signReq)
-	if err != nil {
-		log.Errorf("json unmarshaling failed: %s", err)
-		return "", fmt.Errorf("JSON unmarshaling failed: %w", err)
-	}
+func (s Signer) Sign(ctx context.Context, req *request.SignRequest, id string, principals []string) (cert string, err error) {
 
+	id = signer.KeyID(ctx, id)
 	if id == "" {
 		return "", errors.New("empty id")
 	}
@@ -108,7 +97,7 @@ func (s Signer) Sign(ctx context.Context, payload []byte, id string, principals
 	}
 
 	certreq := signer.CertReq{
-		Key:        signReq.PubKey,
+		Key:        req.PublicKey,
 		ID:         id,
 		Principals: principals,
 	}
@@ -124,17 +113,39 @@ func (s Signer) Sign(ctx context.Context, payload []byte, id string, principals
 		return "", fmt.Errorf("failed to parse user public key: %w", err)
 	}
 
+	ttl := int64(s.TTL)
+	if req.TTL > 0 && req.TTL < ttl {
+		ttl = req.TTL
+	}
+	validBefore := time.Now().Add(time.Duration(ttl) * time.Second)
+	extensions := s.Extensions
+	if opts, ok := ctx.Value(signer.OptionsKey).(signer.Options); ok {
+		if !opts.ValidBefore.IsZero() && opts.ValidBefore.Before(validBefore) {
+			validBefore = opts.ValidBefore
+		}
+
+		if len(opts.Extensions) > 0 {
+			extensions = make(map[string]string, len(s.Extensions)+len(opts.Extensions))
+			for k, v := range s.Extensions {
+				extensions[k] = v
+			}
+			for k, v := range opts.Extensions {
+				extensions[k] = v
+			}
+		}
+	}
+
 	certificate := ssh.Certificate{
 		Serial:          serial,
 		Key:             pubKey,
 		KeyId:           certreq.ID,
 		ValidPrincipals: certreq.Principals,
 		ValidAfter:      uint64(time.Now().Unix() - 60),
-		ValidBefore:     uint64(time.Now().Unix() + int64(s.TTL)),
+		ValidBefore:     uint64(validBefore.Unix()),
 		CertType:        ssh.UserCert,
 		Permissions: ssh.Permissions{
 			CriticalOptions: s.CriticalOptions,
-			Extensions:      s.Extensions,
+			Extensions:      extensions,
 		},
 	}
 
@@ -2,10 +2,13 @@ package local
 
 import (
 	"context"
-	"fmt"
 	"sort"
 	"testing"
+	"time"
 
+	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	"github.com/signmykeyio/signmykey/builtin/request"
+	"github.com/signmykeyio/signmykey/builtin/signer"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/ssh"
 )
@@ -62,21 +65,21 @@ i9Jm7L090D/cW6+hyuIzXBEyp+u1FXzaaEEMw9dsFyp9URYd1b03
 
 	cases := []struct {
 		description string
-		payload     []byte
+		req         *request.SignRequest
 		id          string
 		principals  []string
 		expErr      bool
 	}{
-		{"test with an invalid key", []byte("{\"public_key\": \"invalid key\"}"), "test", []string{"root", "admin"}, true},
-		{"test with valid key and principals", []byte(fmt.Sprintf("{\"public_key\": \"%s\"}", testKey)), "testid", []string{"admin", "root"}, false},
-		{"test with valid key and reversed principals", []byte(fmt.Sprintf("{\"public_key\": \"%s\"}", testKey)), "testid", []string{"root", "admin"}, false},
-		{"test with an empty key", []byte(""), "testid", []string{"root", "admin"}, true},
-		{"test with an empty id", []byte(fmt.Sprintf("{\"public_key\": \"%s\"}", testKey)), "", []string{"root", "admin"}, true},
-		{"test with no principals", []byte(fmt.Sprintf("{\"public_key\": \"%s\"}", testKey)), "testid", []string{}, true},
+		{"test with an invalid key", &request.SignRequest{PublicKey: "invalid key"}, "test", []string{"root", "admin"}, true},
+		{"test with valid key and principals", &request.SignRequest{PublicKey: testKey}, "testid", []string{"admin", "root"}, false},
+		{"test with valid key and reversed principals", &request.SignRequest{PublicKey: testKey}, "testid", []string{"root", "admin"}, false},
+		{"test with an empty key", &request.SignRequest{}, "testid", []string{"root", "admin"}, true},
+		{"test with an empty id", &request.SignRequest{PublicKey: testKey}, "", []string{"root", "admin"}, true},
+		{"test with no principals", &request.SignRequest{PublicKey: testKey}, "testid", []string{}, true},
 	}
 
 	for _, c := range cases {
-		cert, err := s.Sign(context.Background(), c.payload, c.id, c.principals)
+		cert, err := s.Sign(context.Background(), c.req, c.id, c.principals)
 		if c.expErr {
 			assert.Error(t, err, c.description)
 		} else {
@@ -96,4 +99,28 @@ i9Jm7L090D/cW6+hyuIzXBEyp+u1FXzaaEEMw9dsFyp9URYd1b03
 		assert.Equal(t, c.id, sshCert.KeyId, c.description)
 		assert.Equal(t, c.principals, sshCert.ValidPrincipals, c.description)
 	}
+
+	// per request options override config
+	validBefore := time.Now().Add(time.Minute).Truncate(time.Second)
+	ctx := context.WithValue(context.Background(), signer.OptionsKey, signer.Options{
+		Extensions:  map[string]string{signer.AuthTimeExtension: "1234"},
+		ValidBefore: validBefore,
+	})
+	s.Extensions = map[string]string{"permit-pty": ""}
+	cert, err := s.Sign(ctx, &request.SignRequest{PublicKey: testKey}, "testid", []string{"root"})
+	assert.NoError(t, err)
+
+	parsedCert, _, _, _, _ := ssh.ParseAuthorizedKey([]byte(cert))
+	sshCert := parsedCert.(*ssh.Certificate)
+	assert.Equal(t, uint64(validBefore.Unix()), sshCert.ValidBefore)
+	assert.Equal(t, map[string]string{"permit-pty": "", signer.AuthTimeExtension: "1234"}, sshCert.Extensions)
+	assert.Equal(t, map[string]string{"permit-pty": ""}, s.Extensions)
+
+	// key ID is read from authenticated identity
+	ctx = authenticator.WithIdentity(context.Background(), authenticator.NewIdentity("ldap", "foo", "ldap-foo"))
+	cert, err = s.Sign(ctx, &request.SignRequest{PublicKey: testKey}, "", []string{"root"})
+	assert.NoError(t, err)
+
+	parsedCert, _, _, _, _ = ssh.ParseAuthorizedKey([]byte(cert))
+	assert.Equal(t, "ldap-foo", parsedCert.(*ssh.Certificate).KeyId)
 }
@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/signmykeyio/signmykey/builtin/request"
 	"github.com/signmykeyio/signmykey/builtin/signer"
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
@@ -27,10 +29,6 @@ type Signer struct {
 	fullAddr string
 }
 
-type vaultSignReq struct {
-	PubKey string `json:"public_key" binding:"required"`
-}
-
 // Init method is used to ingest config of Signer
 func (v *Signer) Init(config *viper.Viper) error {
 	neededEntries := []string{
@@ -123,14 +121,7 @@ func (v Signer) ReadCA(ctx context.Context) (string, error) {
 }
 
 // Sign method is used to sign passed SSH Key.
-func (v Signer) Sign(ctx context.Context, payload []byte, id string, principals []string) (cert string, err error) {
-
-	var signReq vaultSignReq
-	err = json.Unmarshal(payload, &signReq)
-	if err != nil {
-		log.Errorf("json unmarshaling failed: %s", err)
-		return "", fmt.Errorf("JSON unmarshaling failed: %w", err)
-	}
+func (v Signer) Sign(ctx context.Context, signReq *request.SignRequest, id string, principals []string) (cert string, err error) {
 
 	token, err := v.getToken(ctx)
 	if err != nil {
@@ -138,15 +129,15 @@ func (v Signer) Sign(ctx context.Context, payload []byte, id string, principals
 	}
 
 	certreq := signer.CertReq{
-		Key:        signReq.PubKey,
-		ID:         id,
+		Key:        signReq.PublicKey,
+		ID:         signer.KeyID(ctx, id),
 		Principals: principals,
 	}
 	data, err := json.Marshal(map[string]string{
 		"key_id":           certreq.ID,
 		"public_key":       certreq.Key,
 		"valid_principals": strings.Join(certreq.Principals, ","),
-		"ttl":              v.SignTTL,
+		"ttl":              v.signTTL(signReq.TTL),
 	})
 	if err != nil {
 		return "", fmt.Errorf("marshaling of sign request payload failed: %w", err)
@@ -250,3 +241,24 @@ func (v Signer) getToken(ctx context.Context) (string, error) {
 
 	return token, nil
 }
+
+// signTTL returns the TTL of certificate, requested TTL if it is shorter than SignTTL
+func (v Signer) signTTL(requested int64) string {
+	if requested <= 0 {
+		return v.SignTTL
+	}
+
+	configured, err := time.ParseDuration(v.SignTTL)
+	if err != nil {
+		seconds, err := strconv.ParseInt(v.SignTTL, 10, 64)
+		if err != nil {
+			return v.SignTTL
+		}
+		configured = time.Duration(seconds) * time.Second
+	}
+	if time.Duration(requested)*time.Second >= configured {
+		return v.SignTTL
+	}
+
+	return fmt.Sprintf("%ds", requested)
+}
@@ -2,10 +2,10 @@ package vault
 
 import (
 	"context"
-	"fmt"
 	"sort"
 	"testing"
 
+	"github.com/signmykeyio/signmykey/builtin/request"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/ssh"
 )
@@ -27,21 +27,21 @@ func TestSigner(t *testing.T) {
 	testKey := "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQDCScycMJgKYj7IsyrPYsCVryhz4//mjekvElmihYLc/njL1cC9KBTRhdbV1NYw9RFC/CENAwrHcGXAcgMuY0fFUQOyKDa6HmVIxT8vszcePAutl6YvcFYuTCJRYjOQXWBmYEe1NJI8yfR+CMU8HdfXbXUhU93UxpNX8rzXGv3KSSky6v1BAkzTl5QiQRdjn18Wf8z3e1sMbxjfD+ygas9rpmbUONsUc6d5U6YYTroJA/DoRIG92IBK9GjH1w/l9Wvcs2V5atCorKwasdCsEFO5Jv84XO41smo/IF+gd0hUtKDDGkk/djk3TmC9h2WUBb43lxiv0wn2ByTIMAorCqFb" // nolint: lll
 
 	cases := []struct {
-		payload    []byte
+		req        *request.SignRequest
 		id         string
 		principals []string
 		expErr     bool
 	}{
-		{[]byte("{\"public_key\": \"invalid key\"}"), "test", []string{"root", "admin"}, true},
-		{[]byte(fmt.Sprintf("{\"public_key\": \"%s\"}", testKey)), "testid", []string{"admin", "root"}, false},
-		{[]byte(fmt.Sprintf("{\"public_key\": \"%s\"}", testKey)), "testid", []string{"root", "admin"}, false},
-		{[]byte(""), "testid", []string{"root", "admin"}, true},
-		{[]byte(fmt.Sprintf("{\"public_key\": \"%s\"}", testKey)), "", []string{"root", "admin"}, true},
-		{[]byte(fmt.Sprintf("{\"public_key\": \"%s\"}", testKey)), "testid", []string{}, true},
+		{&request.SignRequest{PublicKey: "invalid key"}, "test", []string{"root", "admin"}, true},
+		{&request.SignRequest{PublicKey: testKey}, "testid", []string{"admin", "root"}, false},
+		{&request.SignRequest{PublicKey: testKey}, "testid", []string{"root", "admin"}, false},
+		{&request.SignRequest{}, "testid", []string{"root", "admin"}, true},
+		{&request.SignRequest{PublicKey: testKey}, "", []string{"root", "admin"}, true},
+		{&request.SignRequest{PublicKey: testKey}, "testid", []string{}, true},
 	}
 
 	for _, c := range cases {
-		cert, err := vs.Sign(context.Background(), c.payload, c.id, c.principals)
+		cert, err := vs.Sign(context.Background(), c.req, c.id, c.principals)
 		if c.expErr {
 			assert.Error(t, err)
 		} else {
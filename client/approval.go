@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dghubble/sling"
+)
+
+// requestSecretHeader is the HTTP header holding the secret of a sign request when reading it
+const requestSecretHeader = "X-Signmykey-Request-Secret"
+
+// PendingError is returned when a sign request waits for the approval of other users
+type PendingError struct {
+	RequestID string
+	// Secret is needed to read the request and its certificate
+	Secret  string
+	Expires time.Time
+}
+
+func (e *PendingError) Error() string {
+	return fmt.Sprintf("sign request %s waiting for approval until %s", e.RequestID, e.Expires.Format(time.RFC3339))
+}
+
+// ApprovalDecision represents the approval or denial of a request by an approver
+type ApprovalDecision struct {
+	Approver string    `json:"approver"`
+	Time     time.Time `json:"time"`
+	Comment  string    `json:"comment"`
+}
+
+// ApprovalRequest represents a sign request waiting for approval
+type ApprovalRequest struct {
+	ID             string             `json:"id"`
+	Status         string             `json:"status"`
+	Error          string             `json:"error"`
+	User           string             `json:"user"`
+	Username       string             `json:"username"`
+	Principals     []string           `json:"principals"`
+	PublicKey      string             `json:"public_key"`
+	TTL            int64              `json:"ttl"`
+	Required       int                `json:"required_approvals"`
+	ApproverGroups []string           `json:"approver_groups"`
+	Approvals      []ApprovalDecision `json:"approvals"`
+	Denial         *ApprovalDecision  `json:"denial"`
+	Created        time.Time          `json:"created"`
+	Expires        time.Time          `json:"expires"`
+	Certificate    string             `json:"certificate"`
+}
+
+// DecisionRequest represents the payload sent to SMK server to approve or deny a request,
+// approver credentials are the same as sign requests ones
+type DecisionRequest struct {
+	SignRequest
+	Comment string `json:"comment,omitempty"`
+}
+
+// GetApprovalRequest reads approval request id, and its certificate once approved, from SMK
+// server with the secret given to the requester.
+func GetApprovalRequest(httpClient *http.Client, addr, id, secret string) (*ApprovalRequest, error) {
+	approvalReq := &ApprovalRequest{}
+	approvalErr := &signError{}
+	res, err := sling.New().Client(httpClient).Get(addr).Path("v1/requests/"+url.PathEscape(id)).Set(requestSecretHeader, secret).Receive(approvalReq, approvalErr)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != 200 {
+		return nil, errors.New(approvalErr.Error)
+	}
+
+	return approvalReq, nil
+}
+
+// ShowApprovalRequest reads approval request id, without its certificate, from SMK server
+// with approver credentials.
+func ShowApprovalRequest(httpClient *http.Client, addr, id string, body *SignRequest) (*ApprovalRequest, error) {
+	approvalReq := &ApprovalRequest{}
+	approvalErr := &signError{}
+	req := sling.New().Client(httpClient).Post(addr).Path("v1/requests/" + url.PathEscape(id) + "/show")
+	if body.Token != "" {
+		req = req.Set("Authorization", "Bearer "+body.Token)
+	}
+	res, err := req.BodyJSON(body).Receive(approvalReq, approvalErr)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != 200 {
+		return nil, errors.New(approvalErr.Error)
+	}
+
+	return approvalReq, nil
+}
+
+// WaitApproval polls approval request id every interval until it is decided, and returns the
+// certificate of approved request.
+func WaitApproval(ctx context.Context, httpClient *http.Client, addr, id, secret string, interval time.Duration) (string, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		approvalReq, err := GetApprovalRequest(httpClient, addr, id, secret)
+		if err != nil {
+			return "", err
+		}
+
+		switch approvalReq.Status {
+		case "approved":
+			if approvalReq.Certificate != "" {
+				return approvalReq.Certificate, nil
+			}
+		case "denied":
+			if approvalReq.Denial == nil {
+				return "", errors.New("sign request denied")
+			}
+			if approvalReq.Denial.Comment == "" {
+				return "", fmt.Errorf("sign request denied by %s", approvalReq.Denial.Approver)
+			}
+			return "", fmt.Errorf("sign request denied by %s: %s", approvalReq.Denial.Approver, approvalReq.Denial.Comment)
+		case "expired":
+			return "", errors.New("sign request expired before approval")
+		case "failed":
+			return "", fmt.Errorf("sign request approved but signing failed: %s", approvalReq.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDecision approves, or denies, approval request id with approver credentials.
+func SendDecision(httpClient *http.Client, addr, id string, approve bool, body *DecisionRequest) (*ApprovalRequest, error) {
+	path := "v1/requests/" + url.PathEscape(id) + "/deny"
+	if approve {
+		path = "v1/requests/" + url.PathEscape(id) + "/approve"
+	}
+
+	approvalReq := &ApprovalRequest{}
+	approvalErr := &signError{}
+	req := sling.New().Client(httpClient).Post(addr).Path(path)
+	if body.Token != "" {
+		req = req.Set("Authorization", "Bearer "+body.Token)
+	}
+	res, err := req.BodyJSON(body).Receive(approvalReq, approvalErr)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != 200 {
+		return nil, errors.New(approvalErr.Error)
+	}
+
+	return approvalReq, nil
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dghubble/sling"
+)
+
+// Grant represents principals temporarily granted to a user
+type Grant struct {
+	ID         string    `json:"id"`
+	User       string    `json:"user"`
+	Principals []string  `json:"principals"`
+	Reason     string    `json:"reason"`
+	Granter    string    `json:"granter"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+}
+
+// GrantSpec represents the grant to create
+type GrantSpec struct {
+	User       string   `json:"user"`
+	Principals []string `json:"principals"`
+	Duration   string   `json:"duration"`
+	Reason     string   `json:"reason"`
+}
+
+// GrantRequest represents the payload sent to SMK server to manage grants, admin credentials
+// are the same as sign requests ones
+type GrantRequest struct {
+	SignRequest
+	Grant *GrantSpec `json:"grant,omitempty"`
+}
+
+type grantsResponse struct {
+	Grants []Grant `json:"grants"`
+}
+
+// CreateGrant grants principals of spec to a user with admin credentials.
+func CreateGrant(httpClient *http.Client, addr string, credentials SignRequest, spec GrantSpec) (*Grant, error) {
+	grant := &Grant{}
+	if err := sendGrantRequest(httpClient, addr, "v1/grants", &GrantRequest{SignRequest: credentials, Grant: &spec}, grant); err != nil {
+		return nil, err
+	}
+
+	return grant, nil
+}
+
+// ListGrants returns active grants with admin credentials.
+func ListGrants(httpClient *http.Client, addr string, credentials SignRequest) ([]Grant, error) {
+	res := &grantsResponse{}
+	if err := sendGrantRequest(httpClient, addr, "v1/grants/list", &GrantRequest{SignRequest: credentials}, res); err != nil {
+		return nil, err
+	}
+
+	return res.Grants, nil
+}
+
+// RevokeGrant revokes grant id with admin credentials.
+func RevokeGrant(httpClient *http.Client, addr string, credentials SignRequest, id string) (*Grant, error) {
+	grant := &Grant{}
+	if err := sendGrantRequest(httpClient, addr, "v1/grants/"+url.PathEscape(id)+"/revoke", &GrantRequest{SignRequest: credentials}, grant); err != nil {
+		return nil, err
+	}
+
+	return grant, nil
+}
+
+func sendGrantRequest(httpClient *http.Client, addr, path string, body *GrantRequest, success interface{}) error {
+	grantErr := &signError{}
+	req := sling.New().Client(httpClient).Post(addr).Path(path)
+	if body.Token != "" {
+		req = req.Set("Authorization", "Bearer "+body.Token)
+	}
+	res, err := req.BodyJSON(body).Receive(success, grantErr)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != 200 && res.StatusCode != 201 {
+		return errors.New(grantErr.Error)
+	}
+
+	return nil
+}
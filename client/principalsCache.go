@@ -0,0 +1,45 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dghubble/sling"
+)
+
+// PurgeSpec represents the cached principals to purge
+type PurgeSpec struct {
+	User string `json:"user"`
+}
+
+// PurgeRequest represents the payload sent to SMK server to purge cached principals, admin
+// credentials are the same as sign requests ones
+type PurgeRequest struct {
+	SignRequest
+	Purge PurgeSpec `json:"purge"`
+}
+
+type purgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+// PurgePrincipalsCache purges cached principals of user, its ID or user name, with admin
+// credentials. It returns the number of cache entries removed.
+func PurgePrincipalsCache(httpClient *http.Client, addr string, credentials SignRequest, user string) (int, error) {
+	res := &purgeResponse{}
+	purgeErr := &signError{}
+	req := sling.New().Client(httpClient).Post(addr).Path("v1/principals/cache/purge")
+	if credentials.Token != "" {
+		req = req.Set("Authorization", "Bearer "+credentials.Token)
+	}
+	httpRes, err := req.BodyJSON(&PurgeRequest{SignRequest: credentials, Purge: PurgeSpec{User: user}}).Receive(res, purgeErr)
+	if err != nil {
+		return 0, err
+	}
+
+	if httpRes.StatusCode != 200 {
+		return 0, errors.New(purgeErr.Error)
+	}
+
+	return res.Purged, nil
+}
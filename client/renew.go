@@ -0,0 +1,169 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/dghubble/sling"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/signmykeyio/signmykey/util"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+type nonceResponse struct {
+	Nonce string `json:"nonce"`
+}
+
+type renewRequest struct {
+	Certificate string `json:"certificate"`
+	Nonce       string `json:"nonce"`
+	Signature   string `json:"signature"`
+}
+
+// GetNonce returns a new nonce from SMK server.
+func GetNonce(httpClient *http.Client, addr string) (string, error) {
+	nonceRes := &nonceResponse{}
+	nonceErr := &signError{}
+	res, err := sling.New().Client(httpClient).Get(addr).Path("v1/nonce").Receive(nonceRes, nonceErr)
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode != 200 {
+		return "", fmt.Errorf("error getting nonce: %s", res.Status)
+	}
+
+	return nonceRes.Nonce, nil
+}
+
+// Renew is used to get a fresh certificate for the public key path using its still valid
+// certificate. Private key proves possession of the certificate by signing a server nonce.
+func Renew(httpClient *http.Client, addr, pubKeyFile string, signer ssh.Signer) (certificate string, err error) {
+	certPath, err := homedir.Expand(strings.Replace(pubKeyFile, ".pub", "-cert.pub", 1))
+	if err != nil {
+		return "", err
+	}
+
+	cert, err := os.ReadFile(certPath) // nolint: gosec
+	if err != nil {
+		return "", err
+	}
+
+	nonce, signature, err := SignNonce(httpClient, addr, signer, util.RenewNamespace)
+	if err != nil {
+		return "", err
+	}
+
+	body := &renewRequest{
+		Certificate: strings.TrimSpace(string(cert)),
+		Nonce:       nonce,
+		Signature:   signature,
+	}
+
+	signRes := &signResponse{}
+	signErr := &signError{}
+	res, err := sling.New().Client(httpClient).Post(addr).Path("v1/renew").BodyJSON(body).Receive(signRes, signErr)
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode != 200 {
+		return "", errors.New(signErr.Error)
+	}
+
+	return signRes.Certificate, nil
+}
+
+// SignNonce gets a new nonce from SMK server and signs it with signer in given namespace.
+func SignNonce(httpClient *http.Client, addr string, signer ssh.Signer, namespace string) (nonce, signature string, err error) {
+	nonce, err = GetNonce(httpClient, addr)
+	if err != nil {
+		return "", "", err
+	}
+
+	sig, err := util.SSHSign(signer, namespace, []byte(nonce))
+	if err != nil {
+		return "", "", err
+	}
+
+	return nonce, string(sig), nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// LoadSigner returns a signer for the private key matching the public key path. The key is
+// searched in ssh-agent first then in private key file (public key path without .pub suffix).
+// passphrase is called if private key file is encrypted. closer must be closed once signer
+// isn't used anymore, it releases the ssh-agent connection.
+func LoadSigner(pubKeyFile string, passphrase func() ([]byte, error)) (signer ssh.Signer, closer io.Closer, err error) {
+	pubKeyStr, err := GetUserPubKey(pubKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pubKeyStr))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing public key: %w", err)
+	}
+
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		conn, err := net.Dial("unix", socket)
+		if err == nil {
+			signers, err := agent.NewClient(conn).Signers()
+			if err == nil {
+				for _, signer := range signers {
+					if string(signer.PublicKey().Marshal()) == string(pubKey.Marshal()) {
+						return signer, conn, nil
+					}
+				}
+			}
+			conn.Close() // nolint:errcheck
+		}
+	}
+
+	signer, err = loadFileSigner(pubKeyFile, pubKey, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return signer, nopCloser{}, nil
+}
+
+// loadFileSigner returns a signer for the private key file matching pubKey
+func loadFileSigner(pubKeyFile string, pubKey ssh.PublicKey, passphrase func() ([]byte, error)) (ssh.Signer, error) {
+	privKeyPath, err := homedir.Expand(strings.TrimSuffix(pubKeyFile, ".pub"))
+	if err != nil {
+		return nil, err
+	}
+	privKey, err := os.ReadFile(privKeyPath) // nolint: gosec
+	if err != nil {
+		return nil, fmt.Errorf("private key not found in ssh-agent nor in %s: %w", privKeyPath, err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(privKey)
+	var missingPassphrase *ssh.PassphraseMissingError
+	if errors.As(err, &missingPassphrase) && passphrase != nil {
+		var pass []byte
+		pass, err = passphrase()
+		if err != nil {
+			return nil, err
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(privKey, pass)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key %s: %w", privKeyPath, err)
+	}
+
+	if string(signer.PublicKey().Marshal()) != string(pubKey.Marshal()) {
+		return nil, fmt.Errorf("private key %s doesn't match public key %s", privKeyPath, pubKeyFile)
+	}
+
+	return signer, nil
+}
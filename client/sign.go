@@ -2,48 +2,79 @@ package client
 
 import (
 	"errors"
+	"net/http"
+	"time"
 
 	"github.com/dghubble/sling"
 )
 
-type signLDAPRequest struct {
+// SignRequest represents the payload sent to SMK server to sign a key.
+type SignRequest struct {
 	User      string `json:"user"`
 	Password  string `json:"password"`
 	PublicKey string `json:"public_key"`
 	Otp       string `json:"otp"`
+	Nonce     string `json:"nonce,omitempty"`
+	Signature string `json:"signature,omitempty"`
+
+	ProofNonce     string `json:"proof_nonce,omitempty"`
+	ProofSignature string `json:"proof_signature,omitempty"`
+
+	TTL        int64    `json:"ttl,omitempty"`
+	Principals []string `json:"principals,omitempty"`
+
+	// Token is an API token sent in the Authorization header instead of a password
+	Token string `json:"-"`
 }
 
-type signLDAPResponse struct {
+type signResponse struct {
 	Certificate string `json:"certificate"`
+
+	// fields of sign requests waiting for approval
+	RequestID     string    `json:"request_id"`
+	RequestSecret string    `json:"request_secret"`
+	Expires       time.Time `json:"expires"`
 }
 
-type signLDAPError struct {
+type signError struct {
 	Error string `json:"error"`
 }
 
 // Sign is used to sign an SSH key with user/password combination.
 func Sign(addr, user, password, pubKey, otp string) (certificate string, err error) {
-
-	body := &signLDAPRequest{
+	return SendSignRequest(nil, addr, &SignRequest{
 		User:      user,
 		Password:  password,
 		PublicKey: pubKey,
 		Otp:       otp,
-	}
-
-	signResponse := &signLDAPResponse{}
-	signError := &signLDAPError{}
+	})
+}
 
-	res, err := sling.New().Post(addr).Path("v1/sign").BodyJSON(body).Receive(signResponse, signError)
+// SendSignRequest sends a sign request to SMK server with given HTTP client (or default one if nil).
+// A *PendingError is returned when the request waits for approval.
+func SendSignRequest(httpClient *http.Client, addr string, body *SignRequest) (certificate string, err error) {
+	signRes := &signResponse{}
+	signErr := &signError{}
+	req := sling.New().Client(httpClient).Post(addr).Path("v1/sign")
+	if body.Token != "" {
+		req = req.Set("Authorization", "Bearer "+body.Token)
+	}
+	res, err := req.BodyJSON(body).Receive(signRes, signErr)
 	if err != nil {
 		return certificate, err
 	}
 
+	if res.StatusCode == 202 {
+		err = &PendingError{RequestID: signRes.RequestID, Secret: signRes.RequestSecret, Expires: signRes.Expires}
+		return certificate, err
+	}
+
 	if res.StatusCode != 200 {
-		err = errors.New(signError.Error)
+		err = errors.New(signErr.Error)
 		return certificate, err
 	}
 
-	certificate = signResponse.Certificate
+	certificate = signRes.Certificate
+
 	return certificate, err
 }
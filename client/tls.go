@@ -0,0 +1,60 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// NewHTTPClient returns an HTTP client presenting the given client certificate and trusting the
+// given CA. Empty paths keep the default behaviour.
+func NewHTTPClient(certFile, keyFile, caFile string) (*http.Client, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("both TLS client certificate and key must be set")
+		}
+
+		certPath, err := homedir.Expand(certFile)
+		if err != nil {
+			return nil, err
+		}
+		keyPath, err := homedir.Expand(keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("error loading TLS client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		caPath, err := homedir.Expand(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		caPEM, err := os.ReadFile(caPath) // nolint: gosec
+		if err != nil {
+			return nil, fmt.Errorf("error reading TLS CA file: %w", err)
+		}
+
+		tlsCfg.RootCAs = x509.NewCertPool()
+		if !tlsCfg.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no valid certificate found in TLS CA file %s", caFile)
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+
+	return &http.Client{Transport: transport}, nil
+}
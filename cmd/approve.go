@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/signmykeyio/signmykey/client"
+	"github.com/spf13/cobra"
+)
+
+var (
+	approveCfgFile string
+	approveDeny    bool
+	approveShow    bool
+	approveComment string
+)
+
+var approveCmd = &cobra.Command{
+	Use:   "approve ID",
+	Short: "Approve, or deny, a sign request waiting for approval",
+	Args:  cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadCredentialsConfig(cmd, approveCfgFile)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		httpClient, smkAddr, err := serverClient()
+		if err != nil {
+			return err
+		}
+
+		// each command logs in once, OTP codes can't be replayed
+		credentials, err := userCredentials()
+		if err != nil {
+			return err
+		}
+
+		if approveShow {
+			approvalReq, err := client.ShowApprovalRequest(httpClient, smkAddr, args[0], &credentials)
+			if err != nil {
+				return err
+			}
+			printApprovalRequest(approvalReq)
+			return nil
+		}
+
+		approvalReq, err := client.SendDecision(httpClient, smkAddr, args[0], !approveDeny, &client.DecisionRequest{
+			SignRequest: credentials,
+			Comment:     approveComment,
+		})
+		if err != nil {
+			return err
+		}
+		printApprovalRequest(approvalReq)
+
+		switch approvalReq.Status {
+		case "pending":
+			color.Green("\nApproval recorded, %d more needed", approvalReq.Required-len(approvalReq.Approvals))
+		case "approved":
+			color.Green("\nSign request approved")
+		case "denied":
+			color.Green("\nSign request denied")
+		default:
+			color.HiYellow("\nSign request %s: %s", approvalReq.Status, approvalReq.Error)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	addCredentialsFlags(approveCmd, &approveCfgFile)
+	approveCmd.Flags().BoolVar(&approveDeny, "deny", false, "Deny sign request instead of approving it")
+	approveCmd.Flags().StringVar(&approveComment, "comment", "", "Comment recorded with decision")
+	approveCmd.Flags().BoolVar(&approveShow, "show", false, "Show sign request without deciding on it")
+
+	rootCmd.AddCommand(approveCmd)
+}
+
+func printApprovalRequest(approvalReq *client.ApprovalRequest) {
+	color.HiBlack("Sign request %s:\n", approvalReq.ID)
+	color.HiBlack("  - User: %s", approvalReq.User)
+	color.HiBlack("  - Principals: %s", strings.Join(approvalReq.Principals, ","))
+	color.HiBlack("  - Status: %s (%d/%d approvals)", approvalReq.Status, len(approvalReq.Approvals), approvalReq.Required)
+	color.HiBlack("  - Expires: %s", approvalReq.Expires.Local().Format(time.RFC3339))
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"github.com/fatih/color"
+	"github.com/signmykeyio/signmykey/client"
+	"github.com/spf13/cobra"
+)
+
+var cacheCfgFile string
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage principals cache of server, restricted to principals cache admins",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadCredentialsConfig(cmd, cacheCfgFile)
+	},
+}
+
+var cachePurgeCmd = &cobra.Command{
+	Use:   "purge USER",
+	Short: "Purge cached principals of a user, by ID or user name",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		httpClient, smkAddr, err := serverClient()
+		if err != nil {
+			return err
+		}
+		credentials, err := userCredentials()
+		if err != nil {
+			return err
+		}
+
+		purged, err := client.PurgePrincipalsCache(httpClient, smkAddr, credentials, args[0])
+		if err != nil {
+			return err
+		}
+
+		color.Green("\n%d cached principals entries of %s purged", purged, args[0])
+
+		return nil
+	},
+}
+
+func init() {
+	addCredentialsFlags(cacheCmd, &cacheCfgFile)
+
+	cacheCmd.AddCommand(cachePurgeCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
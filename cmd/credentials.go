@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/signmykeyio/signmykey/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// credentialsFlags maps config keys shared with root command to flags of admin commands
+var credentialsFlags = map[string]string{
+	"addr": "addr", "user": "user", "password": "password", "otp": "otp",
+	"tlsCert": "tls-cert", "tlsKey": "tls-key", "tlsCA": "tls-ca",
+}
+
+// addCredentialsFlags adds server address and user credentials flags to cmd and its subcommands
+func addCredentialsFlags(cmd *cobra.Command, cfgFile *string) {
+	cmd.PersistentFlags().StringVarP(cfgFile, "cfg", "c", "~/.signmykey.yml", "config file")
+	cmd.PersistentFlags().StringP("addr", "a", "http://127.0.0.1:9600/", "SMK server address")
+	cmd.PersistentFlags().StringP("user", "u", "", "User used to login instead of current")
+	cmd.PersistentFlags().StringP("password", "p", "", "Password used to login")
+	cmd.PersistentFlags().StringP("otp", "o", "", "One time password")
+	cmd.PersistentFlags().String("tls-cert", "", "Path of TLS client certificate used to login instead of password")
+	cmd.PersistentFlags().String("tls-key", "", "Path of TLS client certificate private key")
+	cmd.PersistentFlags().String("tls-ca", "", "Path of CA used to verify SMK server certificate")
+}
+
+// loadCredentialsConfig binds credentials flags of cmd and loads client config. Flags share
+// config keys with root command, so they are only bound when cmd runs.
+func loadCredentialsConfig(cmd *cobra.Command, cfgFile string) error {
+	for key, flag := range credentialsFlags {
+		if err := viper.BindPFlag(key, cmd.Flag(flag)); err != nil {
+			return err
+		}
+	}
+
+	return initConfig(cfgFile)
+}
+
+// serverClient returns the HTTP client and the address of SMK server
+func serverClient() (*http.Client, string, error) {
+	httpClient, err := client.NewHTTPClient(viper.GetString("tlsCert"), viper.GetString("tlsKey"), viper.GetString("tlsCA"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	smkAddr := viper.GetString("addr")
+	if !strings.HasSuffix(smkAddr, "/") {
+		smkAddr = smkAddr + "/"
+	}
+
+	return httpClient, smkAddr, nil
+}
+
+// userCredentials returns the credentials of current user, password is asked when no
+// API token or TLS client certificate replaces it
+func userCredentials() (client.SignRequest, error) {
+	token := viper.GetString("token")
+	username := viper.GetString("user")
+	if username == "" && token == "" && viper.GetString("tlsCert") == "" {
+		user, err := user.Current()
+		if err != nil {
+			return client.SignRequest{}, err
+		}
+		username = user.Username
+	}
+
+	password := viper.GetString("password")
+	if password == "" && token == "" && viper.GetString("tlsCert") == "" {
+		fmt.Printf("Enter signmykey password (will be hidden): ")
+		passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+		if err != nil {
+			return client.SignRequest{}, err
+		}
+		fmt.Println()
+		password = string(passwordBytes)
+	}
+
+	return client.SignRequest{
+		User:     username,
+		Password: password,
+		Otp:      viper.GetString("otp"),
+		Token:    token,
+	}, nil
+}
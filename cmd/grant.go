@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/signmykeyio/signmykey/client"
+	"github.com/spf13/cobra"
+)
+
+var (
+	grantCfgFile    string
+	grantPrincipals []string
+	grantDuration   time.Duration
+	grantReason     string
+)
+
+var grantCmd = &cobra.Command{
+	Use:   "grant",
+	Short: "Manage principals temporarily granted to users, restricted to grants admins",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadCredentialsConfig(cmd, grantCfgFile)
+	},
+}
+
+var grantCreateCmd = &cobra.Command{
+	Use:   "create USER",
+	Short: "Grant principals to a user for a limited time",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		httpClient, smkAddr, err := serverClient()
+		if err != nil {
+			return err
+		}
+		credentials, err := userCredentials()
+		if err != nil {
+			return err
+		}
+
+		grant, err := client.CreateGrant(httpClient, smkAddr, credentials, client.GrantSpec{
+			User:       args[0],
+			Principals: grantPrincipals,
+			Duration:   grantDuration.String(),
+			Reason:     grantReason,
+		})
+		if err != nil {
+			return err
+		}
+
+		color.Green("\nGrant %s created, %s granted to %s until %s", grant.ID, strings.Join(grant.Principals, ","), grant.User, grant.Expires.Local().Format(time.RFC3339))
+
+		return nil
+	},
+}
+
+var grantListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List active grants",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		httpClient, smkAddr, err := serverClient()
+		if err != nil {
+			return err
+		}
+		credentials, err := userCredentials()
+		if err != nil {
+			return err
+		}
+
+		grants, err := client.ListGrants(httpClient, smkAddr, credentials)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUSER\tPRINCIPALS\tEXPIRES\tGRANTER\tREASON") // nolint:errcheck
+		for _, g := range grants {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", // nolint:errcheck
+				g.ID, g.User, strings.Join(g.Principals, ","), g.Expires.Local().Format(time.RFC3339), g.Granter, g.Reason)
+		}
+
+		return w.Flush()
+	},
+}
+
+var grantRevokeCmd = &cobra.Command{
+	Use:   "revoke ID",
+	Short: "Revoke a grant before its expiration",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		httpClient, smkAddr, err := serverClient()
+		if err != nil {
+			return err
+		}
+		credentials, err := userCredentials()
+		if err != nil {
+			return err
+		}
+
+		grant, err := client.RevokeGrant(httpClient, smkAddr, credentials, args[0])
+		if err != nil {
+			return err
+		}
+
+		color.Green("\nGrant %s of %s revoked", grant.ID, grant.User)
+
+		return nil
+	},
+}
+
+func init() {
+	addCredentialsFlags(grantCmd, &grantCfgFile)
+
+	grantCreateCmd.Flags().StringSliceVar(&grantPrincipals, "principals", []string{}, "Principals granted to user")
+	grantCreateCmd.Flags().DurationVar(&grantDuration, "duration", time.Hour, "Validity of grant, limited by server")
+	grantCreateCmd.Flags().StringVar(&grantReason, "reason", "", "Reason of grant, recorded in audit logs (required)")
+
+	grantCmd.AddCommand(grantCreateCmd, grantListCmd, grantRevokeCmd)
+	rootCmd.AddCommand(grantCmd)
+}
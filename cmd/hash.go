@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/mdp/qrterminal/v3"
 	"github.com/signmykeyio/signmykey/util"
@@ -11,10 +14,21 @@ import (
 	"golang.org/x/term"
 )
 
+var (
+	hashMigrate       bool
+	hashOTPAlgorithm  string
+	hashOTPDigits     int
+	hashOTPPeriod     int
+	hashRecoveryCodes int
+)
+
 var hashCmd = &cobra.Command{
 	Use:   "hash",
-	Short: "Hash password to use with local authenticator",
+	Short: "Hash password to use with local or htpasswd authenticators",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if hashMigrate {
+			return migrateHash()
+		}
 
 		fmt.Printf("Password to hash (will be hidden): ")
 		password, err := term.ReadPassword(int(os.Stdin.Fd()))
@@ -36,14 +50,30 @@ var hashCmd = &cobra.Command{
 
 		if useOtp == "Y" || useOtp == "y" {
 			seed := util.GenerateSeed()
-			encryptedSeed := util.EncryptSeed(seed, password)
-			str := util.ProvisionURI(seed)
+			params := util.OTPParams{Secret: seed, Algorithm: strings.ToUpper(hashOTPAlgorithm), Digits: hashOTPDigits, Period: hashOTPPeriod}
+			if err := params.Validate(); err != nil {
+				return err
+			}
+			str := params.URI()
+
+			// TOTP parameters are kept with the seed in its otpauth URI
+			encryptedSeed, err := util.EncryptSeed(str, password)
+			if err != nil {
+				return err
+			}
 
 			fmt.Printf("\nScan this with your OTP application\n")
 			qrterminal.GenerateHalfBlock(str, qrterminal.L, os.Stdout)
 			fmt.Printf("\n...or create a new OTP secret manually if you cannot scan QR codes")
 			fmt.Printf("\nOTP Secret: %s\n", seed)
-			fmt.Printf("\nHashed password: %s\n", string(hash)+","+encryptedSeed)
+
+			codes, recoveryCodes, err := util.GenerateRecoveryCodes(hashRecoveryCodes)
+			if err != nil {
+				return err
+			}
+			printRecoveryCodes(codes)
+
+			fmt.Printf("\nHashed password: %s\n", util.JoinHashedPassword(string(hash), encryptedSeed, recoveryCodes))
 
 		} else {
 			fmt.Printf("\nHashed password: %s\n", string(hash))
@@ -53,6 +83,48 @@ var hashCmd = &cobra.Command{
 	},
 }
 
+// migrateHash encrypts again the legacy OTP seed of an existing hashed password in current format
+func migrateHash() error {
+	fmt.Printf("Hashed password to migrate: ")
+	entry, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	entry = strings.TrimSpace(entry)
+
+	hash, encryptedSeed, recoveryCodes := util.SplitHashedPassword(entry)
+	if encryptedSeed == "" {
+		return errors.New("hashed password has no OTP seed to migrate")
+	}
+	if !util.IsLegacySeed(encryptedSeed) {
+		return errors.New("OTP seed already uses current encryption")
+	}
+
+	fmt.Printf("Password of user (will be hidden): ")
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+
+	if err := util.CheckPassword(hash, password); err != nil {
+		return fmt.Errorf("\n%w", err)
+	}
+
+	upgraded, err := util.UpgradeSeed(encryptedSeed, password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nHashed password: %s\n", util.JoinHashedPassword(hash, upgraded, recoveryCodes))
+
+	return nil
+}
+
 func init() {
+	hashCmd.Flags().StringVar(&hashOTPAlgorithm, "otp-algorithm", util.DefaultOTPAlgorithm, "OTP HMAC algorithm (SHA1, SHA256 or SHA512)")
+	hashCmd.Flags().IntVar(&hashOTPDigits, "otp-digits", util.DefaultOTPDigits, "OTP code length (6 to 8)")
+	hashCmd.Flags().IntVar(&hashOTPPeriod, "otp-period", util.DefaultOTPPeriod, "OTP code validity period in seconds")
+	hashCmd.Flags().IntVar(&hashRecoveryCodes, "recovery-codes", util.DefaultRecoveryCodes, "Number of one-time recovery codes accepted instead of OTP")
+	hashCmd.Flags().BoolVar(&hashMigrate, "migrate", false, "Migrate OTP seed of an existing hashed password to current encryption")
 	rootCmd.AddCommand(hashCmd)
 }
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// principalsProvider represents the config of a principals provider
+type principalsProvider struct {
+	Type string
+	Opts *viper.Viper
+
+	// Timeout and Optional are the lookup policy of provider, read from timeout and optional
+	// entries of provider options
+	Timeout  time.Duration
+	Optional bool
+
+	// Principals of provider are cached when CacheTTL isn't 0, read from cacheTTL,
+	// cacheNegativeTTL and cacheMaxEntries entries of provider options
+	CacheTTL         time.Duration
+	CacheNegativeTTL time.Duration
+	CacheMaxEntries  int
+}
+
+// policyEntries are the entries of provider options read by readPolicy
+var policyEntries = []string{"timeout", "optional", "cachettl", "cachenegativettl", "cachemaxentries"}
+
+// readPolicy reads lookup policy of provider from config, principalsTimeout is the default
+// timeout
+func (p *principalsProvider) readPolicy(config *viper.Viper) error {
+	config.SetDefault("timeout", viper.GetDuration("principalsTimeout"))
+	config.SetDefault("cacheMaxEntries", 10000)
+
+	p.Timeout = config.GetDuration("timeout")
+	p.Optional = config.GetBool("optional")
+	if p.Timeout < 0 {
+		return fmt.Errorf("timeout of %s principals provider must not be negative", p.Type)
+	}
+
+	p.CacheTTL = config.GetDuration("cacheTTL")
+	p.CacheNegativeTTL = config.GetDuration("cacheNegativeTTL")
+	p.CacheMaxEntries = config.GetInt("cacheMaxEntries")
+	if p.CacheTTL < 0 || p.CacheNegativeTTL < 0 || p.CacheMaxEntries < 0 {
+		return fmt.Errorf("cacheTTL, cacheNegativeTTL and cacheMaxEntries of %s principals provider must not be negative", p.Type)
+	}
+
+	return nil
+}
+
+// principalsProvidersConfig returns configs of principals providers in the order they are
+// queried: principalsProviders list, principalsProviders map sorted by type, or principalsType
+// and principalsOpts.
+func principalsProvidersConfig(logger *logrus.Logger) ([]principalsProvider, error) {
+	if !viper.IsSet("principalsProviders") {
+		princsTypeConfig := viper.GetString("principalsType")
+		if princsTypeConfig == "" {
+			return nil, errors.New("principals type not defined in config")
+		}
+
+		provider, err := newPrincipalsProvider(princsTypeConfig, viper.GetStringMap("principalsOpts"))
+		if err != nil {
+			return nil, err
+		}
+
+		return []principalsProvider{provider}, nil
+	}
+
+	items, ok := viper.Get("principalsProviders").([]interface{})
+	if !ok {
+		// map order is random, providers are sorted to be queried in the same order
+		// across restarts
+		types := []string{}
+		for princsTypeConfig := range viper.GetStringMap("principalsProviders") {
+			types = append(types, princsTypeConfig)
+		}
+		slices.Sort(types)
+		logger.WithField("ctx", "server").Warnf("principalsProviders map is deprecated, providers are queried sorted by type (%v), use a list to set their order", types)
+
+		providers := []principalsProvider{}
+		for _, princsTypeConfig := range types {
+			provider, err := newPrincipalsProvider(princsTypeConfig, viper.GetStringMap("principalsProviders."+princsTypeConfig))
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, provider)
+		}
+
+		return providers, nil
+	}
+
+	providers := []principalsProvider{}
+	for i, item := range items {
+		item, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("principals provider %d of principalsProviders list must be a map", i)
+		}
+
+		opts := maps.Clone(item)
+		princsTypeConfig := ""
+		for key, value := range opts {
+			if strings.EqualFold(key, "type") {
+				princsTypeConfig, _ = value.(string)
+				delete(opts, key)
+			}
+		}
+		if princsTypeConfig == "" {
+			return nil, fmt.Errorf("type of principals provider %d of principalsProviders list not defined", i)
+		}
+
+		provider, err := newPrincipalsProvider(princsTypeConfig, opts)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+
+	return providers, nil
+}
+
+// newPrincipalsProvider returns the provider of type configured with options, its lookup policy
+// is read from options and removed from the options given to provider.
+func newPrincipalsProvider(princsTypeConfig string, options map[string]interface{}) (principalsProvider, error) {
+	provider := principalsProvider{Type: princsTypeConfig}
+
+	policy := viper.New()
+	if err := policy.MergeConfigMap(options); err != nil {
+		return provider, err
+	}
+	if err := provider.readPolicy(policy); err != nil {
+		return provider, err
+	}
+
+	// policy entries aren't options of provider
+	opts := maps.Clone(options)
+	for key := range opts {
+		if slices.Contains(policyEntries, strings.ToLower(key)) {
+			delete(opts, key)
+		}
+	}
+	provider.Opts = viper.New()
+	if err := provider.Opts.MergeConfigMap(opts); err != nil {
+		return provider, err
+	}
+
+	return provider, nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/signmykeyio/signmykey/util"
+	"github.com/spf13/cobra"
+)
+
+var recoveryCodesCount int
+
+var recoveryCodesCmd = &cobra.Command{
+	Use:   "recovery-codes",
+	Short: "Regenerate OTP recovery codes of a hashed password",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		fmt.Printf("Hashed password to update: ")
+		entry, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		hash, encryptedSeed, _ := util.SplitHashedPassword(strings.TrimSpace(entry))
+		if encryptedSeed == "" {
+			return errors.New("hashed password has no OTP seed, recovery codes are only used with OTP")
+		}
+
+		codes, recoveryCodes, err := util.GenerateRecoveryCodes(recoveryCodesCount)
+		if err != nil {
+			return err
+		}
+		printRecoveryCodes(codes)
+
+		fmt.Printf("\nHashed password: %s\n", util.JoinHashedPassword(hash, encryptedSeed, recoveryCodes))
+
+		return nil
+	},
+}
+
+func printRecoveryCodes(codes []string) {
+	if len(codes) == 0 {
+		return
+	}
+
+	fmt.Printf("\nRecovery codes, each one can be used once instead of OTP:\n")
+	for _, code := range codes {
+		fmt.Printf("  %s\n", code)
+	}
+	fmt.Printf("\nUsed codes are removed from the server config file: the local authenticator needs the\nupgradeFile option with recovery codes, the server doesn't start without it.\n")
+}
+
+func init() {
+	recoveryCodesCmd.Flags().IntVar(&recoveryCodesCount, "count", util.DefaultRecoveryCodes, "Number of recovery codes to generate")
+	rootCmd.AddCommand(recoveryCodesCmd)
+}
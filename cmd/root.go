@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/user"
 	"strings"
@@ -10,9 +14,11 @@ import (
 	"github.com/fatih/color"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/signmykeyio/signmykey/client"
+	"github.com/signmykeyio/signmykey/util"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/term"
 )
 
@@ -53,8 +59,11 @@ var rootCmd = &cobra.Command{
 			pubKeysFiles = foundPubKeysFiles
 		}
 
+		// API token and client certificate replace user and password, user is known by server
+		token := viper.GetString("token")
+
 		username := viper.GetString("user")
-		if username == "" {
+		if username == "" && token == "" && viper.GetString("tlsCert") == "" {
 			user, err := user.Current()
 			if err != nil {
 				return err
@@ -62,14 +71,37 @@ var rootCmd = &cobra.Command{
 			username = user.Username
 		}
 
-		password := viper.GetString("password")
-		if password == "" {
-			fmt.Printf("Enter signmykey password (will be hidden): ")
-			passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+		httpClient, err := client.NewHTTPClient(viper.GetString("tlsCert"), viper.GetString("tlsKey"), viper.GetString("tlsCA"))
+		if err != nil {
+			return err
+		}
+
+		// SSH login key signs a server nonce instead of sending a password
+		var loginSigner ssh.Signer
+		if loginKey := viper.GetString("loginKey"); loginKey != "" {
+			var loginCloser io.Closer
+			loginSigner, loginCloser, err = client.LoadSigner(loginKey, passphrasePrompt(loginKey))
 			if err != nil {
 				return err
 			}
-			password = string(passwordBytes)
+			defer loginCloser.Close() // nolint:errcheck
+		}
+
+		// password is only asked when a key can't be renewed, a TLS client certificate, an SSH
+		// login key or an API token replaces it
+		password := viper.GetString("password")
+		passwordAsked := password != "" || viper.GetString("tlsCert") != "" || loginSigner != nil || token != ""
+		getPassword := func() (string, error) {
+			if !passwordAsked {
+				fmt.Printf("Enter signmykey password (will be hidden): ")
+				passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+				if err != nil {
+					return "", err
+				}
+				password = string(passwordBytes)
+				passwordAsked = true
+			}
+			return password, nil
 		}
 
 		smkAddr := viper.GetString("addr")
@@ -86,9 +118,56 @@ var rootCmd = &cobra.Command{
 				return fmt.Errorf("%v, public key: %v", err, pubKeyFile)
 			}
 
-			signedKey, err := client.Sign(smkAddr, username, password, pubKey, otp)
-			if err != nil {
-				return fmt.Errorf("%v, public key: %v", err, pubKeyFile)
+			var signedKey string
+			if viper.GetBool("renew") && client.CertStillValid(pubKeyFile) {
+				signedKey, err = renewKey(httpClient, smkAddr, pubKeyFile)
+				if err != nil {
+					color.HiYellow("\nRenewal of %s failed, falling back to login: %s", pubKeyFile, err)
+				}
+			}
+
+			if signedKey == "" {
+				password, err := getPassword()
+				if err != nil {
+					return err
+				}
+
+				signReq := &client.SignRequest{
+					User:       username,
+					Password:   password,
+					PublicKey:  pubKey,
+					Otp:        otp,
+					TTL:        int64(viper.GetDuration("ttl").Seconds()),
+					Principals: viper.GetStringSlice("principals"),
+					Token:      token,
+				}
+				if loginSigner != nil {
+					signReq.Nonce, signReq.Signature, err = client.SignNonce(httpClient, smkAddr, loginSigner, util.LoginNamespace)
+					if err != nil {
+						return fmt.Errorf("%v, public key: %v", err, pubKeyFile)
+					}
+				}
+
+				if viper.GetBool("keyProof") {
+					keySigner, keyCloser, err := client.LoadSigner(pubKeyFile, passphrasePrompt(pubKeyFile))
+					if err != nil {
+						return fmt.Errorf("%v, public key: %v", err, pubKeyFile)
+					}
+					signReq.ProofNonce, signReq.ProofSignature, err = client.SignNonce(httpClient, smkAddr, keySigner, util.KeyProofNamespace)
+					keyCloser.Close() // nolint:errcheck
+					if err != nil {
+						return fmt.Errorf("%v, public key: %v", err, pubKeyFile)
+					}
+				}
+
+				signedKey, err = client.SendSignRequest(httpClient, smkAddr, signReq)
+				var pendingErr *client.PendingError
+				if errors.As(err, &pendingErr) {
+					signedKey, err = waitApproval(httpClient, smkAddr, pendingErr)
+				}
+				if err != nil {
+					return fmt.Errorf("%v, public key: %v", err, pubKeyFile)
+				}
 			}
 
 			err = client.WriteUserSignedKey(signedKey, pubKeyFile)
@@ -130,6 +209,40 @@ an alternative algorithm :
 	},
 }
 
+func passphrasePrompt(pubKeyFile string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		fmt.Printf("Enter passphrase of %s (will be hidden): ", strings.TrimSuffix(pubKeyFile, ".pub"))
+		defer fmt.Println()
+		return term.ReadPassword(int(os.Stdin.Fd()))
+	}
+}
+
+// waitApproval polls a sign request waiting for approval until it is decided or expired
+func waitApproval(httpClient *http.Client, smkAddr string, pendingErr *client.PendingError) (string, error) {
+	color.HiYellow("\nSign request needs approval, ask an approver to run:\n\n  signmykey approve %s\n", pendingErr.RequestID)
+	color.HiBlack("Waiting for approval until %s...", pendingErr.Expires.Local().Format(time.RFC3339))
+
+	ctx, cancel := context.WithDeadline(context.Background(), pendingErr.Expires.Add(time.Minute))
+	defer cancel()
+
+	cert, err := client.WaitApproval(ctx, httpClient, smkAddr, pendingErr.RequestID, pendingErr.Secret, viper.GetDuration("approvalPoll"))
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "", errors.New("sign request expired before approval")
+	}
+
+	return cert, err
+}
+
+func renewKey(httpClient *http.Client, smkAddr, pubKeyFile string) (string, error) {
+	signer, closer, err := client.LoadSigner(pubKeyFile, passphrasePrompt(pubKeyFile))
+	if err != nil {
+		return "", err
+	}
+	defer closer.Close() // nolint:errcheck
+
+	return client.Renew(httpClient, smkAddr, pubKeyFile, signer)
+}
+
 // Execute root command
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
@@ -178,6 +291,60 @@ func init() {
 		color.Red(fmt.Sprintf("%s", err))
 		os.Exit(1)
 	}
+
+	rootCmd.Flags().BoolP("renew", "r", false, "Renew still valid certificates without login, if allowed by server")
+	if err := viper.BindPFlag("renew", rootCmd.Flags().Lookup("renew")); err != nil {
+		color.Red(fmt.Sprintf("%s", err))
+		os.Exit(1)
+	}
+
+	rootCmd.Flags().String("login-key", "", "Path of public key registered on server used to login instead of password")
+	if err := viper.BindPFlag("loginKey", rootCmd.Flags().Lookup("login-key")); err != nil {
+		color.Red(fmt.Sprintf("%s", err))
+		os.Exit(1)
+	}
+
+	rootCmd.Flags().Bool("key-proof", false, "Prove possession of private keys to sign, required by some servers")
+	if err := viper.BindPFlag("keyProof", rootCmd.Flags().Lookup("key-proof")); err != nil {
+		color.Red(fmt.Sprintf("%s", err))
+		os.Exit(1)
+	}
+
+	rootCmd.Flags().String("tls-cert", "", "Path of TLS client certificate used to login instead of password")
+	if err := viper.BindPFlag("tlsCert", rootCmd.Flags().Lookup("tls-cert")); err != nil {
+		color.Red(fmt.Sprintf("%s", err))
+		os.Exit(1)
+	}
+
+	rootCmd.Flags().String("tls-key", "", "Path of TLS client certificate private key")
+	if err := viper.BindPFlag("tlsKey", rootCmd.Flags().Lookup("tls-key")); err != nil {
+		color.Red(fmt.Sprintf("%s", err))
+		os.Exit(1)
+	}
+
+	rootCmd.Flags().String("tls-ca", "", "Path of CA used to verify SMK server certificate")
+	if err := viper.BindPFlag("tlsCA", rootCmd.Flags().Lookup("tls-ca")); err != nil {
+		color.Red(fmt.Sprintf("%s", err))
+		os.Exit(1)
+	}
+
+	rootCmd.Flags().Duration("ttl", 0, "Requested certificate validity, only shorter than server one is honored")
+	if err := viper.BindPFlag("ttl", rootCmd.Flags().Lookup("ttl")); err != nil {
+		color.Red(fmt.Sprintf("%s", err))
+		os.Exit(1)
+	}
+
+	rootCmd.Flags().StringSlice("principals", []string{}, "Requested subset of principals allowed for user")
+	if err := viper.BindPFlag("principals", rootCmd.Flags().Lookup("principals")); err != nil {
+		color.Red(fmt.Sprintf("%s", err))
+		os.Exit(1)
+	}
+
+	rootCmd.Flags().Duration("approval-poll", 5*time.Second, "Interval between checks of sign requests waiting for approval")
+	if err := viper.BindPFlag("approvalPoll", rootCmd.Flags().Lookup("approval-poll")); err != nil {
+		color.Red(fmt.Sprintf("%s", err))
+		os.Exit(1)
+	}
 }
 
 func initConfig(cfgFile string) error {
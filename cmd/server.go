@@ -1,23 +1,42 @@
 package cmd
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"time"
 
 	"github.com/signmykeyio/signmykey/api"
+	"github.com/signmykeyio/signmykey/builtin/approval"
+	memoryApproval "github.com/signmykeyio/signmykey/builtin/approval/memory"
 	"github.com/signmykeyio/signmykey/builtin/authenticator"
+	htpasswdAuth "github.com/signmykeyio/signmykey/builtin/authenticator/htpasswd"
 	ldapAuth "github.com/signmykeyio/signmykey/builtin/authenticator/ldap"
 	localAuth "github.com/signmykeyio/signmykey/builtin/authenticator/local"
+	mtlsAuth "github.com/signmykeyio/signmykey/builtin/authenticator/mtls"
 	oidcropcAuth "github.com/signmykeyio/signmykey/builtin/authenticator/oidcropc"
+	radiusAuth "github.com/signmykeyio/signmykey/builtin/authenticator/radius"
+	sshkeyAuth "github.com/signmykeyio/signmykey/builtin/authenticator/sshkey"
+	tokenAuth "github.com/signmykeyio/signmykey/builtin/authenticator/token"
+	webhookAuth "github.com/signmykeyio/signmykey/builtin/authenticator/webhook"
+	"github.com/signmykeyio/signmykey/builtin/lockout"
+	memoryLockout "github.com/signmykeyio/signmykey/builtin/lockout/memory"
+	redisLockout "github.com/signmykeyio/signmykey/builtin/lockout/redis"
 	"github.com/signmykeyio/signmykey/builtin/principals"
+	"github.com/signmykeyio/signmykey/builtin/principals/cache"
+	grantsPrinc "github.com/signmykeyio/signmykey/builtin/principals/grants"
 	ldapPrinc "github.com/signmykeyio/signmykey/builtin/principals/ldap"
 	localPrinc "github.com/signmykeyio/signmykey/builtin/principals/local"
 	oidcropcPrinc "github.com/signmykeyio/signmykey/builtin/principals/oidcropc"
+	"github.com/signmykeyio/signmykey/builtin/principals/rules"
+	tokenPrinc "github.com/signmykeyio/signmykey/builtin/principals/token"
 	userPrinc "github.com/signmykeyio/signmykey/builtin/principals/user"
 	"github.com/signmykeyio/signmykey/builtin/signer"
 	localSign "github.com/signmykeyio/signmykey/builtin/signer/local"
 	vaultSign "github.com/signmykeyio/signmykey/builtin/signer/vault"
+	"github.com/signmykeyio/signmykey/util"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -72,6 +91,12 @@ var serverCmd = &cobra.Command{
 			"local":    &localAuth.Authenticator{},
 			"ldap":     &ldapAuth.Authenticator{},
 			"oidcropc": &oidcropcAuth.Authenticator{},
+			"mtls":     &mtlsAuth.Authenticator{},
+			"sshkey":   &sshkeyAuth.Authenticator{},
+			"radius":   &radiusAuth.Authenticator{},
+			"htpasswd": &htpasswdAuth.Authenticator{},
+			"token":    &tokenAuth.Authenticator{},
+			"webhook":  &webhookAuth.Authenticator{},
 		}
 		auth, ok := authType[authTypeConfig]
 		if !ok {
@@ -84,53 +109,67 @@ var serverCmd = &cobra.Command{
 			return
 		}
 
+		// API tokens are checked ahead of Authenticator, for automation next to users
+		// logging in with passwords
+		tokens, _ := auth.(*tokenAuth.Authenticator)
+		if viper.IsSet("tokensFile") && tokens == nil {
+			tokensOpts := viper.New()
+			tokensOpts.Set("tokensFile", viper.GetString("tokensFile"))
+			tokens = &tokenAuth.Authenticator{}
+			if err := tokens.Init(tokensOpts); err != nil {
+				logger.WithField("ctx", "server").WithError(err).Error("Setting API tokens")
+				return
+			}
+		}
+
 		// Principals init
-		princsType := map[string]principals.Principals{
-			"local":    &localPrinc.Principals{},
-			"ldap":     &ldapPrinc.Principals{},
-			"oidcropc": &oidcropcPrinc.Principals{},
-			"user":     &userPrinc.Principals{},
+		princsType := map[string]func() principals.Principals{
+			"local":    func() principals.Principals { return &localPrinc.Principals{} },
+			"ldap":     func() principals.Principals { return &ldapPrinc.Principals{} },
+			"oidcropc": func() principals.Principals { return &oidcropcPrinc.Principals{} },
+			"grants":   func() principals.Principals { return &grantsPrinc.Principals{} },
+			"token":    func() principals.Principals { return &tokenPrinc.Principals{} },
+			"user":     func() principals.Principals { return &userPrinc.Principals{} },
 		}
 		princsProviders := []principals.Principals{}
+		princsCaches := []*cache.Cache{}
 
-		if viper.IsSet("principalsProviders") {
-			for princsTypeConfig := range viper.GetStringMap("principalsProviders") {
-				princsOptsSection := "principalsProviders." + princsTypeConfig
-
-				logger.WithField("ctx", "server").Infof("Configure %v principals provider", princsTypeConfig)
-				princs, ok := princsType[princsTypeConfig]
-				if !ok {
-					logger.WithField("ctx", "server").WithError(fmt.Errorf("unknown principals type %s", princsTypeConfig)).Error("Setting Principals type")
-					return
-				}
-				err = princs.Init(viper.Sub(princsOptsSection))
-				if err != nil {
-					logger.WithField("ctx", "server").WithError(err).Error("Setting Principals options")
-					return
-				}
-
-				princsProviders = append(princsProviders, princs)
-			}
-		} else {
-			princsTypeConfig := viper.GetString("principalsType")
-			if princsTypeConfig == "" {
-				logger.WithField("ctx", "server").WithError(errors.New("principals type not defined in config")).Error("Setting Principals type")
-				return
-			}
-
-			logger.WithField("ctx", "server").Infof("Configure %v principals provider", princsTypeConfig)
-			princs, ok := princsType[princsTypeConfig]
+		princsConfigs, err := principalsProvidersConfig(logger)
+		if err != nil {
+			logger.WithField("ctx", "server").WithError(err).Error("Setting Principals type")
+			return
+		}
+		for _, princsConfig := range princsConfigs {
+			logger.WithField("ctx", "server").Infof("Configure %v principals provider", princsConfig.Type)
+			newPrincs, ok := princsType[princsConfig.Type]
 			if !ok {
-				logger.WithField("ctx", "server").WithError(fmt.Errorf("unknown principals type %s", princsTypeConfig)).Error("Setting Principals type")
+				logger.WithField("ctx", "server").WithError(fmt.Errorf("unknown principals type %s", princsConfig.Type)).Error("Setting Principals type")
 				return
 			}
-			err = princs.Init(viper.Sub("principalsOpts"))
+			princs := newPrincs()
+			err = princs.Init(princsConfig.Opts)
 			if err != nil {
 				logger.WithField("ctx", "server").WithError(err).Error("Setting Principals options")
 				return
 			}
 
-			princsProviders = append(princsProviders, princs)
+			if princsConfig.CacheTTL > 0 {
+				// revoked grants must stop being returned at once
+				if _, ok := princs.(*grantsPrinc.Principals); ok {
+					logger.WithField("ctx", "server").WithError(errors.New("grants principals can't be cached")).Error("Setting Principals options")
+					return
+				}
+				princsCache := cache.New(princs, princsConfig.CacheTTL, princsConfig.CacheNegativeTTL, princsConfig.CacheMaxEntries)
+				princsCaches = append(princsCaches, princsCache)
+				princs = princsCache
+			}
+
+			princsProviders = append(princsProviders, &principals.Provider{
+				Principals: princs,
+				Type:       princsConfig.Type,
+				Timeout:    princsConfig.Timeout,
+				Optional:   princsConfig.Optional,
+			})
 		}
 
 		if len(princsProviders) == 0 {
@@ -138,6 +177,27 @@ var serverCmd = &cobra.Command{
 			return
 		}
 
+		viper.SetDefault("principalsMode", api.PrincipalsMerge)
+		princsMode := viper.GetString("principalsMode")
+		if !slices.Contains([]string{api.PrincipalsMerge, api.PrincipalsFirstMatch, api.PrincipalsIntersection}, princsMode) {
+			logger.WithField("ctx", "server").WithError(errors.New("principalsMode must be merge, first or intersection")).Error("Setting principals mode")
+			return
+		}
+
+		// Principals rules init
+		var princsRules *rules.Pipeline
+		if viper.IsSet("principalsRules") {
+			princsRules = &rules.Pipeline{}
+			err = viper.UnmarshalKey("principalsRules", princsRules)
+			if err == nil {
+				err = princsRules.Compile()
+			}
+			if err != nil {
+				logger.WithField("ctx", "server").WithError(err).Error("Setting principals rules")
+				return
+			}
+		}
+
 		// Signer init
 		signerTypeConfig := viper.GetString("signerType")
 		if signerTypeConfig == "" {
@@ -169,17 +229,164 @@ var serverCmd = &cobra.Command{
 			}
 		}
 
+		if authTypeConfig == "mtls" && (viper.GetBool("tlsDisable") || viper.GetString("tlsClientCA") == "") {
+			logger.WithField("ctx", "server").WithError(errors.New("tlsClientCA must be defined and tlsDisable False with mtls authenticator")).Error("Setting TLS config")
+			return
+		}
+
+		// servers behind a load balancer share the key authenticating their nonces
+		if nonceKeyFile := viper.GetString("nonceKeyFile"); nonceKeyFile != "" {
+			nonceKey, err := os.ReadFile(nonceKeyFile) // nolint: gosec
+			if err == nil {
+				err = util.SetNonceKey(bytes.TrimSpace(nonceKey))
+			}
+			if err != nil {
+				logger.WithField("ctx", "server").WithError(err).Error("Setting nonce key")
+				return
+			}
+		}
+
+		renewMaxLifetime := viper.GetDuration("renewMaxLifetime")
+		if renewMaxLifetime > 0 && signerTypeConfig != "local" {
+			logger.WithField("ctx", "server").WithError(errors.New("certificate renewal is only supported with local signer")).Error("Setting renewal config")
+			return
+		}
+
+		// Login lockout init
+		lockoutConfig := api.LockoutConfig{}
+		if lockoutTypeConfig := viper.GetString("lockoutType"); lockoutTypeConfig != "" {
+			lockoutType := map[string]lockout.Store{
+				"memory": &memoryLockout.Store{},
+				"redis":  &redisLockout.Store{},
+			}
+			store, ok := lockoutType[lockoutTypeConfig]
+			if !ok {
+				logger.WithField("ctx", "server").WithError(fmt.Errorf("unknown lockout type %s", lockoutTypeConfig)).Error("Setting lockout type")
+				return
+			}
+
+			lockoutOpts := viper.Sub("lockoutOpts")
+			if lockoutOpts == nil {
+				lockoutOpts = viper.New()
+			}
+			err = store.Init(lockoutOpts)
+			if err != nil {
+				logger.WithField("ctx", "server").WithError(err).Error("Setting lockout options")
+				return
+			}
+
+			lockoutOpts.SetDefault("maxFailures", 5)
+			lockoutOpts.SetDefault("window", "15m")
+			lockoutOpts.SetDefault("baseDelay", "1m")
+			lockoutOpts.SetDefault("maxDelay", "1h")
+			lockoutConfig = api.LockoutConfig{
+				Store:       store,
+				MaxFailures: lockoutOpts.GetInt64("maxFailures"),
+				Window:      lockoutOpts.GetDuration("window"),
+				BaseDelay:   lockoutOpts.GetDuration("baseDelay"),
+				MaxDelay:    lockoutOpts.GetDuration("maxDelay"),
+			}
+			if lockoutConfig.MaxFailures < 1 || lockoutConfig.Window <= 0 || lockoutConfig.BaseDelay <= 0 || lockoutConfig.MaxDelay < lockoutConfig.BaseDelay {
+				logger.WithField("ctx", "server").WithError(errors.New("maxFailures, window and baseDelay must be positive and maxDelay greater than baseDelay")).Error("Setting lockout options")
+				return
+			}
+		}
+
+		// Approval workflow init
+		approvalConfig := api.ApprovalConfig{}
+		if approvalTypeConfig := viper.GetString("approvalType"); approvalTypeConfig != "" {
+			approvalType := map[string]approval.Store{
+				"memory": &memoryApproval.Store{},
+			}
+			store, ok := approvalType[approvalTypeConfig]
+			if !ok {
+				logger.WithField("ctx", "server").WithError(fmt.Errorf("unknown approval type %s", approvalTypeConfig)).Error("Setting approval type")
+				return
+			}
+
+			approvalOpts := viper.Sub("approvalOpts")
+			if approvalOpts == nil {
+				approvalOpts = viper.New()
+			}
+			err = store.Init(approvalOpts)
+			if err != nil {
+				logger.WithField("ctx", "server").WithError(err).Error("Setting approval options")
+				return
+			}
+
+			rules := []approval.Rule{}
+			err = viper.UnmarshalKey("approvalRules", &rules)
+			if err != nil {
+				logger.WithField("ctx", "server").WithError(err).Error("Setting approval rules")
+				return
+			}
+			for i := range rules {
+				if rules[i].Approvals == 0 {
+					rules[i].Approvals = 1
+				}
+				if rules[i].TTL == 0 {
+					rules[i].TTL = 15 * time.Minute
+				}
+				if err := rules[i].Validate(); err != nil {
+					logger.WithField("ctx", "server").WithError(err).Error("Setting approval rules")
+					return
+				}
+			}
+			if len(rules) == 0 {
+				logger.WithField("ctx", "server").WithError(errors.New("no approval rule defined")).Error("Setting approval rules")
+				return
+			}
+
+			approvalConfig = api.ApprovalConfig{Store: store, Rules: rules}
+		}
+
+		// Grants administration is enabled by grants principals provider
+		grantsConfig := api.GrantsConfig{}
+		for _, princs := range princsProviders {
+			if grantsProvider, ok := princs.(*principals.Provider).Principals.(*grantsPrinc.Principals); ok {
+				grantsConfig = api.GrantsConfig{
+					Store:       grantsProvider.Store,
+					AdminGroups: grantsProvider.AdminGroups,
+					MaxDuration: grantsProvider.MaxDuration,
+				}
+
+				// expired grants are removed and logged even without sign requests
+				go func() {
+					for now := range time.Tick(time.Minute) {
+						grantsProvider.Store.Sweep(now)
+					}
+				}()
+			}
+		}
+
 		config := api.Config{
 			Auth:   auth,
 			Princs: princsProviders,
 			Signer: signer,
+			Tokens: tokens,
+
+			PrincipalsMode:  princsMode,
+			PrincipalsRules: princsRules,
 
 			Logger: logger,
 
-			Addr:       viper.GetString("address"),
-			TLSDisable: viper.GetBool("tlsDisable"),
-			TLSCert:    viper.GetString("tlsCert"),
-			TLSKey:     viper.GetString("tlsKey"),
+			Addr:        viper.GetString("address"),
+			TLSDisable:  viper.GetBool("tlsDisable"),
+			TLSCert:     viper.GetString("tlsCert"),
+			TLSKey:      viper.GetString("tlsKey"),
+			TLSClientCA: viper.GetString("tlsClientCA"),
+
+			RenewMaxLifetime: renewMaxLifetime,
+			KeyProofRequired: viper.GetBool("keyProofRequired"),
+
+			Lockout:  lockoutConfig,
+			Approval: approvalConfig,
+			Grants:   grantsConfig,
+
+			PrincipalsCache: api.PrincipalsCacheConfig{
+				Caches:      princsCaches,
+				AdminGroups: viper.GetStringSlice("principalsCacheAdminGroups"),
+			},
 		}
 
 		api.Serve(config)
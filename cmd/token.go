@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/signmykeyio/signmykey/builtin/authenticator/token"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tokenFile       string
+	tokenPrincipals []string
+	tokenMaxTTL     time.Duration
+	tokenExpires    string
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage API tokens of token authenticator",
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create an API token, its secret is only shown once",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		expires, err := parseExpires(tokenExpires, time.Now())
+		if err != nil {
+			return err
+		}
+
+		tokens, err := token.ReadTokens(tokenFile)
+		if err != nil {
+			return err
+		}
+
+		secret, t, err := token.NewToken(tokens, args[0], tokenPrincipals, tokenMaxTTL, expires)
+		if err != nil {
+			return err
+		}
+
+		if err := token.WriteTokens(tokenFile, append(tokens, t)); err != nil {
+			return err
+		}
+
+		fmt.Printf("Token %s created for %s, use it with SMK_TOKEN environment variable:\n\n%s\n", t.ID, t.Name, secret)
+
+		return nil
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API tokens",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tokens, err := token.ReadTokens(tokenFile)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSTATUS\tPRINCIPALS\tMAX TTL\tEXPIRES\tCREATED") // nolint:errcheck
+		for _, t := range tokens {
+			principals, maxTTL, expires := "*", "-", "never"
+			if len(t.Principals) > 0 {
+				principals = strings.Join(t.Principals, ",")
+			}
+			if t.MaxTTL > 0 {
+				maxTTL = (time.Duration(t.MaxTTL) * time.Second).String()
+			}
+			if !t.Expires.IsZero() {
+				expires = t.Expires.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", // nolint:errcheck
+				t.ID, t.Name, t.Status(now), principals, maxTTL, expires, t.Created.Format(time.RFC3339))
+		}
+
+		return w.Flush()
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke ID",
+	Short: "Revoke an API token",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tokens, err := token.ReadTokens(tokenFile)
+		if err != nil {
+			return err
+		}
+
+		for i, t := range tokens {
+			if t.ID != args[0] {
+				continue
+			}
+			if !t.Revoked.IsZero() {
+				return fmt.Errorf("token %s already revoked", t.ID)
+			}
+
+			tokens[i].Revoked = time.Now().UTC().Truncate(time.Second)
+			if err := token.WriteTokens(tokenFile, tokens); err != nil {
+				return err
+			}
+			fmt.Printf("Token %s of %s revoked\n", t.ID, t.Name)
+
+			return nil
+		}
+
+		return fmt.Errorf("token %s not found", args[0])
+	},
+}
+
+// parseExpires parses token expiration, as a duration from now or a date
+func parseExpires(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		if d <= 0 {
+			return time.Time{}, errors.New("expiration must be in the future")
+		}
+		return now.Add(d), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if !t.After(now) {
+				return time.Time{}, errors.New("expiration must be in the future")
+			}
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid expiration %q, must be a duration (ex: 720h) or a date (ex: 2030-01-31)", value)
+}
+
+func init() {
+	tokenCmd.PersistentFlags().StringVarP(&tokenFile, "file", "f", "/etc/signmykey/tokens.json", "Path of tokens file")
+
+	tokenCreateCmd.Flags().StringSliceVar(&tokenPrincipals, "principals", []string{}, "Principals allowed for token (default: no restriction)")
+	tokenCreateCmd.Flags().DurationVar(&tokenMaxTTL, "max-ttl", 0, "Maximum validity of certificates signed with token (default: signer TTL)")
+	tokenCreateCmd.Flags().StringVar(&tokenExpires, "expires", "", "Expiration of token, as a duration or a date (default: never)")
+
+	tokenCmd.AddCommand(tokenCreateCmd, tokenListCmd, tokenRevokeCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
@@ -0,0 +1,610 @@
+// Package ldaptest provides an in-process LDAP server for tests. It implements simple binds,
+// searches with equality, presence, boolean and LDAP_MATCHING_RULE_IN_CHAIN filters, paged
+// results, Active Directory ranged attribute retrieval, and StartTLS.
+package ldaptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// LDAP protocol operations and result codes used by Server
+const (
+	opBindRequest       = 0
+	opBindResponse      = 1
+	opUnbindRequest     = 2
+	opSearchRequest     = 3
+	opSearchResultEntry = 4
+	opSearchResultDone  = 5
+	opExtendedRequest   = 23
+	opExtendedResponse  = 24
+
+	resultSuccess            = 0
+	resultProtocolError      = 2
+	resultSizeLimitExceeded  = 4
+	resultNoSuchObject       = 32
+	resultInvalidCredentials = 49
+	resultUnwillingToPerform = 53
+
+	startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+	// InChainOID is the LDAP_MATCHING_RULE_IN_CHAIN matching rule of Active Directory
+	InChainOID = "1.2.840.113556.1.4.1941"
+)
+
+// Entry represents an LDAP entry, Password is checked on binds with its DN
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Server is an in-process LDAP server
+type Server struct {
+	// URL of the server, ldap:// or ldaps:// when started with TLS
+	URL string
+
+	// TLSConfig is used for ldaps and StartTLS
+	TLSConfig *tls.Config
+
+	// Conns and Binds count accepted connections and bind requests
+	Conns atomic.Int64
+	Binds atomic.Int64
+
+	// Searches counts search requests, each page of paged searches counts
+	Searches atomic.Int64
+
+	// SizeLimit is the maximum number of entries returned by searches without paged results
+	// control, like MaxPageSize of Active Directory. No limit if 0.
+	SizeLimit int
+
+	// MaxValRange is the maximum number of values of an attribute returned at once, like
+	// MaxValRange of Active Directory. Larger attributes are returned with ranged retrieval
+	// (member;range=0-1499). No limit if 0.
+	MaxValRange int
+
+	// SearchDelay delays responses of searches, to test slow servers
+	SearchDelay time.Duration
+
+	listener net.Listener
+	mu       sync.Mutex
+	entries  []Entry
+	conns    map[net.Conn]struct{}
+}
+
+// NewServer starts a plaintext LDAP server serving entries, StartTLS is available if
+// tlsConfig isn't nil. Server is closed at the end of the test.
+func NewServer(t testing.TB, entries []Entry, tlsConfig *tls.Config) *Server {
+	return newServer(t, entries, tlsConfig, false)
+}
+
+// NewTLSServer starts a ldaps server serving entries.
+func NewTLSServer(t testing.TB, entries []Entry, tlsConfig *tls.Config) *Server {
+	return newServer(t, entries, tlsConfig, true)
+}
+
+func newServer(t testing.TB, entries []Entry, tlsConfig *tls.Config, ldaps bool) *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{
+		URL:       "ldap://" + ln.Addr().String(),
+		TLSConfig: tlsConfig,
+		listener:  ln,
+		entries:   entries,
+		conns:     map[net.Conn]struct{}{},
+	}
+	if ldaps {
+		s.URL = "ldaps://" + ln.Addr().String()
+		s.listener = tls.NewListener(ln, tlsConfig)
+	}
+	t.Cleanup(s.Close)
+
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				return
+			}
+			s.Conns.Add(1)
+			s.mu.Lock()
+			s.conns[conn] = struct{}{}
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+// Addr returns the host:port address of the server
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// SetEntries replaces entries served by the server
+func (s *Server) SetEntries(entries []Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = entries
+}
+
+// CloseConns closes all open client connections, the server keeps listening
+func (s *Server) CloseConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		conn.Close() // nolint:errcheck
+		delete(s.conns, conn)
+	}
+}
+
+// Close stops the server and closes all client connections
+func (s *Server) Close() {
+	s.listener.Close() // nolint:errcheck
+	s.CloseConns()
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close() // nolint:errcheck
+	}()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID, ok := packet.Children[0].Value.(int64)
+		if !ok {
+			return
+		}
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case opBindRequest:
+			s.Binds.Add(1)
+			write(conn, messageID, result(opBindResponse, s.bind(op)))
+		case opUnbindRequest:
+			return
+		case opSearchRequest:
+			s.Searches.Add(1)
+			time.Sleep(s.SearchDelay)
+			var controls *ber.Packet
+			if len(packet.Children) > 2 {
+				controls = packet.Children[2]
+			}
+			code, paging := s.search(conn, messageID, op, controls)
+			if paging != nil {
+				write(conn, messageID, result(opSearchResultDone, code), paging)
+				continue
+			}
+			write(conn, messageID, result(opSearchResultDone, code))
+		case opExtendedRequest:
+			if len(op.Children) == 0 || string(op.Children[0].Data.Bytes()) != startTLSOID || s.TLSConfig == nil {
+				write(conn, messageID, result(opExtendedResponse, resultProtocolError))
+				continue
+			}
+			if _, ok := conn.(*tls.Conn); ok {
+				write(conn, messageID, result(opExtendedResponse, resultUnwillingToPerform))
+				continue
+			}
+			write(conn, messageID, result(opExtendedResponse, resultSuccess))
+
+			tlsConn := tls.Server(conn, s.TLSConfig)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.conns[tlsConn] = struct{}{}
+			s.mu.Unlock()
+			conn = tlsConn
+		default:
+			return
+		}
+	}
+}
+
+func (s *Server) bind(op *ber.Packet) int64 {
+	if len(op.Children) < 3 {
+		return resultProtocolError
+	}
+	dn := string(op.Children[1].Data.Bytes())
+	password := string(op.Children[2].Data.Bytes())
+
+	// anonymous bind
+	if dn == "" && password == "" {
+		return resultSuccess
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.DN, dn) && entry.Password != "" && entry.Password == password {
+			return resultSuccess
+		}
+	}
+
+	return resultInvalidCredentials
+}
+
+// search sends entries matching search request op, it returns the result code and the
+// paged results control of the response, if any
+func (s *Server) search(conn net.Conn, messageID int64, op *ber.Packet, controls *ber.Packet) (int64, *ldap.ControlPaging) {
+	if len(op.Children) < 8 {
+		return resultProtocolError, nil
+	}
+	baseDN := strings.ToLower(string(op.Children[0].Data.Bytes()))
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+
+	attributes := []string{}
+	for _, attr := range op.Children[7].Children {
+		attributes = append(attributes, string(attr.Data.Bytes()))
+	}
+
+	s.mu.Lock()
+	entries := append([]Entry{}, s.entries...)
+	s.mu.Unlock()
+
+	baseFound := false
+	found := []Entry{}
+	for _, entry := range entries {
+		dn := strings.ToLower(entry.DN)
+		if dn == baseDN {
+			baseFound = true
+		}
+
+		inScope := false
+		switch scope {
+		case 0:
+			inScope = dn == baseDN
+		case 1:
+			parent := ""
+			if i := strings.Index(dn, ","); i >= 0 {
+				parent = dn[i+1:]
+			}
+			inScope = parent == baseDN
+		default:
+			inScope = dn == baseDN || strings.HasSuffix(dn, ","+baseDN) || baseDN == ""
+		}
+		if !inScope || !match(entries, entry, filter) {
+			continue
+		}
+		found = append(found, entry)
+	}
+
+	if !baseFound && baseDN != "" && !hasSuffixEntry(entries, baseDN) {
+		return resultNoSuchObject, nil
+	}
+
+	code := int64(resultSuccess)
+	paging := pagingControl(controls)
+	if paging != nil {
+		// cookie is the offset of the next page
+		offset, _ := strconv.Atoi(string(paging.Cookie))
+		offset = min(offset, len(found))
+		end := min(offset+int(paging.PagingSize), len(found))
+		paging.Cookie = nil
+		if end < len(found) {
+			paging.Cookie = []byte(strconv.Itoa(end))
+		}
+		found = found[offset:end]
+	} else if s.SizeLimit > 0 && len(found) > s.SizeLimit {
+		found = found[:s.SizeLimit]
+		code = resultSizeLimitExceeded
+	}
+
+	for _, entry := range found {
+		write(conn, messageID, s.searchEntry(entry, attributes))
+	}
+
+	return code, paging
+}
+
+// pagingControl returns the paged results control of request controls, if any
+func pagingControl(controls *ber.Packet) *ldap.ControlPaging {
+	if controls == nil {
+		return nil
+	}
+	for _, child := range controls.Children {
+		control, err := ldap.DecodeControl(child)
+		if err != nil {
+			continue
+		}
+		if paging, ok := control.(*ldap.ControlPaging); ok {
+			return paging
+		}
+	}
+
+	return nil
+}
+
+// hasSuffixEntry returns true if an entry is below baseDN, so that bases without their own
+// entry are valid
+func hasSuffixEntry(entries []Entry, baseDN string) bool {
+	for _, entry := range entries {
+		if strings.HasSuffix(strings.ToLower(entry.DN), ","+baseDN) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e Entry) values(attr string) []string {
+	if strings.EqualFold(attr, "dn") || strings.EqualFold(attr, "distinguishedName") {
+		return []string{e.DN}
+	}
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, attr) {
+			return values
+		}
+	}
+
+	return nil
+}
+
+func match(entries []Entry, entry Entry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case 0: // and
+		for _, child := range filter.Children {
+			if !match(entries, entry, child) {
+				return false
+			}
+		}
+		return true
+	case 1: // or
+		for _, child := range filter.Children {
+			if match(entries, entry, child) {
+				return true
+			}
+		}
+		return false
+	case 2: // not
+		return len(filter.Children) == 1 && !match(entries, entry, filter.Children[0])
+	case 3: // equality
+		if len(filter.Children) != 2 {
+			return false
+		}
+		attr := string(filter.Children[0].Data.Bytes())
+		value := string(filter.Children[1].Data.Bytes())
+		for _, v := range entry.values(attr) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	case 7: // present
+		attr := string(filter.Data.Bytes())
+		return strings.EqualFold(attr, "objectClass") || len(entry.values(attr)) > 0
+	case 9: // extensible match
+		var rule, attr, value string
+		for _, child := range filter.Children {
+			switch child.Tag {
+			case 1:
+				rule = string(child.Data.Bytes())
+			case 2:
+				attr = string(child.Data.Bytes())
+			case 3:
+				value = string(child.Data.Bytes())
+			}
+		}
+		if rule == InChainOID {
+			return inChain(entries, entry, attr, value, map[string]bool{})
+		}
+		if rule != "" {
+			return false
+		}
+		for _, v := range entry.values(attr) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// inChain returns true if value is a value of attr of entry, or of attr of entries whose DN
+// is a value of attr of entry, recursively
+func inChain(entries []Entry, entry Entry, attr, value string, visited map[string]bool) bool {
+	visited[strings.ToLower(entry.DN)] = true
+	for _, v := range entry.values(attr) {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+		if visited[strings.ToLower(v)] {
+			continue
+		}
+		for _, child := range entries {
+			if strings.EqualFold(child.DN, v) && inChain(entries, child, attr, value, visited) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (s *Server) searchEntry(entry Entry, attributes []string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "DN"))
+
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	add := func(name string, values []string) {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+
+	all := len(attributes) == 0
+	for _, attr := range attributes {
+		if attr == "*" {
+			all = true
+		}
+	}
+	if all {
+		for name, values := range entry.Attributes {
+			add(s.valueRange(name, values, 0, -1))
+		}
+	} else {
+		for _, attr := range attributes {
+			name, low, high := attr, 0, -1
+			if i := strings.Index(strings.ToLower(attr), ";range="); i >= 0 {
+				name = attr[:i]
+				bounds := strings.SplitN(attr[i+len(";range="):], "-", 2)
+				low, _ = strconv.Atoi(bounds[0])
+				if len(bounds) == 2 && bounds[1] != "*" {
+					high, _ = strconv.Atoi(bounds[1])
+				}
+			}
+			if values := entry.values(name); len(values) > 0 && !strings.EqualFold(name, "dn") {
+				add(s.valueRange(name, values, low, high))
+			}
+		}
+	}
+	op.AppendChild(attrs)
+
+	return op
+}
+
+// valueRange returns values of attribute name from low to high (to the last one if high is
+// -1), limited to MaxValRange values. Name gets a range option if not all values are returned.
+func (s *Server) valueRange(name string, values []string, low, high int) (string, []string) {
+	if s.MaxValRange == 0 && low == 0 && high == -1 {
+		return name, values
+	}
+
+	last := len(values) - 1
+	if high == -1 || high > last {
+		high = last
+	}
+	if s.MaxValRange > 0 {
+		high = min(high, low+s.MaxValRange-1)
+	}
+	low = min(low, len(values))
+	if low == 0 && high == last {
+		return name, values
+	}
+
+	end := strconv.Itoa(high)
+	if high == last {
+		end = "*"
+	}
+
+	return fmt.Sprintf("%s;range=%d-%s", name, low, end), values[low : high+1]
+}
+
+func result(opTag ber.Tag, code int64) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opTag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, diagnostic(code), "Diagnostic Message"))
+
+	return op
+}
+
+func diagnostic(code int64) string {
+	if code == resultSuccess {
+		return ""
+	}
+
+	return fmt.Sprintf("ldaptest error %d", code)
+}
+
+func write(conn net.Conn, messageID int64, op *ber.Packet, controls ...ldap.Control) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	packet.AppendChild(op)
+	if len(controls) > 0 {
+		encoded := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+		for _, control := range controls {
+			encoded.AppendChild(control.Encode())
+		}
+		packet.AppendChild(encoded)
+	}
+
+	conn.Write(packet.Bytes()) // nolint:errcheck
+}
+
+// NewTLSConfig returns a server TLS config with a certificate for 127.0.0.1 and localhost,
+// and the PEM encoded self-signed CA which issued it.
+func NewTLSConfig(t testing.TB) (*tls.Config, []byte) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldaptest CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+
+	return tlsConfig, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+}
@@ -0,0 +1,184 @@
+// Package oidctest provides an in-process OpenID Connect provider for tests. It implements
+// discovery, the resource owner password credentials grant, JWKS and userinfo endpoints.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// KeyID is the kid of the key signing ID tokens
+const KeyID = "oidctest"
+
+// User represents a user of the provider
+type User struct {
+	Password string
+	// Claims are added to ID tokens of user, they override default ones (iss, aud, exp...)
+	Claims map[string]interface{}
+	// Userinfo is returned by userinfo endpoint
+	Userinfo map[string]interface{}
+}
+
+// Server is an in-process OpenID Connect provider
+type Server struct {
+	// Issuer is the issuer URL of the provider
+	Issuer string
+
+	ClientID     string
+	ClientSecret string
+
+	// Key signs ID tokens with RS256
+	Key *rsa.PrivateKey
+
+	// Discoveries and KeyFetches count requests to discovery and JWKS endpoints
+	Discoveries atomic.Int64
+	KeyFetches  atomic.Int64
+
+	mu    sync.Mutex
+	users map[string]User
+}
+
+// NewServer starts a provider serving users for given client. Server is closed at the end of
+// the test.
+func NewServer(t testing.TB, clientID, clientSecret string, users map[string]User) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Key:          key,
+		users:        users,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/userinfo", s.userinfo)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	s.Issuer = server.URL
+
+	return s
+}
+
+// SetUser adds or replaces a user of the provider
+func (s *Server) SetUser(name string, user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[name] = user
+}
+
+// SignIDToken returns an ID token holding claims signed with Key
+func (s *Server) SignIDToken(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": KeyID, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, s.Key, crypto.SHA256, digest[:])
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	s.Discoveries.Add(1)
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":            s.Issuer,
+		"token_endpoint":    s.Issuer + "/token",
+		"userinfo_endpoint": s.Issuer + "/userinfo",
+		"jwks_uri":          s.Issuer + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	s.KeyFetches.Add(1)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(s.Key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.Key.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "password" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	if r.PostForm.Get("client_id") != s.ClientID || r.PostForm.Get("client_secret") != s.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	s.mu.Lock()
+	name := r.PostForm.Get("username")
+	user, ok := s.users[name]
+	s.mu.Unlock()
+	if !ok || user.Password != r.PostForm.Get("password") {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss": s.Issuer,
+		"sub": name,
+		"aud": s.ClientID,
+		"exp": now.Add(5 * time.Minute).Unix(),
+		"iat": now.Unix(),
+	}
+	for k, v := range user.Claims {
+		claims[k] = v
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access-" + name,
+		"id_token":     s.SignIDToken(claims),
+		"token_type":   "Bearer",
+	})
+}
+
+func (s *Server) userinfo(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer access-")
+
+	s.mu.Lock()
+	user, ok := s.users[name]
+	s.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user.Userinfo)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,45 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReplaceInFile replaces the single occurrence of old by new in file at path. The file is
+// rewritten atomically with its current permissions.
+func ReplaceInFile(path, old, new string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(path) // nolint: gosec
+	if err != nil {
+		return err
+	}
+	if count := strings.Count(string(content), old); count != 1 {
+		return fmt.Errorf("expected 1 occurrence of replaced string in %s, found %d", path, count)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // nolint:errcheck
+
+	if _, err := tmp.WriteString(strings.Replace(string(content), old, new, 1)); err != nil {
+		tmp.Close() // nolint:errcheck
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close() // nolint:errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,128 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// NonceTTL is the validity duration of nonces issued by IssueNonce
+const NonceTTL = 2 * time.Minute
+
+// NonceStore issues short lived nonces authenticated with a key and makes sure that each
+// nonce is consumed only once. Consumed nonces are kept in memory: with several servers sharing
+// a key, a nonce could be consumed once by each of them.
+type NonceStore struct {
+	key  []byte
+	ttl  time.Duration
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+var defaultNonceStore = NewNonceStore(NonceTTL)
+
+// NonceKeySize is the minimum size of keys given to NewNonceStoreWithKey
+const NonceKeySize = 32
+
+// NewNonceStore creates a NonceStore with a new random key and given nonce validity duration.
+// Nonces are only accepted by the process which issued them.
+func NewNonceStore(ttl time.Duration) *NonceStore {
+	key := make([]byte, NonceKeySize)
+	_, _ = rand.Read(key)
+
+	return newNonceStore(key, ttl)
+}
+
+// NewNonceStoreWithKey creates a NonceStore with given key and nonce validity duration, stores
+// sharing a key accept nonces issued by each other.
+func NewNonceStoreWithKey(key []byte, ttl time.Duration) (*NonceStore, error) {
+	if len(key) < NonceKeySize {
+		return nil, fmt.Errorf("nonce key must be at least %d bytes long", NonceKeySize)
+	}
+
+	return newNonceStore(key, ttl), nil
+}
+
+func newNonceStore(key []byte, ttl time.Duration) *NonceStore {
+	return &NonceStore{
+		key:  key,
+		ttl:  ttl,
+		used: map[string]time.Time{},
+	}
+}
+
+// Issue returns a new nonce
+func (n *NonceStore) Issue() string {
+	buf := make([]byte, 8+16, 8+16+sha256.Size)
+	binary.BigEndian.PutUint64(buf, uint64(time.Now().Unix()))
+	_, _ = rand.Read(buf[8:])
+
+	mac := hmac.New(sha256.New, n.key)
+	mac.Write(buf)
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(buf))
+}
+
+// Consume checks that nonce was issued by this store, is not expired and was not already
+// consumed
+func (n *NonceStore) Consume(nonce string) error {
+	raw, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(raw) != 8+16+sha256.Size {
+		return errors.New("invalid nonce")
+	}
+
+	mac := hmac.New(sha256.New, n.key)
+	mac.Write(raw[:8+16])
+	if !hmac.Equal(mac.Sum(nil), raw[8+16:]) {
+		return errors.New("invalid nonce")
+	}
+
+	issued := time.Unix(int64(binary.BigEndian.Uint64(raw[:8])), 0)
+	if time.Since(issued) > n.ttl {
+		return errors.New("expired nonce")
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for usedNonce, expire := range n.used {
+		if time.Now().After(expire) {
+			delete(n.used, usedNonce)
+		}
+	}
+
+	if _, ok := n.used[nonce]; ok {
+		return errors.New("nonce already used")
+	}
+	n.used[nonce] = issued.Add(n.ttl)
+
+	return nil
+}
+
+// SetNonceKey replaces the default NonceStore by one using key, so that nonces issued by a
+// server are accepted by the other servers sharing key. It must be called before issuing nonces.
+func SetNonceKey(key []byte) error {
+	store, err := NewNonceStoreWithKey(key, NonceTTL)
+	if err != nil {
+		return err
+	}
+	defaultNonceStore = store
+
+	return nil
+}
+
+// IssueNonce returns a new nonce from the default NonceStore
+func IssueNonce() string {
+	return defaultNonceStore.Issue()
+}
+
+// ConsumeNonce consumes nonce from the default NonceStore
+func ConsumeNonce(nonce string) error {
+	return defaultNonceStore.Consume(nonce)
+}
@@ -4,15 +4,14 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/hmac"
 	"crypto/rand"
-	"crypto/sha1"
 	"encoding/base32"
-	"encoding/binary"
-	"fmt"
-	"io"
-	"math"
-	"net/url"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
 // GenerateSeed creates a random 16 byte Base32 string that serves as OTP Seed
@@ -27,56 +26,93 @@ func GenerateSeed() string {
 	return seed
 }
 
-// EncryptSeed encrypts the seed with the user's password as key
-// We use AES-128 bit encryption so we reuse the user's password
-// as much as needed. The end result is Base32 encoded and will be
-// appended to the hashed password in the configuration file
-func EncryptSeed(seed string, password []byte) string {
-	// Make a key that is 16 byte long, using as many repetitions
-	// of the password as needed
-	rep := 1 + 16/len(password)
-	key := bytes.Repeat(password, rep)
+// Encrypted OTP seeds format versions. Legacy seeds are encrypted with AES-128-CFB keyed by
+// the repeated password and base32 encoded. Version 2 seeds are "v2." followed by the base64url
+// encoding of salt, nonce and XChaCha20-Poly1305 ciphertext, keyed with argon2id.
+const (
+	seedV2Prefix  = "v2."
+	seedV2SaltLen = 16
+	seedV2Time    = 3
+	seedV2Memory  = 64 * 1024
+	seedV2Threads = 4
+)
 
-	plaintext := []byte(seed)
+// EncryptSeed encrypts the seed with a key derived from the user's password. The end result
+// will be appended to the hashed password in the configuration file
+func EncryptSeed(seed string, password []byte) (string, error) {
+	salt := make([]byte, seedV2SaltLen, seedV2SaltLen+chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
 
-	//Create a new Cipher Block from the key
-	block, err := aes.NewCipher(key[:16])
+	aead, err := chacha20poly1305.NewX(argon2.IDKey(password, salt, seedV2Time, seedV2Memory, seedV2Threads, chacha20poly1305.KeySize))
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		panic(err)
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
 	}
 
-	stream := cipher.NewCFBEncrypter(block, iv) // nolint:staticcheck
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], plaintext)
+	out := aead.Seal(append(salt, nonce...), nonce, []byte(seed), []byte(seedV2Prefix))
 
-	return base32.StdEncoding.EncodeToString(ciphertext)
+	return seedV2Prefix + base64.RawURLEncoding.EncodeToString(out), nil
 }
 
-// DecryptSeed decrypts the base32 encoded encrypted seed
-// with the user's password as key. Reversing the EncryptSeed()
-// we use AES-128 bit encryption and the key is generated by using
+// DecryptSeed decrypts an encrypted seed, in legacy or current format, with the user's
+// password. The end result is the TOTP seed
+func DecryptSeed(encryptedSeed string, password []byte) (string, error) {
+	if !strings.HasPrefix(encryptedSeed, seedV2Prefix) {
+		return decryptLegacySeed(encryptedSeed, password)
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(encryptedSeed, seedV2Prefix))
+	if err != nil || len(raw) < seedV2SaltLen+chacha20poly1305.NonceSizeX+chacha20poly1305.Overhead {
+		return "", errors.New("invalid encrypted seed")
+	}
+	salt := raw[:seedV2SaltLen]
+	nonce := raw[seedV2SaltLen : seedV2SaltLen+chacha20poly1305.NonceSizeX]
+
+	aead, err := chacha20poly1305.NewX(argon2.IDKey(password, salt, seedV2Time, seedV2Memory, seedV2Threads, chacha20poly1305.KeySize))
+	if err != nil {
+		return "", err
+	}
+
+	seed, err := aead.Open(nil, nonce, raw[seedV2SaltLen+chacha20poly1305.NonceSizeX:], []byte(seedV2Prefix))
+	if err != nil {
+		return "", errors.New("unable to decrypt seed")
+	}
+
+	return string(seed), nil
+}
+
+// IsLegacySeed returns true if encryptedSeed uses the legacy format and should be upgraded
+func IsLegacySeed(encryptedSeed string) bool {
+	return !strings.HasPrefix(encryptedSeed, seedV2Prefix)
+}
+
+// decryptLegacySeed reverses the legacy AES-128-CFB encryption with the key generated by using
 // the user's password as much as needed.
-// The end result is the TOTP seed
-func DecryptSeed(encryptedSeed string, password []byte) string {
-	// Make a key that is 16 byte long, using as many repetitions
-	// of the password as needed
+func decryptLegacySeed(encryptedSeed string, password []byte) (string, error) {
+	if len(password) == 0 {
+		return "", errors.New("empty password")
+	}
 	rep := 1 + 16/len(password)
 	key := bytes.Repeat(password, rep)
 
-	ciphertext, _ := base32.StdEncoding.DecodeString(encryptedSeed)
+	ciphertext, err := base32.StdEncoding.DecodeString(encryptedSeed)
+	if err != nil {
+		return "", errors.New("invalid encrypted seed")
+	}
 
 	block, err := aes.NewCipher(key[:16])
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	if len(ciphertext) < aes.BlockSize {
-		panic("ciphertext too short")
+		return "", errors.New("encrypted seed too short")
 	}
 	iv := ciphertext[:aes.BlockSize]
 	ciphertext = ciphertext[aes.BlockSize:]
@@ -84,47 +120,35 @@ func DecryptSeed(encryptedSeed string, password []byte) string {
 	stream := cipher.NewCFBDecrypter(block, iv) // nolint:staticcheck
 	stream.XORKeyStream(ciphertext, ciphertext)
 
-	return string(ciphertext[:])
+	return string(ciphertext), nil
+}
+
+// UpgradeSeed decrypts a legacy encrypted seed and encrypts it again in current format
+func UpgradeSeed(encryptedSeed string, password []byte) (string, error) {
+	seed, err := DecryptSeed(encryptedSeed, password)
+	if err != nil {
+		return "", err
+	}
+
+	return EncryptSeed(seed, password)
 }
 
 // ProvisionURI creates an otpauth URI commonly used by mobile phone
-// authenticator applications
+// authenticator applications, with default TOTP parameters
 func ProvisionURI(secret string) string {
-	auth := "totp/"
-	label := "SignMyKey"
-	q := make(url.Values)
-	q.Add("secret", secret)
-	q.Add("issuer", "SignMyKey")
-
-	return "otpauth://" + auth + label + "?" + q.Encode()
+	return OTPParams{Secret: secret}.URI()
 }
 
 // GenerateOTPCode calculates a code as defined in rfc6238
-// using the seed and a specific time
-// the settings are hardcoded to what is most commonly used:
+// using the seed and a specific time step with default parameters:
 // 30 seconds window (the code changes every 30 seconds)
 // generated code is 6 digits long
 // the HMAC is using SHA1
 func GenerateOTPCode(seed string, timeval int64) string {
-
-	secretBytes, err := base32.StdEncoding.DecodeString(seed)
+	code, err := OTPParams{Secret: seed}.Code(timeval)
 	if err != nil {
 		panic(err)
 	}
 
-	buf := make([]byte, 8)
-	hash := hmac.New(sha1.New, secretBytes)
-	binary.BigEndian.PutUint64(buf, uint64(timeval))
-	hash.Write(buf)
-	sum := hash.Sum(nil)
-
-	offset := sum[len(sum)-1] & 0xf
-	value := int64(((int(sum[offset]) & 0x7f) << 24) |
-		((int(sum[offset+1] & 0xff)) << 16) |
-		((int(sum[offset+2] & 0xff)) << 8) |
-		(int(sum[offset+3]) & 0xff))
-
-	mod := int32(value % int64(math.Pow10(6)))
-
-	return fmt.Sprintf(fmt.Sprintf("%%0%dd", 6), mod)
+	return code
 }
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeedEncryption(t *testing.T) {
+	seed := "JBSWY3DPEHPK3PXP"
+	// encrypted with the legacy AES-128-CFB format
+	legacy := "2HYAJEWSLXOT3PMLZK6FYIKYCM7EE5LTYW4XYFDMFZDF56TE3SIA===="
+
+	decrypted, err := DecryptSeed(legacy, []byte("otppassword"))
+	assert.NoError(t, err)
+	assert.Equal(t, seed, decrypted)
+	assert.True(t, IsLegacySeed(legacy))
+
+	encrypted, err := EncryptSeed(seed, []byte("otppassword"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, "v2."))
+	assert.False(t, IsLegacySeed(encrypted))
+	assert.NotContains(t, encrypted, ",")
+	assert.NotContains(t, encrypted, ":")
+	assert.NotContains(t, encrypted, "$")
+
+	decrypted, err = DecryptSeed(encrypted, []byte("otppassword"))
+	assert.NoError(t, err)
+	assert.Equal(t, seed, decrypted)
+
+	_, err = DecryptSeed(encrypted, []byte("badpassword"))
+	assert.EqualError(t, err, "unable to decrypt seed")
+
+	upgraded, err := UpgradeSeed(legacy, []byte("otppassword"))
+	assert.NoError(t, err)
+	assert.False(t, IsLegacySeed(upgraded))
+	decrypted, err = DecryptSeed(upgraded, []byte("otppassword"))
+	assert.NoError(t, err)
+	assert.Equal(t, seed, decrypted)
+
+	// invalid inputs return errors instead of panicking
+	_, err = DecryptSeed("AAAA", []byte("otppassword"))
+	assert.EqualError(t, err, "invalid encrypted seed")
+	_, err = DecryptSeed("AAAAAAAA", []byte("otppassword"))
+	assert.EqualError(t, err, "encrypted seed too short")
+	_, err = DecryptSeed(legacy, []byte(""))
+	assert.EqualError(t, err, "empty password")
+	_, err = DecryptSeed("v2.AAAA", []byte("otppassword"))
+	assert.EqualError(t, err, "invalid encrypted seed")
+}
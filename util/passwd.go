@@ -0,0 +1,211 @@
+package util
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrPasswordMismatch is returned by CheckPassword when password doesn't match hash
+var ErrPasswordMismatch = errors.New("bad password")
+
+// CheckPassword compares password with a bcrypt ($2a$, $2b$, $2y$), argon2id ($argon2id$) or
+// sha512-crypt ($6$) hash.
+func CheckPassword(hash string, password []byte) error {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), password)
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+		return err
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return checkArgon2id(hash, password)
+	case strings.HasPrefix(hash, "$6$"):
+		return checkSHA512Crypt(hash, password)
+	default:
+		return errors.New("unsupported password hash format")
+	}
+}
+
+// checkArgon2id compares password with an argon2id hash in PHC string format:
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>
+func checkArgon2id(hash string, password []byte) error {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return errors.New("unsupported argon2id version")
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return errors.New("invalid argon2id parameters")
+	}
+	if time == 0 || threads == 0 {
+		return errors.New("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return errors.New("invalid argon2id salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return errors.New("invalid argon2id hash")
+	}
+
+	computed := argon2.IDKey(password, salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return ErrPasswordMismatch
+	}
+
+	return nil
+}
+
+const (
+	cryptB64          = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	sha512CryptRounds = 5000
+)
+
+// checkSHA512Crypt compares password with a sha512-crypt hash as generated by glibc crypt(3):
+// $6$[rounds=<rounds>$]<salt>$<hash>
+func checkSHA512Crypt(hash string, password []byte) error {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 && len(parts) != 5 {
+		return errors.New("invalid sha512-crypt hash")
+	}
+
+	rounds := sha512CryptRounds
+	customRounds := false
+	if len(parts) == 5 {
+		if !strings.HasPrefix(parts[2], "rounds=") {
+			return errors.New("invalid sha512-crypt hash")
+		}
+		var err error
+		rounds, err = strconv.Atoi(strings.TrimPrefix(parts[2], "rounds="))
+		if err != nil {
+			return errors.New("invalid sha512-crypt rounds")
+		}
+		// same bounds as glibc
+		if rounds < 1000 {
+			rounds = 1000
+		} else if rounds > 999999999 {
+			rounds = 999999999
+		}
+		customRounds = true
+	}
+
+	salt := parts[len(parts)-2]
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+
+	computed := sha512Crypt(password, []byte(salt), rounds, customRounds)
+	if subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) != 1 {
+		return ErrPasswordMismatch
+	}
+
+	return nil
+}
+
+func sha512Crypt(password, salt []byte, rounds int, customRounds bool) string {
+	repeat := func(digest []byte, length int) []byte {
+		out := make([]byte, 0, length)
+		for len(out) < length {
+			out = append(out, digest[:min(len(digest), length-len(out))]...)
+		}
+		return out
+	}
+
+	b := sha512.New()
+	b.Write(password)
+	b.Write(salt)
+	b.Write(password)
+	digestB := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(password)
+	a.Write(salt)
+	a.Write(repeat(digestB, len(password)))
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write(digestB)
+		} else {
+			a.Write(password)
+		}
+	}
+	digestA := a.Sum(nil)
+
+	dp := sha512.New()
+	for range password {
+		dp.Write(password)
+	}
+	p := repeat(dp.Sum(nil), len(password))
+
+	ds := sha512.New()
+	for i := 0; i < 16+int(digestA[0]); i++ {
+		ds.Write(salt)
+	}
+	s := repeat(ds.Sum(nil), len(salt))
+
+	c := digestA
+	for i := 0; i < rounds; i++ {
+		h := sha512.New()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString("$6$")
+	if customRounds {
+		fmt.Fprintf(&out, "rounds=%d$", rounds)
+	}
+	out.Write(salt)
+	out.WriteString("$")
+
+	encode := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for ; n > 0; n-- {
+			out.WriteByte(cryptB64[w&0x3f])
+			w >>= 6
+		}
+	}
+	order := [][3]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4}, {47, 5, 26}, {6, 27, 48},
+		{28, 49, 7}, {50, 8, 29}, {9, 30, 51}, {31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13},
+		{56, 14, 35}, {15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19}, {62, 20, 41},
+	}
+	for _, idx := range order {
+		encode(c[idx[0]], c[idx[1]], c[idx[2]], 4)
+	}
+	encode(0, 0, c[63], 2)
+
+	return out.String()
+}
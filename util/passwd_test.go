@@ -0,0 +1,40 @@
+package util
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/argon2"
+)
+
+func TestCheckPassword(t *testing.T) {
+	salt := []byte("somesaltsomesalt")
+	argonHash := fmt.Sprintf("$argon2id$v=19$m=1024,t=1,p=1$%s$%s",
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("goodpassword"), salt, 1, 1024, 1, 32)))
+
+	cases := []struct {
+		hash     string
+		password string
+		err      error
+	}{
+		{"$2a$10$h8bTe02uZIkAa5j1NiuVVOXdUONmch.y151qyK004Hb8EF7rTRq0u", "goodpassword", nil},
+		{"$2a$10$h8bTe02uZIkAa5j1NiuVVOXdUONmch.y151qyK004Hb8EF7rTRq0u", "badpassword", ErrPasswordMismatch},
+		{argonHash, "goodpassword", nil},
+		{argonHash, "badpassword", ErrPasswordMismatch},
+		// generated with glibc crypt(3)
+		{"$6$saltsalt$4nDDCnJc5/DUO283DcOB5mhD4sYaeJBq9u9glWD/aXSCm0bxQVc/ccQBQuwSeR79CiR0y1jtYZV8fMC..hFsZ0", "goodpassword", nil},
+		{"$6$saltsalt$4nDDCnJc5/DUO283DcOB5mhD4sYaeJBq9u9glWD/aXSCm0bxQVc/ccQBQuwSeR79CiR0y1jtYZV8fMC..hFsZ0", "badpassword", ErrPasswordMismatch},
+		{"$6$rounds=1234$averyveryverylon$mnVZd3pZAlYoZLe99uh0gkIdXC0Iyy3Htt/Fjp0.ra2R0XEdmwiGcedTQDGIMUuWOn/.rK70kBa6WvDv.tkpa/", "a much longer password with more than sixty four bytes in it for the repeat path!!", nil},
+		{"$6$x$QSmr1Bx2g4O6BzKvdkgOcyU6H91X6I/XBv5pSalMhSPkwdH6Beo3F455xZJg0v//bxVK5F4OE5k1.0xuR26MK0", "", nil},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.err, CheckPassword(c.hash, []byte(c.password)), c.hash)
+	}
+
+	assert.EqualError(t, CheckPassword("$1$md5$hash", []byte("password")), "unsupported password hash format")
+	assert.EqualError(t, CheckPassword("$argon2id$v=19$m=1024$salt$hash", []byte("password")), "invalid argon2id parameters")
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"strings"
+)
+
+// DefaultRecoveryCodes is the number of recovery codes generated with an OTP seed
+const DefaultRecoveryCodes = 10
+
+// SplitHashedPassword splits a "signmykey hash" entry in its password hash, encrypted OTP seed
+// and hashed recovery codes fields: <hash>[,<encrypted seed>[,<recovery codes>]]
+func SplitHashedPassword(entry string) (hash, encryptedSeed, recoveryCodes string) {
+	// password hashes may contain commas (argon2id parameters) but not after their last $
+	i := strings.Index(entry[strings.LastIndex(entry, "$")+1:], ",")
+	if i < 0 {
+		return entry, "", ""
+	}
+	i += strings.LastIndex(entry, "$") + 1
+
+	hash = entry[:i]
+	encryptedSeed, recoveryCodes, _ = strings.Cut(entry[i+1:], ",")
+
+	return hash, encryptedSeed, recoveryCodes
+}
+
+// JoinHashedPassword is the reverse of SplitHashedPassword
+func JoinHashedPassword(hash, encryptedSeed, recoveryCodes string) string {
+	entry := hash
+	if encryptedSeed != "" {
+		entry += "," + encryptedSeed
+		if recoveryCodes != "" {
+			entry += "," + recoveryCodes
+		}
+	}
+
+	return entry
+}
+
+// GenerateRecoveryCodes returns count random recovery codes and the field storing their
+// SHA-256 hashes, separated by dots
+func GenerateRecoveryCodes(count int) (codes []string, field string, err error) {
+	hashes := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		data := make([]byte, 15)
+		if _, err := rand.Read(data); err != nil {
+			return nil, "", err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(data))
+		code := raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, strings.Join(hashes, "."), nil
+}
+
+// ConsumeRecoveryCode checks code against the hashed recovery codes field and returns the field
+// without this code if it matches
+func ConsumeRecoveryCode(field, code string) (newField string, ok bool) {
+	if field == "" {
+		return field, false
+	}
+
+	hashed := hashRecoveryCode(code)
+	hashes := strings.Split(field, ".")
+	for i, h := range hashes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hashed)) == 1 {
+			return strings.Join(append(hashes[:i:i], hashes[i+1:]...), "."), true
+		}
+	}
+
+	return field, false
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,54 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitHashedPassword(t *testing.T) {
+	cases := []struct {
+		entry    string
+		hash     string
+		seed     string
+		recovery string
+	}{
+		{"$2a$10$hash", "$2a$10$hash", "", ""},
+		{"$2a$10$hash,SEED", "$2a$10$hash", "SEED", ""},
+		{"$2a$10$hash,v2.seed,h1.h2", "$2a$10$hash", "v2.seed", "h1.h2"},
+		{"$argon2id$v=19$m=1024,t=1,p=1$salt$hash,v2.seed,h1", "$argon2id$v=19$m=1024,t=1,p=1$salt$hash", "v2.seed", "h1"},
+	}
+
+	for _, c := range cases {
+		hash, seed, recovery := SplitHashedPassword(c.entry)
+		assert.Equal(t, c.hash, hash, c.entry)
+		assert.Equal(t, c.seed, seed, c.entry)
+		assert.Equal(t, c.recovery, recovery, c.entry)
+		assert.Equal(t, c.entry, JoinHashedPassword(hash, seed, recovery))
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, field, err := GenerateRecoveryCodes(3)
+	assert.NoError(t, err)
+	assert.Len(t, codes, 3)
+	assert.Len(t, strings.Split(field, "."), 3)
+
+	_, ok := ConsumeRecoveryCode(field, "aaaa-bbbb-cccc-dddd")
+	assert.False(t, ok)
+
+	// codes are accepted without dashes and with upper case
+	field, ok = ConsumeRecoveryCode(field, strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")))
+	assert.True(t, ok)
+	assert.Len(t, strings.Split(field, "."), 2)
+
+	_, ok = ConsumeRecoveryCode(field, codes[1])
+	assert.False(t, ok)
+
+	field, ok = ConsumeRecoveryCode(field, codes[0])
+	assert.True(t, ok)
+	field, ok = ConsumeRecoveryCode(field, codes[2])
+	assert.True(t, ok)
+	assert.Equal(t, "", field)
+}
@@ -0,0 +1,153 @@
+package util
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHSIG format is described in openssh PROTOCOL.sshsig file, signatures are compatible
+// with "ssh-keygen -Y sign" and "ssh-keygen -Y verify".
+const (
+	sshsigMagic   = "SSHSIG"
+	sshsigVersion = 1
+	sshsigHash    = "sha512"
+	sshsigPEMType = "SSH SIGNATURE"
+)
+
+// SSHSIG namespaces of server nonces signed by clients
+const (
+	// LoginNamespace is used to sign login nonces with a registered SSH key
+	LoginNamespace = "login@signmykey.io"
+	// RenewNamespace is used to sign renewal nonces with the key of a still valid certificate
+	RenewNamespace = "renew@signmykey.io"
+	// KeyProofNamespace is used to prove possession of the private key to sign
+	KeyProofNamespace = "key-proof@signmykey.io"
+)
+
+type sshsigSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          string
+}
+
+type sshsigBlob struct {
+	Version       uint32
+	PublicKey     string
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     string
+}
+
+func sshsigData(namespace, hashAlgorithm string, message []byte) []byte {
+	var hash []byte
+	if hashAlgorithm == "sha256" {
+		sum := sha256.Sum256(message)
+		hash = sum[:]
+	} else {
+		sum := sha512.Sum512(message)
+		hash = sum[:]
+	}
+
+	return append([]byte(sshsigMagic), ssh.Marshal(sshsigSignedData{
+		Namespace:     namespace,
+		HashAlgorithm: hashAlgorithm,
+		Hash:          string(hash),
+	})...)
+}
+
+// SSHSign signs message with signer in given namespace and returns an armored SSHSIG signature.
+func SSHSign(signer ssh.Signer, namespace string, message []byte) ([]byte, error) {
+	if namespace == "" {
+		return nil, errors.New("empty SSHSIG namespace")
+	}
+
+	data := sshsigData(namespace, sshsigHash, message)
+
+	var sig *ssh.Signature
+	var err error
+	if signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// SHA1 based ssh-rsa signatures are not allowed by SSHSIG format
+		algoSigner, ok := signer.(ssh.AlgorithmSigner)
+		if !ok {
+			return nil, errors.New("RSA signer doesn't support rsa-sha2-512 signatures")
+		}
+		sig, err = algoSigner.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error signing SSHSIG data: %w", err)
+	}
+
+	blob := append([]byte(sshsigMagic), ssh.Marshal(sshsigBlob{
+		Version:       sshsigVersion,
+		PublicKey:     string(signer.PublicKey().Marshal()),
+		Namespace:     namespace,
+		HashAlgorithm: sshsigHash,
+		Signature:     string(ssh.Marshal(sig)),
+	})...)
+
+	return pem.EncodeToMemory(&pem.Block{Type: sshsigPEMType, Bytes: blob}), nil
+}
+
+// SSHVerify verifies an armored SSHSIG signature of message in given namespace and returns
+// the public key which made the signature. Caller must check that this key is the expected one.
+func SSHVerify(armored []byte, namespace string, message []byte) (ssh.PublicKey, error) {
+	block, _ := pem.Decode(bytes.TrimSpace(armored))
+	if block == nil || block.Type != sshsigPEMType {
+		// also accept unarmored base64 signature
+		raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(armored)))
+		if err != nil {
+			return nil, errors.New("invalid SSHSIG armor")
+		}
+		block = &pem.Block{Type: sshsigPEMType, Bytes: raw}
+	}
+
+	if !bytes.HasPrefix(block.Bytes, []byte(sshsigMagic)) {
+		return nil, errors.New("invalid SSHSIG magic preamble")
+	}
+
+	var blob sshsigBlob
+	if err := ssh.Unmarshal(block.Bytes[len(sshsigMagic):], &blob); err != nil {
+		return nil, fmt.Errorf("invalid SSHSIG blob: %w", err)
+	}
+
+	if blob.Version != sshsigVersion {
+		return nil, fmt.Errorf("unsupported SSHSIG version %d", blob.Version)
+	}
+	if blob.Namespace != namespace {
+		return nil, fmt.Errorf("SSHSIG namespace %q doesn't match expected %q", blob.Namespace, namespace)
+	}
+	if blob.HashAlgorithm != "sha512" && blob.HashAlgorithm != "sha256" {
+		return nil, fmt.Errorf("unsupported SSHSIG hash algorithm %q", blob.HashAlgorithm)
+	}
+
+	pubKey, err := ssh.ParsePublicKey([]byte(blob.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSHSIG public key: %w", err)
+	}
+
+	sig := &ssh.Signature{}
+	if err := ssh.Unmarshal([]byte(blob.Signature), sig); err != nil {
+		return nil, fmt.Errorf("invalid SSHSIG signature: %w", err)
+	}
+	if sig.Format == ssh.KeyAlgoRSA {
+		return nil, errors.New("SHA1 based ssh-rsa SSHSIG signatures are not allowed")
+	}
+
+	if err := pubKey.Verify(sshsigData(namespace, blob.HashAlgorithm, message), sig); err != nil {
+		return nil, fmt.Errorf("invalid SSHSIG signature: %w", err)
+	}
+
+	return pubKey, nil
+}
@@ -0,0 +1,66 @@
+package util
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHSig(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := SSHSign(signer, "test@signmykey.io", []byte("message"))
+	assert.NoError(t, err)
+
+	pubKey, err := SSHVerify(sig, "test@signmykey.io", []byte("message"))
+	assert.NoError(t, err)
+	assert.Equal(t, signer.PublicKey().Marshal(), pubKey.Marshal())
+
+	_, err = SSHVerify(sig, "other@signmykey.io", []byte("message"))
+	assert.EqualError(t, err, "SSHSIG namespace \"test@signmykey.io\" doesn't match expected \"other@signmykey.io\"")
+
+	_, err = SSHVerify(sig, "test@signmykey.io", []byte("other message"))
+	assert.ErrorContains(t, err, "invalid SSHSIG signature")
+
+	_, err = SSHVerify([]byte("garbage"), "test@signmykey.io", []byte("message"))
+	assert.EqualError(t, err, "invalid SSHSIG armor")
+
+	_, err = SSHSign(signer, "", []byte("message"))
+	assert.EqualError(t, err, "empty SSHSIG namespace")
+}
+
+func TestNonceStore(t *testing.T) {
+	store := NewNonceStore(time.Minute)
+
+	nonce := store.Issue()
+	assert.NoError(t, store.Consume(nonce))
+	assert.EqualError(t, store.Consume(nonce), "nonce already used")
+
+	assert.EqualError(t, NewNonceStore(time.Minute).Consume(store.Issue()), "invalid nonce")
+	assert.EqualError(t, store.Consume("garbage"), "invalid nonce")
+
+	expiredStore := NewNonceStore(-time.Second)
+	assert.EqualError(t, expiredStore.Consume(expiredStore.Issue()), "expired nonce")
+
+	// stores sharing a key accept nonces issued by each other
+	key := []byte("0123456789abcdef0123456789abcdef")
+	store, err := NewNonceStoreWithKey(key, time.Minute)
+	assert.NoError(t, err)
+	otherStore, err := NewNonceStoreWithKey(key, time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, otherStore.Consume(store.Issue()))
+
+	_, err = NewNonceStoreWithKey(key[:31], time.Minute)
+	assert.EqualError(t, err, "nonce key must be at least 32 bytes long")
+}
@@ -0,0 +1,232 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" // nolint:gosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default TOTP parameters, used for bare base32 seeds
+const (
+	DefaultOTPAlgorithm = "SHA1"
+	DefaultOTPDigits    = 6
+	DefaultOTPPeriod    = 30
+)
+
+// OTPParams represents TOTP parameters of a user as described in otpauth URIs
+type OTPParams struct {
+	Secret    string
+	Algorithm string
+	Digits    int
+	Period    int
+}
+
+// ParseOTPSeed returns TOTP parameters of a decrypted seed. Seed is either a bare base32
+// secret, using default parameters, or an otpauth://totp/ URI.
+func ParseOTPSeed(seed string) (OTPParams, error) {
+	if !strings.HasPrefix(seed, "otpauth://") {
+		params := OTPParams{Secret: seed}
+		return params, params.Validate()
+	}
+
+	u, err := url.Parse(seed)
+	if err != nil || u.Host != "totp" {
+		return OTPParams{}, errors.New("invalid otpauth URI")
+	}
+
+	q := u.Query()
+	params := OTPParams{
+		Secret:    q.Get("secret"),
+		Algorithm: strings.ToUpper(q.Get("algorithm")),
+	}
+	if digits := q.Get("digits"); digits != "" {
+		if params.Digits, err = strconv.Atoi(digits); err != nil {
+			return OTPParams{}, errors.New("invalid otpauth digits")
+		}
+	}
+	if period := q.Get("period"); period != "" {
+		if params.Period, err = strconv.Atoi(period); err != nil {
+			return OTPParams{}, errors.New("invalid otpauth period")
+		}
+	}
+
+	return params, params.Validate()
+}
+
+// Validate checks TOTP parameters, zero values stand for default parameters
+func (p OTPParams) Validate() error {
+	if _, err := p.secret(); err != nil {
+		return errors.New("invalid OTP secret")
+	}
+	if _, err := p.hash(); err != nil {
+		return err
+	}
+	if p.Digits != 0 && (p.Digits < 6 || p.Digits > 8) {
+		return errors.New("OTP digits must be between 6 and 8")
+	}
+	if p.Period < 0 {
+		return errors.New("OTP period must be positive")
+	}
+
+	return nil
+}
+
+// URI returns the otpauth URI of TOTP parameters, commonly used by mobile phone
+// authenticator applications
+func (p OTPParams) URI() string {
+	q := make(url.Values)
+	q.Add("secret", p.Secret)
+	q.Add("issuer", "SignMyKey")
+	if p.Algorithm != "" && p.Algorithm != DefaultOTPAlgorithm {
+		q.Add("algorithm", p.Algorithm)
+	}
+	if p.Digits != 0 && p.Digits != DefaultOTPDigits {
+		q.Add("digits", strconv.Itoa(p.Digits))
+	}
+	if p.Period != 0 && p.Period != DefaultOTPPeriod {
+		q.Add("period", strconv.Itoa(p.Period))
+	}
+
+	return "otpauth://totp/SignMyKey?" + q.Encode()
+}
+
+func (p OTPParams) secret() ([]byte, error) {
+	secret := strings.ToUpper(strings.TrimRight(strings.TrimSpace(p.Secret), "="))
+	if secret == "" {
+		return nil, errors.New("empty OTP secret")
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+}
+
+func (p OTPParams) hash() (func() hash.Hash, error) {
+	switch p.Algorithm {
+	case "", "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported OTP algorithm %q", p.Algorithm)
+	}
+}
+
+func (p OTPParams) digits() int {
+	if p.Digits == 0 {
+		return DefaultOTPDigits
+	}
+	return p.Digits
+}
+
+func (p OTPParams) period() int64 {
+	if p.Period == 0 {
+		return DefaultOTPPeriod
+	}
+	return int64(p.Period)
+}
+
+// Code calculates the code of time step counter as defined in rfc6238
+func (p OTPParams) Code(counter int64) (string, error) {
+	secret, err := p.secret()
+	if err != nil {
+		return "", errors.New("invalid OTP secret")
+	}
+	hashFunc, err := p.hash()
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(counter))
+	mac := hmac.New(hashFunc, secret)
+	mac.Write(buf)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < p.digits(); i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", p.digits(), value%mod), nil
+}
+
+// OTPValidator validates TOTP codes within a skew window and rejects codes of an already
+// accepted time step, so a code can't be replayed
+type OTPValidator struct {
+	// Skew is the number of time steps accepted before and after the current one
+	Skew int
+
+	mu       sync.Mutex
+	accepted map[string]otpAccepted
+}
+
+type otpAccepted struct {
+	step   int64
+	expire time.Time
+}
+
+// NewOTPValidator creates an OTPValidator accepting skew time steps around the current one
+func NewOTPValidator(skew int) *OTPValidator {
+	return &OTPValidator{
+		Skew:     skew,
+		accepted: map[string]otpAccepted{},
+	}
+}
+
+// Validate checks otp against codes of decrypted seed. key identifies the seed owner in the
+// used codes cache, usually the user name.
+func (v *OTPValidator) Validate(key, seed, otp string) error {
+	params, err := ParseOTPSeed(seed)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	current := now.Unix() / params.period()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for k, accepted := range v.accepted {
+		if now.After(accepted.expire) {
+			delete(v.accepted, k)
+		}
+	}
+
+	for step := current - int64(v.Skew); step <= current+int64(v.Skew); step++ {
+		code, err := params.Code(step)
+		if err != nil {
+			return err
+		}
+		if !hmac.Equal([]byte(code), []byte(otp)) {
+			continue
+		}
+
+		if accepted, ok := v.accepted[key]; ok && step <= accepted.step {
+			return errors.New("otp already used")
+		}
+		v.accepted[key] = otpAccepted{
+			step:   step,
+			expire: time.Unix((step+int64(v.Skew)+1)*params.period(), 0),
+		}
+
+		return nil
+	}
+
+	return errors.New("otp does not match")
+}
@@ -0,0 +1,89 @@
+package util
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOTPCode(t *testing.T) {
+	// test vectors from RFC 6238 appendix B
+	secrets := map[string]string{
+		"SHA1":   base32.StdEncoding.EncodeToString([]byte("12345678901234567890")),
+		"SHA256": base32.StdEncoding.EncodeToString([]byte("12345678901234567890123456789012")),
+		"SHA512": base32.StdEncoding.EncodeToString([]byte("1234567890123456789012345678901234567890123456789012345678901234")),
+	}
+
+	cases := []struct {
+		time      int64
+		algorithm string
+		code      string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, c := range cases {
+		params := OTPParams{Secret: secrets[c.algorithm], Algorithm: c.algorithm, Digits: 8}
+		code, err := params.Code(c.time / 30)
+		assert.NoError(t, err)
+		assert.Equal(t, c.code, code, c.algorithm)
+	}
+
+	assert.Equal(t, "287082", GenerateOTPCode(secrets["SHA1"], 1))
+}
+
+func TestParseOTPSeed(t *testing.T) {
+	params := OTPParams{Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA256", Digits: 8, Period: 60}
+	assert.Equal(t, "otpauth://totp/SignMyKey?algorithm=SHA256&digits=8&issuer=SignMyKey&period=60&secret=JBSWY3DPEHPK3PXP", params.URI())
+
+	parsed, err := ParseOTPSeed(params.URI())
+	assert.NoError(t, err)
+	assert.Equal(t, params, parsed)
+
+	parsed, err = ParseOTPSeed("JBSWY3DPEHPK3PXP")
+	assert.NoError(t, err)
+	assert.Equal(t, OTPParams{Secret: "JBSWY3DPEHPK3PXP"}, parsed)
+
+	_, err = ParseOTPSeed("otpauth://totp/SignMyKey?secret=JBSWY3DPEHPK3PXP&algorithm=MD5")
+	assert.EqualError(t, err, "unsupported OTP algorithm \"MD5\"")
+	_, err = ParseOTPSeed("otpauth://totp/SignMyKey?secret=JBSWY3DPEHPK3PXP&digits=4")
+	assert.EqualError(t, err, "OTP digits must be between 6 and 8")
+	_, err = ParseOTPSeed("otpauth://hotp/SignMyKey?secret=JBSWY3DPEHPK3PXP")
+	assert.EqualError(t, err, "invalid otpauth URI")
+	_, err = ParseOTPSeed("not base32!")
+	assert.EqualError(t, err, "invalid OTP secret")
+}
+
+func TestOTPValidator(t *testing.T) {
+	seed := "otpauth://totp/SignMyKey?secret=JBSWY3DPEHPK3PXP&period=30"
+	params, _ := ParseOTPSeed(seed)
+	step := time.Now().Unix() / 30
+	code := func(step int64) string {
+		code, err := params.Code(step)
+		assert.NoError(t, err)
+		return code
+	}
+
+	validator := NewOTPValidator(2)
+	assert.NoError(t, validator.Validate("alice", seed, code(step-1)))
+	assert.EqualError(t, validator.Validate("alice", seed, code(step-1)), "otp already used")
+	// cache is per key
+	assert.NoError(t, validator.Validate("bob", seed, code(step-1)))
+	assert.NoError(t, validator.Validate("alice", seed, code(step+1)))
+	// codes older than the last accepted one are rejected
+	assert.EqualError(t, validator.Validate("alice", seed, code(step)), "otp already used")
+	assert.EqualError(t, validator.Validate("alice", seed, code(step+4)), "otp does not match")
+
+	strict := NewOTPValidator(0)
+	assert.EqualError(t, strict.Validate("alice", seed, code(step-1)), "otp does not match")
+}